@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/history"
+)
+
+// eventAcknowledged is the history event recorded when a visit is
+// acknowledged.
+const eventAcknowledged = "acknowledged"
+
+// visit is a doorbell ring that hasn't been acknowledged yet.
+type visit struct {
+	time time.Time
+	name string
+	mac  string
+	// session is the ID of the visit session, if visit sessions are kept
+	// track of.
+	session string
+}
+
+// startVisit records that the doorbell rang for a target, replacing any
+// unacknowledged visit. It returns the recorded visit.
+func (d *doorbell) startVisit(v visit) *visit {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.visit = &v
+	d.notifyChanged()
+
+	return d.visit
+}
+
+// isCurrentVisit returns whether the visit is still unacknowledged (and
+// hasn't been replaced by a later visit).
+func (d *doorbell) isCurrentVisit(v *visit) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.visit == v
+}
+
+// Acknowledge marks the current visit as acknowledged (eg. because someone
+// let the cat in). The origin (eg. "tray" or "webhook") is logged. It
+// returns the name of the visiting target, or false if there was no visit to
+// acknowledge.
+func (d *doorbell) Acknowledge(ctx context.Context, origin string) (string, bool) {
+	d.mu.Lock()
+	v := d.visit
+	d.visit = nil
+	if v != nil {
+		d.notifyChanged()
+	}
+	d.mu.Unlock()
+
+	if v == nil {
+		return "", false
+	}
+
+	slog.Info("Acknowledged visit",
+		slog.String("name", v.name), slog.String("mac", v.mac), slog.String("origin", origin))
+
+	if v.session != "" {
+		d.acknowledgeSession(ctx, v.session)
+	}
+
+	record := history.Detection{
+		Time:  time.Now(),
+		Name:  v.name,
+		MAC:   v.mac,
+		Event: eventAcknowledged,
+	}
+	if err := d.history.Record(ctx, &record); err != nil {
+		slog.Warn("Failed to record acknowledgement", slog.Any("error", err))
+	}
+	d.publish(record)
+
+	return v.name, true
+}
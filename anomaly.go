@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/anomaly"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+// anomalyCheckInterval is how often visit patterns are relearnt from the
+// history, and targets are checked for missed visits.
+const anomalyCheckInterval = 15 * time.Minute
+
+// watchAnomalies periodically relearns the visit patterns of targets, and
+// reports targets that haven't visited for longer than usual.
+func (d *doorbell) watchAnomalies(ctx context.Context) error {
+	ticker := time.NewTicker(anomalyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		conf, _ := d.config()
+		if conf.Anomalies.Enabled {
+			now := time.Now()
+			if err := d.anomalies.Refresh(ctx, conf.Anomalies, anomalyTargets(conf), now); err != nil {
+				slog.Warn("Failed to learn visit patterns", slog.Any("error", err))
+			}
+
+			for _, m := range d.anomalies.Missing(conf.Anomalies, now) {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case d.missing <- m:
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// raiseMissing raises a low priority notification for a target that hasn't
+// visited for longer than usual.
+func (d *doorbell) raiseMissing(ctx context.Context, m anomaly.Missing) {
+	conf, _ := d.config()
+
+	var color string
+	for _, t := range conf.Targets {
+		if t.Name == m.Name {
+			color = t.Color
+		}
+	}
+
+	now := time.Now()
+	title, message := d.texts.Render(m.Name, latestconfig.EventMissing, &notifier.TextData{
+		Name:       m.Name,
+		MAC:        d.redactor.Redact(m.MAC),
+		Time:       now,
+		CountToday: d.visitsToday(ctx, m.Name, now),
+		LastVisit:  m.LastVisit.Local(),
+	})
+
+	d.raiseEvent(ctx, &notifier.Notification{
+		Event:    latestconfig.EventMissing,
+		Title:    title,
+		Message:  message,
+		Name:     m.Name,
+		Color:    color,
+		MAC:      d.redactor.Redact(m.MAC),
+		Time:     now,
+		Priority: notifier.PriorityLow,
+		Instance: d.instance(),
+	}, m.MAC)
+}
+
+// checkUnusualVisit raises a low priority notification if a visit is at an
+// hour the target rarely visits at.
+func (d *doorbell) checkUnusualVisit(ctx context.Context, n *notifier.Notification, mac string) {
+	conf, _ := d.config()
+	if !conf.Anomalies.Enabled || !d.anomalies.Unusual(conf.Anomalies, n.Name, n.Time) {
+		return
+	}
+
+	unusual := *n
+	unusual.Event = latestconfig.EventUnusualVisit
+	unusual.Title, unusual.Message = d.texts.Render(n.Name, unusual.Event, &notifier.TextData{
+		Name:       n.Name,
+		MAC:        n.MAC,
+		RSSI:       n.RSSI,
+		Time:       n.Time.Local(),
+		CountToday: d.visitsToday(ctx, n.Name, n.Time),
+	})
+	unusual.Priority = notifier.PriorityLow
+
+	d.raiseEvent(ctx, &unusual, mac)
+}
+
+// anomalyTargets returns the names of the targets watched for anomalies.
+func anomalyTargets(conf *latestconfig.Config) []string {
+	if len(conf.Anomalies.Targets) > 0 {
+		return conf.Anomalies.Targets
+	}
+
+	names := make([]string, 0, len(conf.Targets))
+	for _, t := range conf.Targets {
+		names = append(names, t.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/dpeckett/cat-doorbell/internal/web"
+)
+
+// Status returns a snapshot of the doorbell state for the REST API.
+func (d *doorbell) Status() web.Status {
+	status := d.status()
+
+	conf, _ := d.config()
+
+	s := web.Status{
+		Instance:      conf.InstanceName(),
+		Broker:        status.broker,
+		Connected:     status.connected,
+		Reconnecting:  status.reconnecting,
+		Paused:        status.paused,
+		GatewaySilent: status.gatewaySilent,
+		Maintenance:   status.maintenance,
+	}
+
+	if !status.maintenanceUntil.IsZero() {
+		s.MaintenanceUntil = &status.maintenanceUntil
+	}
+
+	if !status.expectingUntil.IsZero() {
+		s.ExpectingUntil = &status.expectingUntil
+	}
+
+	if status.brokerErr != nil {
+		s.BrokerError = status.brokerErr.Error()
+	}
+
+	for _, b := range status.brokers {
+		broker := web.BrokerStatus{Address: b.Address, Connected: b.Connected}
+		if b.Err != nil {
+			broker.Error = b.Err.Error()
+		}
+
+		s.Brokers = append(s.Brokers, broker)
+	}
+
+	if !status.pausedUntil.IsZero() {
+		s.PausedUntil = &status.pausedUntil
+	}
+
+	for _, dev := range status.devices {
+		device := web.Device{
+			Name:       dev.Name,
+			RSSI:       dev.RSSI,
+			Present:    dev.Present,
+			Battery:    dev.Battery,
+			BatteryLow: dev.BatteryLow,
+			Visiting:   dev.visiting,
+		}
+		if !dev.LastSeen.IsZero() {
+			device.LastSeen = &dev.LastSeen
+		}
+		if !dev.PresentSince.IsZero() {
+			device.Since = &dev.PresentSince
+		}
+		if !dev.CooldownUntil.IsZero() {
+			device.CooldownUntil = &dev.CooldownUntil
+		}
+
+		s.Devices = append(s.Devices, device)
+
+		if dev.Present != nil {
+			s.Presence = append(s.Presence, web.Presence{
+				Name:    dev.Name,
+				Present: *dev.Present,
+				Since:   dev.PresentSince,
+			})
+		}
+
+		if dev.Battery != nil {
+			s.Batteries = append(s.Batteries, web.Battery{
+				Name:    dev.Name,
+				Level:   *dev.Battery,
+				Low:     dev.BatteryLow,
+				Updated: dev.BatteryUpdated,
+			})
+		}
+	}
+
+	for _, o := range status.beacons {
+		s.Origins = append(s.Origins, web.Origin{Origin: o.origin, LastBeacon: o.lastBeacon})
+	}
+
+	if status.visit != nil {
+		s.Visit = &web.Visit{
+			Name: status.visit.name,
+			Time: status.visit.time,
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,109 @@
+//go:build !noaudio
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/sound"
+)
+
+func init() {
+	featureAudio.register(sound.Backend())
+
+	newPlayer = func(conf *latestconfig.Config) (player, error) {
+		p, err := sound.NewPlayer(playerOptions(conf))
+		if err != nil {
+			return nil, err
+		}
+
+		// Decode the sounds ahead of time, so the doorbell rings without
+		// delay. Sounds that fail to load are reported again when played.
+		if err := p.Preload(soundFiles(conf)...); err != nil {
+			slog.Warn("Failed to preload sounds", slog.Any("error", err))
+		}
+
+		return &soundPlayer{Player: p}, nil
+	}
+
+	audioDevices = func() ([]audioDevice, error) {
+		devices, err := sound.Devices()
+		if err != nil {
+			return nil, err
+		}
+
+		var result []audioDevice
+		for _, device := range devices {
+			result = append(result, audioDevice{Name: device.Name, Description: device.Description})
+		}
+
+		return result, nil
+	}
+}
+
+// soundPlayer plays doorbell sounds through the speaker.
+type soundPlayer struct {
+	*sound.Player
+}
+
+func (p *soundPlayer) Update(conf *latestconfig.Config) error {
+	if err := p.Player.Update(playerOptions(conf)); err != nil {
+		return err
+	}
+
+	if err := p.Preload(soundFiles(conf)...); err != nil {
+		return fmt.Errorf("failed to preload sounds: %w", err)
+	}
+
+	return nil
+}
+
+// playerOptions returns the options of the sound player.
+func playerOptions(conf *latestconfig.Config) sound.Options {
+	return sound.Options{
+		Device:       conf.Sound.Device,
+		Volume:       *conf.Sound.Volume,
+		WhilePlaying: sound.WhilePlaying(conf.Sound.WhilePlaying),
+		BufferSize:   conf.Sound.BufferSize,
+		DuckOthers:   conf.Sound.DuckOthers,
+		Schedule:     conf.Sound.Schedule,
+	}
+}
+
+// soundFiles returns the paths of the sounds the targets ring the doorbell
+// with (an empty path being the embedded doorbell sound), and those the
+// schedule plays instead.
+func soundFiles(conf *latestconfig.Config) []string {
+	var files []string
+	for _, t := range conf.Targets {
+		files = append(files, t.Sound.File, t.Sound.ButtonFile)
+	}
+
+	for _, s := range conf.Sound.Schedule {
+		if s.File != "" {
+			files = append(files, s.File)
+		}
+	}
+
+	return files
+}
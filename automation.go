@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/automation"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/source/mqtt"
+)
+
+// automationPublishTimeout is how long publishing the state may take.
+const automationPublishTimeout = 10 * time.Second
+
+// watchAutomation publishes the state for automations, restarting whenever
+// the configuration changes.
+func (d *doorbell) watchAutomation(ctx context.Context) error {
+	for {
+		conf, changed := d.config()
+		if conf.Automation == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+				continue
+			}
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			d.runAutomation(runCtx, conf)
+		}()
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		}
+
+		cancel()
+		<-done
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// runAutomation publishes the state on the configured interval, and whenever
+// an event is raised, until the context is cancelled.
+func (d *doorbell) runAutomation(ctx context.Context, conf *latestconfig.Config) {
+	events, unsubscribe := d.Subscribe()
+	defer unsubscribe()
+
+	var client *mqtt.Client
+	var temperature atomic.Pointer[automation.Temperature]
+	if conf.Automation.Topic != "" || conf.Automation.TemperatureTopic != "" {
+		client = mqtt.NewClient(conf.Broker, "automation")
+
+		if topic := conf.Automation.TemperatureTopic; topic != "" {
+			client.Subscribe(topic, func(payload []byte) {
+				v, err := automation.ParseTemperature(payload, conf.Automation.TemperatureField)
+				if err != nil {
+					slog.Warn("Failed to read temperature", slog.String("topic", topic), slog.Any("error", err))
+					return
+				}
+
+				temperature.Store(&automation.Temperature{Value: v, Time: time.Now()})
+			})
+		}
+
+		go func() {
+			if err := client.Run(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to connect to MQTT broker for automations", slog.Any("error", err))
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(conf.Automation.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.publishAutomation(ctx, conf, client, temperature.Load(), automation.TriggerInterval, "")
+		case event := <-events:
+			// Every beacon from a target is recorded, but only those that
+			// ring the doorbell are worth publishing.
+			if event.Event == string(latestconfig.EventDetected) && !event.Notified {
+				continue
+			}
+
+			d.publishAutomation(ctx, conf, client, temperature.Load(), event.Event, event.Name)
+		}
+	}
+}
+
+// publishAutomation publishes the current state to the configured topic and
+// webhook.
+func (d *doorbell) publishAutomation(ctx context.Context, conf *latestconfig.Config, client *mqtt.Client,
+	temperature *automation.Temperature, trigger, name string) {
+	ctx, cancel := context.WithTimeout(ctx, automationPublishTimeout)
+	defer cancel()
+
+	state := d.automationState(ctx, conf, time.Now())
+	state.Trigger = trigger
+	state.Name = name
+	state.Temperature = temperature
+
+	payload, err := json.Marshal(state)
+	if err != nil {
+		slog.Warn("Failed to encode automation state", slog.Any("error", err))
+		return
+	}
+
+	if conf.Automation.Topic != "" {
+		if err := client.Publish(ctx, conf.Automation.Topic, payload); err != nil {
+			slog.Warn("Failed to publish automation state", slog.Any("error", err))
+		}
+	}
+
+	if conf.Automation.WebhookURL != "" {
+		if err := automation.Post(ctx, conf.Automation.WebhookURL, payload); err != nil {
+			slog.Warn("Failed to post automation state", slog.Any("error", err))
+		}
+	}
+}
+
+// automationState returns the presence and recent visits of each target.
+func (d *doorbell) automationState(ctx context.Context, conf *latestconfig.Config, now time.Time) *automation.State {
+	state := &automation.State{Time: now, Instance: conf.InstanceName()}
+
+	present := make(map[string]bool)
+	for _, dev := range d.status().devices {
+		if dev.Present != nil {
+			present[dev.Name] = *dev.Present
+		}
+	}
+
+	visitEvents := []string{string(latestconfig.EventDetected), string(latestconfig.EventButtonPressed)}
+	recent, err := d.history.List(ctx, history.Query{
+		Since:        now.Add(-time.Hour),
+		NotifiedOnly: true,
+		Events:       visitEvents,
+	})
+	if err != nil {
+		slog.Warn("Failed to count recent visits", slog.Any("error", err))
+	}
+	state.VisitsLastHour = len(recent)
+
+	state.Targets = make([]automation.Target, 0, len(conf.Targets))
+	for _, t := range conf.Targets {
+		target := automation.Target{Name: t.Name}
+
+		if p, ok := present[t.Name]; ok {
+			target.Present = &p
+			state.Present = state.Present || p
+		}
+
+		for _, r := range recent {
+			if r.Name == t.Name {
+				target.VisitsLastHour++
+			}
+		}
+
+		last, err := d.history.List(ctx, history.Query{Name: t.Name, Events: visitEvents, Limit: 1})
+		if err != nil {
+			slog.Warn("Failed to find last detection", slog.String("name", t.Name), slog.Any("error", err))
+		} else if len(last) > 0 {
+			target.LastSeen = &last[0].Time
+		}
+
+		state.Targets = append(state.Targets, target)
+	}
+
+	return state
+}
@@ -0,0 +1,537 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/source/mqtt"
+	"github.com/dpeckett/cat-doorbell/internal/source/simulate"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// benchConnectTimeout is how long a benchmark through the broker waits for
+// the broker connection before giving up.
+const benchConnectTimeout = 30 * time.Second
+
+func benchCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "bench",
+		Usage: "Measure the throughput and latency of beacon handling with synthetic load",
+		Description: "Beacons from synthetic devices are fed through the beacon queue, detection and event handling,\n" +
+			"either directly or through the configured broker (with --broker), and the throughput, latency\n" +
+			"percentiles and dropped beacons are reported. The configured limits are used, notifications are\n" +
+			"paused and detections are recorded in a temporary history, so it can run alongside the doorbell.",
+		Flags: []cli.Flag{
+			&cli.IntFlag{
+				Name:  "devices",
+				Usage: "Number of synthetic devices, which take turns sending beacons",
+				Value: 10,
+			},
+			&cli.StringFlag{
+				Name:  "rate",
+				Usage: "Beacons sent per second (eg. 200/s, or 600/m)",
+				Value: "100/s",
+			},
+			&cli.DurationFlag{
+				Name:  "duration",
+				Usage: "How long to send beacons for",
+				Value: 10 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "detection-timeout",
+				Usage: "Detection timeout of the synthetic devices (0s makes every beacon a detection)",
+				Value: time.Minute,
+			},
+			&cli.BoolFlag{
+				Name:  "broker",
+				Usage: "Send the beacons through the configured broker, rather than directly",
+			},
+			&cli.DurationFlag{
+				Name:  "wait",
+				Usage: "How long to wait for the last beacons to be handled once they have all been sent",
+				Value: 5 * time.Second,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output the results as JSON",
+			},
+		},
+		Action: runBench,
+	}
+}
+
+// benchResult is the outcome of a benchmark.
+type benchResult struct {
+	Devices int     `json:"devices"`
+	Rate    float64 `json:"rate"`
+	// Sent is the number of beacons sent, and SentRate how many were sent
+	// per second, which is below Rate if sending couldn't keep up.
+	Sent     int     `json:"sent"`
+	SentRate float64 `json:"sentRate"`
+	// Handled is the number of beacons handled, and Throughput how many
+	// were handled per second.
+	Handled    int     `json:"handled"`
+	Throughput float64 `json:"throughput"`
+	// Dropped is the number of beacons dropped because the beacon queue was
+	// full, and Lost the number that were neither handled nor dropped (eg.
+	// lost by the broker, or still queued).
+	Dropped int `json:"dropped"`
+	Lost    int `json:"lost"`
+	// LatencyMS holds percentiles of the time from sending a beacon to it
+	// having been handled, in milliseconds.
+	LatencyMS  benchLatency `json:"latencyMs"`
+	Detections int          `json:"detections"`
+}
+
+type benchLatency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+func runBench(c *cli.Context) error {
+	conf, err := readConfig(c)
+	if err != nil {
+		return err
+	}
+
+	devices := c.Int("devices")
+	if devices < 1 || devices > 1<<16 {
+		return errors.New("devices must be between 1 and 65536")
+	}
+
+	rate, err := parseRate(c.String("rate"))
+	if err != nil {
+		return err
+	}
+
+	if c.Duration("duration") <= 0 {
+		return errors.New("duration must be positive")
+	}
+
+	viaBroker := c.Bool("broker")
+	if viaBroker && conf.Broker.Address == "" {
+		return errors.New("no broker configured")
+	}
+
+	topic := fmt.Sprintf("cat-doorbell/bench/%d", os.Getpid())
+	bench, err := benchConfig(conf, devices, c.Duration("detection-timeout"), viaBroker, topic)
+	if err != nil {
+		return err
+	}
+
+	tracker := newBenchTracker()
+	load := simulate.NewLoad(devices, rate, c.Duration("duration"), tracker.sent)
+
+	opts := runOptions{
+		headless:  true,
+		onHandled: tracker.handled,
+		onDropped: tracker.dropped,
+	}
+
+	var beacons chan source.Beacon
+	var src *benchSource
+	if viaBroker {
+		beacons = make(chan source.Beacon)
+	} else {
+		src = &benchSource{load: load, tracker: tracker, wait: c.Duration("wait")}
+		opts.source = src
+	}
+
+	d, cleanup, err := openSimulation(bench, opts)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if src != nil {
+		src.d = d
+	}
+
+	// Notifications are paused, so detections are recorded without ringing
+	// the doorbell or notifying anyone.
+	d.pauseUntil(time.Time{})
+
+	ctx, stop := signal.NotifyContext(c.Context, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return d.run(ctx)
+	})
+
+	if viaBroker {
+		// The publisher has a client ID of its own, so the broker doesn't
+		// disconnect the doorbell's connection in favour of it.
+		publisherConf := bench.Broker
+		publisherConf.ClientID = fmt.Sprintf("cat-doorbell-bench-%d", os.Getpid())
+
+		g.Go(func() error {
+			return mqtt.NewPublisher(publisherConf, topic).Run(ctx, beacons)
+		})
+
+		g.Go(func() error {
+			defer cancel()
+
+			if err := waitConnected(ctx, d); err != nil {
+				return err
+			}
+
+			if err := load.Run(ctx, beacons); err != nil {
+				return err
+			}
+
+			settleBench(ctx, tracker, d, c.Duration("wait"))
+
+			return nil
+		})
+	}
+
+	err = g.Wait()
+	if err != nil && !errors.Is(err, errSourceFinished) && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	if err := c.Context.Err(); err != nil {
+		return err
+	}
+
+	result := tracker.result(devices, rate)
+
+	// The history was recorded by the workers, which have finished.
+	if err := d.history.Each(c.Context, history.Query{}, func(history.Detection) error {
+		result.Detections++
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to count detections: %w", err)
+	}
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Devices:\t%d\n", result.Devices)
+	fmt.Fprintf(w, "Sent:\t%d (%.1f/s of %.1f/s)\n", result.Sent, result.SentRate, result.Rate)
+	fmt.Fprintf(w, "Handled:\t%d (%.1f/s)\n", result.Handled, result.Throughput)
+	fmt.Fprintf(w, "Dropped:\t%d\n", result.Dropped)
+	fmt.Fprintf(w, "Lost:\t%d\n", result.Lost)
+	fmt.Fprintf(w, "Latency:\tp50 %s, p90 %s, p99 %s, max %s\n",
+		formatBenchLatency(result.LatencyMS.P50), formatBenchLatency(result.LatencyMS.P90),
+		formatBenchLatency(result.LatencyMS.P99), formatBenchLatency(result.LatencyMS.Max))
+	fmt.Fprintf(w, "Detections:\t%d\n", result.Detections)
+
+	return w.Flush()
+}
+
+// benchConfig returns the configuration of a benchmark, with a target for
+// each synthetic device and the configured limits. Beacons sent through the
+// broker are published to their own topic, so the running doorbell doesn't
+// receive them.
+func benchConfig(conf *latestconfig.Config, devices int, detectionTimeout time.Duration, viaBroker bool, topic string) (*latestconfig.Config, error) {
+	bench := &latestconfig.Config{
+		TypeMeta:         conf.TypeMeta,
+		DetectionTimeout: detectionTimeout,
+		Limits:           conf.Limits,
+	}
+
+	for i := range devices {
+		bench.Targets = append(bench.Targets, latestconfig.TargetConfig{
+			Name: fmt.Sprintf("Device %d", i+1),
+			MAC:  simulate.LoadMAC(i),
+		})
+	}
+
+	if viaBroker {
+		cleanSession := true
+
+		bench.Broker = conf.Broker
+		bench.Broker.Topics = []latestconfig.TopicConfig{{
+			Topic:         topic,
+			PayloadFormat: latestconfig.PayloadFormatJSON,
+			Encrypted:     conf.Broker.EncryptionKey != "",
+		}}
+		bench.Broker.Fallbacks = nil
+		bench.Broker.AcknowledgeButton = nil
+		bench.Broker.ClientID = ""
+		bench.Broker.CleanSession = &cleanSession
+	}
+
+	bench.PopulateDefaults()
+	if err := bench.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid benchmark configuration: %w", err)
+	}
+
+	return bench, nil
+}
+
+// parseRate parses a rate of the form "200/s" (or "600/m"), or a plain
+// number of beacons per second, into beacons per second.
+func parseRate(s string) (float64, error) {
+	count, unit, found := strings.Cut(s, "/")
+
+	per := time.Second
+	if found {
+		var err error
+		if per, err = time.ParseDuration("1" + unit); err != nil {
+			return 0, fmt.Errorf("invalid rate %q: expected eg. 200/s", s)
+		}
+	}
+
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid rate %q: expected eg. 200/s", s)
+	}
+
+	return n / per.Seconds(), nil
+}
+
+// waitConnected waits for the doorbell to connect to the broker, so that
+// beacons published by the benchmark aren't lost before it has subscribed.
+func waitConnected(ctx context.Context, d *doorbell) error {
+	ctx, cancel := context.WithTimeout(ctx, benchConnectTimeout)
+	defer cancel()
+
+	for !d.status().connected {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errors.New("failed to connect to the broker")
+			}
+
+			return ctx.Err()
+		case <-d.changed:
+		}
+	}
+
+	return nil
+}
+
+func formatBenchLatency(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Microsecond).String()
+}
+
+// settleBench waits, for up to the given time each, for the beacons that
+// have been sent to be handled (or dropped), and then for the detections to
+// be handled.
+func settleBench(ctx context.Context, tracker *benchTracker, d *doorbell, wait time.Duration) {
+	beaconsCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	tracker.settle(beaconsCtx)
+
+	workersCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	if err := d.workers.Wait(workersCtx); err != nil {
+		slog.Warn("Detections are still being handled", slog.Any("error", err))
+	}
+}
+
+// benchSource sends the beacons of a load directly to the doorbell, and
+// returns once they have been handled.
+type benchSource struct {
+	load    *simulate.Load
+	tracker *benchTracker
+	// d is the doorbell the beacons are sent to.
+	d    *doorbell
+	wait time.Duration
+}
+
+func (s *benchSource) Run(ctx context.Context, beacons chan<- source.Beacon) error {
+	if err := s.load.Run(ctx, beacons); err != nil {
+		return err
+	}
+
+	settleBench(ctx, s.tracker, s.d, s.wait)
+
+	return nil
+}
+
+// benchTracker measures how long each beacon of a load takes to be handled.
+type benchTracker struct {
+	mu sync.Mutex
+	// pending holds when each beacon that hasn't been handled or dropped
+	// yet was sent, by sequence number.
+	pending   map[int]time.Time
+	latencies []time.Duration
+	sentCount int
+	dropCount int
+	// firstSent, lastSent and lastHandled bound the periods beacons were
+	// sent and handled in.
+	firstSent, lastSent, lastHandled time.Time
+	// idle is signalled whenever the last pending beacon is handled or
+	// dropped.
+	idle chan struct{}
+}
+
+func newBenchTracker() *benchTracker {
+	return &benchTracker{
+		pending: make(map[int]time.Time),
+		idle:    make(chan struct{}, 1),
+	}
+}
+
+func (t *benchTracker) sent(b source.Beacon) {
+	seq, ok := simulate.Sequence(b)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.sentCount == 0 {
+		t.firstSent = now
+	}
+	t.lastSent = now
+	t.sentCount++
+	t.pending[seq] = now
+}
+
+func (t *benchTracker) handled(b source.Beacon) {
+	t.done(b, func(sent, now time.Time) {
+		t.latencies = append(t.latencies, now.Sub(sent))
+		t.lastHandled = now
+	})
+}
+
+func (t *benchTracker) dropped(b source.Beacon) {
+	t.done(b, func(_, _ time.Time) {
+		t.dropCount++
+	})
+}
+
+// done records that a beacon has been handled or dropped.
+func (t *benchTracker) done(b source.Beacon, record func(sent, now time.Time)) {
+	seq, ok := simulate.Sequence(b)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sent, ok := t.pending[seq]
+	if !ok {
+		return
+	}
+	delete(t.pending, seq)
+
+	record(sent, now)
+
+	if len(t.pending) == 0 {
+		select {
+		case t.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// settle waits for the beacons that have been sent to be handled or
+// dropped, or for the context to be cancelled.
+func (t *benchTracker) settle(ctx context.Context) {
+	for {
+		t.mu.Lock()
+		pending := len(t.pending)
+		t.mu.Unlock()
+
+		if pending == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.idle:
+		}
+	}
+}
+
+// result summarizes the beacons sent so far.
+func (t *benchTracker) result(devices int, rate float64) benchResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := benchResult{
+		Devices: devices,
+		Rate:    rate,
+		Sent:    t.sentCount,
+		Handled: len(t.latencies),
+		Dropped: t.dropCount,
+		Lost:    len(t.pending),
+	}
+
+	// Rates are measured over the intervals between beacons.
+	if result.Sent > 1 {
+		result.SentRate = float64(result.Sent-1) / t.lastSent.Sub(t.firstSent).Seconds()
+	}
+	if result.Handled > 1 {
+		result.Throughput = float64(result.Handled-1) / t.lastHandled.Sub(t.firstSent).Seconds()
+	}
+
+	if len(t.latencies) > 0 {
+		latencies := slices.Clone(t.latencies)
+		slices.Sort(latencies)
+
+		percentile := func(p float64) float64 {
+			i := int(math.Ceil(p*float64(len(latencies)))) - 1
+			return float64(latencies[max(i, 0)]) / float64(time.Millisecond)
+		}
+
+		result.LatencyMS = benchLatency{
+			P50: percentile(0.5),
+			P90: percentile(0.9),
+			P99: percentile(0.99),
+			Max: percentile(1),
+		}
+	}
+
+	return result
+}
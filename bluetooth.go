@@ -0,0 +1,41 @@
+//go:build !noble
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/source/ble"
+)
+
+func init() {
+	featureBluetooth.register(ble.Backend())
+
+	newScanner = func(serviceUUIDs, buttonMACs []string) (source.Source, error) {
+		scanner, err := ble.New(serviceUUIDs, buttonMACs)
+		if err != nil {
+			return nil, err
+		}
+
+		return scanner, nil
+	}
+
+	checkAdapter = ble.CheckAdapter
+}
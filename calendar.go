@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/calendar"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+const (
+	// calendarCheckInterval is how often the calendar is checked for events
+	// that have started.
+	calendarCheckInterval = time.Minute
+	// calendarFetchTimeout is how long to wait for the calendar to download.
+	calendarFetchTimeout = 30 * time.Second
+)
+
+// calendarPause is the pause applied for a calendar event.
+type calendarPause struct {
+	// event identifies the occurrence of the calendar event.
+	event string
+	// until is when the pause ends.
+	until time.Time
+}
+
+// watchCalendar pauses notifications while a matching calendar event is in
+// progress. Notifications can be resumed during the event, which doesn't pause
+// them again.
+func (d *doorbell) watchCalendar(ctx context.Context) error {
+	var cal *calendar.Calendar
+	var applied calendarPause
+
+	for {
+		conf, changed := d.config()
+		if conf.Calendar == nil {
+			if applied.event != "" {
+				d.resumePausedUntil(applied.until)
+				applied = calendarPause{}
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+				continue
+			}
+		}
+
+		if fetched, err := fetchCalendar(ctx, conf.Calendar); err != nil {
+			slog.Warn("Failed to fetch calendar", slog.Any("error", err))
+		} else {
+			cal = fetched
+		}
+
+		refresh := time.NewTimer(conf.Calendar.RefreshInterval)
+		check := time.NewTicker(calendarCheckInterval)
+
+	checks:
+		for {
+			if cal != nil {
+				applied = d.applyCalendar(cal, conf.Calendar, applied, time.Now())
+			}
+
+			select {
+			case <-ctx.Done():
+				refresh.Stop()
+				check.Stop()
+				return ctx.Err()
+			case <-changed:
+				break checks
+			case <-refresh.C:
+				break checks
+			case <-check.C:
+			case <-d.clockJumps():
+				// Events may have started or ended.
+			}
+		}
+
+		refresh.Stop()
+		check.Stop()
+	}
+}
+
+// fetchCalendar downloads the calendar.
+func fetchCalendar(ctx context.Context, conf *latestconfig.CalendarConfig) (*calendar.Calendar, error) {
+	ctx, cancel := context.WithTimeout(ctx, calendarFetchTimeout)
+	defer cancel()
+
+	return calendar.Fetch(ctx, conf)
+}
+
+// applyCalendar pauses notifications for a matching event in progress, that
+// they haven't already been paused for, and resumes them if the event they
+// were paused for has since been removed. It returns the pause now applied.
+func (d *doorbell) applyCalendar(cal *calendar.Calendar, conf *latestconfig.CalendarConfig, applied calendarPause, now time.Time) calendarPause {
+	// Of overlapping events, the one that ends last pauses notifications.
+	var current *calendar.Event
+	for _, e := range cal.Ongoing(now) {
+		if matchesCalendar(conf, e.Summary) && (current == nil || e.End.After(current.End)) {
+			current = &e
+		}
+	}
+
+	if current == nil {
+		if applied.event != "" && applied.until.After(now) {
+			slog.Info("Calendar event was removed, resuming notifications")
+			d.resumePausedUntil(applied.until)
+		}
+
+		return calendarPause{}
+	}
+
+	key := current.UID + "/" + current.Start.String() + "/" + current.End.String()
+	if key == applied.event {
+		return applied
+	}
+
+	slog.Info("Pausing notifications for calendar event",
+		slog.String("summary", current.Summary), slog.Time("until", current.End))
+	d.pauseUntil(current.End)
+
+	return calendarPause{event: key, until: current.End}
+}
+
+// matchesCalendar returns whether a calendar event's summary pauses
+// notifications.
+func matchesCalendar(conf *latestconfig.CalendarConfig, summary string) bool {
+	if len(conf.Summaries) == 0 {
+		return true
+	}
+
+	for _, s := range conf.Summaries {
+		if strings.Contains(strings.ToLower(summary), strings.ToLower(s)) {
+			return true
+		}
+	}
+
+	return false
+}
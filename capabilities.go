@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/secret"
+	"github.com/urfave/cli/v2"
+)
+
+// capability describes whether a subsystem is built into the binary, and
+// whether it works on this host.
+type capability struct {
+	Name string `json:"name"`
+	// Compiled is whether the subsystem is built into the binary.
+	Compiled bool `json:"compiled"`
+	// Tag is the build tag that leaves the subsystem out, if it's optional.
+	Tag string `json:"tag,omitempty"`
+	// Backend is the implementation the subsystem uses, or "none" if it
+	// wasn't built in.
+	Backend string `json:"backend"`
+	// Functional is whether the subsystem works on this host.
+	Functional bool `json:"functional"`
+	// Error is why the subsystem doesn't work on this host.
+	Error string `json:"error,omitempty"`
+}
+
+// capabilityReport is the machine-readable result of the capabilities
+// command.
+type capabilityReport struct {
+	Version      string       `json:"version"`
+	Platform     string       `json:"platform"`
+	Capabilities []capability `json:"capabilities"`
+}
+
+// errNoTTS is reported for text-to-speech, which the doorbell doesn't
+// support on any platform (it plays sound files instead).
+var errNoTTS = errors.New("text-to-speech is not supported, doorbell sounds are played from sound files")
+
+// getCapabilities checks which subsystems are built into the binary and
+// work on this host. Unlike the self-test, it doesn't need a configuration.
+func getCapabilities() capabilityReport {
+	info := getBuildInfo()
+	report := capabilityReport{
+		Version:  info.Version,
+		Platform: info.Platform,
+	}
+
+	// probe reports an optional feature, checking it works on this host if
+	// it's built in.
+	probe := func(name string, f *feature, check func() error) {
+		c := capability{
+			Name:     name,
+			Compiled: f.enabled(),
+			Tag:      f.tag,
+			Backend:  orNone(f.backend),
+		}
+
+		err := f.check()
+		if err == nil {
+			err = check()
+		}
+
+		c.Functional = err == nil
+		if err != nil {
+			c.Error = err.Error()
+		}
+
+		report.Capabilities = append(report.Capabilities, c)
+	}
+
+	probe("audio", featureAudio, func() error {
+		conf := &latestconfig.Config{}
+		conf.PopulateDefaults()
+
+		player, err := newPlayer(conf)
+		if err != nil {
+			return err
+		}
+		player.Close()
+
+		return nil
+	})
+
+	probe("bluetooth", featureBluetooth, func() error {
+		return checkAdapter()
+	})
+
+	probe("tray", featureGUI, func() error {
+		if !hasDisplay() {
+			return errors.New("no display is available (neither DISPLAY nor WAYLAND_DISPLAY is set)")
+		}
+
+		return nil
+	})
+
+	probe("web", featureWeb, func() error {
+		return nil
+	})
+
+	report.Capabilities = append(report.Capabilities, capability{
+		Name:    "tts",
+		Backend: orNone(""),
+		Error:   errNoTTS.Error(),
+	})
+
+	// The keyring is always built in, but needs a secret service (eg. GNOME
+	// Keyring) on Linux.
+	keyring := capability{
+		Name:       "keyring",
+		Compiled:   true,
+		Backend:    secret.Backend(),
+		Functional: true,
+	}
+
+	if err := secret.Available(); err != nil {
+		keyring.Functional = false
+		keyring.Error = err.Error()
+	}
+
+	report.Capabilities = append(report.Capabilities, keyring)
+
+	return report
+}
+
+func capabilitiesCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "capabilities",
+		Usage: "Print which subsystems are built in and work on this host as JSON",
+		Action: func(c *cli.Context) error {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(getCapabilities())
+		},
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// clockCheckInterval is how often the system clock is checked for jumps.
+	clockCheckInterval = 10 * time.Second
+	// clockJumpThreshold is how far the wall clock must move, beyond the
+	// time that elapsed, to count as a jump.
+	clockJumpThreshold = 5 * time.Second
+)
+
+// watchClock detects jumps of the system clock (eg. NTP setting it after
+// boot, or resuming from suspend), and changes of the local UTC offset (eg.
+// daylight saving time starting), so that schedules for a time of day are
+// re-evaluated. Timeouts measured from when something happened (eg. cooldowns
+// and absence timeouts) use the monotonic clock, which doesn't jump.
+func (d *doorbell) watchClock(ctx context.Context) error {
+	ticker := time.NewTicker(clockCheckInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if clockChanged(last, now, now.Sub(last)) {
+			d.clockJumped()
+		}
+		last = now
+	}
+}
+
+// clockChanged returns whether schedules for a time of day must be
+// re-evaluated between two readings of the clock, given the time that
+// elapsed between them, because the clock jumped or the local UTC offset
+// changed.
+func clockChanged(last, now time.Time, elapsed time.Duration) bool {
+	_, lastOffset := last.Zone()
+	_, offset := now.Zone()
+
+	switch jump := clockJump(last, now, elapsed); {
+	case jump.Abs() >= clockJumpThreshold:
+		slog.Warn("System clock jumped, re-evaluating schedules", slog.Duration("jump", jump))
+	case offset != lastOffset:
+		slog.Info("Local time offset changed, re-evaluating schedules",
+			slog.Duration("offset", time.Duration(offset)*time.Second))
+	default:
+		return false
+	}
+
+	return true
+}
+
+// clockJump returns how far the wall clock moved between two readings,
+// beyond the time that elapsed between them (as measured by the monotonic
+// clock).
+func clockJump(from, to time.Time, elapsed time.Duration) time.Duration {
+	return to.Round(0).Sub(from.Round(0)) - elapsed
+}
+
+// clockJumps returns a channel that is closed when the system clock jumps,
+// or the local UTC offset changes.
+func (d *doorbell) clockJumps() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.clockChanged
+}
+
+// clockJumped wakes up the schedules waiting on clockJumps, and restarts the
+// timer ending a pause, which may be until a time of day (eg. the end of a
+// calendar event).
+func (d *doorbell) clockJumped() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	close(d.clockChanged)
+	d.clockChanged = make(chan struct{})
+
+	if d.resumeTimer != nil {
+		d.resumeTimer.Reset(time.Until(d.pausedUntil))
+	}
+
+	d.notifyChanged()
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockJump(t *testing.T) {
+	// Readings of time.Now carry a monotonic clock reading, which must not
+	// be used to work out how far the wall clock moved.
+	monotonic := time.Now()
+	wall := monotonic.Round(0)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		elapsed  time.Duration
+		want     time.Duration
+	}{
+		{"monotonic, no jump", monotonic, monotonic.Add(10 * time.Second), 10 * time.Second, 0},
+		{"monotonic, forward", monotonic, monotonic.Add(time.Hour), 10 * time.Second, time.Hour - 10*time.Second},
+		{"monotonic, backward", monotonic, monotonic.Add(-time.Minute), 10 * time.Second, -time.Minute - 10*time.Second},
+		{"wall, no jump", wall, wall.Add(10 * time.Second), 10 * time.Second, 0},
+		{"wall, forward", wall, wall.Add(time.Hour), 10 * time.Second, time.Hour - 10*time.Second},
+		{"wall, backward", wall, wall.Add(-time.Minute), 10 * time.Second, -time.Minute - 10*time.Second},
+		{"mixed, forward", monotonic, wall.Add(time.Hour), 10 * time.Second, time.Hour - 10*time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clockJump(tt.from, tt.to, tt.elapsed); got != tt.want {
+				t.Errorf("clockJump() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClockChanged(t *testing.T) {
+	utc := time.Date(2024, 3, 31, 0, 59, 55, 0, time.UTC)
+	// Daylight saving time starting, where the local time goes forward an
+	// hour but the clock doesn't jump.
+	summer := time.FixedZone("BST", 60*60)
+
+	tests := []struct {
+		name      string
+		last, now time.Time
+		elapsed   time.Duration
+		want      bool
+	}{
+		{"ticking", utc, utc.Add(10 * time.Second), 10 * time.Second, false},
+		{"drift", utc, utc.Add(14 * time.Second), 10 * time.Second, false},
+		{"jumped forward", utc, utc.Add(15 * time.Second), 10 * time.Second, true},
+		{"jumped back", utc, utc.Add(5 * time.Second), 10 * time.Second, true},
+		{"resumed from suspend", utc, utc.Add(8 * time.Hour), 10 * time.Second, true},
+		{"offset changed", utc, utc.Add(10 * time.Second).In(summer), 10 * time.Second, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clockChanged(tt.last, tt.now, tt.elapsed); got != tt.want {
+				t.Errorf("clockChanged() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRaiseLate(t *testing.T) {
+	due := time.Date(2024, 5, 1, 21, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"not due yet", due.Add(-time.Minute), false},
+		{"due", due, true},
+		{"jumped past", due.Add(3 * time.Hour), true},
+		{"a whole period later", due.Add(24 * time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := raiseLate(tt.now, due, 24*time.Hour); got != tt.want {
+				t.Errorf("raiseLate() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExpirePauseRearms checks that a pause timer firing before the pause
+// ends (eg. because the clock went back) is restarted, rather than resuming
+// notifications early.
+func TestExpirePauseRearms(t *testing.T) {
+	d := &doorbell{}
+	d.pauseUntil(time.Now().Add(50 * time.Millisecond))
+
+	// The clock going back moves the end of the pause further away than
+	// the running timer.
+	d.mu.Lock()
+	d.pausedUntil = time.Now().Add(300 * time.Millisecond)
+	d.mu.Unlock()
+
+	time.Sleep(150 * time.Millisecond)
+	if !d.isPaused() {
+		t.Fatal("notifications resumed before the end of the pause")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.isPaused() {
+		if time.Now().After(deadline) {
+			t.Fatal("notifications weren't resumed at the end of the pause")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,350 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/config"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+	"github.com/urfave/cli/v2"
+)
+
+func configCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "Create and inspect the configuration file",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "init",
+				Usage: "Write a starter configuration file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "broker",
+						Usage: "Address of the MQTT broker (eg. tcp://localhost:1883)",
+					},
+					&cli.StringFlag{
+						Name:  "mac",
+						Usage: "MAC address of the cat's tag",
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Name of the cat",
+					},
+					&cli.BoolFlag{
+						Name:  "scan",
+						Usage: "Scan for devices using the host's Bluetooth adapter",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Overwrite an existing configuration file",
+					},
+				},
+				Action: initConfig,
+			},
+			{
+				Name:  "migrate",
+				Usage: "Rewrite the configuration file using the latest schema version (comments are not preserved)",
+				Action: func(c *cli.Context) error {
+					path := c.String("config")
+
+					migrated, err := config.Migrate(path)
+					if err != nil {
+						return fmt.Errorf("failed to migrate configuration: %w", err)
+					}
+
+					if !migrated {
+						fmt.Printf("Configuration already uses %s\n", latestconfig.APIVersion)
+						return nil
+					}
+
+					fmt.Printf("Migrated configuration to %s (the original was saved to %s.bak)\n", latestconfig.APIVersion, path)
+
+					return nil
+				},
+			},
+			{
+				Name:  "validate",
+				Usage: "Validate the configuration file and report suspicious values",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "strict",
+						Usage: "Treat warnings as errors",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					conf, err := readConfig(c)
+					if err != nil {
+						return fmt.Errorf("configuration is invalid: %w", err)
+					}
+
+					var warnings []string
+					for _, d := range conf.Deprecations() {
+						warnings = append(warnings, d.String())
+					}
+					warnings = append(warnings, conf.Lint()...)
+
+					// Profiles are run by the same instance, so are checked
+					// along with it.
+					for _, p := range conf.Profiles {
+						paths := []string{c.String("system-config"), profileConfigPath(c.String("config"), p.Name)}
+
+						profileConf, err := config.Load(paths, nil)
+						if err != nil {
+							return fmt.Errorf("profile %q: configuration is invalid: %w", p.Name, err)
+						}
+
+						for _, d := range profileConf.Deprecations() {
+							warnings = append(warnings, fmt.Sprintf("profile %q: %s", p.Name, d))
+						}
+						for _, w := range profileConf.Lint() {
+							warnings = append(warnings, fmt.Sprintf("profile %q: %s", p.Name, w))
+						}
+					}
+
+					for _, w := range warnings {
+						fmt.Printf("warning: %s\n", w)
+					}
+
+					if len(warnings) > 0 && c.Bool("strict") {
+						return fmt.Errorf("configuration has %d warnings", len(warnings))
+					}
+
+					fmt.Println("Configuration is valid")
+
+					return nil
+				},
+			},
+			{
+				Name:  "history",
+				Usage: "List the previous versions of the configuration file, kept whenever cat-doorbell rewrites it",
+				Action: func(c *cli.Context) error {
+					snapshots, err := config.ListSnapshots(c.String("config"))
+					if err != nil {
+						return err
+					}
+
+					if len(snapshots) == 0 {
+						fmt.Println("No previous versions")
+						return nil
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "VERSION\tREPLACED\tSIZE")
+					for i, s := range snapshots {
+						fmt.Fprintf(w, "%d\t%s\t%d\n", i+1, s.Time.Local().Format(time.DateTime), s.Size)
+					}
+
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "rollback",
+				Usage:     "Restore a previous version of the configuration file (by default, the most recent)",
+				ArgsUsage: "[VERSION]",
+				Action: func(c *cli.Context) error {
+					path := c.String("config")
+
+					version := 1
+					if c.NArg() > 0 {
+						var err error
+						version, err = strconv.Atoi(c.Args().First())
+						if err != nil || version < 1 {
+							return fmt.Errorf("invalid version %q: expected a number from \"cat-doorbell config history\"", c.Args().First())
+						}
+					}
+
+					snapshots, err := config.ListSnapshots(path)
+					if err != nil {
+						return err
+					}
+
+					if version > len(snapshots) {
+						return fmt.Errorf("version %d not found, there are %d previous versions", version, len(snapshots))
+					}
+
+					snapshot := snapshots[version-1]
+					if err := config.Rollback(path, snapshot); err != nil {
+						return fmt.Errorf("failed to roll back configuration: %w", err)
+					}
+
+					fmt.Printf("Restored the version replaced at %s (the running instance reloads it automatically)\n",
+						snapshot.Time.Local().Format(time.DateTime))
+
+					return nil
+				},
+			},
+		},
+	}
+}
+
+var starterConfigTemplate = template.Must(template.New("config").Parse(`apiVersion: {{ .APIVersion }}
+kind: Config
+{{- if .Broker }}
+# The MQTT broker that the beacon receivers publish to.
+broker:
+  address: {{ printf "%q" .Broker }}
+{{- end }}
+{{- if .Scan }}
+# Scan for devices using the host's Bluetooth adapter.
+scanner:
+  enabled: true
+{{- end }}
+# How long to wait before notifying about the same device again.
+detectionTimeout: 5m
+# The devices to listen for.
+targets:
+- name: {{ printf "%q" .Name }}
+  mac: {{ printf "%q" .MAC }}
+`))
+
+type starterConfig struct {
+	APIVersion string
+	Broker     string
+	Scan       bool
+	Name       string
+	MAC        string
+}
+
+func initConfig(c *cli.Context) error {
+	path := c.String("config")
+
+	if !c.Bool("force") {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists (use --force to overwrite it)", path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to stat configuration file: %w", err)
+		}
+	}
+
+	starter := starterConfig{
+		APIVersion: latestconfig.APIVersion,
+		Broker:     c.String("broker"),
+		Scan:       c.Bool("scan"),
+		Name:       c.String("name"),
+		MAC:        c.String("mac"),
+	}
+
+	if isTerminal(os.Stdin) {
+		in := bufio.NewReader(os.Stdin)
+
+		var err error
+		if starter.Broker == "" && !starter.Scan {
+			starter.Broker, err = prompt(in, "MQTT broker address (leave empty to scan with this computer's Bluetooth adapter)", "")
+			if err != nil {
+				return err
+			}
+			starter.Scan = starter.Broker == ""
+		}
+
+		if starter.Name == "" {
+			starter.Name, err = prompt(in, "Name of the cat", "Mittens")
+			if err != nil {
+				return err
+			}
+		}
+
+		for starter.MAC == "" {
+			starter.MAC, err = prompt(in, "MAC address of the cat's tag", "")
+			if err != nil {
+				return err
+			}
+
+			if _, err := util.NormalizeMAC(starter.MAC); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				starter.MAC = ""
+			}
+		}
+	}
+
+	if starter.Broker == "" && !starter.Scan {
+		return errors.New("either --broker or --scan is required")
+	}
+
+	if starter.MAC == "" {
+		return errors.New("--mac is required")
+	}
+
+	if starter.Name == "" {
+		starter.Name = "Mittens"
+	}
+
+	var buf bytes.Buffer
+	if err := starterConfigTemplate.Execute(&buf, starter); err != nil {
+		return fmt.Errorf("failed to render configuration: %w", err)
+	}
+
+	if _, err := config.FromYAML(bytes.NewReader(buf.Bytes())); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create configuration directory: %w", err)
+	}
+
+	// Keep the configuration being overwritten (with --force).
+	if err := config.TakeSnapshot(path); err != nil {
+		return fmt.Errorf("failed to snapshot configuration file: %w", err)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write configuration file: %w", err)
+	}
+
+	fmt.Printf("Wrote %s\n", path)
+
+	return nil
+}
+
+// prompt asks the user for a value, returning def if they enter nothing.
+func prompt(in *bufio.Reader, question, def string) (string, error) {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	answer, err := in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && answer != "") {
+		return "", fmt.Errorf("failed to read answer: %w", err)
+	}
+
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def, nil
+	}
+
+	return answer, nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
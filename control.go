@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/control"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+// testRequest asks the beacon handling loop to ring the doorbell for a fake
+// detection.
+type testRequest struct {
+	target string
+	reply  chan testReply
+}
+
+type testReply struct {
+	results []control.TestResult
+	err     error
+}
+
+// ControlStatus returns a snapshot of the doorbell state for the control
+// socket.
+func (d *doorbell) ControlStatus() control.Status {
+	return control.Status{
+		Status:    d.Status(),
+		Recording: d.status().recording,
+	}
+}
+
+// TestDetection rings the doorbell for a fake detection of the named target
+// (or the first target if the name is empty), and returns the result of
+// delivering its notification to each notifier.
+func (d *doorbell) TestDetection(ctx context.Context, target string) ([]control.TestResult, error) {
+	reply := make(chan testReply, 1)
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case d.tests <- testRequest{target: target, reply: reply}:
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-reply:
+		return r.results, r.err
+	}
+}
+
+// InjectFaults injects faults into the connection to the broker, if the
+// doorbell was started in developer mode.
+func (d *doorbell) InjectFaults(injection control.FaultInjection) (control.Faults, error) {
+	if d.faults == nil {
+		return control.Faults{}, control.ErrDeveloperMode
+	}
+
+	if injection.Drop != nil {
+		slog.Info("Dropping MQTT messages", slog.Int("count", *injection.Drop))
+		d.faults.Drop(*injection.Drop)
+	}
+
+	if injection.Latency != nil {
+		slog.Info("Delaying MQTT messages", slog.Duration("latency", *injection.Latency))
+		d.faults.SetLatency(*injection.Latency)
+	}
+
+	if injection.Disconnect {
+		slog.Info("Disconnecting from MQTT broker")
+		d.faults.Disconnect()
+	}
+
+	state := d.faults.State()
+
+	return control.Faults{Drop: state.Drop, Latency: state.Latency}, nil
+}
+
+// handleTest rings the doorbell and delivers a notification as if the target
+// had been detected, regardless of whether notifications are paused. Actions
+// aren't run, and nothing is recorded in the history.
+func (d *doorbell) handleTest(ctx context.Context, req testRequest) {
+	conf, _ := d.config()
+
+	var target *latestconfig.TargetConfig
+	for i := range conf.Targets {
+		if req.target == "" || conf.Targets[i].Name == req.target {
+			target = &conf.Targets[i]
+			break
+		}
+	}
+
+	if target == nil {
+		err := fmt.Errorf("unknown target %q", req.target)
+		if req.target == "" {
+			err = fmt.Errorf("no targets configured")
+		}
+
+		req.reply <- testReply{err: err}
+		return
+	}
+
+	slog.Info("Testing detection", slog.String("name", target.Name))
+
+	now := time.Now()
+	title, message := d.texts.Render(target.Name, latestconfig.EventDetected, &notifier.TextData{
+		Name:       target.Name,
+		MAC:        d.redactor.Redact(target.MAC),
+		Time:       now.Local(),
+		CountToday: d.visitsToday(ctx, target.Name, now),
+	})
+
+	n := &notifier.Notification{
+		Event:    latestconfig.EventDetected,
+		Title:    title + " (test)",
+		Message:  message,
+		Name:     target.Name,
+		Color:    target.Color,
+		MAC:      d.redactor.Redact(target.MAC),
+		Time:     now,
+		Instance: d.instance(),
+	}
+
+	dispatcher, cam := d.dispatcher, d.camera
+	go func() {
+		var results []control.TestResult
+		for _, r := range d.notify(ctx, dispatcher, cam, n) {
+			result := control.TestResult{Notifier: r.Notifier, Latency: r.Latency, Queued: r.Queued}
+			if r.Err != nil {
+				result.Error = r.Err.Error()
+			}
+
+			results = append(results, result)
+		}
+
+		req.reply <- testReply{results: results}
+	}()
+
+	if d.player != nil {
+		if err := d.player.Play(target.Sound.File); err != nil {
+			slog.Warn("Failed to play doorbell sound", slog.Any("error", err))
+		}
+	}
+}
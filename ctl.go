@@ -0,0 +1,459 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/control"
+	"github.com/dpeckett/cat-doorbell/internal/web"
+	"github.com/urfave/cli/v2"
+)
+
+// controlClient returns a client for the running instance's control socket.
+func controlClient(c *cli.Context) *control.Client {
+	return control.NewClient(c.String("control-socket"))
+}
+
+func pauseCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "pause",
+		Usage:     "Pause notifications of the running instance, for a duration (eg. 1h) or until resumed",
+		ArgsUsage: "[DURATION]",
+		Action: func(c *cli.Context) error {
+			if c.NArg() > 1 {
+				return errors.New("expected at most one duration")
+			}
+
+			var duration time.Duration
+			if c.NArg() == 1 {
+				var err error
+				duration, err = time.ParseDuration(c.Args().First())
+				if err != nil || duration <= 0 {
+					return fmt.Errorf("invalid duration %q: expected a positive duration (eg. 1h)", c.Args().First())
+				}
+			}
+
+			status, err := controlClient(c).Pause(c.Context, duration)
+			if err != nil {
+				return err
+			}
+
+			if status.PausedUntil != nil {
+				fmt.Printf("Paused notifications until %s\n", formatPausedUntil(*status.PausedUntil))
+			} else {
+				fmt.Println("Paused notifications until resumed")
+			}
+
+			return nil
+		},
+	}
+}
+
+func resumeCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "resume",
+		Usage: "Resume notifications of the running instance",
+		Action: func(c *cli.Context) error {
+			if _, err := controlClient(c).Resume(c.Context); err != nil {
+				return err
+			}
+
+			fmt.Println("Resumed notifications")
+
+			return nil
+		},
+	}
+}
+
+func maintenanceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "maintenance",
+		Usage: "Start or stop maintenance mode in the running instance, eg. for a planned broker reboot",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "start",
+				Usage:     "Start maintenance mode, for a duration (eg. 1h) or until stopped",
+				ArgsUsage: "[DURATION]",
+				Action: func(c *cli.Context) error {
+					if c.NArg() > 1 {
+						return errors.New("expected at most one duration")
+					}
+
+					var duration time.Duration
+					if c.NArg() == 1 {
+						var err error
+						duration, err = time.ParseDuration(c.Args().First())
+						if err != nil || duration <= 0 {
+							return fmt.Errorf("invalid duration %q: expected a positive duration (eg. 1h)", c.Args().First())
+						}
+					}
+
+					status, err := controlClient(c).StartMaintenance(c.Context, duration)
+					if err != nil {
+						return err
+					}
+
+					if status.MaintenanceUntil != nil {
+						fmt.Printf("Started maintenance until %s\n", formatPausedUntil(*status.MaintenanceUntil))
+					} else {
+						fmt.Println("Started maintenance until stopped")
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "stop",
+				Usage: "Stop maintenance mode (scheduled maintenance windows still apply)",
+				Action: func(c *cli.Context) error {
+					status, err := controlClient(c).StopMaintenance(c.Context)
+					if err != nil {
+						return err
+					}
+
+					if status.Maintenance {
+						fmt.Println("Stopped maintenance, but a scheduled maintenance window is in progress")
+					} else {
+						fmt.Println("Stopped maintenance")
+					}
+
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func expectCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "expect",
+		Usage: "Start or stop expect mode in the running instance, which makes detection more sensitive while the cat is expected back",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "start",
+				Usage:     "Start expect mode, for a duration (eg. 30m) or the configured duration",
+				ArgsUsage: "[DURATION]",
+				Action: func(c *cli.Context) error {
+					if c.NArg() > 1 {
+						return errors.New("expected at most one duration")
+					}
+
+					var duration time.Duration
+					if c.NArg() == 1 {
+						var err error
+						duration, err = time.ParseDuration(c.Args().First())
+						if err != nil || duration <= 0 {
+							return fmt.Errorf("invalid duration %q: expected a positive duration (eg. 1h)", c.Args().First())
+						}
+					}
+
+					status, err := controlClient(c).StartExpecting(c.Context, duration)
+					if err != nil {
+						return err
+					}
+
+					if status.ExpectingUntil != nil {
+						fmt.Printf("Expecting the cat until %s\n", formatPausedUntil(*status.ExpectingUntil))
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "stop",
+				Usage: "Stop expect mode",
+				Action: func(c *cli.Context) error {
+					if _, err := controlClient(c).StopExpecting(c.Context); err != nil {
+						return err
+					}
+
+					fmt.Println("Stopped expecting the cat")
+
+					return nil
+				},
+			},
+		},
+	}
+}
+
+func statusCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "status",
+		Usage: "Show the status of the running instance",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output the status as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			status, err := controlClient(c).Status(c.Context)
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(status)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+			switch {
+			case status.Broker == "":
+				fmt.Fprintln(w, "Broker:\tnone (scanning for devices)")
+			case status.Connected:
+				fmt.Fprintf(w, "Broker:\tconnected to %s\n", status.Broker)
+			case status.Reconnecting:
+				fmt.Fprintf(w, "Broker:\treconnecting to %s (%s)\n", status.Broker, orDash(status.BrokerError))
+			default:
+				fmt.Fprintf(w, "Broker:\tdisconnected from %s (%s)\n", status.Broker, orDash(status.BrokerError))
+			}
+
+			for _, b := range status.Brokers {
+				state := "connected"
+				switch {
+				case b.Connected:
+				case b.Error != "":
+					state = "unreachable (" + b.Error + ")"
+				default:
+					state = "not connected"
+				}
+
+				fmt.Fprintf(w, "\t%s: %s\n", b.Address, state)
+			}
+
+			switch {
+			case !status.Paused:
+				fmt.Fprintln(w, "Notifications:\tenabled")
+			case status.PausedUntil != nil:
+				fmt.Fprintf(w, "Notifications:\tpaused until %s\n", formatPausedUntil(*status.PausedUntil))
+			default:
+				fmt.Fprintln(w, "Notifications:\tpaused until resumed")
+			}
+
+			switch {
+			case !status.Maintenance:
+			case status.MaintenanceUntil != nil:
+				fmt.Fprintf(w, "Maintenance:\tuntil %s\n", formatPausedUntil(*status.MaintenanceUntil))
+			default:
+				fmt.Fprintln(w, "Maintenance:\tin progress")
+			}
+
+			if status.ExpectingUntil != nil {
+				fmt.Fprintf(w, "Expecting:\tuntil %s\n", formatPausedUntil(*status.ExpectingUntil))
+			}
+
+			if status.Visit != nil {
+				fmt.Fprintf(w, "Visit:\t%s at %s (unacknowledged)\n", status.Visit.Name, status.Visit.Time.Local().Format(time.Kitchen))
+			} else {
+				fmt.Fprintln(w, "Visit:\tnone")
+			}
+
+			if len(status.Devices) > 0 {
+				fmt.Fprintln(w, "Devices:\t")
+			}
+
+			for _, dev := range status.Devices {
+				fmt.Fprintf(w, "\t%s: %s\n", dev.Name, describeDevice(dev))
+			}
+
+			switch {
+			case status.GatewaySilent:
+				fmt.Fprintln(w, "Beacons:\tnot being received")
+			case len(status.Origins) == 0:
+				fmt.Fprintln(w, "Beacons:\tnone received yet")
+			default:
+				fmt.Fprintln(w, "Beacons:\tbeing received")
+			}
+
+			for _, o := range status.Origins {
+				fmt.Fprintf(w, "\t%s: last received %s\n", o.Origin, o.LastBeacon.Local().Format(time.DateTime))
+			}
+
+			fmt.Fprintf(w, "Recording:\t%s\n", orDash(status.Recording))
+
+			return w.Flush()
+		},
+	}
+}
+
+func recordingCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "recording",
+		Usage: "Start or stop recording beacons in the running instance",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "start",
+				Usage: "Start recording beacons, and print the path of the recording",
+				Action: func(c *cli.Context) error {
+					path, err := controlClient(c).StartRecording(c.Context)
+					if err != nil {
+						return err
+					}
+
+					fmt.Println(path)
+
+					return nil
+				},
+			},
+			{
+				Name:  "stop",
+				Usage: "Stop recording beacons",
+				Action: func(c *cli.Context) error {
+					return controlClient(c).StopRecording(c.Context)
+				},
+			},
+		},
+	}
+}
+
+// describeDevice summarizes the state of a target device on one line.
+func describeDevice(dev web.Device) string {
+	var parts []string
+
+	if dev.LastSeen == nil {
+		parts = append(parts, "not seen yet")
+	} else {
+		seen := "last seen " + dev.LastSeen.Local().Format(time.DateTime)
+		if dev.RSSI != 0 {
+			seen += fmt.Sprintf(" (%d dBm)", dev.RSSI)
+		}
+
+		parts = append(parts, seen)
+	}
+
+	if dev.Present != nil {
+		state := "away"
+		if *dev.Present {
+			state = "home"
+		}
+
+		if dev.Since != nil {
+			state += " since " + dev.Since.Local().Format(time.DateTime)
+		}
+
+		parts = append(parts, state)
+	}
+
+	if dev.Battery != nil {
+		battery := fmt.Sprintf("battery %d%%", *dev.Battery)
+		if dev.BatteryLow {
+			battery += " (low)"
+		}
+
+		parts = append(parts, battery)
+	}
+
+	if dev.CooldownUntil != nil {
+		parts = append(parts, "rings again after "+dev.CooldownUntil.Local().Format(time.Kitchen))
+	}
+
+	if dev.Visiting {
+		parts = append(parts, "visiting")
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func devCommand() *cli.Command {
+	// printFaults prints the faults being injected.
+	printFaults := func(faults *control.Faults) {
+		fmt.Printf("Dropping the next %d messages, delaying messages by %s\n", faults.Drop, faults.Latency)
+	}
+
+	return &cli.Command{
+		Name:  "dev",
+		Usage: "Inject faults into the running instance's broker connection (requires --dev)",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "disconnect",
+				Usage: "Drop the connection to the broker, as if it was lost",
+				Action: func(c *cli.Context) error {
+					faults, err := controlClient(c).InjectFaults(c.Context, control.FaultInjection{Disconnect: true})
+					if err != nil {
+						return err
+					}
+
+					fmt.Println("Disconnected from the broker")
+					printFaults(faults)
+
+					return nil
+				},
+			},
+			{
+				Name:      "drop",
+				Usage:     "Drop the next COUNT messages received from the broker (0 stops dropping)",
+				ArgsUsage: "COUNT",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.New("expected a number of messages")
+					}
+
+					count, err := strconv.Atoi(c.Args().First())
+					if err != nil || count < 0 {
+						return fmt.Errorf("invalid number of messages %q", c.Args().First())
+					}
+
+					faults, err := controlClient(c).InjectFaults(c.Context, control.FaultInjection{Drop: &count})
+					if err != nil {
+						return err
+					}
+
+					printFaults(faults)
+
+					return nil
+				},
+			},
+			{
+				Name:      "latency",
+				Usage:     "Delay every message received from the broker (0s for no delay)",
+				ArgsUsage: "DURATION",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.New("expected a duration")
+					}
+
+					latency, err := time.ParseDuration(c.Args().First())
+					if err != nil || latency < 0 {
+						return fmt.Errorf("invalid duration %q: expected a duration (eg. 500ms)", c.Args().First())
+					}
+
+					faults, err := controlClient(c).InjectFaults(c.Context, control.FaultInjection{Latency: &latency})
+					if err != nil {
+						return err
+					}
+
+					printFaults(faults)
+
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dpeckett/cat-doorbell/internal/config"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+func deviceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "device",
+		Usage: "Manage the devices to listen for",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "add",
+				Usage: "Add a device",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "mac",
+						Usage: "MAC address of the device",
+					},
+					&cli.StringFlag{
+						Name:  "local-name",
+						Usage: "Glob pattern matched against the device's advertised local name",
+					},
+					&cli.StringFlag{
+						Name:  "service-uuid",
+						Usage: "Service UUID advertised by the device",
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Name of the device (eg. the cat's name)",
+					},
+					&cli.DurationFlag{
+						Name:  "detection-timeout",
+						Usage: "Override the default detection timeout for this device",
+					},
+					&cli.StringFlag{
+						Name:  "message",
+						Usage: "Notification message to display when the device is detected",
+					},
+					&cli.StringFlag{
+						Name:  "sound",
+						Usage: "Path to an MP3, WAV, OGG or FLAC file to play when the device is detected",
+					},
+					&cli.StringFlag{
+						Name:  "color",
+						Usage: "Accent colour used to distinguish the device (eg. #ff8800)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					target := latestconfig.TargetConfig{
+						Name:             c.String("name"),
+						MAC:              c.String("mac"),
+						LocalName:        c.String("local-name"),
+						ServiceUUID:      c.String("service-uuid"),
+						DetectionTimeout: c.Duration("detection-timeout"),
+						Color:            c.String("color"),
+						Notification: latestconfig.TargetNotificationConfig{
+							Message: c.String("message"),
+						},
+						Sound: latestconfig.TargetSoundConfig{
+							File: c.String("sound"),
+						},
+					}
+
+					if err := config.Edit(c.String("config"), func(doc *yaml.Node) error {
+						return config.AddTarget(doc, target)
+					}); err != nil {
+						return fmt.Errorf("failed to add device: %w", err)
+					}
+
+					slog.Info("Added device", slog.String("name", target.Name), slog.String("mac", target.MAC))
+
+					return nil
+				},
+			},
+			{
+				Name:      "remove",
+				Usage:     "Remove a device",
+				ArgsUsage: "MAC",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return fmt.Errorf("expected a single MAC address argument")
+					}
+
+					mac := c.Args().First()
+					if err := config.Edit(c.String("config"), func(doc *yaml.Node) error {
+						return config.RemoveTarget(doc, mac)
+					}); err != nil {
+						return fmt.Errorf("failed to remove device: %w", err)
+					}
+
+					slog.Info("Removed device", slog.String("mac", mac))
+
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "List the configured devices",
+				Action: func(c *cli.Context) error {
+					conf, err := readConfig(c)
+					if err != nil {
+						return err
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "NAME\tMAC\tLOCAL NAME\tSERVICE UUID\tDETECTION TIMEOUT")
+					for _, t := range conf.Targets {
+						fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+							t.Name, orDash(t.MAC), orDash(t.LocalName), orDash(t.ServiceUUID), t.DetectionTimeout)
+					}
+
+					return w.Flush()
+				},
+			},
+		},
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
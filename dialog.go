@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/urfave/cli/v2"
+)
+
+func errorDialogCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "error-dialog",
+		Usage:     "Show why the doorbell stopped in a window",
+		ArgsUsage: "MESSAGE",
+		// Only run by the system tray, when the doorbell fails.
+		Hidden: true,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "log-file",
+				Usage: "Path of the log file the window offers to open",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := featureGUI.check(); err != nil {
+				return err
+			}
+
+			return runErrorDialog(c.Args().First(), c.String("log-file"))
+		},
+	}
+}
+
+// showErrorDialog shows the error in a window, so that it isn't only in the
+// log when there is no terminal to read it from. The window is shown by a
+// separate process, as it can't share the main thread with the system tray,
+// and outlives this one. Failing to show it is only logged.
+func showErrorDialog(c *cli.Context, err error, logFilePath string) {
+	if err := startErrorDialog(c, err.Error(), logFilePath); err != nil {
+		slog.Warn("Failed to show error dialog", slog.Any("error", err))
+	}
+}
+
+func startErrorDialog(c *cli.Context, message, logFilePath string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	cmd := exec.Command(executable,
+		"--log-dir", c.String("log-dir"),
+		"error-dialog", "--log-file", logFilePath, message)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open error dialog: %w", err)
+	}
+
+	return cmd.Process.Release()
+}
@@ -0,0 +1,78 @@
+//go:build !nogui
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"log/slog"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+	"github.com/dpeckett/cat-doorbell/internal/assets"
+	"github.com/pkg/browser"
+)
+
+func init() {
+	runErrorDialog = runErrorDialogWindow
+}
+
+// runErrorDialogWindow shows a window explaining why the doorbell stopped,
+// with buttons to open the log file and the troubleshooting guide, until it
+// is closed.
+func runErrorDialogWindow(message, logFilePath string) error {
+	a := app.NewWithID("com.github.dpeckett.cat-doorbell")
+	if icon, err := assets.ReadFile("cat-icon-error.png"); err == nil {
+		a.SetIcon(fyne.NewStaticResource("cat-icon-error.png", icon))
+	}
+
+	w := a.NewWindow("Doorbell Stopped")
+
+	heading := widget.NewLabelWithStyle("The doorbell stopped because of an error:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	text := widget.NewLabel(message)
+	text.Wrapping = fyne.TextWrapWord
+
+	buttons := container.NewHBox(layout.NewSpacer())
+	if logFilePath != "" {
+		buttons.Add(widget.NewButton("View Logs", func() {
+			if err := browser.OpenFile(logFilePath); err != nil {
+				slog.Warn("Failed to open log file", slog.Any("error", err))
+			}
+		}))
+	}
+
+	buttons.Add(widget.NewButton("Help", func() {
+		if err := openHelp(); err != nil {
+			slog.Warn("Failed to open troubleshooting guide", slog.Any("error", err))
+		}
+	}))
+
+	closeButton := widget.NewButton("Close", w.Close)
+	closeButton.Importance = widget.HighImportance
+	buttons.Add(closeButton)
+
+	w.SetContent(container.NewBorder(heading, buttons, nil, nil, container.NewVScroll(text)))
+	w.Resize(fyne.NewSize(480, 200))
+	w.ShowAndRun()
+
+	return nil
+}
@@ -0,0 +1,1334 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/action"
+	"github.com/dpeckett/cat-doorbell/internal/anomaly"
+	"github.com/dpeckett/cat-doorbell/internal/assets"
+	"github.com/dpeckett/cat-doorbell/internal/camera"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/constants"
+	"github.com/dpeckett/cat-doorbell/internal/control"
+	"github.com/dpeckett/cat-doorbell/internal/detector"
+	"github.com/dpeckett/cat-doorbell/internal/event"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/keyed"
+	"github.com/dpeckett/cat-doorbell/internal/metrics"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+	"github.com/dpeckett/cat-doorbell/internal/session"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/source/mqtt"
+	"github.com/dpeckett/cat-doorbell/internal/source/replay"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+	"github.com/dpeckett/cat-doorbell/internal/visits"
+	"github.com/dpeckett/cat-doorbell/internal/webpush"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// recentDetectionsLimit is the number of recent detections kept for display.
+	recentDetectionsLimit = 5
+	// presenceCheckInterval is how often target devices are checked for
+	// departures.
+	presenceCheckInterval = 10 * time.Second
+	// soundLatencyBudget is how soon after a beacon is received the doorbell
+	// sound should be heard. Slower sounds are logged.
+	soundLatencyBudget = constants.SoundLatencyBudget
+	// sessionCheckTimeout is how long to wait for the session state before
+	// playing the doorbell sound regardless.
+	sessionCheckTimeout = 100 * time.Millisecond
+)
+
+type runOptions struct {
+	// profile is the name of the profile the doorbell runs, or empty for
+	// the doorbell of the configuration file itself.
+	profile string
+	// configPaths are the paths of the layered configuration files, which
+	// are reloaded when they change.
+	configPaths []string
+	// configOverrides are applied on top of the configuration files.
+	configOverrides []string
+	// historyPath is the path to the detection history database.
+	historyPath string
+	// queuePath is the path to the queue of undelivered notifications.
+	queuePath string
+	// certDir is where the web server's self-signed certificate is stored.
+	certDir string
+	// pushDir is where the web push key and subscriptions are stored.
+	pushDir string
+	// visitsPath is the path to the visit sessions, which survive restarts.
+	visitsPath string
+	// headless disables the system tray and desktop notifications.
+	headless bool
+	// recordPath, if specified, is the path of a recording every received
+	// beacon is appended to from startup.
+	recordPath string
+	// recordDir is where recordings started at runtime are written, unless
+	// recordPath is specified.
+	recordDir string
+	// controlSocket is the path of the socket other commands control the
+	// doorbell through. Only one instance may listen on it.
+	controlSocket string
+	// source, if specified, is the only source beacons are received from
+	// (eg. a simulation), instead of the configured broker and scanner.
+	source source.Source
+	// linger is how long the doorbell keeps running once source has sent
+	// its last beacon.
+	linger time.Duration
+	// dev enables developer mode, in which faults can be injected into the
+	// broker connection through the control socket.
+	dev bool
+	// onHandled and onDropped, if specified, are called with each beacon
+	// once it has been handled, or when it is dropped because the beacon
+	// queue is full (eg. to benchmark the beacon pipeline).
+	onHandled func(b source.Beacon)
+	onDropped func(b source.Beacon)
+}
+
+// recentDetection is a detection that would have raised a notification.
+type recentDetection struct {
+	time    time.Time
+	message string
+	// color is the accent colour of the detected device.
+	color string
+}
+
+// doorbellStatus is a snapshot of the doorbell state.
+type doorbellStatus struct {
+	// broker is the address of the MQTT broker that is connected to (or is
+	// being connected to), if any.
+	broker string
+	// brokers holds the status of the broker and each of its fallbacks, if
+	// fallbacks are configured.
+	brokers []mqtt.BrokerStatus
+	// connected is true if the MQTT broker connection is up.
+	connected bool
+	// reconnecting is true if the MQTT broker connection is down and is
+	// being retried.
+	reconnecting bool
+	// brokerErr is why the MQTT broker connection is down, if known.
+	brokerErr error
+	// paused is true if notifications are paused.
+	paused bool
+	// pausedUntil is when notifications will resume, or zero if they are
+	// paused until explicitly resumed.
+	pausedUntil time.Time
+	// recent holds the most recent detections, newest first.
+	recent []recentDetection
+	// devices holds the state of each target device, sorted by name.
+	devices []deviceStatus
+	// visit is the unacknowledged visit, if any.
+	visit *visit
+	// recording is the path of the recording beacons are written to, if
+	// they are being recorded.
+	recording string
+	// beacons holds when a beacon was last received from each origin (eg.
+	// MQTT topic).
+	beacons []originStatus
+	// gatewaySilent is true if no beacons have been received for the
+	// gateway timeout.
+	gatewaySilent bool
+	// maintenance is true if maintenance mode is active.
+	maintenance bool
+	// maintenanceUntil is when manually started maintenance ends, or zero if
+	// it lasts until stopped (or is scheduled).
+	maintenanceUntil time.Time
+	// expectingUntil is when expect mode ends, or zero if it isn't active.
+	expectingUntil time.Time
+}
+
+// deviceStatus is the state of a target device.
+type deviceStatus struct {
+	detector.Device
+	// visiting is true if the device rang the doorbell for the
+	// unacknowledged visit.
+	visiting bool
+}
+
+// doorbell ties together the detection logic and everything that should
+// happen when a target device is detected.
+type doorbell struct {
+	opts     runOptions
+	detector *detector.Detector
+	// workers handle the events of each target device in order, and the
+	// events of different target devices in parallel.
+	workers *keyed.Pool
+	// dispatcher, actions, events, texts, camera and redactor are only
+	// replaced by the beacon handling loop, once the workers have finished
+	// handling earlier events (see applyConfig).
+	dispatcher *notifier.Dispatcher
+	actions    *action.Runner
+	events     *event.Deriver
+	texts      *notifier.Texts
+	// correlator holds back custom events until their correlated events
+	// occur. It outlives configuration reloads.
+	correlator *event.Correlator
+	// camera takes snapshots for notifications, or is nil if there is no
+	// camera.
+	camera   *camera.Camera
+	redactor *util.MACRedactor
+	history  history.Store
+	// queue stores notifications that couldn't be delivered.
+	queue *notifier.Queue
+	// push stores the web push key and the subscriptions of the browsers
+	// that enabled notifications on the dashboard.
+	push *webpush.Service
+	// visits stores the visit session of each target.
+	visits   *visits.Store
+	metrics  *metrics.Metrics
+	iconPath string
+	// player plays the doorbell sound, or is nil if sound is disabled.
+	player player
+	// changed receives a value whenever the doorbell status changes.
+	changed chan struct{}
+	// reloads receives reloaded configurations to apply.
+	reloads chan *latestconfig.Config
+	// overdue receives the custom events of visits that have gone
+	// unacknowledged for too long.
+	overdue chan overdueVisit
+	// anomalies learns the visit patterns of targets from the history.
+	anomalies *anomaly.Detector
+	// missing receives targets that haven't visited for longer than usual.
+	missing chan anomaly.Missing
+	// summaries receives the visit summaries of targets that are due.
+	summaries chan summary
+	// tests receives requests to ring the doorbell for fake detections.
+	tests chan testRequest
+	// evaluations receives requests to evaluate hypothetical beacons.
+	evaluations chan evaluationRequest
+	// dropped is the number of beacons dropped since it was last logged.
+	dropped atomic.Int64
+	// ctrl serves the control socket, or is nil if there isn't one.
+	ctrl *control.Server
+	// closers release the resources acquired by open.
+	closers []func()
+	// faults injects faults into the broker connection, or is nil unless in
+	// developer mode.
+	faults *mqtt.Faults
+
+	mu   sync.Mutex
+	conf *latestconfig.Config
+	// confChanged is closed (and replaced) whenever the configuration is
+	// reloaded.
+	confChanged chan struct{}
+	// clockChanged is closed (and replaced) whenever the system clock jumps.
+	clockChanged chan struct{}
+	broker       mqtt.Status
+	// hasConnected is true once the MQTT broker connection has been up.
+	hasConnected bool
+	paused       bool
+	pausedUntil  time.Time
+	resumeTimer  *time.Timer
+	recent       []recentDetection
+	// visit is the unacknowledged visit, if any.
+	visit *visit
+	// recorder records received beacons to recordingPath, or is nil if they
+	// aren't being recorded.
+	recorder      *replay.Recorder
+	recordingPath string
+	// subscribers receive every recorded event.
+	subscribers map[chan history.Detection]struct{}
+	// watchdog tracks when beacons were last received.
+	watchdog watchdog
+	// doorbellsPressed holds when each of the other doorbells last rang
+	// this one.
+	doorbellsPressed map[string]time.Time
+	// motionActive holds whether each of the ONVIF camera's motion topics
+	// currently reports motion.
+	motionActive map[string]bool
+	// maintenance is maintenance mode started manually.
+	maintenance maintenance
+	// expect is expect mode, if it is active.
+	expect expect
+	// visitsClient shares visit sessions with other instances, or is nil if
+	// they aren't shared.
+	visitsClient *mqtt.Client
+	// overlapsWarned holds the targets that have been warned about matching
+	// the same beacons as others.
+	overlapsWarned map[string]bool
+}
+
+func newDoorbell(conf *latestconfig.Config, opts runOptions) *doorbell {
+	var faults *mqtt.Faults
+	if opts.dev {
+		faults = mqtt.NewFaults()
+	}
+
+	return &doorbell{
+		conf:         conf,
+		opts:         opts,
+		detector:     detector.New(conf.Targets),
+		workers:      keyed.New(conf.Limits.EventWorkers, conf.Limits.EventQueueSize),
+		correlator:   event.NewCorrelator(),
+		redactor:     conf.Privacy.MACRedactor(),
+		metrics:      metrics.New(conf.InstanceName()),
+		changed:      make(chan struct{}, 1),
+		reloads:      make(chan *latestconfig.Config),
+		overdue:      make(chan overdueVisit),
+		missing:      make(chan anomaly.Missing),
+		summaries:    make(chan summary),
+		tests:        make(chan testRequest),
+		evaluations:  make(chan evaluationRequest),
+		faults:       faults,
+		confChanged:  make(chan struct{}),
+		clockChanged: make(chan struct{}),
+		watchdog:     watchdog{since: time.Now(), seen: make(map[string]time.Time)},
+
+		doorbellsPressed: make(map[string]time.Time),
+		motionActive:     make(map[string]bool),
+		overlapsWarned:   make(map[string]bool),
+	}
+}
+
+// open acquires the resources the doorbell needs to run (eg. the control
+// socket, speaker and history), so that failures are reported before the
+// doorbell starts. If it fails, the resources acquired so far are released,
+// otherwise close must be called once the doorbell has stopped running.
+func (d *doorbell) open() (err error) {
+	defer func() {
+		if err != nil {
+			d.close()
+		}
+	}()
+
+	conf, _ := d.config()
+	if d.opts.source == nil && !hasSources(conf) {
+		return errors.New("no beacon sources configured")
+	}
+
+	if d.faults != nil {
+		slog.Warn("Developer mode enabled, faults can be injected into the broker connection")
+	}
+
+	// Only one instance may run at a time, otherwise the doorbell would ring
+	// twice for every detection.
+	if d.opts.controlSocket != "" {
+		ctrl, err := control.Listen(d.opts.controlSocket, d)
+		if err != nil {
+			return err
+		}
+		d.ctrl = ctrl
+		d.closers = append(d.closers, func() { _ = ctrl.Close() })
+	}
+
+	// Initialize the speaker. Headless machines often don't have audio, so
+	// carry on without sound.
+	if err := featureAudio.check(); err != nil {
+		slog.Warn("Sounds disabled", slog.Any("error", err))
+	} else if player, err := newPlayer(conf); err != nil {
+		if !d.opts.headless {
+			return err
+		}
+
+		slog.Warn("Failed to initialize speaker, sounds disabled", slog.Any("error", err))
+	} else {
+		d.player = player
+		d.closers = append(d.closers, player.Close)
+	}
+
+	var cleanup func()
+	d.iconPath, cleanup, err = unpackIcon()
+	if err != nil {
+		return err
+	}
+	d.closers = append(d.closers, cleanup)
+
+	d.queue, err = notifier.OpenQueue(d.opts.queuePath)
+	if err != nil {
+		return err
+	}
+
+	d.push, err = webpush.Open(d.opts.pushDir)
+	if err != nil {
+		return err
+	}
+
+	d.visits, err = visits.Open(d.opts.visitsPath, conf.InstanceName())
+	if err != nil {
+		return err
+	}
+
+	d.dispatcher, err = d.newDispatcher(conf)
+	if err != nil {
+		return err
+	}
+
+	d.actions, err = action.NewRunner(conf.Actions)
+	if err != nil {
+		return err
+	}
+
+	d.events, err = event.NewDeriver(conf.Events)
+	if err != nil {
+		return err
+	}
+
+	d.texts, err = notifier.NewTexts(conf)
+	if err != nil {
+		return err
+	}
+
+	d.camera = newCamera(conf)
+
+	d.history, err = history.Open(conf.History, d.opts.historyPath)
+	if err != nil {
+		return err
+	}
+	d.closers = append(d.closers, func() { _ = d.history.Close() })
+
+	d.anomalies = anomaly.New(d.history)
+
+	d.closers = append(d.closers, d.StopRecording)
+	if d.opts.recordPath != "" {
+		if _, err := d.StartRecording(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close releases the resources acquired by open, in the reverse order they
+// were acquired.
+func (d *doorbell) close() {
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		d.closers[i]()
+	}
+	d.closers = nil
+}
+
+// run runs the opened doorbell until the context is cancelled or an
+// unrecoverable error occurs.
+func (d *doorbell) run(ctx context.Context) error {
+	conf, _ := d.config()
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	d.restoreVisit(ctx)
+
+	// Sources send beacons to the queue, which drops the oldest when the
+	// beacon handling loop can't keep up.
+	received := make(chan source.Beacon)
+	beacons := make(chan source.Beacon)
+	queue := source.NewQueue(conf.Limits.BeaconQueueSize, d.beaconDropped)
+	d.metrics.RegisterQueues(queue.Len, d.workers.Len)
+	d.metrics.RegisterMaintenance(d.inMaintenance)
+	d.metrics.RegisterDevices(d.metricsDevices)
+
+	g.Go(func() error {
+		return queue.Run(ctx, received, beacons)
+	})
+
+	if d.opts.source != nil {
+		g.Go(func() error {
+			return d.runSource(ctx, received)
+		})
+	} else {
+		g.Go(func() error {
+			return d.superviseSource(ctx, received, "mqtt",
+				func(conf *latestconfig.Config) any {
+					return conf.Broker
+				},
+				func(conf *latestconfig.Config) (source.Source, error) {
+					// The new source will report when it has connected.
+					d.setBrokerStatus(mqtt.Status{})
+
+					if conf.Broker.Address == "" {
+						return nil, nil
+					}
+
+					return mqtt.New(conf.Broker, d.setBrokerStatus, func() {
+						if _, ok := d.Acknowledge(ctx, "button"); !ok {
+							slog.Debug("Acknowledge button pressed without a visit to acknowledge")
+						}
+					}, func(start bool, duration time.Duration) {
+						if start {
+							d.StartExpecting(duration)
+						} else {
+							d.StopExpecting()
+						}
+					}, d.faults), nil
+				})
+		})
+
+		g.Go(func() error {
+			return d.superviseSource(ctx, received, "bluetooth",
+				func(conf *latestconfig.Config) any {
+					return []any{conf.Scanner.Enabled, conf.ServiceUUIDs(), conf.ButtonMACs()}
+				},
+				func(conf *latestconfig.Config) (source.Source, error) {
+					if !conf.Scanner.Enabled {
+						return nil, nil
+					}
+
+					if err := featureBluetooth.check(); err != nil {
+						return nil, err
+					}
+
+					scanner, err := newScanner(conf.ServiceUUIDs(), conf.ButtonMACs())
+					if err != nil {
+						return nil, fmt.Errorf("failed to create scanner: %w", err)
+					}
+
+					return scanner, nil
+				})
+		})
+	}
+
+	if len(d.opts.configPaths) > 0 {
+		g.Go(func() error {
+			return d.watchConfig(ctx)
+		})
+	}
+
+	g.Go(func() error {
+		return d.watchAnomalies(ctx)
+	})
+
+	g.Go(func() error {
+		return d.watchSummaries(ctx)
+	})
+
+	g.Go(func() error {
+		return d.watchClock(ctx)
+	})
+
+	g.Go(func() error {
+		return d.watchCalendar(ctx)
+	})
+
+	g.Go(func() error {
+		return d.watchAutomation(ctx)
+	})
+
+	g.Go(func() error {
+		return d.watchVisits(ctx)
+	})
+
+	g.Go(func() error {
+		return d.watchONVIF(ctx)
+	})
+
+	if d.ctrl != nil {
+		g.Go(func() error {
+			return d.ctrl.Run(ctx)
+		})
+	}
+
+	if conf.Web.ListenAddress != "" {
+		if err := featureWeb.check(); err != nil {
+			return err
+		}
+
+		server, err := newWebServer(conf, d.history, d.push, d, d.opts.certDir)
+		if err != nil {
+			return fmt.Errorf("failed to create web server: %w", err)
+		}
+
+		g.Go(func() error {
+			return server.Run(ctx)
+		})
+	}
+
+	if conf.Metrics.ListenAddress != "" {
+		g.Go(func() error {
+			return d.metrics.Serve(ctx, conf.Metrics.ListenAddress)
+		})
+	}
+
+	g.Go(func() error {
+		return d.workers.Run(ctx)
+	})
+
+	g.Go(func() error {
+		ticker := time.NewTicker(presenceCheckInterval)
+		defer ticker.Stop()
+
+		retryTicker := time.NewTicker(conf.NotificationQueue.RetryInterval)
+		defer retryTicker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case b := <-beacons:
+				d.handleBeacon(ctx, b)
+
+				if d.opts.onHandled != nil {
+					d.opts.onHandled(b)
+				}
+			case <-ticker.C:
+				d.checkDepartures(ctx)
+				d.checkGateway(ctx)
+
+				if n := d.dropped.Swap(0); n > 0 {
+					slog.Warn("Dropped beacons that couldn't be handled fast enough", slog.Int64("count", n))
+				}
+			case <-retryTicker.C:
+				current, _ := d.config()
+				go d.dispatcher.Flush(ctx, current.NotificationQueue.MaxAge)
+			case o := <-d.overdue:
+				d.handle(ctx, o.visit.name, func() {
+					d.raiseOverdue(ctx, o)
+				})
+			case m := <-d.missing:
+				d.handle(ctx, m.Name, func() {
+					d.raiseMissing(ctx, m)
+				})
+			case s := <-d.summaries:
+				d.handle(ctx, s.target.Name, func() {
+					d.raiseSummary(ctx, s)
+				})
+			case req := <-d.tests:
+				d.handleTest(ctx, req)
+			case req := <-d.evaluations:
+				d.handleEvaluation(req)
+			case conf := <-d.reloads:
+				d.applyConfig(ctx, conf)
+
+				current, _ := d.config()
+				retryTicker.Reset(current.NotificationQueue.RetryInterval)
+			}
+		}
+	})
+
+	return g.Wait()
+}
+
+func (d *doorbell) handleBeacon(ctx context.Context, b source.Beacon) {
+	slog.Debug("Received beacon from device",
+		slog.String("mac", b.MAC), slog.Int("rssi", b.RSSI), slog.String("origin", b.Origin))
+
+	d.metrics.BeaconReceived()
+
+	now := time.Now()
+
+	d.recordBeacon(&b, now)
+	d.beaconSeen(ctx, b.Origin, now)
+
+	detections := d.detector.Observe(b, now)
+	if len(detections) > 0 && b.Battery != nil {
+		d.statusChanged()
+	}
+
+	if len(detections) > 0 && len(detections[0].Overlaps) > 0 {
+		d.warnOverlaps(detections[0])
+	}
+
+	for _, detection := range detections {
+		d.handle(ctx, detection.Target.Name, func() {
+			d.handleDetection(ctx, detection, now)
+		})
+	}
+}
+
+// warnOverlaps warns that a beacon matched several targets, once for each
+// combination of targets.
+func (d *doorbell) warnOverlaps(detection *detector.Detection) {
+	key := detection.Target.Name + "\x00" + strings.Join(detection.Overlaps, "\x00")
+
+	d.mu.Lock()
+	warned := d.overlapsWarned[key]
+	d.overlapsWarned[key] = true
+	d.mu.Unlock()
+
+	if !warned {
+		slog.Warn("Beacon matches several targets, attributed to the one that takes precedence",
+			slog.String("name", detection.Target.Name), slog.String("mac", d.redactor.Redact(detection.MAC)),
+			slog.String("ignored", strings.Join(detection.Overlaps, ", ")))
+	}
+}
+
+// errSourceFinished is returned by run once the beacon source given in the
+// run options has finished, and the doorbell has lingered.
+var errSourceFinished = errors.New("beacon source finished")
+
+// runSource runs the beacon source given in the run options. Once it has
+// sent its last beacon, the doorbell keeps running for the linger period
+// (eg. so notifications can be delivered), then stops.
+func (d *doorbell) runSource(ctx context.Context, beacons chan<- source.Beacon) error {
+	if err := d.opts.source.Run(ctx, beacons); err != nil {
+		return err
+	}
+
+	slog.Info("Sent the last beacon, waiting before stopping", slog.Duration("wait", d.opts.linger))
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d.opts.linger):
+		return errSourceFinished
+	}
+}
+
+// beaconDropped records a beacon that was dropped because the beacon queue
+// was full. Drops are logged periodically, rather than for every beacon.
+func (d *doorbell) beaconDropped(b source.Beacon) {
+	d.metrics.BeaconDropped()
+	d.dropped.Add(1)
+
+	if d.opts.onDropped != nil {
+		d.opts.onDropped(b)
+	}
+}
+
+// handle queues work for a target device. It runs after the previously
+// queued work for the same target (so eg. a departure can't overtake its
+// arrival), and in parallel with the work for other targets.
+func (d *doorbell) handle(ctx context.Context, name string, fn func()) {
+	if err := d.workers.Submit(ctx, name, fn); err != nil {
+		slog.Debug("Not handling event", slog.String("name", name), slog.Any("error", err))
+	}
+}
+
+// checkDepartures raises departure events for target devices that haven't
+// been seen within their absence timeout.
+func (d *doorbell) checkDepartures(ctx context.Context) {
+	now := time.Now()
+	for _, detection := range d.detector.Departures(now) {
+		d.handle(ctx, detection.Target.Name, func() {
+			d.handleDetection(ctx, detection, now)
+		})
+	}
+}
+
+func (d *doorbell) handleDetection(ctx context.Context, detection *detector.Detection, now time.Time) {
+	target := detection.Target
+	paused := d.isPaused()
+
+	// Only one detection of each visit rings the doorbell, even across
+	// restarts and instances.
+	var session string
+	if conf, _ := d.config(); conf.Visits != nil && detection.Event == latestconfig.EventDetected && detection.Notify && !paused {
+		s, ok := d.claimVisit(ctx, conf.Visits, detection, now)
+		if ok {
+			session = s.ID
+		} else {
+			slog.Info("Not ringing the doorbell, it already rang for this visit",
+				slog.String("name", target.Name), slog.String("instance", s.Instance))
+
+			detection.Notify = false
+			detection.Reason = visitRungReason(s.Instance)
+		}
+	}
+
+	// The sound is played before anything else, as recording the detection
+	// and rendering notifications would noticeably delay it.
+	soundFile, ring := doorbellSound(detection)
+	if ring && detection.Notify && !paused {
+		d.ring(soundFile, now)
+	}
+
+	record := history.Detection{
+		Time:     now,
+		Name:     target.Name,
+		MAC:      detection.MAC,
+		RSSI:     detection.RSSI,
+		Event:    string(detection.Event),
+		Notified: detection.Notify && !paused,
+	}
+	if err := d.history.Record(ctx, &record); err != nil {
+		slog.Warn("Failed to record detection", slog.Any("error", err))
+	}
+	d.publish(record)
+
+	switch detection.Event {
+	case latestconfig.EventArrived:
+		slog.Info("Target device arrived",
+			slog.String("name", target.Name), slog.String("mac", detection.MAC))
+		d.statusChanged()
+	case latestconfig.EventDeparted:
+		slog.Info("Target device departed",
+			slog.String("name", target.Name), slog.String("mac", detection.MAC))
+		d.statusChanged()
+	}
+
+	if !detection.Notify {
+		slog.Debug("Ignoring detection of device",
+			slog.String("name", target.Name), slog.String("mac", detection.MAC),
+			slog.String("event", string(detection.Event)),
+			slog.Int("rssi", detection.RSSI), slog.String("reason", detection.Reason))
+		return
+	}
+
+	switch detection.Event {
+	case latestconfig.EventButtonPressed:
+		slog.Info("Target device button pressed",
+			slog.String("name", target.Name), slog.String("mac", detection.MAC))
+	case latestconfig.EventArrived, latestconfig.EventDeparted:
+	case latestconfig.EventStationary:
+		slog.Warn("Target device has been stationary",
+			slog.String("name", target.Name), slog.String("mac", detection.MAC),
+			slog.Duration("after", target.StationaryAfter))
+	case latestconfig.EventLowBattery:
+		slog.Warn("Target device battery is low",
+			slog.String("name", target.Name), slog.String("mac", detection.MAC),
+			slog.Int("battery", detection.Battery))
+	default:
+		slog.Info("Detected target device",
+			slog.String("name", target.Name), slog.String("mac", detection.MAC), slog.Int("rssi", detection.RSSI))
+	}
+
+	title, message := d.texts.Render(target.Name, detection.Event, &notifier.TextData{
+		Name:       target.Name,
+		MAC:        d.redactor.Redact(detection.MAC),
+		RSSI:       detection.RSSI,
+		Time:       now.Local(),
+		CountToday: d.visitsToday(ctx, target.Name, now),
+		Battery:    detection.Battery,
+	})
+
+	// Arrivals coincide with a detection, so aren't worth listing separately.
+	if detection.Event != latestconfig.EventArrived {
+		d.addRecent(recentDetection{time: now, message: message, color: target.Color})
+	}
+
+	n := &notifier.Notification{
+		Event:    detection.Event,
+		Title:    title,
+		Message:  message,
+		Name:     target.Name,
+		Color:    target.Color,
+		MAC:      d.redactor.Redact(detection.MAC),
+		RSSI:     detection.RSSI,
+		Time:     now,
+		Instance: d.instance(),
+	}
+
+	// Actions (eg. opening the pet flap) still run while notifications are
+	// paused.
+	go d.actions.Run(ctx, n)
+
+	var overdue []event.Derived
+	for _, derived := range d.events.Derive(n) {
+		if derived.UnacknowledgedFor > 0 {
+			overdue = append(overdue, derived)
+			continue
+		}
+
+		if derived.With != nil && !d.correlator.Correlate(derived, detection.MAC) {
+			slog.Debug("Waiting for a correlated event",
+				slog.String("event", string(derived.Notification.Event)), slog.String("name", target.Name),
+				slog.Any("with", derived.With.Events), slog.Duration("within", derived.With.Within))
+			continue
+		}
+
+		d.raiseEvent(ctx, derived.Notification, detection.MAC)
+	}
+
+	d.observe(ctx, detection.Event, now)
+
+	if ring {
+		d.checkUnusualVisit(ctx, n, detection.MAC)
+	}
+
+	if paused {
+		slog.Info("Notifications are paused, not ringing the doorbell")
+		return
+	}
+
+	d.metrics.Detected(target.Name, string(detection.Event))
+
+	go d.notify(ctx, d.dispatcher, d.camera, n)
+
+	if ring {
+		v := d.startVisit(visit{time: now, name: target.Name, mac: detection.MAC, session: session})
+		for _, derived := range overdue {
+			d.scheduleOverdue(ctx, v, derived)
+		}
+	}
+}
+
+// doorbellSound returns the sound file a detection rings the doorbell with
+// (empty for the embedded sound), or false if it doesn't ring the doorbell.
+// Only detections and button presses ring the doorbell.
+func doorbellSound(detection *detector.Detection) (string, bool) {
+	switch detection.Event {
+	case latestconfig.EventButtonPressed:
+		return detection.Target.Sound.ButtonFile, true
+	case latestconfig.EventArrived, latestconfig.EventDeparted, latestconfig.EventStationary, latestconfig.EventLowBattery:
+		return "", false
+	default:
+		return detection.Target.Sound.File, true
+	}
+}
+
+// ring plays the doorbell sound, and records how long after the beacon was
+// received it is heard.
+func (d *doorbell) ring(soundFile string, received time.Time) {
+	if d.player == nil {
+		return
+	}
+
+	conf, _ := d.config()
+	if conf.Sound.FollowMe && !d.userPresent() {
+		return
+	}
+
+	if conf.Sound.QuietDuringCalls && inCall() {
+		return
+	}
+
+	if err := d.player.Play(soundFile); err != nil {
+		slog.Warn("Failed to play doorbell sound", slog.Any("error", err))
+		return
+	}
+
+	latency := time.Since(received) + d.player.Latency()
+	d.metrics.SoundPlayed(latency)
+
+	if latency > soundLatencyBudget {
+		slog.Warn("Doorbell sound was slow to play",
+			slog.Duration("latency", latency), slog.Duration("budget", soundLatencyBudget))
+	} else {
+		slog.Debug("Played doorbell sound", slog.Duration("latency", latency))
+	}
+}
+
+// userPresent returns whether the user has an active, unlocked desktop
+// session on this machine. If the session state can't be determined, the user
+// is assumed to be present, so that the doorbell isn't silenced by mistake.
+func (d *doorbell) userPresent() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), sessionCheckTimeout)
+	defer cancel()
+
+	state, err := session.Current(ctx)
+	if err != nil {
+		slog.Warn("Failed to get the session state, playing the doorbell sound", slog.Any("error", err))
+		return true
+	}
+
+	if state != session.Active {
+		slog.Info("Not playing the doorbell sound, the user isn't at this machine", slog.String("session", string(state)))
+		return false
+	}
+
+	return true
+}
+
+// inCall returns whether the user appears to be on a call. If that can't be
+// determined, they are assumed not to be.
+func inCall() bool {
+	using, err := session.InCall()
+	if err != nil {
+		slog.Warn("Failed to check for a call, playing the doorbell sound", slog.Any("error", err))
+		return false
+	}
+
+	if using != "" {
+		slog.Info("Not playing the doorbell sound during a call", slog.String("inUse", using))
+		return true
+	}
+
+	return false
+}
+
+// screenLock returns whether the screen is locked, or unknown if that can't be
+// determined. Without a desktop session (eg. once logged out), the screen is
+// considered locked, as nobody is at the machine.
+func screenLock() notifier.ScreenLock {
+	ctx, cancel := context.WithTimeout(context.Background(), sessionCheckTimeout)
+	defer cancel()
+
+	state, err := session.Current(ctx)
+	if err != nil {
+		slog.Warn("Failed to get the screen lock state, notifying regardless", slog.Any("error", err))
+		return notifier.ScreenLockUnknown
+	}
+
+	if state == session.Locked || state == session.None {
+		return notifier.ScreenLocked
+	}
+
+	return notifier.ScreenUnlocked
+}
+
+// visitsToday returns the number of times the target has rung the doorbell
+// since midnight.
+func (d *doorbell) visitsToday(ctx context.Context, name string, now time.Time) int {
+	year, month, day := now.Local().Date()
+
+	visits, err := d.history.List(ctx, history.Query{
+		Since:        time.Date(year, month, day, 0, 0, 0, 0, time.Local),
+		Name:         name,
+		NotifiedOnly: true,
+		Events:       []string{string(latestconfig.EventDetected), string(latestconfig.EventButtonPressed)},
+	})
+	if err != nil {
+		slog.Warn("Failed to count today's visits", slog.Any("error", err))
+		return 0
+	}
+
+	return len(visits)
+}
+
+// notify delivers a notification and records (and returns) the outcome for
+// each notifier. If the camera (which may be nil) captures the event, a
+// snapshot is attached to the notification first.
+func (d *doorbell) notify(ctx context.Context, dispatcher *notifier.Dispatcher, cam *camera.Camera, n *notifier.Notification) []notifier.Result {
+	if cam != nil && cam.Captures(n.Event) {
+		snapshot, err := cam.Snapshot(ctx)
+		if err != nil {
+			slog.Warn("Failed to fetch camera snapshot, notifying without it", slog.Any("error", err))
+		} else {
+			withSnapshot := *n
+			withSnapshot.Snapshot = snapshot
+			n = &withSnapshot
+		}
+	}
+
+	if dispatcher.ScreenAware() {
+		withScreen := *n
+		withScreen.Screen = screenLock()
+		n = &withScreen
+	}
+
+	results := dispatcher.Notify(ctx, n)
+	for _, result := range results {
+		d.metrics.NotificationDelivered(result.Notifier, result.Err)
+	}
+
+	return results
+}
+
+// TargetColors returns the accent colour of each target, by name.
+func (d *doorbell) TargetColors() map[string]string {
+	conf, _ := d.config()
+
+	colors := make(map[string]string, len(conf.Targets))
+	for _, t := range conf.Targets {
+		colors[t.Name] = t.Color
+	}
+
+	return colors
+}
+
+// PushEnabled returns true if a web push notifier is configured, so browsers
+// may subscribe to notifications.
+func (d *doorbell) PushEnabled() bool {
+	conf, _ := d.config()
+
+	return slices.ContainsFunc(conf.Notifiers, func(n latestconfig.NotifierConfig) bool {
+		return n.WebPush != nil
+	})
+}
+
+// Pause suppresses notifications for the given duration, or until Resume is
+// called if the duration is zero.
+func (d *doorbell) Pause(duration time.Duration) {
+	var until time.Time
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+
+	d.pauseUntil(until)
+
+	slog.Info("Paused notifications", slog.Duration("duration", duration))
+}
+
+// pauseUntil suppresses notifications until the given time, or until Resume
+// is called if the time is zero.
+func (d *doorbell) pauseUntil(until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.resumeTimer != nil {
+		d.resumeTimer.Stop()
+		d.resumeTimer = nil
+	}
+
+	d.paused = true
+	d.pausedUntil = until
+	if !until.IsZero() {
+		d.resumeTimer = time.AfterFunc(time.Until(until), d.expirePause)
+	}
+
+	d.notifyChanged()
+}
+
+// Resume re-enables notifications.
+func (d *doorbell) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.resumeLocked()
+}
+
+// expirePause resumes notifications if a timed pause has elapsed. The pause
+// may have been replaced since the timer was started, or if it is until a
+// time of day, the clock may have gone back.
+func (d *doorbell) expirePause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.pausedUntil.IsZero() {
+		return
+	}
+
+	if remaining := time.Until(d.pausedUntil); remaining > 0 {
+		d.resumeTimer.Reset(remaining)
+		return
+	}
+
+	d.resumeLocked()
+}
+
+func (d *doorbell) resumeLocked() {
+	if !d.paused {
+		return
+	}
+
+	if d.resumeTimer != nil {
+		d.resumeTimer.Stop()
+		d.resumeTimer = nil
+	}
+
+	d.paused = false
+	d.pausedUntil = time.Time{}
+
+	slog.Info("Resumed notifications")
+
+	d.notifyChanged()
+}
+
+// resumePausedUntil re-enables notifications if they are paused until the
+// given time, ie. the pause hasn't since been replaced or ended.
+func (d *doorbell) resumePausedUntil(until time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.paused && d.pausedUntil.Equal(until) {
+		d.resumeLocked()
+	}
+}
+
+// formatPausedUntil formats when notifications will resume, including the
+// date unless it is today.
+func formatPausedUntil(t time.Time) string {
+	t = t.Local()
+	if y, m, d := time.Now().Date(); t.Year() == y && t.Month() == m && t.Day() == d {
+		return t.Format(time.Kitchen)
+	}
+
+	return t.Format("Mon Jan 2 " + time.Kitchen)
+}
+
+func (d *doorbell) isPaused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.paused
+}
+
+func (d *doorbell) setBrokerStatus(status mqtt.Status) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if status.Connected && !d.broker.Connected && d.hasConnected {
+		d.metrics.MQTTReconnected()
+	}
+
+	// Beacons can't have been received while the broker was disconnected,
+	// so the gateway gets a full timeout to resume publishing them.
+	if status.Connected && !d.broker.Connected {
+		d.watchdog.since = time.Now()
+	}
+
+	for _, b := range status.Brokers {
+		d.metrics.BrokerConnected(b.Address, b.Connected)
+	}
+
+	d.broker = status
+	if status.Connected {
+		d.hasConnected = true
+	}
+	d.notifyChanged()
+}
+
+func (d *doorbell) addRecent(r recentDetection) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.recent = append([]recentDetection{r}, d.recent...)
+	if len(d.recent) > recentDetectionsLimit {
+		d.recent = d.recent[:recentDetectionsLimit]
+	}
+
+	d.notifyChanged()
+}
+
+// status returns a snapshot of the doorbell state.
+func (d *doorbell) status() doorbellStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	broker := d.broker.Address
+	if broker == "" {
+		broker = d.conf.Broker.Address
+	}
+
+	now := time.Now()
+	maintenance, maintenanceUntil := d.maintenanceLocked(now)
+
+	var devices []deviceStatus
+	for _, dev := range d.detector.Devices(now) {
+		devices = append(devices, deviceStatus{
+			Device:   dev,
+			visiting: d.visit != nil && d.visit.name == dev.Name,
+		})
+	}
+
+	return doorbellStatus{
+		broker:        broker,
+		brokers:       d.broker.Brokers,
+		connected:     d.broker.Connected,
+		reconnecting:  d.broker.Reconnecting,
+		brokerErr:     d.broker.Err,
+		paused:        d.paused,
+		pausedUntil:   d.pausedUntil,
+		recent:        slices.Clone(d.recent),
+		devices:       devices,
+		visit:         d.visit,
+		recording:     d.recordingPath,
+		beacons:       d.watchdog.origins(),
+		gatewaySilent: d.watchdog.silent,
+
+		maintenance:      maintenance,
+		maintenanceUntil: maintenanceUntil,
+		expectingUntil:   d.expect.until,
+	}
+}
+
+// metricsDevices returns the state of each target device for the metrics.
+func (d *doorbell) metricsDevices() []metrics.Device {
+	var devices []metrics.Device
+	for _, dev := range d.status().devices {
+		devices = append(devices, metrics.Device{
+			Name:          dev.Name,
+			LastSeen:      dev.LastSeen,
+			RSSI:          dev.RSSI,
+			Present:       dev.Present,
+			Battery:       dev.Battery,
+			CooldownUntil: dev.CooldownUntil,
+			Visiting:      dev.visiting,
+		})
+	}
+
+	return devices
+}
+
+// statusChanged signals that the presence or battery level of a target has
+// changed.
+func (d *doorbell) statusChanged() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.notifyChanged()
+}
+
+// Subscribe returns a channel that receives every recorded event (with
+// redacted MAC addresses), and a function to unsubscribe. Events are dropped
+// if the subscriber falls behind.
+func (d *doorbell) Subscribe() (<-chan history.Detection, func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.subscribers == nil {
+		d.subscribers = make(map[chan history.Detection]struct{})
+	}
+
+	events := make(chan history.Detection, 16)
+	d.subscribers[events] = struct{}{}
+
+	return events, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		delete(d.subscribers, events)
+	}
+}
+
+// publish sends an event to the subscribers.
+func (d *doorbell) publish(event history.Detection) {
+	event.MAC = d.RedactMAC(event.MAC)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for events := range d.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// instance returns the name of the doorbell instance.
+func (d *doorbell) instance() string {
+	conf, _ := d.config()
+	return conf.InstanceName()
+}
+
+// RedactMAC redacts a MAC address according to the privacy configuration.
+func (d *doorbell) RedactMAC(mac string) string {
+	conf, _ := d.config()
+	return conf.Privacy.MACRedactor().Redact(mac)
+}
+
+// notifyChanged signals that the status has changed, the caller must hold
+// the lock.
+func (d *doorbell) notifyChanged() {
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+// unpackAsset extracts an embedded asset to a file, replaced in tests.
+var unpackAsset = assets.Unpack
+
+// unpackIcon extracts the notification icon to a temporary directory. The
+// returned function removes the directory.
+func unpackIcon() (string, func(), error) {
+	tempDir, err := os.MkdirTemp("", "cat-doorbell")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	catIconPath := filepath.Join(tempDir, "cat-icon.png")
+	if err := unpackAsset("cat-icon.png", catIconPath); err != nil {
+		_ = os.RemoveAll(tempDir)
+		return "", nil, fmt.Errorf("failed to unpack cat icon: %w", err)
+	}
+
+	return catIconPath, func() { _ = os.RemoveAll(tempDir) }, nil
+}
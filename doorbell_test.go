@@ -0,0 +1,309 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/control"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+)
+
+// fakePlayer stands in for the speaker.
+type fakePlayer struct {
+	// latency is how long after Play the sound is heard.
+	latency time.Duration
+	// played is when Play was last called.
+	played time.Time
+	closed bool
+}
+
+func (p *fakePlayer) Play(string) error {
+	p.played = time.Now()
+	return nil
+}
+
+func (p *fakePlayer) Update(*latestconfig.Config) error { return nil }
+func (p *fakePlayer) Latency() time.Duration            { return p.latency }
+func (p *fakePlayer) Close()                            { p.closed = true }
+
+// failingSource is a beacon source that fails to connect to its broker.
+type failingSource struct {
+	err error
+}
+
+func (s failingSource) Run(context.Context, chan<- source.Beacon) error {
+	return s.err
+}
+
+// startupTest is a doorbell with all of its state in a temporary directory.
+type startupTest struct {
+	conf *latestconfig.Config
+	opts runOptions
+	// player is the speaker opened by the doorbell, or nil if it fails to
+	// open.
+	player *fakePlayer
+	// tempDir is where the notification icon is unpacked.
+	tempDir string
+}
+
+func newStartupTest(t *testing.T) *startupTest {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	// The notification icon is unpacked to the temporary directory.
+	tempDir := filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tempDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TMPDIR", tempDir)
+
+	conf := &latestconfig.Config{
+		Targets: []latestconfig.TargetConfig{{Name: "Mittens", MAC: "AA:BB:CC:DD:EE:FF"}},
+	}
+	conf.PopulateTypeMeta()
+	conf.PopulateDefaults()
+	conf.Web.ListenAddress = ""
+	conf.Metrics.ListenAddress = ""
+	// Desktop notifications aren't supported by every build.
+	conf.Notifiers = nil
+	conf.History = latestconfig.HistoryConfig{Backend: latestconfig.HistoryBackendSQLite}
+
+	st := &startupTest{
+		conf: conf,
+		opts: runOptions{
+			historyPath:   filepath.Join(dir, "history.db"),
+			queuePath:     filepath.Join(dir, "notification-queue.json"),
+			pushDir:       filepath.Join(dir, "push"),
+			visitsPath:    filepath.Join(dir, "visits.json"),
+			controlSocket: filepath.Join(dir, "control.sock"),
+			source:        failingSource{err: errors.New("not expected to run")},
+		},
+		player:  &fakePlayer{},
+		tempDir: tempDir,
+	}
+
+	backend, prevPlayer := featureAudio.backend, newPlayer
+	featureAudio.register("fake")
+	newPlayer = func(*latestconfig.Config) (player, error) {
+		return st.player, nil
+	}
+	t.Cleanup(func() {
+		featureAudio.backend, newPlayer = backend, prevPlayer
+	})
+
+	return st
+}
+
+// checkReleased checks that the resources acquired by open were released.
+func (st *startupTest) checkReleased(t *testing.T) {
+	t.Helper()
+
+	// Another instance can only listen on the control socket once it has
+	// been closed.
+	ctrl, err := control.Listen(st.opts.controlSocket, nil)
+	if err != nil {
+		t.Errorf("control socket wasn't released: %v", err)
+	} else {
+		_ = ctrl.Close()
+	}
+
+	if st.player != nil && !st.player.closed {
+		t.Error("speaker wasn't closed")
+	}
+
+	entries, err := os.ReadDir(st.tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) > 0 {
+		t.Errorf("notification icon wasn't removed, found %s", entries[0].Name())
+	}
+}
+
+func TestOpenMissingAsset(t *testing.T) {
+	st := newStartupTest(t)
+
+	prev := unpackAsset
+	unpackAsset = func(name, _ string) error {
+		return fmt.Errorf("failed to open %s: %w", name, fs.ErrNotExist)
+	}
+	t.Cleanup(func() { unpackAsset = prev })
+
+	d := newDoorbell(st.conf, st.opts)
+	if err := d.open(); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("open() = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	st.checkReleased(t)
+}
+
+func TestOpenSpeakerFailure(t *testing.T) {
+	errSpeaker := errors.New("no audio output device")
+
+	t.Run("desktop", func(t *testing.T) {
+		st := newStartupTest(t)
+		st.player = nil
+		newPlayer = func(*latestconfig.Config) (player, error) {
+			return nil, errSpeaker
+		}
+
+		d := newDoorbell(st.conf, st.opts)
+		if err := d.open(); !errors.Is(err, errSpeaker) {
+			t.Fatalf("open() = %v, want %v", err, errSpeaker)
+		}
+
+		st.checkReleased(t)
+	})
+
+	// Headless machines often don't have audio, so the doorbell carries on
+	// without sound.
+	t.Run("headless", func(t *testing.T) {
+		st := newStartupTest(t)
+		st.player = nil
+		st.opts.headless = true
+		newPlayer = func(*latestconfig.Config) (player, error) {
+			return nil, errSpeaker
+		}
+
+		d := newDoorbell(st.conf, st.opts)
+		if err := d.open(); err != nil {
+			t.Fatalf("open() failed: %v", err)
+		}
+		if d.player != nil {
+			t.Error("open() set a player without a speaker")
+		}
+
+		d.close()
+		st.checkReleased(t)
+	})
+}
+
+func TestRunBrokerFailure(t *testing.T) {
+	st := newStartupTest(t)
+
+	// Nothing listens on the port once the listener is closed, so the
+	// connection is refused.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	st.opts.source = nil
+	st.conf.Broker.Address = "tcp://" + addr
+	st.conf.Broker.ConnectRetryInterval = 50 * time.Millisecond
+
+	d := newDoorbell(st.conf, st.opts)
+	if err := d.open(); err != nil {
+		t.Fatalf("open() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.run(ctx)
+	}()
+
+	// A single broker is retried until it can be connected to, so the
+	// failure is reported in the status rather than stopping the doorbell.
+	for {
+		status := d.status()
+		if status.reconnecting && status.brokerErr != nil {
+			break
+		}
+
+		select {
+		case err := <-done:
+			t.Fatalf("run() = %v before the broker failure was reported", err)
+		case <-ctx.Done():
+			t.Fatal("broker failure wasn't reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("run() = %v, want %v", err, context.Canceled)
+	}
+
+	d.close()
+	st.checkReleased(t)
+}
+
+func TestHandleDetectionLatency(t *testing.T) {
+	tests := []struct {
+		name   string
+		visits *latestconfig.VisitsConfig
+	}{
+		{name: "Without visits"},
+		{name: "Visits tracked across restarts", visits: &latestconfig.VisitsConfig{
+			ClaimDelay: latestconfig.DefaultVisitClaimDelay,
+		}},
+		{name: "Visits shared without peers", visits: &latestconfig.VisitsConfig{
+			Topic:      "cat-doorbell/visits",
+			ClaimDelay: latestconfig.DefaultVisitClaimDelay,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newStartupTest(t)
+			// As long as the speaker's default buffer.
+			st.player.latency = 100 * time.Millisecond
+			st.conf.Visits = tt.visits
+
+			d := newDoorbell(st.conf, st.opts)
+			if err := d.open(); err != nil {
+				t.Fatalf("open() failed: %v", err)
+			}
+			defer d.close()
+
+			now := time.Now()
+			detections := d.detector.Observe(source.Beacon{MAC: "AA:BB:CC:DD:EE:FF", RSSI: -60}, now)
+			if len(detections) != 1 || !detections[0].Notify {
+				t.Fatalf("Observe() = %v, want a detection that rings the doorbell", detections)
+			}
+
+			d.handleDetection(context.Background(), detections[0], now)
+
+			if st.player.played.IsZero() {
+				t.Fatal("the doorbell sound wasn't played")
+			}
+
+			latency := st.player.played.Sub(now) + st.player.Latency()
+			if latency > soundLatencyBudget {
+				t.Errorf("latency = %s, want at most %s", latency, soundLatencyBudget)
+			}
+		})
+	}
+}
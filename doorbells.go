@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+// PressDoorbell rings the doorbell and raises a "doorbellPressed" event on
+// behalf of another doorbell (eg. a Ring or Reolink video doorbell), unless
+// it was pressed within its cooldown. It returns false if there is no
+// doorbell with the given name.
+func (d *doorbell) PressDoorbell(ctx context.Context, name string) bool {
+	conf, _ := d.config()
+	i := slices.IndexFunc(conf.Doorbells, func(b latestconfig.DoorbellConfig) bool {
+		return b.Name == name
+	})
+	if i == -1 {
+		return false
+	}
+	bell := conf.Doorbells[i]
+
+	now := time.Now()
+
+	d.mu.Lock()
+	last, ok := d.doorbellsPressed[name]
+	repeated := ok && now.Sub(last) < bell.Cooldown
+	if !repeated {
+		d.doorbellsPressed[name] = now
+	}
+	d.mu.Unlock()
+
+	if repeated {
+		slog.Debug("Ignoring repeated doorbell press",
+			slog.String("name", name), slog.Time("lastPressed", last))
+		return true
+	}
+
+	d.handle(ctx, name, func() {
+		if !d.isPaused() {
+			d.ring(bell.SoundFile, now)
+		}
+
+		title, message := d.texts.Render(name, latestconfig.EventDoorbellPressed, &notifier.TextData{
+			Name: name,
+			Time: now.Local(),
+		})
+
+		d.raiseEvent(ctx, &notifier.Notification{
+			Event:    latestconfig.EventDoorbellPressed,
+			Title:    title,
+			Message:  message,
+			Name:     name,
+			Time:     now,
+			Instance: d.instance(),
+		}, "")
+	})
+
+	return true
+}
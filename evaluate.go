@@ -0,0 +1,422 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/action"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/control"
+	"github.com/dpeckett/cat-doorbell/internal/detector"
+	"github.com/dpeckett/cat-doorbell/internal/event"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+	"github.com/dpeckett/cat-doorbell/internal/visits"
+	"github.com/dpeckett/cat-doorbell/internal/web"
+	"github.com/urfave/cli/v2"
+)
+
+func evaluateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "evaluate",
+		Usage: "Show which events a hypothetical beacon would raise and why, without ringing the doorbell",
+		Description: "If cat-doorbell is running, the beacon is evaluated against its current state (eg. when each\n" +
+			"target was last detected). Otherwise (or with --offline) it is evaluated against the configuration,\n" +
+			"as the first beacon received after starting. Nothing is notified, run or recorded either way.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "mac",
+				Usage:    "MAC address of the device",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "rssi",
+				Usage: "Signal strength of the beacon in dBm (0 if unknown)",
+				Value: -60,
+			},
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "Advertised local name of the device",
+			},
+			&cli.StringFlag{
+				Name:  "time",
+				Usage: "When the beacon is received, as an RFC 3339 timestamp or a time of day today (eg. 22:30)",
+			},
+			&cli.BoolFlag{
+				Name:  "button",
+				Usage: "Report a button press in the beacon",
+			},
+			&cli.IntFlag{
+				Name:  "battery",
+				Usage: "Battery level reported by the beacon in percent",
+			},
+			&cli.BoolFlag{
+				Name:  "offline",
+				Usage: "Evaluate against the configuration, rather than the running instance",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output the evaluation as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			b := web.Beacon{
+				MAC:    c.String("mac"),
+				RSSI:   c.Int("rssi"),
+				Name:   c.String("name"),
+				Button: c.Bool("button"),
+			}
+
+			if c.IsSet("battery") {
+				battery := c.Int("battery")
+				b.Battery = &battery
+			}
+
+			if c.IsSet("time") {
+				t, err := parseEvaluationTime(c.String("time"), time.Now())
+				if err != nil {
+					return err
+				}
+				b.Time = &t
+			}
+
+			var evaluation *web.Evaluation
+			var err error
+			if !c.Bool("offline") {
+				evaluation, err = controlClient(c).Evaluate(c.Context, b)
+			}
+			if c.Bool("offline") || errors.Is(err, control.ErrNotRunning) {
+				evaluation, err = evaluateOffline(c, b)
+			}
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(evaluation)
+			}
+
+			return printEvaluation(evaluation)
+		},
+	}
+}
+
+// evaluateOffline evaluates a beacon against the configuration, as the first
+// beacon received after starting.
+func evaluateOffline(c *cli.Context, b web.Beacon) (*web.Evaluation, error) {
+	conf, err := readConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	notifiers := conf.Notifiers
+	if isHeadless(c) {
+		notifiers = slices.DeleteFunc(slices.Clone(notifiers), func(n latestconfig.NotifierConfig) bool {
+			return n.Desktop != nil
+		})
+	}
+
+	dispatcher, err := notifier.NewDispatcher(notifiers, "", nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifiers: %w", err)
+	}
+
+	actions, err := action.NewRunner(conf.Actions)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := event.NewDeriver(conf.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &evaluator{
+		detector:   detector.New(conf.Targets),
+		events:     events,
+		correlator: event.NewCorrelator(),
+		dispatcher: dispatcher,
+		actions:    actions,
+		instance:   conf.InstanceName(),
+	}
+
+	evaluation, err := e.evaluate(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &evaluation, nil
+}
+
+// parseEvaluationTime parses an RFC 3339 timestamp, or a time of day (eg.
+// "22:30") on the day of now.
+func parseEvaluationTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	clock, err := time.ParseInLocation("15:04", s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected an RFC 3339 timestamp or a time of day (eg. 22:30)", s)
+	}
+
+	year, month, day := now.Local().Date()
+
+	return time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, time.Local), nil
+}
+
+func printEvaluation(evaluation *web.Evaluation) error {
+	if evaluation.Target == "" {
+		fmt.Printf("%s doesn't match any target, so the beacon would be ignored\n", evaluation.MAC)
+		return nil
+	}
+
+	fmt.Printf("%s matches target %q at %s\n", evaluation.MAC, evaluation.Target,
+		evaluation.Time.Local().Format(time.DateTime))
+	if len(evaluation.Overlaps) > 0 {
+		fmt.Printf("It also matches %s, but %q takes precedence\n",
+			strings.Join(evaluation.Overlaps, ", "), evaluation.Target)
+	}
+	if evaluation.Paused {
+		fmt.Println("Notifications are paused")
+	}
+	fmt.Println()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EVENT\tRSSI\tNOTIFY\tRING\tNOTIFIERS\tACTIONS\tREASON")
+	for _, e := range evaluation.Events {
+		name := e.Event
+		if e.DerivedFrom != "" {
+			name = fmt.Sprintf("%s (from %s)", e.Event, e.DerivedFrom)
+		}
+
+		rssi := "-"
+		if e.RSSI != 0 {
+			rssi = fmt.Sprint(e.RSSI)
+		}
+
+		actions := e.Actions
+		for _, a := range e.RateLimitedActions {
+			actions = append(actions, a+" (rate limited)")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%s\t%s\t%s\n", name, rssi, e.Notify, e.Ring,
+			orDash(strings.Join(e.Notifiers, ", ")), orDash(strings.Join(actions, ", ")), orDash(e.Reason))
+	}
+
+	return w.Flush()
+}
+
+// evaluationRequest asks the beacon handling loop to evaluate a beacon.
+type evaluationRequest struct {
+	beacon web.Beacon
+	reply  chan evaluationReply
+}
+
+type evaluationReply struct {
+	evaluation web.Evaluation
+	err        error
+}
+
+// Evaluate works out what receiving a beacon would do, given the current
+// state of the targets, without ringing the doorbell, notifying, running
+// actions or changing any state.
+func (d *doorbell) Evaluate(ctx context.Context, b web.Beacon) (web.Evaluation, error) {
+	reply := make(chan evaluationReply, 1)
+
+	select {
+	case <-ctx.Done():
+		return web.Evaluation{}, ctx.Err()
+	case d.evaluations <- evaluationRequest{beacon: b, reply: reply}:
+	}
+
+	select {
+	case <-ctx.Done():
+		return web.Evaluation{}, ctx.Err()
+	case r := <-reply:
+		return r.evaluation, r.err
+	}
+}
+
+// handleEvaluation evaluates a beacon. It runs on the beacon handling loop,
+// so the configuration can't be reloaded underneath it.
+func (d *doorbell) handleEvaluation(req evaluationRequest) {
+	e := &evaluator{
+		detector:   d.detector,
+		events:     d.events,
+		correlator: d.correlator,
+		dispatcher: d.dispatcher,
+		actions:    d.actions,
+		paused:     d.isPaused(),
+		instance:   d.instance(),
+	}
+
+	if conf, _ := d.config(); conf.Visits != nil {
+		e.visits = d.visits
+	}
+
+	evaluation, err := e.evaluate(req.beacon)
+	req.reply <- evaluationReply{evaluation: evaluation, err: err}
+}
+
+// evaluator works out what receiving a beacon would do, following the same
+// rules as handleDetection.
+type evaluator struct {
+	detector   *detector.Detector
+	events     *event.Deriver
+	correlator *event.Correlator
+	dispatcher *notifier.Dispatcher
+	actions    *action.Runner
+	// paused is true if notifications are paused.
+	paused   bool
+	instance string
+	// visits holds the visit sessions, or is nil if they aren't kept track
+	// of.
+	visits *visits.Store
+}
+
+func (e *evaluator) evaluate(b web.Beacon) (web.Evaluation, error) {
+	mac, err := util.NormalizeMAC(b.MAC)
+	if err != nil {
+		return web.Evaluation{}, fmt.Errorf("%w: %w", web.ErrInvalidBeacon, err)
+	}
+
+	evaluation := web.Evaluation{Time: time.Now(), MAC: mac, Paused: e.paused, Events: []web.EvaluatedEvent{}}
+	if b.Time != nil {
+		evaluation.Time = *b.Time
+	}
+
+	detections := e.detector.Evaluate(source.Beacon{
+		MAC:     mac,
+		RSSI:    b.RSSI,
+		Name:    b.Name,
+		Button:  b.Button,
+		Battery: b.Battery,
+	}, evaluation.Time)
+
+	for _, detection := range detections {
+		target := detection.Target
+		evaluation.Target = target.Name
+		evaluation.Overlaps = detection.Overlaps
+
+		if e.visits != nil && detection.Event == latestconfig.EventDetected && detection.Notify && !e.paused {
+			if s, ok := e.visits.Current(target.Name); ok && s.Active(evaluation.Time, target.DetectionTimeout) {
+				detection.Notify = false
+				detection.Reason = visitRungReason(s.Instance)
+			}
+		}
+
+		_, ring := doorbellSound(detection)
+		evaluated := web.EvaluatedEvent{
+			Event:  string(detection.Event),
+			RSSI:   detection.RSSI,
+			Notify: detection.Notify,
+			Reason: detection.Reason,
+			Ring:   ring && detection.Notify && !e.paused,
+		}
+
+		if !detection.Notify {
+			evaluation.Events = append(evaluation.Events, evaluated)
+			continue
+		}
+
+		n := &notifier.Notification{
+			Event:    detection.Event,
+			Name:     target.Name,
+			Color:    target.Color,
+			MAC:      detection.MAC,
+			RSSI:     detection.RSSI,
+			Time:     evaluation.Time,
+			Instance: e.instance,
+		}
+		if e.dispatcher.ScreenAware() {
+			n.Screen = screenLock()
+		}
+
+		e.deliver(&evaluated, n)
+		evaluation.Events = append(evaluation.Events, evaluated)
+
+		for _, derived := range e.events.Derive(n) {
+			evaluatedDerived := web.EvaluatedEvent{
+				Event:       string(derived.Notification.Event),
+				DerivedFrom: string(detection.Event),
+				RSSI:        detection.RSSI,
+				Notify:      true,
+			}
+
+			// While paused, deliver gives that as the reason instead.
+			switch {
+			case derived.UnacknowledgedFor > 0 && !ring:
+				evaluatedDerived.Notify = false
+				evaluatedDerived.Reason = "the event doesn't start a visit to go unacknowledged"
+			case derived.UnacknowledgedFor > 0 && !e.paused:
+				evaluatedDerived.Notify = false
+				evaluatedDerived.Reason = fmt.Sprintf("raised if the visit goes unacknowledged for %s", derived.UnacknowledgedFor)
+			case derived.With != nil && !e.correlator.Correlated(derived):
+				evaluatedDerived.Notify = false
+				evaluatedDerived.Reason = fmt.Sprintf("raised if %s occurs within %s",
+					joinEvents(derived.With.Events), derived.With.Within)
+			}
+
+			e.deliver(&evaluatedDerived, derived.Notification)
+			evaluation.Events = append(evaluation.Events, evaluatedDerived)
+		}
+	}
+
+	return evaluation, nil
+}
+
+// deliver adds the actions an event would run and the notifiers it would be
+// delivered to. Actions run while notifications are paused, but nothing is
+// delivered.
+func (e *evaluator) deliver(evaluated *web.EvaluatedEvent, n *notifier.Notification) {
+	evaluated.Actions, evaluated.RateLimitedActions = e.actions.Triggered(n)
+
+	if e.paused {
+		if evaluated.Notify {
+			evaluated.Notify = false
+			evaluated.Reason = "notifications are paused"
+		}
+
+		return
+	}
+
+	evaluated.Notifiers = e.dispatcher.Subscribed(n)
+}
+
+func joinEvents(events []latestconfig.EventType) string {
+	names := make([]string, 0, len(events))
+	for _, e := range events {
+		names = append(names, string(e))
+	}
+
+	return strings.Join(names, " or ")
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/event"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+// overdueVisit is a custom event raised if a visit is still unacknowledged.
+type overdueVisit struct {
+	visit        *visit
+	notification *notifier.Notification
+}
+
+// raiseEvent records and delivers an event that doesn't ring the doorbell,
+// such as a custom event or an anomaly.
+func (d *doorbell) raiseEvent(ctx context.Context, n *notifier.Notification, mac string) {
+	paused := d.isPaused()
+
+	slog.Info("Raised event",
+		slog.String("event", string(n.Event)), slog.String("name", n.Name), slog.String("mac", mac))
+
+	record := history.Detection{
+		Time:     n.Time,
+		Name:     n.Name,
+		MAC:      mac,
+		RSSI:     n.RSSI,
+		Event:    string(n.Event),
+		Notified: !paused,
+	}
+	if err := d.history.Record(ctx, &record); err != nil {
+		slog.Warn("Failed to record event", slog.Any("error", err))
+	}
+	d.publish(record)
+
+	go d.actions.Run(ctx, n)
+
+	d.observe(ctx, n.Event, n.Time)
+
+	if paused {
+		return
+	}
+
+	d.metrics.Detected(n.Name, string(n.Event))
+
+	go d.notify(ctx, d.dispatcher, d.camera, n)
+}
+
+// scheduleOverdue raises a custom event once the visit has gone
+// unacknowledged for long enough (which may be immediately, for a visit
+// restored after a restart).
+func (d *doorbell) scheduleOverdue(ctx context.Context, v *visit, derived event.Derived) {
+	time.AfterFunc(time.Until(v.time.Add(derived.UnacknowledgedFor)), func() {
+		select {
+		case d.overdue <- overdueVisit{visit: v, notification: derived.Notification}:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// raiseOverdue raises the custom event of an overdue visit, unless the visit
+// has been acknowledged (or replaced) in the meantime.
+func (d *doorbell) raiseOverdue(ctx context.Context, o overdueVisit) {
+	if !d.isCurrentVisit(o.visit) {
+		return
+	}
+
+	n := *o.notification
+	n.Time = time.Now()
+
+	d.raiseEvent(ctx, &n, o.visit.mac)
+
+	if o.visit.session != "" {
+		d.remindSession(ctx, o.visit.session, n.Event)
+	}
+}
+
+// observe records that an event occurred, raising the custom events that were
+// waiting for it.
+func (d *doorbell) observe(ctx context.Context, event latestconfig.EventType, at time.Time) {
+	for _, c := range d.correlator.Observe(event, at) {
+		slog.Debug("Correlated event occurred",
+			slog.String("event", string(c.Notification.Event)), slog.String("with", string(event)))
+
+		d.raiseEvent(ctx, c.Notification, c.MAC)
+	}
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// expect is expect mode, during which detection is more sensitive so the
+// cat is noticed as early as possible. It is guarded by the doorbell's mutex.
+type expect struct {
+	// until is when expect mode ends, or zero if it isn't active.
+	until time.Time
+	// timer ends expect mode once it has elapsed.
+	timer *time.Timer
+}
+
+// StartExpecting starts expect mode for the given duration, or for the
+// configured duration if it is zero. Starting it again extends (or shortens)
+// it rather than adding to it.
+func (d *doorbell) StartExpecting(duration time.Duration) {
+	d.mu.Lock()
+	if duration <= 0 {
+		duration = d.conf.Expect.Duration
+	}
+
+	if d.expect.timer != nil {
+		d.expect.timer.Stop()
+	}
+
+	d.expect = expect{
+		until: time.Now().Add(duration),
+		timer: time.AfterFunc(duration, d.expireExpecting),
+	}
+	d.updateTargetsLocked()
+	d.notifyChanged()
+	d.mu.Unlock()
+
+	slog.Info("Started expecting the cat", slog.Duration("duration", duration))
+}
+
+// StopExpecting ends expect mode early.
+func (d *doorbell) StopExpecting() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.stopExpectingLocked()
+}
+
+// expireExpecting ends expect mode once it has elapsed. It may have been
+// extended since the timer was started, or the clock may have gone back.
+func (d *doorbell) expireExpecting() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.expect.until.IsZero() {
+		return
+	}
+
+	if remaining := time.Until(d.expect.until); remaining > 0 {
+		d.expect.timer.Reset(remaining)
+		return
+	}
+
+	d.stopExpectingLocked()
+}
+
+func (d *doorbell) stopExpectingLocked() {
+	if d.expect.until.IsZero() {
+		return
+	}
+
+	d.expect.timer.Stop()
+	d.expect = expect{}
+	d.updateTargetsLocked()
+
+	slog.Info("Stopped expecting the cat")
+
+	d.notifyChanged()
+}
+
+// updateTargetsLocked applies the configured targets to the detector, made
+// more sensitive while expect mode is active. The doorbell's mutex must be
+// held.
+func (d *doorbell) updateTargetsLocked() {
+	if d.expect.until.IsZero() {
+		d.detector.Update(d.conf.Targets)
+		return
+	}
+
+	d.detector.Update(expectTargets(d.conf.Targets, d.conf.Expect))
+}
+
+// expectTargets returns copies of the targets made more sensitive for expect
+// mode: their RSSI thresholds are lowered, their detection timeouts are
+// shortened, and a single beacon rings the doorbell.
+func expectTargets(targets []latestconfig.TargetConfig, conf latestconfig.ExpectConfig) []latestconfig.TargetConfig {
+	expecting := make([]latestconfig.TargetConfig, len(targets))
+	for i, t := range targets {
+		// A zero threshold means every beacon is close enough already.
+		if t.RSSIThreshold != 0 {
+			t.RSSIThreshold -= conf.RSSIOffset
+		}
+		t.DetectionTimeout = min(t.DetectionTimeout, conf.DetectionTimeout)
+		t.MinBeacons = 1
+		expecting[i] = t
+	}
+
+	return expecting
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/webpush"
+	"github.com/urfave/cli/v2"
+)
+
+// feature is an optional subsystem that can be left out of the binary with a
+// build tag, so that slim builds (eg. for headless servers) don't depend on
+// cgo audio or GUI libraries. Each feature registers its implementation from
+// files that are only built without its tag.
+type feature struct {
+	name string
+	// tag is the build tag that leaves the feature out.
+	tag string
+	// backend names the registered implementation, or is empty if the feature
+	// was left out.
+	backend string
+}
+
+var (
+	featureAudio     = &feature{name: "audio", tag: "noaudio"}
+	featureBluetooth = &feature{name: "bluetooth", tag: "noble"}
+	featureGUI       = &feature{name: "gui", tag: "nogui"}
+	featureWeb       = &feature{name: "web", tag: "noweb"}
+)
+
+// features lists the optional features, in the order they are reported.
+var features = []*feature{featureAudio, featureBluetooth, featureGUI, featureWeb}
+
+// register records that the feature is built in, using the named backend.
+func (f *feature) register(backend string) {
+	f.backend = backend
+}
+
+// enabled returns whether the feature is built in.
+func (f *feature) enabled() bool {
+	return f.backend != ""
+}
+
+// check returns an error if the feature was left out of the binary.
+func (f *feature) check() error {
+	if !f.enabled() {
+		return fmt.Errorf("%s support is not included in this build (built with the %q tag)", f.name, f.tag)
+	}
+
+	return nil
+}
+
+// The implementations of the optional features, which are nil unless the
+// feature is built in.
+var (
+	// newPlayer initializes the speaker.
+	newPlayer func(conf *latestconfig.Config) (player, error)
+	// audioDevices lists the audio output devices.
+	audioDevices func() ([]audioDevice, error)
+	// newScanner creates a beacon source that scans for devices using the
+	// host's Bluetooth adapter.
+	newScanner func(serviceUUIDs, buttonMACs []string) (source.Source, error)
+	// checkAdapter checks that the host's Bluetooth adapter can be used.
+	checkAdapter func() error
+	// newWebServer creates the web dashboard and API server.
+	newWebServer func(conf *latestconfig.Config, history history.Store, push *webpush.Service, d *doorbell, certDir string) (server, error)
+	// runTray runs the doorbells returned (and opened) by start with a
+	// system tray icon. If start fails (eg. because the configuration is
+	// invalid), the tray shows the error until the doorbells can be started.
+	runTray func(c *cli.Context, start func() ([]*doorbell, error), logFilePath string) error
+	// runSettings shows the settings window for the configuration file at
+	// the given path, until it is closed.
+	runSettings func(configPath string) error
+	// runErrorDialog shows a window explaining why the doorbell stopped,
+	// offering to open the log file at the given path, until it is closed.
+	runErrorDialog func(message, logFilePath string) error
+)
+
+// player plays doorbell sounds.
+type player interface {
+	// Play starts playing the sound file at the given path, or the embedded
+	// doorbell sound if the path is empty.
+	Play(path string) error
+	// Update applies the sound settings of the configuration.
+	Update(conf *latestconfig.Config) error
+	// Latency returns how long it takes at most for a sound to be heard once
+	// it starts playing.
+	Latency() time.Duration
+	// Close closes the speaker.
+	Close()
+}
+
+// audioDevice is an audio output device.
+type audioDevice struct {
+	// Name identifies the device in the configuration.
+	Name string
+	// Description is the human readable name of the device.
+	Description string
+}
+
+// server is a long running server.
+type server interface {
+	Run(ctx context.Context) error
+}
@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+	"github.com/urfave/cli/v2"
+)
+
+func historyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Usage: "Show the history of detected devices",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Only show detections after a duration ago (eg. 24h) or RFC 3339 timestamp",
+			},
+			&cli.StringFlag{
+				Name:  "mac",
+				Usage: "Only show detections of the device with the given MAC address",
+			},
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "Include detections that didn't ring the doorbell",
+			},
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "Maximum number of detections to show (0 for no limit)",
+				Value: 100,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output detections as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			q := history.Query{
+				NotifiedOnly: !c.Bool("all"),
+				Limit:        c.Int("limit"),
+			}
+
+			if since := c.String("since"); since != "" {
+				var err error
+				q.Since, err = parseSince(since, time.Now())
+				if err != nil {
+					return err
+				}
+			}
+
+			if mac := c.String("mac"); mac != "" {
+				var err error
+				q.MAC, err = util.NormalizeMAC(mac)
+				if err != nil {
+					return err
+				}
+			}
+
+			conf, err := readConfig(c)
+			if err != nil {
+				return err
+			}
+
+			store, err := history.Open(conf.History, c.String("history-file"))
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			detections, err := store.List(c.Context, q)
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if detections == nil {
+					detections = []history.Detection{}
+				}
+				return enc.Encode(detections)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tNAME\tMAC\tEVENT\tRSSI\tNOTIFIED")
+			for _, d := range detections {
+				rssi := "-"
+				if d.RSSI != 0 {
+					rssi = strconv.Itoa(d.RSSI)
+				}
+
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\n",
+					d.Time.Format(time.DateTime), d.Name, d.MAC, d.Event, rssi, d.Notified)
+			}
+
+			return w.Flush()
+		},
+	}
+}
+
+// parseSince parses either a duration (relative to now) or an RFC 3339 timestamp.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since value %q: expected a duration or RFC 3339 timestamp", since)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/dpeckett/cat-doorbell/internal/config"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/homeassistant"
+)
+
+// loadConfigFiles loads the layered configuration files and overrides. When
+// running as a Home Assistant add-on without a configured broker, the broker
+// provided by the Supervisor is used.
+func loadConfigFiles(ctx context.Context, paths, overrides []string) (*latestconfig.Config, error) {
+	conf, err := config.Load(paths, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	if !conf.HomeAssistant.Addon || conf.Broker.Address != "" {
+		return conf, nil
+	}
+
+	svc, err := homeassistant.DiscoverMQTT(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover MQTT broker: %w", err)
+	}
+
+	slog.Info("Discovered MQTT broker from Home Assistant", slog.String("address", svc.Address()))
+
+	// As no broker is configured, the discovered one can be applied on top of
+	// the configuration.
+	discovered := []string{"broker.address=" + overrideValue(svc.Address())}
+	if conf.Broker.Username == "" && conf.Broker.Password == "" && conf.Broker.PasswordFrom == "" {
+		discovered = append(discovered,
+			"broker.username="+overrideValue(svc.Username),
+			"broker.password="+overrideValue(svc.Password))
+	}
+
+	return config.Load(paths, append(slices.Clone(overrides), discovered...))
+}
+
+// overrideValue quotes a string for use as an override value, so that it
+// isn't interpreted as YAML or expanded as an environment variable.
+func overrideValue(s string) string {
+	quoted, _ := json.Marshal(strings.ReplaceAll(s, "${", "$${"))
+	return string(quoted)
+}
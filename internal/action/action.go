@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package action runs user-defined actions when target devices are detected.
+package action
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+// Runner runs the configured actions.
+type Runner struct {
+	actions []*action
+}
+
+type action struct {
+	conf latestconfig.ActionConfig
+	run  func(ctx context.Context, n *notifier.Notification) error
+
+	mu      sync.Mutex
+	lastRun time.Time
+}
+
+// NewRunner creates a runner for the given action configurations.
+func NewRunner(confs []latestconfig.ActionConfig) (*Runner, error) {
+	var r Runner
+	for _, conf := range confs {
+		a := &action{conf: conf}
+
+		switch {
+		case len(conf.Command) > 0:
+			cmd, err := newCommand(conf.Command)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create action %q: %w", conf.Name, err)
+			}
+
+			a.run = cmd.Run
+		case conf.Webhook != nil:
+			webhook, err := notifier.NewWebhook(conf.Webhook)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create action %q: %w", conf.Name, err)
+			}
+
+			a.run = webhook.Notify
+		default:
+			return nil, fmt.Errorf("failed to create action %q: no action type specified", conf.Name)
+		}
+
+		r.actions = append(r.actions, a)
+	}
+
+	return &r, nil
+}
+
+// Inherit carries the rate limits over from the runner this one replaces
+// (eg. when the configuration is reloaded), for the actions that weren't
+// changed.
+func (r *Runner) Inherit(old *Runner) {
+	if old == nil {
+		return
+	}
+
+	for _, a := range r.actions {
+		for _, prev := range old.actions {
+			if prev.conf.Name != a.conf.Name || !reflect.DeepEqual(prev.conf, a.conf) {
+				continue
+			}
+
+			prev.mu.Lock()
+			lastRun := prev.lastRun
+			prev.mu.Unlock()
+
+			a.mu.Lock()
+			a.lastRun = lastRun
+			a.mu.Unlock()
+
+			break
+		}
+	}
+}
+
+// Run runs every action triggered by the notification concurrently, logging
+// any failures. It returns once all actions have completed.
+func (r *Runner) Run(ctx context.Context, n *notifier.Notification) {
+	var wg sync.WaitGroup
+	for _, a := range r.actions {
+		if !a.triggeredBy(n) {
+			continue
+		}
+
+		if !a.allow(n.Time) {
+			slog.Debug("Skipping rate limited action", slog.String("action", a.conf.Name))
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, a.conf.Timeout)
+			defer cancel()
+
+			slog.Debug("Running action", slog.String("action", a.conf.Name), slog.String("name", n.Name))
+
+			if err := a.run(ctx, n); err != nil {
+				slog.Warn("Failed to run action",
+					slog.String("action", a.conf.Name), slog.Any("error", err))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Triggered returns the names of the actions Run would run for the
+// notification, and of those it would skip because they ran too recently,
+// without running them.
+func (r *Runner) Triggered(n *notifier.Notification) (run, rateLimited []string) {
+	for _, a := range r.actions {
+		if !a.triggeredBy(n) {
+			continue
+		}
+
+		if a.limited(n.Time) {
+			rateLimited = append(rateLimited, a.conf.Name)
+		} else {
+			run = append(run, a.conf.Name)
+		}
+	}
+
+	return run, rateLimited
+}
+
+func (a *action) triggeredBy(n *notifier.Notification) bool {
+	if !slices.Contains(a.conf.Events, n.Event) {
+		return false
+	}
+
+	return len(a.conf.Targets) == 0 || slices.Contains(a.conf.Targets, n.Name)
+}
+
+// allow records a run of the action at the given time, unless it would
+// exceed the action's rate limit.
+func (a *action) allow(now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.limitedLocked(now) {
+		return false
+	}
+
+	a.lastRun = now
+
+	return true
+}
+
+// limited returns whether running the action at the given time would exceed
+// its rate limit.
+func (a *action) limited(now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.limitedLocked(now)
+}
+
+func (a *action) limitedLocked(now time.Time) bool {
+	return !a.lastRun.IsZero() && now.Sub(a.lastRun) < a.conf.RateLimit
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package action
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+func TestInheritRateLimits(t *testing.T) {
+	confs := []latestconfig.ActionConfig{
+		{Name: "lights", Command: []string{"true"}, RateLimit: time.Hour},
+		{Name: "camera", Command: []string{"true"}, RateLimit: time.Hour},
+	}
+
+	old, err := NewRunner(confs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)
+	for _, a := range old.actions {
+		if !a.allow(now) {
+			t.Fatalf("action %q was rate limited on its first run", a.conf.Name)
+		}
+	}
+
+	// The camera action is changed by the reload, so its rate limit starts
+	// over.
+	confs[1].RateLimit = 2 * time.Hour
+
+	r, err := NewRunner(confs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Inherit(old)
+
+	later := now.Add(time.Minute)
+	if !r.actions[0].limited(later) {
+		t.Error("unchanged action's rate limit was reset by the reload")
+	}
+	if r.actions[1].limited(later) {
+		t.Error("changed action kept the rate limit of its previous configuration")
+	}
+}
+
+// TestCommandWaitDelay checks that a cancelled command returns even if a
+// process it started keeps its output open.
+func TestCommandWaitDelay(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	cmd, err := newCommand([]string{"sh", "-c", "sleep 30 & sleep 30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := cmd.Run(ctx, &notifier.Notification{}); err == nil {
+		t.Error("Run() succeeded, want an error once cancelled")
+	}
+
+	if elapsed := time.Since(start); elapsed > waitDelay+5*time.Second {
+		t.Errorf("Run() returned after %s, want at most %s after being cancelled", elapsed, waitDelay)
+	}
+}
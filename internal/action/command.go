@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package action
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+const (
+	// maxOutputLength is how much of a failed command's output is included
+	// in the error.
+	maxOutputLength = 512
+	// waitDelay is how long to wait for a command's output to be closed once
+	// it has been killed, as processes it started may hold it open.
+	waitDelay = 2 * time.Second
+)
+
+// command runs an external command.
+type command struct {
+	args []*template.Template
+}
+
+func newCommand(args []string) (*command, error) {
+	var c command
+	for i, arg := range args {
+		tmpl, err := template.New(fmt.Sprintf("arg%d", i)).Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse argument %q: %w", arg, err)
+		}
+
+		c.args = append(c.args, tmpl)
+	}
+
+	return &c, nil
+}
+
+// Run runs the command with its arguments rendered for the notification.
+func (c *command) Run(ctx context.Context, n *notifier.Notification) error {
+	args := make([]string, len(c.args))
+	for i, tmpl := range c.args {
+		var arg strings.Builder
+		if err := tmpl.Execute(&arg, n); err != nil {
+			return fmt.Errorf("failed to execute argument template: %w", err)
+		}
+
+		args[i] = arg.String()
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(),
+		"CAT_DOORBELL_EVENT="+string(n.Event),
+		"CAT_DOORBELL_NAME="+n.Name,
+		"CAT_DOORBELL_MESSAGE="+n.Message,
+		"CAT_DOORBELL_MAC="+n.MAC,
+		"CAT_DOORBELL_RSSI="+strconv.Itoa(n.RSSI),
+		"CAT_DOORBELL_COLOR="+n.Color,
+		"CAT_DOORBELL_TIME="+n.Time.Format(time.RFC3339),
+		"CAT_DOORBELL_INSTANCE="+n.Instance,
+	)
+
+	cmd.WaitDelay = waitDelay
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		out := strings.TrimSpace(output.String())
+		if len(out) > maxOutputLength {
+			out = out[:maxOutputLength] + "..."
+		}
+
+		if out != "" {
+			return fmt.Errorf("failed to run %q: %w: %s", args[0], err, out)
+		}
+
+		return fmt.Errorf("failed to run %q: %w", args[0], err)
+	}
+
+	return nil
+}
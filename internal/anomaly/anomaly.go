@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package anomaly flags unusual visit patterns, based on the detection
+// history.
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+)
+
+// unusualFraction is the fraction of a target's visits, within an hour
+// either side, below which a visit is considered to be at an unusual hour.
+const unusualFraction = 0.02
+
+// visitEvents are the event types that count as visits.
+var visitEvents = []string{string(latestconfig.EventDetected), string(latestconfig.EventButtonPressed)}
+
+// Missing is a target that hasn't visited for longer than usual.
+type Missing struct {
+	// Name is the name of the target.
+	Name string
+	// MAC is the MAC address of the target's last visit.
+	MAC string
+	// LastVisit is when the target last visited.
+	LastVisit time.Time
+}
+
+// profile is the visit pattern of a target.
+type profile struct {
+	// lastVisit is the target's most recent visit, if it has ever visited.
+	lastVisit *history.Detection
+	// visits is the number of visits within the learning period.
+	visits int
+	// byHour is the number of visits within the learning period at each
+	// hour of the (local) day.
+	byHour [24]int
+}
+
+// Detector learns the visit patterns of targets from the history, and flags
+// visits that differ from them.
+type Detector struct {
+	store history.Store
+
+	mu       sync.Mutex
+	profiles map[string]*profile
+	// reported is the last visit of each target that has been reported
+	// missing, so each absence is only reported once.
+	reported map[string]time.Time
+}
+
+// New creates a new anomaly detector using the given history.
+func New(store history.Store) *Detector {
+	return &Detector{
+		store:    store,
+		profiles: make(map[string]*profile),
+		reported: make(map[string]time.Time),
+	}
+}
+
+// Refresh learns the visit patterns of the given targets from the history.
+func (d *Detector) Refresh(ctx context.Context, conf latestconfig.AnomalyConfig, targets []string, now time.Time) error {
+	profiles := make(map[string]*profile, len(targets))
+	for _, name := range targets {
+		var p profile
+
+		last, err := d.store.List(ctx, history.Query{Name: name, Events: visitEvents, Limit: 1})
+		if err != nil {
+			return fmt.Errorf("failed to get last visit of %q: %w", name, err)
+		}
+		if len(last) > 0 {
+			p.lastVisit = &last[0]
+		}
+
+		visits, err := d.store.List(ctx, history.Query{
+			Since:  now.Add(-conf.LearningPeriod),
+			Name:   name,
+			Events: visitEvents,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get visits of %q: %w", name, err)
+		}
+
+		for _, v := range visits {
+			p.visits++
+			p.byHour[v.Time.Local().Hour()]++
+		}
+
+		profiles[name] = &p
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.profiles = profiles
+
+	return nil
+}
+
+// Missing returns the targets that haven't visited for longer than
+// NoVisitsFor. Each absence is only reported once. Targets that have never
+// visited aren't reported.
+func (d *Detector) Missing(conf latestconfig.AnomalyConfig, now time.Time) []Missing {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var missing []Missing
+	for name, p := range d.profiles {
+		if p.lastVisit == nil || now.Sub(p.lastVisit.Time) < conf.NoVisitsFor {
+			continue
+		}
+
+		if d.reported[name].Equal(p.lastVisit.Time) {
+			continue
+		}
+		d.reported[name] = p.lastVisit.Time
+
+		missing = append(missing, Missing{
+			Name:      name,
+			MAC:       p.lastVisit.MAC,
+			LastVisit: p.lastVisit.Time,
+		})
+	}
+
+	return missing
+}
+
+// Unusual returns whether a visit by the target at the given time is at an
+// hour of the day it rarely visits at. Visits aren't considered unusual until
+// the target has visited MinVisits times within the learning period.
+func (d *Detector) Unusual(conf latestconfig.AnomalyConfig, name string, t time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	p, ok := d.profiles[name]
+	if !ok || p.visits == 0 || p.visits < conf.MinVisits {
+		return false
+	}
+
+	hour := t.Local().Hour()
+
+	var nearby int
+	for offset := -1; offset <= 1; offset++ {
+		nearby += p.byHour[(hour+offset+24)%24]
+	}
+
+	return float64(nearby)/float64(p.visits) < unusualFraction
+}
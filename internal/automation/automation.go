@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package automation publishes the doorbell's state for home automations
+// (eg. heating), in a documented JSON schema.
+package automation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TriggerInterval is the trigger of states published on the regular
+// interval, rather than for an event.
+const TriggerInterval = "interval"
+
+// defaultTemperatureField is the field of JSON sensor payloads the
+// temperature is read from by default.
+const defaultTemperatureField = "temperature"
+
+// State is the state published for automations. The JSON encoding is
+// documented in the README, so fields may be added, but not changed or
+// removed.
+type State struct {
+	// Time is when the state was published.
+	Time time.Time `json:"time"`
+	// Trigger is why the state was published: the type of the event that
+	// was raised (eg. "detected"), or "interval".
+	Trigger string `json:"trigger"`
+	// Name is the name of the target that raised the event, if any.
+	Name string `json:"name,omitempty"`
+	// Instance is the name of the doorbell that published the state.
+	Instance string `json:"instance"`
+	// Present is true if any target with presence tracking is present.
+	Present bool `json:"present"`
+	// VisitsLastHour is the number of visits (detections that rang the
+	// doorbell, and button presses) of every target in the last hour.
+	VisitsLastHour int `json:"visitsLastHour"`
+	// Targets is the state of each target.
+	Targets []Target `json:"targets"`
+	// Temperature is the latest reading of the temperature sensor, if one is
+	// configured and has reported.
+	Temperature *Temperature `json:"temperature,omitempty"`
+}
+
+// Target is the state of a target.
+type Target struct {
+	// Name is the name of the target.
+	Name string `json:"name"`
+	// Present is whether the target is present, or nil if the target
+	// doesn't have presence tracking enabled.
+	Present *bool `json:"present,omitempty"`
+	// LastSeen is when the target was last detected, or nil if it never has
+	// been.
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	// VisitsLastHour is the number of visits of the target in the last
+	// hour.
+	VisitsLastHour int `json:"visitsLastHour"`
+}
+
+// Temperature is a temperature sensor reading.
+type Temperature struct {
+	// Value is the temperature, in the unit the sensor reports.
+	Value float64 `json:"value"`
+	// Time is when the reading was received.
+	Time time.Time `json:"time"`
+}
+
+// ParseTemperature reads a temperature from a sensor's MQTT payload, which is
+// either a bare number, or a JSON object with the temperature in the given
+// field (or "temperature" if the field is empty). Nested fields are separated
+// by dots (eg. "sensor.temperature").
+func ParseTemperature(payload []byte, field string) (float64, error) {
+	if v, err := strconv.ParseFloat(strings.TrimSpace(string(payload)), 64); err == nil {
+		return v, nil
+	}
+
+	if field == "" {
+		field = defaultTemperatureField
+	}
+
+	var value any
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return 0, fmt.Errorf("payload is neither a number nor JSON: %w", err)
+	}
+
+	for _, name := range strings.Split(field, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return 0, fmt.Errorf("payload has no %q field", field)
+		}
+
+		if value, ok = obj[name]; !ok {
+			return 0, fmt.Errorf("payload has no %q field", field)
+		}
+	}
+
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("field %q is not a number", field)
+	}
+}
+
+var httpClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// Post sends an encoded state to a webhook.
+func Post(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send state: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
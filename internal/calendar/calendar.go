@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package calendar reads events from an iCalendar (ICS) calendar.
+package calendar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/teambition/rrule-go"
+)
+
+// maxCalendarSize is the largest calendar that will be downloaded.
+const maxCalendarSize = 10 << 20
+
+// Event is an occurrence of a calendar event.
+type Event struct {
+	// UID identifies the calendar event.
+	UID string
+	// Summary is the title of the event (eg. "Holiday").
+	Summary string
+	// Start is when the occurrence starts.
+	Start time.Time
+	// End is when the occurrence ends.
+	End time.Time
+}
+
+// Calendar is a set of (possibly recurring) events.
+type Calendar struct {
+	events []event
+}
+
+// event is a calendar event, which recurs if it has a recurrence set.
+type event struct {
+	uid      string
+	summary  string
+	start    time.Time
+	duration time.Duration
+	// recurrence is when the event occurs, or nil if it occurs once.
+	recurrence *rrule.Set
+}
+
+// Fetch downloads and parses the calendar, which is read from disk if its URL
+// is a path.
+func Fetch(ctx context.Context, conf *latestconfig.CalendarConfig) (*Calendar, error) {
+	if !strings.HasPrefix(conf.URL, "http://") && !strings.HasPrefix(conf.URL, "https://") {
+		f, err := os.Open(conf.URL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open calendar: %w", err)
+		}
+		defer f.Close()
+
+		return Parse(f)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, conf.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if conf.Username != "" {
+		req.SetBasicAuth(conf.Username, conf.Password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch calendar: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCalendarSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read calendar: %w", err)
+	}
+
+	if len(data) > maxCalendarSize {
+		return nil, fmt.Errorf("calendar is larger than %d bytes", maxCalendarSize)
+	}
+
+	return Parse(bytes.NewReader(data))
+}
+
+// Parse reads a calendar in iCalendar format. Events that can't be understood
+// are logged and skipped.
+func Parse(r io.Reader) (*Calendar, error) {
+	cal, err := ics.ParseCalendar(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse calendar: %w", err)
+	}
+
+	// Occurrences that were moved or cancelled are listed as separate events
+	// with the same UID, and replace the occurrence at their recurrence ID.
+	overridden := make(map[string][]time.Time)
+	for _, ve := range cal.Events() {
+		if prop := ve.GetProperty(ics.ComponentPropertyRecurrenceId); prop != nil {
+			if t, err := parseDates(prop); err == nil {
+				overridden[ve.Id()] = append(overridden[ve.Id()], t...)
+			}
+		}
+	}
+
+	var c Calendar
+	for _, ve := range cal.Events() {
+		if prop := ve.GetProperty(ics.ComponentPropertyStatus); prop != nil && strings.EqualFold(prop.Value, "CANCELLED") {
+			continue
+		}
+
+		e, err := parseEvent(ve)
+		if err != nil {
+			slog.Warn("Skipping calendar event", slog.String("uid", ve.Id()), slog.Any("error", err))
+			continue
+		}
+
+		if e.recurrence != nil && ve.GetProperty(ics.ComponentPropertyRecurrenceId) == nil {
+			for _, t := range overridden[e.uid] {
+				e.recurrence.ExDate(t)
+			}
+		}
+
+		c.events = append(c.events, *e)
+	}
+
+	return &c, nil
+}
+
+// parseEvent reads the timing of a calendar event.
+func parseEvent(ve *ics.VEvent) (*event, error) {
+	start, err := ve.GetStartAt()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read start: %w", err)
+	}
+
+	e := event{uid: ve.Id(), start: start}
+	if prop := ve.GetProperty(ics.ComponentPropertySummary); prop != nil {
+		e.summary = prop.Value
+	}
+
+	allDay := false
+	if prop := ve.GetProperty(ics.ComponentPropertyDtStart); prop != nil {
+		values := prop.ICalParameters["VALUE"]
+		allDay = len(values) > 0 && values[0] == "DATE"
+	}
+
+	switch {
+	case ve.GetProperty(ics.ComponentPropertyDtEnd) != nil:
+		end, err := ve.GetEndAt()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read end: %w", err)
+		}
+		e.duration = end.Sub(start)
+	case ve.GetProperty(ics.ComponentPropertyDuration) != nil:
+		e.duration, err = parseDuration(ve.GetProperty(ics.ComponentPropertyDuration).Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read duration: %w", err)
+		}
+	case allDay:
+		e.duration = 24 * time.Hour
+	}
+
+	rule := ve.GetProperty(ics.ComponentPropertyRrule)
+	if rule == nil {
+		return &e, nil
+	}
+
+	opt, err := rrule.StrToROptionInLocation(rule.Value, start.Location())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recurrence rule: %w", err)
+	}
+	opt.Dtstart = start
+
+	r, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recurrence rule: %w", err)
+	}
+
+	e.recurrence = &rrule.Set{}
+	e.recurrence.RRule(r)
+
+	for _, prop := range ve.GetProperties(ics.ComponentPropertyExdate) {
+		exdates, err := parseDates(prop)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read excluded dates: %w", err)
+		}
+
+		for _, t := range exdates {
+			e.recurrence.ExDate(t)
+		}
+	}
+
+	return &e, nil
+}
+
+// parseDates reads the (comma separated) dates of a property such as EXDATE.
+func parseDates(prop *ics.IANAProperty) ([]time.Time, error) {
+	loc := time.Local
+	if tzid := prop.ICalParameters["TZID"]; len(tzid) > 0 {
+		var err error
+		if loc, err = time.LoadLocation(tzid[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return rrule.StrToDatesInLoc(prop.Value, loc)
+}
+
+// durationRE matches an iCalendar duration, eg. "P1DT2H" or "PT30M".
+var durationRE = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration reads an iCalendar duration.
+func parseDuration(s string) (time.Duration, error) {
+	m := durationRE.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+
+	if m[1] == "-" {
+		return 0, errors.New("negative durations are not supported")
+	}
+
+	return d, nil
+}
+
+// Ongoing returns the occurrences of events in progress at the given time.
+func (c *Calendar) Ongoing(at time.Time) []Event {
+	var ongoing []Event
+	for _, e := range c.events {
+		for _, start := range e.occurrences(at) {
+			if end := start.Add(e.duration); !at.Before(start) && at.Before(end) {
+				ongoing = append(ongoing, Event{UID: e.uid, Summary: e.summary, Start: start, End: end})
+			}
+		}
+	}
+
+	slices.SortFunc(ongoing, func(a, b Event) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	return ongoing
+}
+
+// occurrences returns the starts of the occurrences of the event that may be
+// in progress at the given time.
+func (e *event) occurrences(at time.Time) []time.Time {
+	if e.recurrence == nil {
+		return []time.Time{e.start}
+	}
+
+	return e.recurrence.Between(at.Add(-e.duration), at, true)
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package camera fetches snapshots from a doorstep camera.
+package camera
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// maxSnapshotSize is the largest snapshot that will be downloaded.
+const maxSnapshotSize = 10 << 20
+
+// Snapshot is a still image from the camera.
+type Snapshot struct {
+	// ContentType is the MIME type of the image (eg. "image/jpeg").
+	ContentType string `json:"contentType"`
+	// Data is the encoded image.
+	Data []byte `json:"data"`
+}
+
+// Extension returns the file extension (eg. ".jpg") for the image type.
+func (s *Snapshot) Extension() string {
+	switch s.ContentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	}
+
+	if exts, err := mime.ExtensionsByType(s.ContentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+
+	return ".jpg"
+}
+
+// Camera fetches snapshots from an HTTP snapshot URL.
+type Camera struct {
+	conf *latestconfig.CameraConfig
+}
+
+// New creates a new camera.
+func New(conf *latestconfig.CameraConfig) *Camera {
+	return &Camera{conf: conf}
+}
+
+// Captures returns whether notifications of the given event type should
+// include a snapshot.
+func (c *Camera) Captures(event latestconfig.EventType) bool {
+	return slices.Contains(c.conf.Events, event)
+}
+
+// Snapshot fetches a current still image from the camera.
+func (c *Camera) Snapshot(ctx context.Context) (*Snapshot, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.conf.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.conf.SnapshotURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.conf.Username != "" {
+		req.SetBasicAuth(c.conf.Username, c.conf.Password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSnapshotSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	if len(data) > maxSnapshotSize {
+		return nil, fmt.Errorf("snapshot is larger than %d bytes", maxSnapshotSize)
+	}
+
+	// Cameras don't always send a content type, so fall back to sniffing it.
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("snapshot is not an image: %s", contentType)
+	}
+
+	return &Snapshot{ContentType: contentType, Data: data}, nil
+}
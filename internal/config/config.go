@@ -19,11 +19,14 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"os"
 
 	configtypes "github.com/dpeckett/cat-doorbell/internal/config/types"
-	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha1"
+	"github.com/dpeckett/cat-doorbell/internal/config/v1alpha1"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
 	"gopkg.in/yaml.v3"
 )
 
@@ -34,13 +37,99 @@ func FromYAML(r io.Reader) (*latestconfig.Config, error) {
 		return nil, fmt.Errorf("failed to read config from reader: %w", err)
 	}
 
+	confBytes, err = expandEnv(confBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand environment variables: %w", err)
+	}
+
+	versionedConf, err := unmarshalVersioned(confBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	versionedConf, err = migrateToLatest(versionedConf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate config: %w", err)
+	}
+
+	conf := versionedConf.(*latestconfig.Config)
+	conf.PopulateDefaults()
+
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return conf, nil
+}
+
+// Migrate rewrites the config file at the given path using the latest API
+// version, keeping the original alongside it with a ".bak" suffix (and as a
+// snapshot). Comments are not preserved. It returns false (and leaves the
+// file untouched) if the file already uses the latest version.
+func Migrate(path string) (bool, error) {
+	confBytes, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Environment variables are left unexpanded, so that secrets referenced
+	// by the config aren't written to it.
+	versionedConf, err := unmarshalVersioned(confBytes)
+	if err != nil {
+		return false, err
+	}
+
+	if versionedConf.GetAPIVersion() == latestconfig.APIVersion {
+		return false, nil
+	}
+
+	versionedConf, err = migrateToLatest(versionedConf)
+	if err != nil {
+		return false, fmt.Errorf("failed to migrate config: %w", err)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(versionedConf); err != nil {
+		return false, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return false, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if _, err := FromYAML(bytes.NewReader(buf.Bytes())); err != nil {
+		return false, fmt.Errorf("migrated config is invalid: %w", err)
+	}
+
+	if err := writeFileAtomic(path+".bak", confBytes); err != nil {
+		return false, fmt.Errorf("failed to back up config file: %w", err)
+	}
+
+	if err := TakeSnapshot(path); err != nil {
+		return false, fmt.Errorf("failed to snapshot config file: %w", err)
+	}
+
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// unmarshalVersioned unmarshals a config into the type for its API version
+// and kind.
+func unmarshalVersioned(confBytes []byte) (configtypes.Config, error) {
 	var typeMeta configtypes.TypeMeta
 	if err := yaml.Unmarshal(confBytes, &typeMeta); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal type meta from config file: %w", err)
 	}
 
 	var versionedConf configtypes.Config
+	var err error
 	switch typeMeta.APIVersion {
+	case v1alpha1.APIVersion:
+		versionedConf, err = v1alpha1.GetConfigByKind(typeMeta.Kind)
 	case latestconfig.APIVersion:
 		versionedConf, err = latestconfig.GetConfigByKind(typeMeta.Kind)
 	default:
@@ -54,19 +143,23 @@ func FromYAML(r io.Reader) (*latestconfig.Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config from config file: %w", err)
 	}
 
-	versionedConf, err = migrateToLatest(versionedConf)
-	if err != nil {
-		return nil, fmt.Errorf("failed to migrate config: %w", err)
-	}
-
-	return versionedConf.(*latestconfig.Config), nil
+	return versionedConf, nil
 }
 
+// migrateToLatest migrates a config one version at a time until it reaches
+// the latest version.
 func migrateToLatest(versionedConf configtypes.Config) (configtypes.Config, error) {
 	switch conf := versionedConf.(type) {
 	case *latestconfig.Config:
 		// Nothing to do, already at the latest version.
 		return conf, nil
+	case *v1alpha1.Config:
+		migrated, err := migrateV1Alpha1ToV1Alpha2(conf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate from %s: %w", conf.GetAPIVersion(), err)
+		}
+
+		return migrateToLatest(migrated)
 	default:
 		return nil, fmt.Errorf("unsupported config version: %s", conf.GetAPIVersion())
 	}
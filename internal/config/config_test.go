@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/config/v1alpha1"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+const v1alpha1Fixture = "testdata/v1alpha1.yaml"
+
+func loadFixture(t *testing.T, path string) *latestconfig.Config {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := FromYAML(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", path, err)
+	}
+
+	return conf
+}
+
+func TestMigrateV1Alpha1(t *testing.T) {
+	conf := loadFixture(t, v1alpha1Fixture)
+
+	if conf.APIVersion != latestconfig.APIVersion {
+		t.Errorf("APIVersion = %q, want %q", conf.APIVersion, latestconfig.APIVersion)
+	}
+	if conf.MigratedFrom != v1alpha1.APIVersion {
+		t.Errorf("MigratedFrom = %q, want %q", conf.MigratedFrom, v1alpha1.APIVersion)
+	}
+
+	// Fields that are unchanged between the versions are copied as they are.
+	if conf.Broker.Address != "tcp://localhost:1883" || conf.Broker.Username != "doorbell" {
+		t.Errorf("Broker = %q as %q, want tcp://localhost:1883 as doorbell", conf.Broker.Address, conf.Broker.Username)
+	}
+	if len(conf.Broker.Topics) != 1 || conf.Broker.Topics[0].Topic != "home/OMG_ESP32_BLE/BTtoMQTT/+" ||
+		conf.Broker.Topics[0].QoS != 1 || conf.Broker.Topics[0].PayloadFormat != latestconfig.PayloadFormatOpenMQTTGateway {
+		t.Errorf("Broker.Topics = %+v", conf.Broker.Topics)
+	}
+	if conf.DetectionTimeout != 5*time.Minute || conf.RSSIThreshold != -75 || conf.MinBeacons != 2 || conf.WithinWindow != 10*time.Second {
+		t.Errorf("detection settings = %s, %d, %d, %s", conf.DetectionTimeout, conf.RSSIThreshold, conf.MinBeacons, conf.WithinWindow)
+	}
+	if conf.Sound.Volume == nil || *conf.Sound.Volume != 0.5 {
+		t.Errorf("Sound.Volume = %v, want 0.5", conf.Sound.Volume)
+	}
+	if !conf.Privacy.HashMACs || conf.Privacy.Salt != "pepper" {
+		t.Errorf("Privacy = %+v", conf.Privacy)
+	}
+	if len(conf.Notifiers) != 1 || conf.Notifiers[0].Ntfy == nil || conf.Notifiers[0].Ntfy.Topic != "cat-doorbell" ||
+		conf.Notifiers[0].Ntfy.Priority != 4 || !reflect.DeepEqual(conf.Notifiers[0].Events,
+		[]latestconfig.EventType{latestconfig.EventDetected, latestconfig.EventButtonPressed}) {
+		t.Errorf("Notifiers = %+v", conf.Notifiers)
+	}
+	if len(conf.Events) != 1 || conf.Events[0].Name != "lateNight" || conf.Events[0].Between == nil ||
+		conf.Events[0].Between.From != "22:00" || conf.Events[0].Message != "{{.Name}} is out late" {
+		t.Errorf("Events = %+v", conf.Events)
+	}
+
+	if len(conf.Targets) != 3 {
+		t.Fatalf("got %d targets, want 3", len(conf.Targets))
+	}
+
+	// The legacy targetMAC becomes the first target.
+	if legacy := conf.Targets[0]; legacy.MAC != "00:11:22:33:44:55" || legacy.DetectionTimeout != 5*time.Minute {
+		t.Errorf("targetMAC target = %+v", legacy)
+	}
+
+	mittens := conf.Targets[1]
+	if mittens.Name != "Mittens" || mittens.MAC != "AA:BB:CC:DD:EE:FF" || mittens.DetectionTimeout != 2*time.Minute ||
+		mittens.RSSIThreshold != -70 || !mittens.Button || !mittens.NotifyDeparture || mittens.Color != "#ff8800" ||
+		mittens.StationaryAfter != time.Minute || mittens.AbsenceTimeout != 10*time.Minute {
+		t.Errorf("Mittens = %+v", mittens)
+	}
+
+	wantNotification := latestconfig.TargetNotificationConfig{
+		Message:           "{{.Name}} is at the back door",
+		ButtonMessage:     "{{.Name}} pressed the button",
+		ArrivalMessage:    "{{.Name}} is home",
+		DepartureMessage:  "{{.Name}} went out",
+		StationaryMessage: "{{.Name}} is waiting",
+	}
+	// The title and low battery message are new in v1alpha2, so they are
+	// defaulted.
+	notification := mittens.Notification
+	notification.Title, notification.LowBatteryMessage = "", ""
+	if notification != wantNotification {
+		t.Errorf("Mittens.Notification = %+v, want %+v", notification, wantNotification)
+	}
+
+	if mittens.Sound.File != "/usr/share/sounds/meow.wav" || mittens.Sound.ButtonFile != "/usr/share/sounds/chime.ogg" {
+		t.Errorf("Mittens.Sound = %+v", mittens.Sound)
+	}
+
+	socks := conf.Targets[2]
+	if socks.Name != "Socks" || socks.IBeacon == nil || socks.IBeacon.UUID != "e2c56db5-dffb-48d2-b060-d0f5a71096e0" ||
+		socks.IBeacon.Major == nil || *socks.IBeacon.Major != 1 || socks.IBeacon.Minor == nil || *socks.IBeacon.Minor != 2 {
+		t.Errorf("Socks = %+v", socks)
+	}
+	if socks.Notification.Message != "Socks wants in" || socks.Sound.File != "" {
+		t.Errorf("Socks notification and sound = %+v, %+v", socks.Notification, socks.Sound)
+	}
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	original, err := os.ReadFile(v1alpha1Fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, original, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	migrated, err := Migrate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migrated {
+		t.Fatal("Migrate() = false, want true for a v1alpha1 config")
+	}
+
+	backup, err := os.ReadFile(path + ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(backup, original) {
+		t.Error("the backup differs from the original config")
+	}
+
+	want := loadFixture(t, v1alpha1Fixture)
+	got := loadFixture(t, path)
+
+	if got.MigratedFrom != "" {
+		t.Errorf("MigratedFrom = %q after migrating the file, want none", got.MigratedFrom)
+	}
+
+	if deprecations := got.Deprecations(); len(deprecations) > 0 {
+		t.Errorf("Deprecations() = %v after migrating the file, want none", deprecations)
+	}
+
+	// Only the version the configuration was migrated from, and so its
+	// deprecation, may differ.
+	want.MigratedFrom = ""
+	gotFields, wantFields := reflect.ValueOf(got).Elem(), reflect.ValueOf(want).Elem()
+	for i := 0; i < gotFields.NumField(); i++ {
+		field := gotFields.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if g, w := gotFields.Field(i).Interface(), wantFields.Field(i).Interface(); !reflect.DeepEqual(g, w) {
+			t.Errorf("%s differs after migrating the file:\n got: %+v\nwant: %+v", field.Name, g, w)
+		}
+	}
+
+	// The migrated config is already the latest version.
+	migrated, err = Migrate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated {
+		t.Error("Migrate() = true, want false for a config that was already migrated")
+	}
+}
@@ -0,0 +1,395 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrTargetNotFound is returned when a target device is not present in the config.
+var ErrTargetNotFound = errors.New("target not found")
+
+// ErrTokenNotFound is returned when an API token is not present in the config.
+var ErrTokenNotFound = errors.New("token not found")
+
+// Edit loads the config file at the given path as a YAML document, applies the
+// given edit function to it, and atomically writes the result back to disk.
+// Comments and formatting are preserved where possible. The edited document
+// is validated before being written, and the previous version is kept as a
+// snapshot.
+func Edit(path string, edit func(doc *yaml.Node) error) error {
+	confBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(confBytes, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return errors.New("config file is not a YAML mapping")
+	}
+
+	if err := edit(&doc); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if _, err := FromYAML(bytes.NewReader(buf.Bytes())); err != nil {
+		return fmt.Errorf("edited config is invalid: %w", err)
+	}
+
+	if err := TakeSnapshot(path); err != nil {
+		return fmt.Errorf("failed to snapshot config file: %w", err)
+	}
+
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// AddTarget appends the given target device to the config document.
+func AddTarget(doc *yaml.Node, target latestconfig.TargetConfig) error {
+	if target.MAC == "" && target.LocalName == "" && target.ServiceUUID == "" {
+		return errors.New("a MAC address, local name or service UUID is required")
+	}
+
+	if target.MAC != "" {
+		var err error
+		target.MAC, err = util.NormalizeMAC(target.MAC)
+		if err != nil {
+			return err
+		}
+	}
+
+	root := doc.Content[0]
+
+	// The target is encoded using the latest schema.
+	if apiVersion := mappingValue(root, "apiVersion"); apiVersion != nil && apiVersion.Value != latestconfig.APIVersion {
+		return fmt.Errorf("config file uses %s, migrate it to %s with \"cat-doorbell config migrate\" first",
+			apiVersion.Value, latestconfig.APIVersion)
+	}
+
+	targets := mappingValue(root, "targets")
+	if targets == nil {
+		targets = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "targets"},
+			targets,
+		)
+	}
+
+	for _, t := range targets.Content {
+		if mac := mappingValue(t, "mac"); mac != nil && target.MAC != "" && sameMAC(mac.Value, target.MAC) {
+			return fmt.Errorf("target with MAC %s already exists", target.MAC)
+		}
+	}
+
+	var targetNode yaml.Node
+	if err := targetNode.Encode(target); err != nil {
+		return fmt.Errorf("failed to marshal target: %w", err)
+	}
+
+	targets.Content = append(targets.Content, &targetNode)
+
+	return nil
+}
+
+// RemoveTarget removes the target device with the given MAC address from the
+// config document.
+func RemoveTarget(doc *yaml.Node, mac string) error {
+	root := doc.Content[0]
+
+	// Configs written for v1alpha1 may specify the target as targetMAC.
+	if legacy := mappingValue(root, "targetMAC"); legacy != nil && sameMAC(legacy.Value, mac) {
+		removeMappingKey(root, "targetMAC")
+		return nil
+	}
+
+	targets := mappingValue(root, "targets")
+	if targets != nil {
+		for i, t := range targets.Content {
+			if targetMAC := mappingValue(t, "mac"); targetMAC != nil && sameMAC(targetMAC.Value, mac) {
+				targets.Content = append(targets.Content[:i], targets.Content[i+1:]...)
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrTargetNotFound, mac)
+}
+
+// AddToken appends the given API token to the config document.
+func AddToken(doc *yaml.Node, token latestconfig.APITokenConfig) error {
+	root := doc.Content[0]
+
+	web := mappingValue(root, "web")
+	if web == nil {
+		web = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "web"},
+			web,
+		)
+	}
+
+	tokens := mappingValue(web, "tokens")
+	if tokens == nil {
+		tokens = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		web.Content = append(web.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "tokens"},
+			tokens,
+		)
+	}
+
+	for _, t := range tokens.Content {
+		if name := mappingValue(t, "name"); name != nil && name.Value == token.Name {
+			return fmt.Errorf("token %q already exists", token.Name)
+		}
+	}
+
+	var tokenNode yaml.Node
+	if err := tokenNode.Encode(token); err != nil {
+		return fmt.Errorf("failed to marshal token: %w", err)
+	}
+
+	tokens.Content = append(tokens.Content, &tokenNode)
+
+	return nil
+}
+
+// RemoveToken removes the API token with the given name from the config
+// document.
+func RemoveToken(doc *yaml.Node, name string) error {
+	root := doc.Content[0]
+
+	if web := mappingValue(root, "web"); web != nil {
+		if tokens := mappingValue(web, "tokens"); tokens != nil {
+			for i, t := range tokens.Content {
+				if tokenName := mappingValue(t, "name"); tokenName != nil && tokenName.Value == name {
+					tokens.Content = append(tokens.Content[:i], tokens.Content[i+1:]...)
+					return nil
+				}
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: %s", ErrTokenNotFound, name)
+}
+
+// SetSound sets a field of the sound settings in the config document, or
+// removes it if the value is empty.
+func SetSound(doc *yaml.Node, key string, value any) error {
+	return Set(doc, []string{"sound", key}, value)
+}
+
+// Set sets the field at the given path of mapping keys (eg. "broker",
+// "address") in the config document, creating the mappings along the way.
+// The field is removed if the value is empty.
+func Set(doc *yaml.Node, path []string, value any) error {
+	return setField(doc.Content[0], path, value)
+}
+
+// SetTarget sets a field of the target device at the given index in the
+// config document, or removes it if the value is empty.
+func SetTarget(doc *yaml.Node, index int, key string, value any) error {
+	target, err := targetAt(doc, index)
+	if err != nil {
+		return err
+	}
+
+	if key == "mac" && value != "" {
+		mac, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("invalid MAC address: %v", value)
+		}
+
+		if value, err = util.NormalizeMAC(mac); err != nil {
+			return err
+		}
+	}
+
+	return setField(target, []string{key}, value)
+}
+
+// RemoveTargetAt removes the target device at the given index from the
+// config document.
+func RemoveTargetAt(doc *yaml.Node, index int) error {
+	if _, err := targetAt(doc, index); err != nil {
+		return err
+	}
+
+	targets := mappingValue(doc.Content[0], "targets")
+	targets.Content = append(targets.Content[:index], targets.Content[index+1:]...)
+
+	return nil
+}
+
+// targetAt returns the target device at the given index of the config
+// document.
+func targetAt(doc *yaml.Node, index int) (*yaml.Node, error) {
+	targets := mappingValue(doc.Content[0], "targets")
+	if targets == nil || targets.Kind != yaml.SequenceNode || index < 0 || index >= len(targets.Content) {
+		return nil, fmt.Errorf("%w: #%d", ErrTargetNotFound, index)
+	}
+
+	return targets.Content[index], nil
+}
+
+// setField sets the field at the given path of mapping keys below the node,
+// or removes it if the value is empty.
+func setField(node *yaml.Node, path []string, value any) error {
+	key := path[len(path)-1]
+
+	for _, name := range path[:len(path)-1] {
+		child := mappingValue(node, name)
+		if child == nil {
+			if value == "" {
+				return nil
+			}
+
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name},
+				child,
+			)
+		}
+		node = child
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("failed to set %s: not a mapping", strings.Join(path, "."))
+	}
+
+	if value == "" {
+		removeMappingKey(node, key)
+		return nil
+	}
+
+	var valueNode yaml.Node
+	if err := valueNode.Encode(value); err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", strings.Join(path, "."), err)
+	}
+
+	if existing := mappingValue(node, key); existing != nil {
+		valueNode.LineComment = existing.LineComment
+		*existing = valueNode
+		return nil
+	}
+
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&valueNode,
+	)
+
+	return nil
+}
+
+// sameMAC reports whether two MAC addresses are equal, ignoring formatting.
+func sameMAC(a, b string) bool {
+	normalizedA, err := util.NormalizeMAC(a)
+	if err != nil {
+		return false
+	}
+
+	normalizedB, err := util.NormalizeMAC(b)
+	if err != nil {
+		return false
+	}
+
+	return normalizedA == normalizedB
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func removeMappingKey(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := f.Chmod(mode); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace config file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPattern matches "${NAME}" references to environment variables, and the
+// "$${" escape sequence.
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces "${NAME}" references to environment variables in the
+// string values of the given YAML document. "$${" is replaced with a literal
+// "${".
+func expandEnv(data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte("${")) {
+		return data, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if err := expandEnvNode(&doc); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func expandEnvNode(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "${") {
+		var missing []string
+		node.Value = envPattern.ReplaceAllStringFunc(node.Value, func(ref string) string {
+			if ref == "$${" {
+				return "${"
+			}
+
+			name := ref[2 : len(ref)-1]
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				missing = append(missing, name)
+			}
+
+			return value
+		})
+
+		if len(missing) > 0 {
+			return fmt.Errorf("environment variable %q is not set (line %d)", missing[0], node.Line)
+		}
+
+		// Resolve the type of unquoted values again (eg. "qos: ${QOS}").
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+	}
+
+	for _, child := range node.Content {
+		if err := expandEnvNode(child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
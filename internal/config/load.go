@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	configtypes "github.com/dpeckett/cat-doorbell/internal/config/types"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the configuration from the layered configuration files at the
+// given paths, in order of increasing precedence (eg. the system-wide file
+// followed by the user's file), followed by the given overrides (eg. from
+// command line flags). Missing files are skipped, as long as at least one
+// exists.
+//
+// Overrides are of the form "key=value", where the key is a dot separated
+// path to a field (eg. "broker.address") and the value is parsed as YAML.
+func Load(paths []string, overrides []string) (*latestconfig.Config, error) {
+	var layers [][]byte
+	var apiVersion, apiVersionPath string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to read configuration file: %w", err)
+		}
+
+		// Layers are merged before they are migrated, so they must all be
+		// written for the same version.
+		var typeMeta configtypes.TypeMeta
+		if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+			return nil, fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+		}
+
+		if typeMeta.APIVersion != "" {
+			if apiVersion != "" && typeMeta.APIVersion != apiVersion {
+				return nil, fmt.Errorf("%s uses %s but %s uses %s (migrate them to %s with \"cat-doorbell config migrate\")",
+					apiVersionPath, apiVersion, path, typeMeta.APIVersion, latestconfig.APIVersion)
+			}
+
+			apiVersion, apiVersionPath = typeMeta.APIVersion, path
+		}
+
+		layers = append(layers, data)
+	}
+
+	if len(layers) == 0 {
+		return nil, fmt.Errorf("no configuration file found (looked for %s)", strings.Join(paths, ", "))
+	}
+
+	if len(overrides) > 0 {
+		data, err := overridesToYAML(overrides)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, data)
+	}
+
+	merged, err := Merge(layers...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge configuration: %w", err)
+	}
+
+	return FromYAML(bytes.NewReader(merged))
+}
+
+// overridesToYAML converts "key=value" overrides into a YAML document.
+func overridesToYAML(overrides []string) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	for _, override := range overrides {
+		key, value, ok := strings.Cut(override, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid override %q: expected key=value", override)
+		}
+
+		var valueDoc yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &valueDoc); err != nil {
+			return nil, fmt.Errorf("invalid override %q: %w", override, err)
+		}
+
+		valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+		if len(valueDoc.Content) > 0 {
+			valueNode = valueDoc.Content[0]
+		}
+
+		node := root
+		fields := strings.Split(key, ".")
+		for i, field := range fields {
+			if field == "" {
+				return nil, fmt.Errorf("invalid override %q: empty field name", override)
+			}
+
+			// Later overrides of the same field take precedence.
+			child := mappingValue(node, field)
+			if child == nil {
+				child = &yaml.Node{}
+				node.Content = append(node.Content,
+					&yaml.Node{Kind: yaml.ScalarNode, Value: field}, child)
+			}
+
+			if i == len(fields)-1 {
+				*child = *valueNode
+				break
+			}
+
+			if child.Kind != yaml.MappingNode {
+				*child = yaml.Node{Kind: yaml.MappingNode}
+			}
+			node = child
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(root); err != nil {
+		return nil, fmt.Errorf("failed to marshal overrides: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
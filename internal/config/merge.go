@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Merge overlays the given YAML documents in order, so values in later
+// documents override those in earlier ones. Mappings are merged recursively,
+// any other value (including lists) is replaced as a whole.
+func Merge(docs ...[]byte) ([]byte, error) {
+	var merged *yaml.Node
+	for _, data := range docs {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse config: %w", err)
+		}
+
+		// Skip empty documents.
+		if doc.Kind == 0 {
+			continue
+		}
+
+		if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			return nil, errors.New("config is not a YAML mapping")
+		}
+
+		if merged == nil {
+			merged = doc.Content[0]
+			continue
+		}
+
+		mergeMappings(merged, doc.Content[0])
+	}
+
+	if merged == nil {
+		return nil, errors.New("config is empty")
+	}
+
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(merged); err != nil {
+		return nil, fmt.Errorf("failed to marshal merged config: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// mergeMappings overlays the override mapping onto the base mapping.
+func mergeMappings(base, override *yaml.Node) {
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+
+		existing := mappingValue(base, key.Value)
+		switch {
+		case existing == nil:
+			base.Content = append(base.Content, key, value)
+		case existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeMappings(existing, value)
+		default:
+			*existing = *value
+		}
+	}
+}
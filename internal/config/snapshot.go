@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// snapshotTimeFormat is the format of the time in snapshot file names,
+	// which sorts in time order.
+	snapshotTimeFormat = "20060102T150405.000Z"
+	// maxSnapshots is the number of snapshots kept for each config file, the
+	// oldest are removed.
+	maxSnapshots = 20
+)
+
+// Snapshot is a previous version of a config file, saved when it was
+// rewritten.
+type Snapshot struct {
+	// Path is the path of the snapshot.
+	Path string
+	// Time is when the config file was rewritten, replacing this version.
+	Time time.Time
+	// Size is the size of the snapshot in bytes.
+	Size int64
+}
+
+// SnapshotDir returns the directory snapshots of the config file at the
+// given path are kept in.
+func SnapshotDir(path string) string {
+	return filepath.Join(filepath.Dir(path), ".snapshots", filepath.Base(path))
+}
+
+// TakeSnapshot saves the current contents of the config file at the given
+// path as a snapshot, before it is rewritten. It does nothing if the file
+// doesn't exist, or is unchanged since the last snapshot.
+func TakeSnapshot(path string) error {
+	confBytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	snapshots, err := ListSnapshots(path)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) > 0 {
+		latest, err := os.ReadFile(snapshots[0].Path)
+		if err == nil && bytes.Equal(latest, confBytes) {
+			return nil
+		}
+	}
+
+	dir := SnapshotDir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	name := time.Now().UTC().Format(snapshotTimeFormat) + filepath.Ext(path)
+	if err := os.WriteFile(filepath.Join(dir, name), confBytes, 0o600); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	// The new snapshot is the first, so only older snapshots are removed.
+	for i := maxSnapshots - 1; i < len(snapshots); i++ {
+		if err := os.Remove(snapshots[i].Path); err != nil {
+			return fmt.Errorf("failed to remove old snapshot: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ListSnapshots returns the snapshots of the config file at the given path,
+// newest first.
+func ListSnapshots(path string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(SnapshotDir(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot directory: %w", err)
+	}
+
+	var snapshots []Snapshot
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		t, err := time.Parse(snapshotTimeFormat, strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+		if err != nil {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat snapshot: %w", err)
+		}
+
+		snapshots = append(snapshots, Snapshot{
+			Path: filepath.Join(SnapshotDir(path), e.Name()),
+			Time: t,
+			Size: info.Size(),
+		})
+	}
+
+	slices.SortFunc(snapshots, func(a, b Snapshot) int {
+		return b.Time.Compare(a.Time)
+	})
+
+	return snapshots, nil
+}
+
+// Rollback replaces the config file at the given path with the snapshot,
+// after checking that it is valid. The current contents are snapshotted
+// first, so a rollback can itself be rolled back.
+func Rollback(path string, snapshot Snapshot) error {
+	confBytes, err := os.ReadFile(snapshot.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	if _, err := FromYAML(bytes.NewReader(confBytes)); err != nil {
+		return fmt.Errorf("snapshot is invalid: %w", err)
+	}
+
+	if err := TakeSnapshot(path); err != nil {
+		return fmt.Errorf("failed to snapshot config file: %w", err)
+	}
+
+	return writeFileAtomic(path, confBytes)
+}
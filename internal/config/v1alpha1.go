@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/dpeckett/cat-doorbell/internal/config/v1alpha1"
+	"github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"gopkg.in/yaml.v3"
+)
+
+// migrateV1Alpha1ToV1Alpha2 migrates a v1alpha1 config to v1alpha2, which
+// drops the legacy targetMAC field in favour of the targets list, and nests
+// the per-target notification messages and sounds.
+func migrateV1Alpha1ToV1Alpha2(conf *v1alpha1.Config) (*v1alpha2.Config, error) {
+	targets := make([]v1alpha2.TargetConfig, 0, len(conf.Targets)+1)
+	if conf.TargetMAC != "" {
+		targets = append(targets, v1alpha2.TargetConfig{MAC: conf.TargetMAC})
+	}
+
+	for _, t := range conf.Targets {
+		target, err := migrateV1Alpha1Target(t)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", t.Name, err)
+		}
+
+		targets = append(targets, target)
+	}
+
+	unchanged := *conf
+	unchanged.TargetMAC = ""
+	unchanged.Targets = nil
+
+	var migrated v1alpha2.Config
+	if err := convert(&unchanged, &migrated); err != nil {
+		return nil, err
+	}
+
+	if len(targets) > 0 {
+		migrated.Targets = targets
+	}
+
+	migrated.PopulateTypeMeta()
+	migrated.MigratedFrom = conf.GetAPIVersion()
+
+	return &migrated, nil
+}
+
+func migrateV1Alpha1Target(t v1alpha1.TargetConfig) (v1alpha2.TargetConfig, error) {
+	notification := v1alpha2.TargetNotificationConfig{
+		Message:           t.Message,
+		ButtonMessage:     t.ButtonMessage,
+		ArrivalMessage:    t.ArrivalMessage,
+		DepartureMessage:  t.DepartureMessage,
+		StationaryMessage: t.StationaryMessage,
+	}
+
+	sound := v1alpha2.TargetSoundConfig{
+		File:       t.Sound,
+		ButtonFile: t.ButtonSound,
+	}
+
+	t.Message, t.ButtonMessage, t.ArrivalMessage, t.DepartureMessage, t.StationaryMessage = "", "", "", "", ""
+	t.Sound, t.ButtonSound = "", ""
+
+	var migrated v1alpha2.TargetConfig
+	if err := convert(&t, &migrated); err != nil {
+		return v1alpha2.TargetConfig{}, err
+	}
+
+	migrated.Notification = notification
+	migrated.Sound = sound
+
+	return migrated, nil
+}
+
+// convert copies the fields of one version of a config type into another by
+// their YAML names, for fields that are unchanged between the versions.
+func convert(from, to any) error {
+	data, err := yaml.Marshal(from)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, to); err != nil {
+		return fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
+	return nil
+}
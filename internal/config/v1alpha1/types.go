@@ -16,6 +16,9 @@
  * along with this program. If not, see <https://www.gnu.org/licenses/>.
  */
 
+// Package v1alpha1 is the original configuration schema. It is no longer
+// used directly, configuration files using it are migrated to the latest
+// schema when they are loaded.
 package v1alpha1
 
 import (
@@ -27,24 +30,523 @@ import (
 
 const APIVersion = "catdoorbell.github.com/v1alpha1"
 
+// SecretSource is where a secret is read from.
+type SecretSource string
+
+// EventType is the type of event raised when a target device is observed.
+type EventType string
+
+// PayloadFormat is the format of beacon messages published to an MQTT topic.
+type PayloadFormat string
+
 type Config struct {
 	types.TypeMeta `yaml:",inline"`
 	Broker         BrokerConfig `yaml:"broker"`
+	// Scanner configures the built-in BLE scanner.
+	Scanner ScannerConfig `yaml:"scanner,omitempty"`
 	// TargetMAC is the MAC address of the device to listen for.
-	TargetMAC string `yaml:"targetMAC"`
+	// Deprecated: use Targets instead.
+	TargetMAC string `yaml:"targetMAC,omitempty"`
 	// DetectionTimeout is the duration to wait for the device to be detected.
+	// It is used as the default for targets that don't specify their own.
 	DetectionTimeout time.Duration `yaml:"detectionTimeout"`
+	// RSSIThreshold is the minimum signal strength (in dBm, eg. -70) required
+	// for a beacon to ring the doorbell. It is used as the default for targets
+	// that don't specify their own. Zero disables proximity filtering.
+	RSSIThreshold int `yaml:"rssiThreshold,omitempty"`
+	// RSSIWindow is the number of recent beacons whose signal strength is
+	// averaged before comparing against the threshold. It is used as the
+	// default for targets that don't specify their own.
+	RSSIWindow int `yaml:"rssiWindow,omitempty"`
+	// MinBeacons is the number of beacons (that pass the RSSI threshold)
+	// required within WithinWindow before the doorbell rings, so that a
+	// single stray advertisement (eg. from a passing neighbour's device)
+	// doesn't ring it. It is used as the default for targets that don't
+	// specify their own. Zero or one rings on the first beacon.
+	MinBeacons int `yaml:"minBeacons,omitempty"`
+	// WithinWindow is the period MinBeacons must be received within. It is
+	// used as the default for targets that don't specify their own.
+	WithinWindow time.Duration `yaml:"withinWindow,omitempty"`
+	// AbsenceTimeout is how long a target device must go unseen before it is
+	// considered to have departed. It is used as the default for targets that
+	// don't specify their own. Zero disables presence tracking.
+	AbsenceTimeout time.Duration `yaml:"absenceTimeout,omitempty"`
+	// StationaryAfter is how long a target device must beacon continuously
+	// with a near-constant signal strength before it is considered to have
+	// been left behind (eg. a collar that fell off in the garden). It is used
+	// as the default for targets that don't specify their own. Zero disables
+	// the check.
+	StationaryAfter time.Duration `yaml:"stationaryAfter,omitempty"`
+	// StationaryRSSIRange is how much (in dB) the smoothed signal strength of
+	// a stationary device may vary by. It is used as the default for targets
+	// that don't specify their own. Defaults to 6 dB.
+	StationaryRSSIRange int `yaml:"stationaryRSSIRange,omitempty"`
+	// Targets is the list of devices to listen for.
+	Targets []TargetConfig `yaml:"targets,omitempty"`
+	// Notifiers is the list of channels to notify when a device is detected.
+	// Defaults to desktop notifications only.
+	Notifiers []NotifierConfig `yaml:"notifiers,omitempty"`
+	// Actions is the list of commands to run and URLs to request when a
+	// device is detected.
+	Actions []ActionConfig `yaml:"actions,omitempty"`
+	// Events is the list of custom event types (eg. "late-night-visit"),
+	// derived from the built-in events, that notifiers and actions can be
+	// triggered for.
+	Events []EventConfig `yaml:"events,omitempty"`
+	// Privacy configures redaction of device identifiers.
+	Privacy PrivacyConfig `yaml:"privacy,omitempty"`
+	// Sound configures the sounds played when the doorbell rings.
+	Sound SoundConfig `yaml:"sound,omitempty"`
+	// Camera, if specified, includes a snapshot from a doorstep camera in
+	// notifications.
+	Camera *CameraConfig `yaml:"camera,omitempty"`
+	// Anomalies configures detection of unusual visit patterns.
+	Anomalies AnomalyConfig `yaml:"anomalies,omitempty"`
+	// Web configures the web dashboard.
+	Web WebConfig `yaml:"web,omitempty"`
+	// Metrics configures the Prometheus metrics endpoint.
+	Metrics MetricsConfig `yaml:"metrics,omitempty"`
+	// HomeAssistant configures running as a Home Assistant add-on.
+	HomeAssistant HomeAssistantConfig `yaml:"homeAssistant,omitempty"`
+	// Features is the list of experimental features to enable.
+	Features []Feature `yaml:"features,omitempty"`
+}
+
+type WebConfig struct {
+	// ListenAddress is the address (eg. "localhost:8080") the web dashboard
+	// listens on. If not specified, the dashboard is disabled.
+	ListenAddress string `yaml:"listenAddress,omitempty"`
+	// Token, if specified, is a shared token that must be presented as a
+	// bearer token (or a "token" query parameter) when calling any endpoint.
+	Token string `yaml:"token,omitempty"`
+	// Tokens are the API tokens (created with "cat-doorbell token create")
+	// accepted by the server. If any tokens are configured, every endpoint
+	// requires one.
+	Tokens []APITokenConfig `yaml:"tokens,omitempty"`
+	// TLS, if specified, serves the dashboard and API over HTTPS.
+	TLS *WebTLSConfig `yaml:"tls,omitempty"`
+	// Advertise announces the web server on the local network using mDNS (as
+	// "_cat-doorbell._tcp"), so companion apps can find it.
+	Advertise bool `yaml:"advertise,omitempty"`
+	// CORS allows browser applications served from other origins (eg. a Home
+	// Assistant dashboard) to call the API.
+	CORS *CORSConfig `yaml:"cors,omitempty"`
+	// FrameAncestors are the origins (eg. "http://homeassistant.local:8123")
+	// allowed to embed the dashboard in a frame, in addition to the server
+	// itself. "*" allows any origin.
+	FrameAncestors []string `yaml:"frameAncestors,omitempty"`
+	// HomeAssistantIngress trusts requests proxied by Home Assistant ingress
+	// (which authenticates users itself), so they don't require a token.
+	// Enabled by homeAssistant.addon.
+	HomeAssistantIngress bool `yaml:"homeAssistantIngress,omitempty"`
+}
+
+type CORSConfig struct {
+	// AllowedOrigins are the origins (eg. "http://homeassistant.local:8123")
+	// allowed to call the API. "*" allows any origin. Requests that change
+	// state from any other origin are rejected.
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	// AllowCredentials allows browsers to include cookies in requests from
+	// the allowed origins. Can't be used with "*".
+	AllowCredentials bool `yaml:"allowCredentials,omitempty"`
+	// MaxAge is how long browsers may cache the result of preflight requests.
+	// Defaults to 10m.
+	MaxAge time.Duration `yaml:"maxAge,omitempty"`
+}
+
+type APITokenConfig struct {
+	// Name identifies the token (eg. the client it was created for).
+	Name string `yaml:"name"`
+	// Hash is the SHA-256 hash of the token, as "sha256:<hex>". The token
+	// itself is never stored.
+	Hash string `yaml:"hash"`
+}
+
+type WebTLSConfig struct {
+	// CertFile is the path to a PEM encoded certificate (chain). If neither
+	// a certificate or key is specified, a self-signed certificate is
+	// generated.
+	CertFile string `yaml:"certFile,omitempty"`
+	// KeyFile is the path to the PEM encoded private key of the certificate.
+	KeyFile string `yaml:"keyFile,omitempty"`
+}
+
+type EventConfig struct {
+	// Name is the event type raised (eg. "late-night-visit"). It must not be
+	// the name of a built-in event.
+	Name EventType `yaml:"name"`
+	// On is the list of built-in event types the event is derived from.
+	// Defaults to "detected".
+	On []EventType `yaml:"on,omitempty"`
+	// Targets is the list of names of the targets the event is raised for.
+	// Defaults to all targets.
+	Targets []string `yaml:"targets,omitempty"`
+	// Between restricts the event to a time of day.
+	Between *TimeRangeConfig `yaml:"between,omitempty"`
+	// UnacknowledgedFor, if specified, delays the event until the visit has
+	// gone unacknowledged for this long (eg. "long-wait"). The event isn't
+	// raised if the visit is acknowledged first. Only detected and
+	// buttonPressed events start visits.
+	UnacknowledgedFor time.Duration `yaml:"unacknowledgedFor,omitempty"`
+	// Message is a Go template for the notification message, executed with
+	// the notification of the underlying event (.Name, .Message, .RSSI,
+	// .Time etc). Defaults to the message of the underlying event.
+	Message string `yaml:"message,omitempty"`
+}
+
+type TimeRangeConfig struct {
+	// From is the local time of day (as "15:04") the range starts at.
+	From string `yaml:"from"`
+	// To is the local time of day the range ends at (exclusive). If it is
+	// before From, the range spans midnight.
+	To string `yaml:"to"`
+}
+
+type HomeAssistantConfig struct {
+	// Addon runs cat-doorbell as a Home Assistant add-on. The MQTT broker is
+	// discovered from the Supervisor (unless broker.address is set), and the
+	// dashboard is served to Home Assistant ingress on port 8099 (unless
+	// web.listenAddress is set).
+	Addon bool `yaml:"addon,omitempty"`
+}
+
+type MetricsConfig struct {
+	// ListenAddress is the address (eg. "localhost:9090") the Prometheus
+	// metrics endpoint listens on. If not specified, metrics are not served.
+	ListenAddress string `yaml:"listenAddress,omitempty"`
+}
+
+type SoundConfig struct {
+	// File is the path to an MP3, WAV, OGG (Vorbis) or FLAC file to play when a
+	// device is detected. It is used as the default for targets that don't
+	// specify their own. If not specified, the embedded doorbell sound is used.
+	File string `yaml:"file,omitempty"`
+	// ButtonFile is the path to a sound file to play when a device's button is
+	// pressed. Defaults to the detection sound.
+	ButtonFile string `yaml:"buttonFile,omitempty"`
+	// Volume is the playback volume, from 0 (silent) to 1 (unchanged, the
+	// default). Values above 1 amplify the sound.
+	Volume *float64 `yaml:"volume,omitempty"`
+}
+
+type CameraConfig struct {
+	// SnapshotURL is the URL of a current still image from the camera (eg.
+	// "http://camera.local/snapshot.jpg").
+	SnapshotURL string `yaml:"snapshotURL"`
+	// Username, if specified, authenticates with the camera using HTTP basic
+	// authentication.
+	Username string `yaml:"username,omitempty"`
+	// Password is the password for HTTP basic authentication.
+	Password string `yaml:"password,omitempty"`
+	// Timeout is how long to wait for a snapshot before notifying without
+	// one. Defaults to 5s.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Events is the list of event types whose notifications include a
+	// snapshot. Defaults to "detected" and "buttonPressed".
+	Events []EventType `yaml:"events,omitempty"`
+}
+
+type AnomalyConfig struct {
+	// Enabled raises low priority "missing" and "unusualVisit" events when a
+	// target's visits differ from its usual pattern, as learnt from the
+	// history.
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Targets is the list of names of the targets to watch. Defaults to all
+	// targets.
+	Targets []string `yaml:"targets,omitempty"`
+	// NoVisitsFor is how long a target may go without visiting before it is
+	// reported missing. Defaults to 24h.
+	NoVisitsFor time.Duration `yaml:"noVisitsFor,omitempty"`
+	// LearningPeriod is how much of the history a target's usual visiting
+	// hours are learnt from. Defaults to 672h (4 weeks).
+	LearningPeriod time.Duration `yaml:"learningPeriod,omitempty"`
+	// MinVisits is the number of visits within the learning period required
+	// before visits at unusual hours are reported. Defaults to 20.
+	MinVisits int `yaml:"minVisits,omitempty"`
+}
+
+type PrivacyConfig struct {
+	// HashMACs replaces MAC addresses in logs and notifications with a salted
+	// hash. Raw MAC addresses are only kept in memory (and in the history
+	// database).
+	HashMACs bool `yaml:"hashMACs,omitempty"`
+	// Salt is mixed into the MAC address hashes to make them harder to reverse.
+	Salt string `yaml:"salt,omitempty"`
+}
+
+type TargetConfig struct {
+	// Name is the human readable name of the device (eg. the cat's name).
+	Name string `yaml:"name"`
+	// MAC is the MAC address of the device.
+	MAC string `yaml:"mac,omitempty"`
+	// LocalName is a glob pattern (eg. "Tile*") matched against the device's
+	// advertised local name. Useful for devices that use random MAC addresses.
+	LocalName string `yaml:"localName,omitempty"`
+	// ServiceUUID matches devices that advertise the given service UUID (in
+	// 16-bit or 128-bit form). Only supported by the built-in scanner.
+	ServiceUUID string `yaml:"serviceUUID,omitempty"`
+	// IBeacon matches devices that advertise the given iBeacon identity.
+	IBeacon *IBeaconConfig `yaml:"iBeacon,omitempty"`
+	// Eddystone matches devices that advertise the given Eddystone-UID
+	// identity.
+	Eddystone *EddystoneConfig `yaml:"eddystone,omitempty"`
+	// DetectionTimeout overrides the default detection timeout for this device.
+	DetectionTimeout time.Duration `yaml:"detectionTimeout,omitempty"`
+	// RSSIThreshold overrides the default RSSI threshold for this device.
+	RSSIThreshold int `yaml:"rssiThreshold,omitempty"`
+	// RSSIWindow overrides the default RSSI smoothing window for this device.
+	RSSIWindow int `yaml:"rssiWindow,omitempty"`
+	// MinBeacons overrides the default number of beacons required to ring
+	// the doorbell for this device.
+	MinBeacons int `yaml:"minBeacons,omitempty"`
+	// WithinWindow overrides the default period MinBeacons must be received
+	// within for this device.
+	WithinWindow time.Duration `yaml:"withinWindow,omitempty"`
+	// Message is the notification message to display when the device is detected.
+	Message string `yaml:"message,omitempty"`
+	// Button indicates the device is an iTag style keyfinder whose button
+	// presses should raise "buttonPressed" events. Only supported by the
+	// built-in scanner.
+	Button bool `yaml:"button,omitempty"`
+	// ButtonMessage is the notification message to display when the device's
+	// button is pressed.
+	ButtonMessage string `yaml:"buttonMessage,omitempty"`
+	// AbsenceTimeout overrides the default absence timeout for this device.
+	AbsenceTimeout time.Duration `yaml:"absenceTimeout,omitempty"`
+	// NotifyDeparture raises a notification when the device departs.
+	NotifyDeparture bool `yaml:"notifyDeparture,omitempty"`
+	// ArrivalMessage is the notification message to display when the device
+	// arrives after being away.
+	ArrivalMessage string `yaml:"arrivalMessage,omitempty"`
+	// DepartureMessage is the notification message to display when the
+	// device departs.
+	DepartureMessage string `yaml:"departureMessage,omitempty"`
+	// StationaryAfter overrides the default stationary period for this
+	// device.
+	StationaryAfter time.Duration `yaml:"stationaryAfter,omitempty"`
+	// StationaryRSSIRange overrides the default stationary signal strength
+	// range for this device.
+	StationaryRSSIRange int `yaml:"stationaryRSSIRange,omitempty"`
+	// StationaryMessage is the notification message to display when the
+	// device is found to be stationary.
+	StationaryMessage string `yaml:"stationaryMessage,omitempty"`
+	// Color is the accent colour (eg. "#ff8800") used to distinguish the
+	// device in the user interface. Defaults to a colour from a built-in
+	// palette.
+	Color string `yaml:"color,omitempty"`
+	// Sound overrides the default sound file to play when the device is
+	// detected.
+	Sound string `yaml:"sound,omitempty"`
+	// ButtonSound overrides the default sound file to play when the device's
+	// button is pressed.
+	ButtonSound string `yaml:"buttonSound,omitempty"`
+}
+
+type IBeaconConfig struct {
+	// UUID is the 128-bit proximity UUID of the beacon.
+	UUID string `yaml:"uuid"`
+	// Major is the major identifier of the beacon. If not specified, any
+	// major identifier matches.
+	Major *uint16 `yaml:"major,omitempty"`
+	// Minor is the minor identifier of the beacon. If not specified, any
+	// minor identifier matches.
+	Minor *uint16 `yaml:"minor,omitempty"`
+}
+
+type EddystoneConfig struct {
+	// Namespace is the 10-byte namespace of the beacon, as hex.
+	Namespace string `yaml:"namespace"`
+	// Instance is the 6-byte instance of the beacon, as hex. If not
+	// specified, any beacon in the namespace matches.
+	Instance string `yaml:"instance,omitempty"`
 }
 
 type BrokerConfig struct {
-	// Address is the address of the MQTT broker.
+	// Address is the address of the MQTT broker. If not specified, beacons will
+	// not be received from an MQTT broker.
 	Address string `yaml:"address"`
 	// Username is the username for authenticating with the MQTT broker.
 	Username string `yaml:"username"`
 	// Password is the password for authenticating with the MQTT broker.
 	Password string `yaml:"password"`
+	// PasswordFrom reads the password from somewhere other than the
+	// configuration file. "keyring" reads the "broker-password" secret from
+	// the operating system's keyring (see "cat-doorbell secret set").
+	PasswordFrom SecretSource `yaml:"passwordFrom,omitempty"`
+	// TLS configures TLS for the connection to the MQTT broker.
+	TLS *TLSConfig `yaml:"tls,omitempty"`
+	// Topics is the list of topics to subscribe to for beacons.
+	// Defaults to "bluetooth/devices" with raw payloads.
+	Topics []TopicConfig `yaml:"topics,omitempty"`
+	// EncryptionKey is a base64 encoded 256-bit pre-shared key used to encrypt
+	// beacons published in scanner mode, and to decrypt beacons received on
+	// encrypted topics.
+	EncryptionKey string `yaml:"encryptionKey,omitempty"`
+	// AcknowledgeButton configures a smart button (eg. by the door) whose
+	// presses acknowledge the current visit.
+	AcknowledgeButton *AcknowledgeButtonConfig `yaml:"acknowledgeButton,omitempty"`
+	// AutoReconnect reconnects (and resubscribes) automatically when the
+	// connection to the broker is lost. Defaults to true.
+	AutoReconnect *bool `yaml:"autoReconnect,omitempty"`
+	// ConnectRetryInterval is how long to wait between attempts to connect
+	// to the broker, including the initial connection. Defaults to 10s.
+	ConnectRetryInterval time.Duration `yaml:"connectRetryInterval,omitempty"`
+	// KeepAlive is how often the broker is pinged while no other messages
+	// are sent, so that broken connections are detected. Defaults to 30s.
+	KeepAlive time.Duration `yaml:"keepAlive,omitempty"`
+	// CleanSession discards the session (subscriptions and queued messages)
+	// when disconnecting. Set it to false to have the broker queue QoS 1 and
+	// 2 beacons while disconnected. Defaults to true.
+	CleanSession *bool `yaml:"cleanSession,omitempty"`
+	// ClientID identifies the client to the broker. Defaults to
+	// "<hostname>-<pid>", or "cat-doorbell-<hostname>" if clean sessions are
+	// disabled, so that the session survives restarts.
+	ClientID string `yaml:"clientID,omitempty"`
+	// OrderMatters handles messages one at a time, in the order they were
+	// received. If false, messages are handled concurrently. Defaults to
+	// true.
+	OrderMatters *bool `yaml:"orderMatters,omitempty"`
+}
+
+type AcknowledgeButtonConfig struct {
+	// Topic is the MQTT topic the button publishes to when pressed.
+	Topic string `yaml:"topic"`
+	// Action, if specified, only acknowledges messages whose payload is the
+	// given value, or a JSON object with an "action" field of the given value
+	// (eg. "single" for Zigbee2MQTT buttons). Otherwise every message
+	// published to the topic acknowledges the current visit.
+	Action string `yaml:"action,omitempty"`
 }
 
+type TopicConfig struct {
+	// Topic is the MQTT topic to subscribe to. The single-level ("+") and
+	// multi-level ("#") wildcards can be used to subscribe to the topics of
+	// several gateways at once.
+	Topic string `yaml:"topic"`
+	// QoS is the MQTT quality of service level for the subscription (0, 1 or 2).
+	QoS byte `yaml:"qos,omitempty"`
+	// PayloadFormat is the format of messages published to the topic.
+	// Defaults to "raw".
+	PayloadFormat PayloadFormat `yaml:"payloadFormat,omitempty"`
+	// Encrypted indicates that messages published to the topic are encrypted
+	// with the broker encryption key.
+	Encrypted bool `yaml:"encrypted,omitempty"`
+}
+
+type TLSConfig struct {
+	// CACert is the path to a PEM encoded CA certificate bundle used to verify
+	// the broker's certificate. If not specified, the system roots are used.
+	CACert string `yaml:"caCert,omitempty"`
+	// Cert is the path to a PEM encoded client certificate for mutual TLS.
+	Cert string `yaml:"cert,omitempty"`
+	// Key is the path to the PEM encoded private key for the client certificate.
+	Key string `yaml:"key,omitempty"`
+	// InsecureSkipVerify disables verification of the broker's certificate.
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify,omitempty"`
+	// ServerName overrides the server name used for SNI and certificate
+	// verification.
+	ServerName string `yaml:"serverName,omitempty"`
+}
+
+type ScannerConfig struct {
+	// Enabled enables listening for advertisements using the host's Bluetooth
+	// adapter, as an alternative (or in addition) to an MQTT broker.
+	Enabled bool `yaml:"enabled"`
+	// PublishTopic is the MQTT topic beacons are published to when running in
+	// scanner (forwarder) mode. Defaults to "cat-doorbell/beacons".
+	PublishTopic string `yaml:"publishTopic,omitempty"`
+}
+
+type NotifierConfig struct {
+	// Name identifies the notifier in logs. Defaults to the notifier type.
+	Name string `yaml:"name,omitempty"`
+	// Events is the list of event types the notifier is triggered for.
+	// Defaults to "detected", "buttonPressed" and "departed".
+	Events []EventType `yaml:"events,omitempty"`
+	// Desktop raises local desktop notifications.
+	Desktop *DesktopConfig `yaml:"desktop,omitempty"`
+	// Telegram sends messages using a Telegram bot.
+	Telegram *TelegramConfig `yaml:"telegram,omitempty"`
+	// Pushover sends push notifications using Pushover.
+	Pushover *PushoverConfig `yaml:"pushover,omitempty"`
+	// Ntfy publishes notifications to an ntfy topic.
+	Ntfy *NtfyConfig `yaml:"ntfy,omitempty"`
+	// Webhook sends notifications to a generic HTTP endpoint.
+	Webhook *WebhookConfig `yaml:"webhook,omitempty"`
+}
+
+type DesktopConfig struct{}
+
+type TelegramConfig struct {
+	// BotToken is the token of the Telegram bot used to send messages.
+	BotToken string `yaml:"botToken"`
+	// ChatID is the ID of the chat to send messages to.
+	ChatID string `yaml:"chatID"`
+}
+
+type PushoverConfig struct {
+	// Token is the Pushover application API token.
+	Token string `yaml:"token"`
+	// UserKey is the Pushover user (or group) key to send notifications to.
+	UserKey string `yaml:"userKey"`
+	// Priority is the Pushover message priority (-2 to 2).
+	Priority int `yaml:"priority,omitempty"`
+	// Sound is the name of the Pushover sound to play.
+	Sound string `yaml:"sound,omitempty"`
+}
+
+type NtfyConfig struct {
+	// Server is the URL of the ntfy server. Defaults to "https://ntfy.sh".
+	Server string `yaml:"server,omitempty"`
+	// Topic is the ntfy topic to publish notifications to.
+	Topic string `yaml:"topic"`
+	// Token is an optional access token for authenticating with the server.
+	Token string `yaml:"token,omitempty"`
+	// Priority is the ntfy message priority (1 to 5).
+	Priority int `yaml:"priority,omitempty"`
+}
+
+type WebhookConfig struct {
+	// URL is the endpoint to send notifications to.
+	URL string `yaml:"url"`
+	// Method is the HTTP method to use. Defaults to POST.
+	Method string `yaml:"method,omitempty"`
+	// Headers are additional HTTP headers to send with the request.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Body is a Go template for the request body. The template is executed
+	// with the notification (.Title, .Message, .Name, .MAC, .RSSI and .Time)
+	// and may use the "json" function to encode values. Defaults to the
+	// notification encoded as JSON.
+	Body string `yaml:"body,omitempty"`
+}
+
+type ActionConfig struct {
+	// Name identifies the action in logs. Defaults to the action type.
+	Name string `yaml:"name,omitempty"`
+	// Events is the list of event types the action is triggered for.
+	// Defaults to "detected".
+	Events []EventType `yaml:"events,omitempty"`
+	// Targets is the list of names of the targets the action is triggered
+	// for. Defaults to all targets.
+	Targets []string `yaml:"targets,omitempty"`
+	// Command is a command to run, followed by its arguments. Each argument is
+	// a Go template executed with the notification (.Name, .MAC, .RSSI, .Time
+	// etc). The same values are passed in CAT_DOORBELL_* environment variables.
+	Command []string `yaml:"command,omitempty"`
+	// Webhook sends an HTTP request.
+	Webhook *WebhookConfig `yaml:"webhook,omitempty"`
+	// Timeout is how long the action may run before it is cancelled.
+	// Defaults to 30s.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// RateLimit is the minimum time between runs of the action, events within
+	// it are skipped. Defaults to no limit.
+	RateLimit time.Duration `yaml:"rateLimit,omitempty"`
+}
+
+// Feature is an experimental feature that must be explicitly enabled in the
+// configuration before it can be used.
+type Feature string
+
 func (c *Config) GetAPIVersion() string {
 	return APIVersion
 }
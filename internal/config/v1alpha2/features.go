@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package v1alpha2
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Feature is an experimental feature that must be explicitly enabled in the
+// configuration before it can be used.
+type Feature string
+
+// experimentalFeatures describes the known experimental features. Features
+// are removed from this list once they are considered stable.
+var experimentalFeatures = map[Feature]string{}
+
+// FeatureEnabled returns true if the given experimental feature is enabled.
+func (c *Config) FeatureEnabled(f Feature) bool {
+	return slices.Contains(c.Features, f)
+}
+
+// requireFeature returns an error if the given experimental feature is not
+// enabled, for use when validating fields that depend on it.
+func (c *Config) requireFeature(f Feature, field string) error {
+	if !c.FeatureEnabled(f) {
+		return fmt.Errorf("%s requires the experimental %q feature to be enabled", field, f)
+	}
+
+	return nil
+}
+
+func validateFeatures(features []Feature) error {
+	for _, f := range features {
+		if _, ok := experimentalFeatures[f]; !ok {
+			return fmt.Errorf("unknown experimental feature: %q", f)
+		}
+	}
+
+	return nil
+}
+
+// Deprecation describes a deprecated configuration field that is in use.
+type Deprecation struct {
+	// Field is the path of the deprecated field (eg. "targetMAC").
+	Field string
+	// Replacement is the field that should be used instead, if any.
+	Replacement string
+}
+
+func (d Deprecation) String() string {
+	if d.Replacement == "" {
+		return fmt.Sprintf("%s is deprecated", d.Field)
+	}
+
+	return fmt.Sprintf("%s is deprecated, use %s instead", d.Field, d.Replacement)
+}
+
+// deprecatedFields lists the deprecated fields, and how to tell if each of
+// them is set.
+var deprecatedFields = []struct {
+	Deprecation
+	isSet func(c *Config) bool
+}{
+	{
+		Deprecation: Deprecation{Field: "apiVersion catdoorbell.github.com/v1alpha1", Replacement: APIVersion},
+		isSet:       func(c *Config) bool { return c.MigratedFrom == "catdoorbell.github.com/v1alpha1" },
+	},
+}
+
+// Deprecations returns the deprecated fields used by the configuration, as
+// recorded by PopulateDefaults before they were migrated to their
+// replacements.
+func (c *Config) Deprecations() []Deprecation {
+	return c.deprecations
+}
+
+func (c *Config) findDeprecations() []Deprecation {
+	var deprecations []Deprecation
+	for _, f := range deprecatedFields {
+		if f.isSet(c) {
+			deprecations = append(deprecations, f.Deprecation)
+		}
+	}
+
+	return deprecations
+}
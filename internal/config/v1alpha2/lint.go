@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package v1alpha2
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Lint returns warnings about configuration values that are valid but are
+// likely to be mistakes. It should be called after PopulateDefaults.
+func (c *Config) Lint() []string {
+	var warnings []string
+
+	checkedSounds := make(map[string]bool)
+	for i, t := range c.Targets {
+		if t.DetectionTimeout == 0 {
+			warnings = append(warnings, fmt.Sprintf("target %q: detectionTimeout is 0, every beacon will ring the doorbell", t.Name))
+		}
+
+		if t.RSSIThreshold > 0 {
+			warnings = append(warnings, fmt.Sprintf("target %q: rssiThreshold of %d dBm is above 0 dBm and will never be reached", t.Name, t.RSSIThreshold))
+		}
+
+		// Beacons that could match several targets are only attributed to
+		// the first of them that is listed.
+		for _, other := range c.Targets[:i] {
+			if reason, ok := t.Overlap(&other); ok {
+				warnings = append(warnings, fmt.Sprintf("target %q: could match the same beacons as target %q (%s), which takes precedence", t.Name, other.Name, reason))
+			}
+		}
+
+		for _, sound := range []string{t.Sound.File, t.Sound.ButtonFile} {
+			if sound == "" || checkedSounds[sound] {
+				continue
+			}
+			checkedSounds[sound] = true
+
+			if _, err := os.Stat(sound); err != nil {
+				warnings = append(warnings, fmt.Sprintf("target %q: sound file is not accessible: %v", t.Name, err))
+			}
+		}
+	}
+
+	for _, s := range c.Sound.Schedule {
+		if s.File == "" || checkedSounds[s.File] {
+			continue
+		}
+		checkedSounds[s.File] = true
+
+		if _, err := os.Stat(s.File); err != nil {
+			warnings = append(warnings, fmt.Sprintf("sound schedule %s-%s: sound file is not accessible: %v", s.From, s.To, err))
+		}
+	}
+
+	if c.Sound.Device != "" && runtime.GOOS != "linux" {
+		warnings = append(warnings, fmt.Sprintf("sound device is only supported on Linux, the default output device is used instead of %q", c.Sound.Device))
+	}
+
+	if c.Sound.DuckOthers && runtime.GOOS != "linux" {
+		warnings = append(warnings, "sound duckOthers is only supported on Linux, other applications won't be made quieter")
+	}
+
+	if c.Sound.FollowMe && runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		warnings = append(warnings, "sound followMe is only supported on Linux and macOS, sounds will be played regardless of the session state")
+	}
+
+	if c.Sound.QuietDuringCalls && runtime.GOOS != "linux" {
+		warnings = append(warnings, "sound quietDuringCalls is only supported on Linux, sounds will be played during calls")
+	}
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		for _, n := range c.Notifiers {
+			if n.Screen != "" {
+				warnings = append(warnings, fmt.Sprintf("notifier %q: screen is only supported on Linux and macOS, the notifier is triggered regardless of the lock state", n.Name))
+			}
+
+			if n.SkipIf != nil && n.SkipIf.Screen != "" {
+				warnings = append(warnings, fmt.Sprintf("notifier %q: skipIf screen is only supported on Linux and macOS, the notifier is never skipped", n.Name))
+			}
+		}
+	}
+
+	for _, n := range c.Notifiers {
+		if n.SkipIf == nil {
+			continue
+		}
+
+		// A notifier can only be skipped for events the notifiers it refers
+		// to are triggered for too.
+		shared := slices.ContainsFunc(c.Notifiers, func(other NotifierConfig) bool {
+			return slices.Contains(n.SkipIf.Delivered, other.Name) &&
+				slices.ContainsFunc(n.Events, func(e EventType) bool { return slices.Contains(other.Events, e) })
+		})
+		if !shared {
+			warnings = append(warnings, fmt.Sprintf("notifier %q: skipIf refers to notifiers that aren't triggered for any of its events, it will never be skipped", n.Name))
+		}
+	}
+
+	if c.Broker.Proxy != "" && !slices.ContainsFunc(c.Broker.Brokers(), func(b BrokerConfig) bool {
+		return strings.HasPrefix(b.Address, "ws://") || strings.HasPrefix(b.Address, "wss://")
+	}) {
+		warnings = append(warnings, "broker proxy is only used for ws:// and wss:// addresses, and no broker has one")
+	}
+
+	return warnings
+}
@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package v1alpha2
+
+import (
+	"path"
+	"strings"
+)
+
+// globMeta are the characters with a special meaning in local name globs.
+const globMeta = `*?[]\`
+
+// Overlap returns why the two targets could match the same beacon, or false
+// if they can't (or share no kind of criteria). It should be called after
+// PopulateDefaults. Targets matched by MAC address only overlap if their
+// addresses are the same, as the advertisements of a MAC address aren't known
+// in advance.
+func (t *TargetConfig) Overlap(other *TargetConfig) (string, bool) {
+	if t.MAC != "" || other.MAC != "" {
+		if t.MAC == other.MAC {
+			return "the same MAC address", true
+		}
+
+		return "", false
+	}
+
+	// A beacon is either an iBeacon or an Eddystone beacon.
+	if (t.IBeacon != nil && t.Eddystone == nil && other.Eddystone != nil && other.IBeacon == nil) ||
+		(t.Eddystone != nil && t.IBeacon == nil && other.IBeacon != nil && other.Eddystone == nil) {
+		return "", false
+	}
+
+	var reasons []string
+
+	if t.LocalName != "" && other.LocalName != "" {
+		if !globsOverlap(t.LocalName, other.LocalName) {
+			return "", false
+		}
+
+		reasons = append(reasons, "overlapping local names")
+	}
+
+	// Devices rarely advertise more than one service UUID, so targets
+	// matching different ones are taken not to overlap.
+	if t.ServiceUUID != "" && other.ServiceUUID != "" {
+		if t.ServiceUUID != other.ServiceUUID {
+			return "", false
+		}
+
+		reasons = append(reasons, "the same service UUID")
+	}
+
+	if t.IBeacon != nil && other.IBeacon != nil {
+		if t.IBeacon.UUID != other.IBeacon.UUID ||
+			differ(t.IBeacon.Major, other.IBeacon.Major) || differ(t.IBeacon.Minor, other.IBeacon.Minor) {
+			return "", false
+		}
+
+		reasons = append(reasons, "the same iBeacon UUID")
+	}
+
+	if t.Eddystone != nil && other.Eddystone != nil {
+		if t.Eddystone.Namespace != other.Eddystone.Namespace ||
+			(t.Eddystone.Instance != "" && other.Eddystone.Instance != "" && t.Eddystone.Instance != other.Eddystone.Instance) {
+			return "", false
+		}
+
+		reasons = append(reasons, "the same Eddystone namespace")
+	}
+
+	// Targets matched by different kinds of criteria (eg. a local name and
+	// an iBeacon identity) are usually different devices, so they are only
+	// reported when a beacon actually matches both.
+	if len(reasons) == 0 {
+		return "", false
+	}
+
+	return strings.Join(reasons, " and "), true
+}
+
+// differ returns whether both identifiers are specified and different.
+func differ(a, b *uint16) bool {
+	return a != nil && b != nil && *a != *b
+}
+
+// globsOverlap returns whether some local name could match both globs. Globs
+// without special characters are matched against the other glob, otherwise
+// they overlap unless their literal prefixes or suffixes conflict.
+func globsOverlap(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	if !strings.ContainsAny(a, globMeta) {
+		ok, _ := path.Match(b, a)
+		return ok
+	}
+
+	if !strings.ContainsAny(b, globMeta) {
+		ok, _ := path.Match(a, b)
+		return ok
+	}
+
+	prefixA, prefixB := literalPrefix(a), literalPrefix(b)
+	if !strings.HasPrefix(prefixA, prefixB) && !strings.HasPrefix(prefixB, prefixA) {
+		return false
+	}
+
+	suffixA, suffixB := literalSuffix(a), literalSuffix(b)
+	return strings.HasSuffix(suffixA, suffixB) || strings.HasSuffix(suffixB, suffixA)
+}
+
+// literalPrefix returns the part of a glob before its first special
+// character.
+func literalPrefix(glob string) string {
+	if i := strings.IndexAny(glob, globMeta); i >= 0 {
+		return glob[:i]
+	}
+
+	return glob
+}
+
+// literalSuffix returns the part of a glob after its last special character.
+func literalSuffix(glob string) string {
+	if i := strings.LastIndexAny(glob, globMeta); i >= 0 {
+		return glob[i+1:]
+	}
+
+	return glob
+}
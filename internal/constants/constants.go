@@ -18,6 +18,19 @@
 
 package constants
 
+import "time"
+
+// SoundLatencyBudget is how soon after a beacon is received the doorbell
+// sound should be heard.
+const SoundLatencyBudget = 300 * time.Millisecond
+
 var (
 	Version = "dev"
+	// Commit is the commit the binary was built from, if set at build time
+	// (eg. with -ldflags "-X .../constants.Commit=..."). Otherwise it is
+	// taken from the version control information embedded by the Go
+	// toolchain.
+	Commit = ""
+	// BuildDate is when the binary was built, if set at build time.
+	BuildDate = ""
 )
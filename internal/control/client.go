@@ -0,0 +1,256 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/web"
+)
+
+// ErrNotRunning is returned when there is no instance listening on the
+// control socket.
+var ErrNotRunning = errors.New("cat-doorbell isn't running")
+
+// Client sends requests to the running instance.
+type Client struct {
+	path   string
+	client *http.Client
+}
+
+// NewClient creates a client for the control socket at the given path.
+func NewClient(path string) *Client {
+	return &Client{
+		path: path,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", path)
+				},
+			},
+			// Test detections wait for every notifier to respond.
+			Timeout: time.Minute,
+		},
+	}
+}
+
+// Status returns a snapshot of the running instance's state.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/status", nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// Pause suppresses notifications for the given duration, or until resumed
+// if the duration is zero.
+func (c *Client) Pause(ctx context.Context, duration time.Duration) (*Status, error) {
+	var req pauseRequest
+	if duration > 0 {
+		req.Duration = duration.String()
+	}
+
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/pause", req, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// Resume re-enables notifications.
+func (c *Client) Resume(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/resume", nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// StartMaintenance starts maintenance mode for the given duration, or until
+// stopped if the duration is zero.
+func (c *Client) StartMaintenance(ctx context.Context, duration time.Duration) (*Status, error) {
+	var req maintenanceRequest
+	if duration > 0 {
+		req.Duration = duration.String()
+	}
+
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/maintenance/start", req, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// StopMaintenance ends manually started maintenance mode.
+func (c *Client) StopMaintenance(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/maintenance/stop", nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// StartExpecting starts expect mode for the given duration, or for the
+// configured duration if it is zero.
+func (c *Client) StartExpecting(ctx context.Context, duration time.Duration) (*Status, error) {
+	var req expectRequest
+	if duration > 0 {
+		req.Duration = duration.String()
+	}
+
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/expect/start", req, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// StopExpecting ends expect mode early.
+func (c *Client) StopExpecting(ctx context.Context) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodPost, "/expect/stop", nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// TestDetection rings the doorbell for a fake detection of the named target
+// (or the first target if the name is empty).
+func (c *Client) TestDetection(ctx context.Context, target string) ([]TestResult, error) {
+	path := "/test"
+	if target != "" {
+		path += "?" + url.Values{"target": {target}}.Encode()
+	}
+
+	var results []TestResult
+	if err := c.do(ctx, http.MethodPost, path, nil, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// StartRecording starts recording beacons, and returns the path of the
+// recording.
+func (c *Client) StartRecording(ctx context.Context) (string, error) {
+	var resp recordingResponse
+	if err := c.do(ctx, http.MethodPost, "/recording/start", nil, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.Path, nil
+}
+
+// StopRecording stops recording beacons.
+func (c *Client) StopRecording(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/recording/stop", nil, nil)
+}
+
+// InjectFaults injects faults into the running instance's connection to the
+// broker, and returns the faults being injected.
+func (c *Client) InjectFaults(ctx context.Context, injection FaultInjection) (*Faults, error) {
+	req := faultRequest{Disconnect: injection.Disconnect, Drop: injection.Drop}
+	if injection.Latency != nil {
+		req.Latency = injection.Latency.String()
+	}
+
+	var faults Faults
+	if err := c.do(ctx, http.MethodPost, "/faults", req, &faults); err != nil {
+		return nil, err
+	}
+
+	return &faults, nil
+}
+
+// Evaluate works out what receiving a beacon would do in the running
+// instance, without doing it.
+func (c *Client) Evaluate(ctx context.Context, b web.Beacon) (*web.Evaluation, error) {
+	var evaluation web.Evaluation
+	if err := c.do(ctx, http.MethodPost, "/evaluate", b, &evaluation); err != nil {
+		return nil, err
+	}
+
+	return &evaluation, nil
+}
+
+// do sends a request with an optional JSON body, and decodes the JSON
+// response into out (if not nil).
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+
+	// The host is ignored, as requests are sent over the socket.
+	req, err := http.NewRequestWithContext(ctx, method, "http://cat-doorbell"+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return fmt.Errorf("%w (failed to connect to control socket %s)", ErrNotRunning, c.path)
+		}
+
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("request failed: %s", strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,427 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package control lets commands control the running instance over a local
+// unix socket (which Windows also supports).
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/web"
+)
+
+// shutdownTimeout is how long in-flight requests are given to complete on
+// shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// ErrAlreadyRunning is returned when another instance is listening on the
+// control socket.
+var ErrAlreadyRunning = errors.New("another instance is already running")
+
+// ErrDeveloperMode is returned when faults are injected into an instance
+// that wasn't started in developer mode.
+var ErrDeveloperMode = errors.New("developer mode isn't enabled (start cat-doorbell with --dev)")
+
+// Status is a snapshot of the running instance's state.
+type Status struct {
+	web.Status
+	// Recording is the path of the recording beacons are written to, if they
+	// are being recorded.
+	Recording string `json:"recording,omitempty"`
+}
+
+// TestResult is the outcome of delivering a test detection's notification
+// to a single notifier.
+type TestResult struct {
+	// Notifier is the name of the notifier.
+	Notifier string `json:"notifier"`
+	// Latency is how long delivery took.
+	Latency time.Duration `json:"latency"`
+	// Error is why delivery failed, if it did.
+	Error string `json:"error,omitempty"`
+	// Queued is true if the notification was queued, to be delivered once
+	// the notifier's service is reachable again.
+	Queued bool `json:"queued,omitempty"`
+}
+
+// FaultInjection describes faults to inject into the connection to the
+// broker.
+type FaultInjection struct {
+	// Disconnect drops the connection to the broker, as if it was lost.
+	Disconnect bool
+	// Drop, if not nil, is how many of the next received messages to drop.
+	Drop *int
+	// Latency, if not nil, is how long each received message is delayed
+	// before it is handled.
+	Latency *time.Duration
+}
+
+// Faults describes the faults being injected into the connection to the
+// broker.
+type Faults struct {
+	// Drop is how many more received messages will be dropped.
+	Drop int `json:"drop"`
+	// Latency is how long each received message is delayed before it is
+	// handled.
+	Latency time.Duration `json:"latency"`
+}
+
+// Doorbell is the running instance controlled through the socket.
+type Doorbell interface {
+	// ControlStatus returns a snapshot of the doorbell state.
+	ControlStatus() Status
+	// Pause suppresses notifications for the given duration, or until Resume
+	// is called if the duration is zero.
+	Pause(duration time.Duration)
+	// Resume re-enables notifications.
+	Resume()
+	// TestDetection rings the doorbell for a fake detection of the named
+	// target (or the first target if the name is empty), and returns the
+	// result of delivering its notification to each notifier.
+	TestDetection(ctx context.Context, target string) ([]TestResult, error)
+	// StartRecording starts recording beacons, and returns the path of the
+	// recording.
+	StartRecording() (string, error)
+	// StopRecording stops recording beacons.
+	StopRecording()
+	// StartMaintenance starts maintenance mode for the given duration, or
+	// until StopMaintenance is called if the duration is zero.
+	StartMaintenance(duration time.Duration)
+	// StopMaintenance ends manually started maintenance mode.
+	StopMaintenance()
+	// StartExpecting starts expect mode for the given duration, or for the
+	// configured duration if it is zero.
+	StartExpecting(duration time.Duration)
+	// StopExpecting ends expect mode early.
+	StopExpecting()
+	// InjectFaults injects faults into the connection to the broker, and
+	// returns the faults being injected. It returns ErrDeveloperMode unless
+	// the doorbell was started in developer mode.
+	InjectFaults(faults FaultInjection) (Faults, error)
+	// Evaluate works out what receiving a beacon would do, without doing
+	// it.
+	Evaluate(ctx context.Context, b web.Beacon) (web.Evaluation, error)
+}
+
+// pauseRequest is the body of a pause request.
+type pauseRequest struct {
+	// Duration is how long to pause notifications for (eg. "30m"). If not
+	// specified, notifications are paused until resumed.
+	Duration string `json:"duration,omitempty"`
+}
+
+// maintenanceRequest is the body of a request to start maintenance mode.
+type maintenanceRequest struct {
+	// Duration is how long maintenance mode lasts (eg. "30m"). If not
+	// specified, it lasts until stopped.
+	Duration string `json:"duration,omitempty"`
+}
+
+// expectRequest is the body of a request to start expect mode.
+type expectRequest struct {
+	// Duration is how long expect mode lasts (eg. "30m"). If not specified,
+	// it lasts for the configured duration.
+	Duration string `json:"duration,omitempty"`
+}
+
+// faultRequest is the body of a fault injection request.
+type faultRequest struct {
+	// Disconnect drops the connection to the broker, as if it was lost.
+	Disconnect bool `json:"disconnect,omitempty"`
+	// Drop is how many of the next received messages to drop.
+	Drop *int `json:"drop,omitempty"`
+	// Latency is how long each received message is delayed (eg. "500ms", or
+	// "0s" for no delay).
+	Latency string `json:"latency,omitempty"`
+}
+
+// recordingResponse is the body of a response to a recording request.
+type recordingResponse struct {
+	// Path is the path of the recording.
+	Path string `json:"path"`
+}
+
+// Server serves the control socket.
+type Server struct {
+	path     string
+	listener net.Listener
+	doorbell Doorbell
+}
+
+// Listen listens on the control socket at the given path. It returns
+// ErrAlreadyRunning if another instance is already listening on it, and
+// replaces the socket if it was left behind by an instance that exited.
+func Listen(path string, doorbell Doorbell) (*Server, error) {
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w (control socket %s)", ErrAlreadyRunning, path)
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+
+	// Only the user running the doorbell may control it.
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to restrict control socket permissions: %w", err)
+	}
+
+	return &Server{path: path, listener: listener, doorbell: doorbell}, nil
+}
+
+// Close stops listening on the control socket.
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// Run serves control requests until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("POST /pause", s.handlePause)
+	mux.HandleFunc("POST /resume", s.handleResume)
+	mux.HandleFunc("POST /test", s.handleTest)
+	mux.HandleFunc("POST /recording/start", s.handleStartRecording)
+	mux.HandleFunc("POST /recording/stop", s.handleStopRecording)
+	mux.HandleFunc("POST /maintenance/start", s.handleStartMaintenance)
+	mux.HandleFunc("POST /maintenance/stop", s.handleStopMaintenance)
+	mux.HandleFunc("POST /expect/start", s.handleStartExpecting)
+	mux.HandleFunc("POST /expect/stop", s.handleStopExpecting)
+	mux.HandleFunc("POST /faults", s.handleFaults)
+	mux.HandleFunc("POST /evaluate", s.handleEvaluate)
+
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Failed to shut down control socket", slog.Any("error", err))
+		}
+	}()
+
+	slog.Debug("Listening on control socket", slog.String("path", s.path))
+
+	if err := srv.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve control socket: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, s.doorbell.ControlStatus())
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	var req pauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.doorbell.Pause(duration)
+
+	writeJSON(w, s.doorbell.ControlStatus())
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, _ *http.Request) {
+	s.doorbell.Resume()
+
+	writeJSON(w, s.doorbell.ControlStatus())
+}
+
+func (s *Server) handleTest(w http.ResponseWriter, r *http.Request) {
+	results, err := s.doorbell.TestDetection(r.Context(), r.URL.Query().Get("target"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if results == nil {
+		results = []TestResult{}
+	}
+
+	writeJSON(w, results)
+}
+
+func (s *Server) handleStartRecording(w http.ResponseWriter, _ *http.Request) {
+	path, err := s.doorbell.StartRecording()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, recordingResponse{Path: path})
+}
+
+func (s *Server) handleStopRecording(w http.ResponseWriter, _ *http.Request) {
+	s.doorbell.StopRecording()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	var b web.Beacon
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	evaluation, err := s.doorbell.Evaluate(r.Context(), b)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, evaluation)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write response", slog.Any("error", err))
+	}
+}
+
+func (s *Server) handleStartMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.doorbell.StartMaintenance(duration)
+
+	writeJSON(w, s.doorbell.ControlStatus())
+}
+
+func (s *Server) handleStopMaintenance(w http.ResponseWriter, _ *http.Request) {
+	s.doorbell.StopMaintenance()
+
+	writeJSON(w, s.doorbell.ControlStatus())
+}
+
+func (s *Server) handleStartExpecting(w http.ResponseWriter, r *http.Request) {
+	var req expectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.doorbell.StartExpecting(duration)
+
+	writeJSON(w, s.doorbell.ControlStatus())
+}
+
+func (s *Server) handleStopExpecting(w http.ResponseWriter, _ *http.Request) {
+	s.doorbell.StopExpecting()
+
+	writeJSON(w, s.doorbell.ControlStatus())
+}
+
+func (s *Server) handleFaults(w http.ResponseWriter, r *http.Request) {
+	var req faultRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Drop != nil && *req.Drop < 0 {
+		http.Error(w, fmt.Sprintf("invalid number of messages to drop %d", *req.Drop), http.StatusBadRequest)
+		return
+	}
+
+	injection := FaultInjection{Disconnect: req.Disconnect, Drop: req.Drop}
+
+	if req.Latency != "" {
+		latency, err := time.ParseDuration(req.Latency)
+		if err != nil || latency < 0 {
+			http.Error(w, fmt.Sprintf("invalid latency %q", req.Latency), http.StatusBadRequest)
+			return
+		}
+
+		injection.Latency = &latency
+	}
+
+	faults, err := s.doorbell.InjectFaults(injection)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrDeveloperMode) {
+			status = http.StatusForbidden
+		}
+
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	writeJSON(w, faults)
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package detector
+
+// movingAverage computes the average of the most recent RSSI samples.
+type movingAverage struct {
+	samples []int
+	next    int
+	full    bool
+}
+
+func newMovingAverage(window int) *movingAverage {
+	if window < 1 {
+		window = 1
+	}
+
+	return &movingAverage{samples: make([]int, window)}
+}
+
+// Add records a sample and returns the current average.
+func (m *movingAverage) Add(sample int) int {
+	m.samples[m.next] = sample
+	m.next = (m.next + 1) % len(m.samples)
+	if m.next == 0 {
+		m.full = true
+	}
+
+	n := m.next
+	if m.full {
+		n = len(m.samples)
+	}
+
+	var sum int
+	for _, s := range m.samples[:n] {
+		sum += s
+	}
+
+	return sum / n
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package detector
+
+import (
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+)
+
+// batteryRecovery is how far (in percent) the battery level of a target
+// device must rise above its low battery level (eg. because the battery was
+// replaced) before another low battery notification is raised. It keeps a
+// level hovering around the threshold from raising repeated notifications.
+const batteryRecovery = 10
+
+// battery tracks the battery level reported by a target device.
+type battery struct {
+	level   *int
+	updated time.Time
+	// low is true once a low battery detection has been raised, until the
+	// level recovers.
+	low bool
+}
+
+// checkBattery records the battery level reported by a beacon, and returns a
+// low battery detection when the level first drops below the target's low
+// battery level.
+func (state *targetState) checkBattery(mac string, b source.Beacon, now time.Time) *Detection {
+	if b.Battery == nil {
+		return nil
+	}
+
+	level := *b.Battery
+	s := &state.battery
+	s.level = &level
+	s.updated = now
+
+	threshold := state.lowBatteryLevel()
+	if s.low {
+		if level >= threshold+batteryRecovery {
+			s.low = false
+		}
+
+		return nil
+	}
+
+	if level >= threshold {
+		return nil
+	}
+
+	s.low = true
+
+	return &Detection{
+		Target:  &state.conf,
+		MAC:     mac,
+		Event:   latestconfig.EventLowBattery,
+		RSSI:    b.RSSI,
+		Battery: level,
+		Notify:  true,
+	}
+}
+
+// lowBatteryLevel returns the target's low battery level, or zero if low
+// battery notifications are disabled.
+func (state *targetState) lowBatteryLevel() int {
+	if state.conf.LowBatteryLevel == nil {
+		return 0
+	}
+
+	return *state.conf.LowBatteryLevel
+}
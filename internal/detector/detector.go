@@ -0,0 +1,415 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package detector
+
+import (
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+)
+
+// Detection is the result of observing a beacon from a target device.
+type Detection struct {
+	// Target is the configuration of the detected target.
+	Target *latestconfig.TargetConfig
+	// MAC is the normalized MAC address of the device that sent the beacon.
+	MAC string
+	// Event is the type of event the beacon represents.
+	Event latestconfig.EventType
+	// RSSI is the smoothed received signal strength in dBm (zero if unknown).
+	RSSI int
+	// Battery is the battery level of the device in percent (for low
+	// battery detections).
+	Battery int
+	// Notify is true if the detection should ring the doorbell.
+	Notify bool
+	// Reason explains why a detection was ignored (if Notify is false).
+	Reason string
+	// Overlaps are the names of the other targets the beacon matched, which
+	// the target took precedence over.
+	Overlaps []string
+}
+
+// Detector tracks when each target device was last detected and decides
+// whether a received beacon should ring the doorbell.
+//
+// A beacon that matches several targets is attributed to one of them:
+// targets matched by MAC address take precedence over those matched by their
+// advertisements, then targets take precedence over those listed after them.
+type Detector struct {
+	mu sync.Mutex
+	// byMAC indexes targets that are matched by MAC address.
+	byMAC map[string]*targetState
+	// byAdvertisement lists targets that are matched by advertised local name,
+	// service UUID, and/or iBeacon or Eddystone identity.
+	byAdvertisement []*targetState
+}
+
+type targetState struct {
+	conf latestconfig.TargetConfig
+	// shadowed are the names of the targets listed later with the same MAC
+	// address, which are never matched.
+	shadowed     []string
+	lastDetected time.Time
+	// lastSeen, lastMAC and lastRSSI describe the last beacon received from
+	// the target.
+	lastSeen time.Time
+	lastMAC  string
+	lastRSSI int
+	rssi     *movingAverage
+	// beacons are the times of recent beacons that passed the RSSI
+	// threshold, oldest first, used to debounce detections.
+	beacons    []time.Time
+	presence   presence
+	stationary stationary
+	battery    battery
+}
+
+// New creates a new detector for the given targets. Target MAC addresses are
+// expected to have been normalized.
+func New(targets []latestconfig.TargetConfig) *Detector {
+	d := &Detector{}
+	d.setTargets(targets)
+
+	return d
+}
+
+// Update replaces the configuration of the targets. Targets that are matched
+// in the same way as before keep their detection and presence state.
+func (d *Detector) Update(targets []latestconfig.TargetConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.setTargets(targets)
+}
+
+// setTargets indexes the given targets, carrying over the state of existing
+// targets with the same match criteria. The caller must hold the lock (or
+// have exclusive access).
+func (d *Detector) setTargets(targets []latestconfig.TargetConfig) {
+	previous := make(map[string]*targetState)
+	for _, state := range d.states() {
+		previous[matchKey(&state.conf)] = state
+	}
+
+	d.byMAC = make(map[string]*targetState, len(targets))
+	d.byAdvertisement = nil
+
+	for _, t := range targets {
+		state := &targetState{
+			conf: t,
+			rssi: newMovingAverage(t.RSSIWindow),
+		}
+
+		if prev, ok := previous[matchKey(&t)]; ok {
+			state.lastDetected = prev.lastDetected
+			state.lastSeen = prev.lastSeen
+			state.lastMAC = prev.lastMAC
+			state.lastRSSI = prev.lastRSSI
+			state.beacons = prev.beacons
+			state.presence = prev.presence
+			state.stationary = prev.stationary
+			state.battery = prev.battery
+			if prev.conf.RSSIWindow == t.RSSIWindow {
+				state.rssi = prev.rssi
+			}
+		}
+
+		if t.MAC != "" {
+			if first, ok := d.byMAC[t.MAC]; ok {
+				first.shadowed = append(first.shadowed, t.Name)
+			} else {
+				d.byMAC[t.MAC] = state
+			}
+		} else {
+			d.byAdvertisement = append(d.byAdvertisement, state)
+		}
+	}
+}
+
+// matchKey identifies a target by the criteria it is matched with.
+func matchKey(t *latestconfig.TargetConfig) string {
+	if t.MAC != "" {
+		return t.MAC
+	}
+
+	key := t.LocalName + "|" + t.ServiceUUID
+	if t.IBeacon != nil {
+		key += "|ibeacon:" + t.IBeacon.UUID
+		if t.IBeacon.Major != nil {
+			key += ":" + strconv.Itoa(int(*t.IBeacon.Major))
+		}
+		if t.IBeacon.Minor != nil {
+			key += "/" + strconv.Itoa(int(*t.IBeacon.Minor))
+		}
+	}
+	if t.Eddystone != nil {
+		key += "|eddystone:" + t.Eddystone.Namespace + ":" + t.Eddystone.Instance
+	}
+
+	return key
+}
+
+// Observe records a beacon received from a device. If the device is not a
+// target, nil is returned. Otherwise the detection for the beacon is returned,
+// preceded by an arrival if the device was away, and followed by a
+// stationary detection if the device hasn't moved for its stationary period
+// and a low battery detection if its battery level has dropped too low.
+func (d *Detector) Observe(b source.Beacon, now time.Time) []*Detection {
+	mac, err := util.NormalizeMAC(b.MAC)
+	if err != nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, overlaps := d.match(mac, &b)
+	if state == nil {
+		return nil
+	}
+
+	return withOverlaps(state.record(mac, b, now), overlaps)
+}
+
+// Evaluate returns the detections Observe would return for a beacon, without
+// recording it, so the state of the target is left as it was. If the device
+// is not a target, nil is returned.
+func (d *Detector) Evaluate(b source.Beacon, now time.Time) []*Detection {
+	mac, err := util.NormalizeMAC(b.MAC)
+	if err != nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, overlaps := d.match(mac, &b)
+	if state == nil {
+		return nil
+	}
+
+	return withOverlaps(state.clone().record(mac, b, now), overlaps)
+}
+
+// withOverlaps records the other targets a beacon matched in its detections.
+func withOverlaps(detections []*Detection, overlaps []string) []*Detection {
+	for _, det := range detections {
+		det.Overlaps = overlaps
+	}
+
+	return detections
+}
+
+// record records a beacon from the target, and returns its detections.
+func (state *targetState) record(mac string, b source.Beacon, now time.Time) []*Detection {
+	var detections []*Detection
+	if state.seen(mac, now) {
+		detections = append(detections, &Detection{
+			Target: &state.conf,
+			MAC:    mac,
+			Event:  latestconfig.EventArrived,
+			RSSI:   b.RSSI,
+			Notify: true,
+		})
+	}
+
+	det := state.observe(mac, b, now)
+	detections = append(detections, det)
+
+	state.lastSeen = now
+	state.lastMAC = mac
+	if det.RSSI != 0 {
+		state.lastRSSI = det.RSSI
+	}
+
+	if stationary := state.checkStationary(det, now); stationary != nil {
+		detections = append(detections, stationary)
+	}
+
+	if lowBattery := state.checkBattery(mac, b, now); lowBattery != nil {
+		detections = append(detections, lowBattery)
+	}
+
+	return detections
+}
+
+// clone returns a copy of the target's state, which can record beacons
+// without changing the original.
+func (state *targetState) clone() *targetState {
+	c := *state
+	c.beacons = slices.Clone(state.beacons)
+
+	rssi := *state.rssi
+	rssi.samples = slices.Clone(state.rssi.samples)
+	c.rssi = &rssi
+
+	return &c
+}
+
+// observe decides whether a beacon from the target should ring the doorbell.
+func (state *targetState) observe(mac string, b source.Beacon, now time.Time) *Detection {
+	det := &Detection{Target: &state.conf, MAC: mac, Event: latestconfig.EventDetected}
+
+	// Button presses are deliberate, so always ring the doorbell.
+	if b.Button {
+		det.Event = latestconfig.EventButtonPressed
+		det.RSSI = b.RSSI
+		det.Notify = true
+		return det
+	}
+
+	// Beacons without a signal strength (eg. bare MAC payloads) can't be
+	// filtered by proximity.
+	if b.RSSI != 0 {
+		det.RSSI = state.rssi.Add(b.RSSI)
+
+		if state.conf.RSSIThreshold != 0 && det.RSSI < state.conf.RSSIThreshold {
+			det.Reason = "signal too weak"
+			return det
+		}
+	}
+
+	debounced := state.debounce(now)
+
+	if !state.lastDetected.IsZero() && now.Sub(state.lastDetected) < state.conf.DetectionTimeout {
+		det.Reason = "detected recently"
+		return det
+	}
+
+	if debounced {
+		det.Reason = "waiting for more beacons"
+		return det
+	}
+
+	state.lastDetected = now
+	state.beacons = nil
+	det.Notify = true
+
+	return det
+}
+
+// debounce records a beacon, and returns true if fewer than the minimum
+// number of beacons have been received within the window.
+func (state *targetState) debounce(now time.Time) bool {
+	if state.conf.MinBeacons <= 1 {
+		return false
+	}
+
+	// Forget beacons that have fallen out of the window.
+	cutoff := now.Add(-state.conf.WithinWindow)
+	i := 0
+	for i < len(state.beacons) && !state.beacons[i].After(cutoff) {
+		i++
+	}
+	state.beacons = append(state.beacons[i:], now)
+
+	if len(state.beacons) > state.conf.MinBeacons {
+		state.beacons = state.beacons[len(state.beacons)-state.conf.MinBeacons:]
+	}
+
+	return len(state.beacons) < state.conf.MinBeacons
+}
+
+// states returns the state of every target, the caller must hold the lock.
+func (d *Detector) states() []*targetState {
+	states := slices.Clone(d.byAdvertisement)
+	for _, state := range d.byMAC {
+		states = append(states, state)
+	}
+
+	return states
+}
+
+// match returns the target a beacon is attributed to, and the names of the
+// other targets it matched.
+func (d *Detector) match(mac string, b *source.Beacon) (*targetState, []string) {
+	var match *targetState
+	var overlaps []string
+	if state, ok := d.byMAC[mac]; ok {
+		match = state
+		overlaps = slices.Clone(state.shadowed)
+	}
+
+	for _, state := range d.byAdvertisement {
+		if !matchesAdvertisement(&state.conf, b) {
+			continue
+		}
+
+		if match == nil {
+			match = state
+		} else {
+			overlaps = append(overlaps, state.conf.Name)
+		}
+	}
+
+	return match, overlaps
+}
+
+func matchesAdvertisement(t *latestconfig.TargetConfig, b *source.Beacon) bool {
+	if t.LocalName != "" {
+		if b.Name == "" {
+			return false
+		}
+
+		if ok, _ := path.Match(t.LocalName, b.Name); !ok {
+			return false
+		}
+	}
+
+	if t.ServiceUUID != "" && !slices.Contains(b.ServiceUUIDs, t.ServiceUUID) {
+		return false
+	}
+
+	if t.IBeacon != nil && !matchesIBeacon(t.IBeacon, b.IBeacon) {
+		return false
+	}
+
+	if t.Eddystone != nil && !matchesEddystone(t.Eddystone, b.Eddystone) {
+		return false
+	}
+
+	return true
+}
+
+func matchesIBeacon(t *latestconfig.IBeaconConfig, ib *source.IBeacon) bool {
+	if ib == nil || ib.UUID != t.UUID {
+		return false
+	}
+
+	if t.Major != nil && ib.Major != *t.Major {
+		return false
+	}
+
+	return t.Minor == nil || ib.Minor == *t.Minor
+}
+
+func matchesEddystone(t *latestconfig.EddystoneConfig, e *source.Eddystone) bool {
+	if e == nil || e.Namespace != t.Namespace {
+		return false
+	}
+
+	return t.Instance == "" || e.Instance == t.Instance
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package detector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/source/mqtt"
+)
+
+// benchmarkUUID is the proximity UUID of the benchmark iBeacon targets.
+const benchmarkUUID = "e2c56db5-dffb-48d2-b060-d0f5a71096e0"
+
+// benchmarkPayload is a beacon as published by OpenMQTTGateway.
+var benchmarkPayload = []byte(`{"id":"AA:BB:CC:DD:EE:FF","mac_type":0,"name":"Tile Mate",` +
+	`"rssi":-62,"uuid":"e2c56db5-dffb-48d2-b060-d0f5a71096e0","major":1,"minor":42,"batt":87}`)
+
+func BenchmarkDecodeJSON(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := mqtt.DecodeJSON(benchmarkPayload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNormalizePayload(b *testing.B) {
+	payload := []byte("\ufeff\"aa:bb:cc:dd:ee:ff\"\r\n\x00")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = source.NormalizePayload(payload)
+	}
+}
+
+// benchmarkTargets returns n targets of the given kind. The beacon returned
+// for each kind matches the last of them, the worst case for matching.
+func benchmarkTargets(kind string, n int) ([]latestconfig.TargetConfig, source.Beacon) {
+	targets := make([]latestconfig.TargetConfig, n)
+	for i := range targets {
+		t := &targets[i]
+		t.Name = fmt.Sprintf("target-%d", i)
+		t.DetectionTimeout = time.Minute
+		t.RSSIWindow = 5
+
+		switch kind {
+		case "mac":
+			t.MAC = fmt.Sprintf("AA:BB:CC:DD:%02X:%02X", i>>8&0xff, i&0xff)
+		case "glob":
+			t.LocalName = fmt.Sprintf("Tag%d-*", i)
+		case "ibeacon":
+			minor := uint16(i)
+			t.IBeacon = &latestconfig.IBeaconConfig{UUID: benchmarkUUID, Minor: &minor}
+		}
+	}
+
+	last := n - 1
+	beacon := source.Beacon{MAC: "11:22:33:44:55:66", RSSI: -60}
+	switch kind {
+	case "mac":
+		beacon.MAC = targets[last].MAC
+	case "glob":
+		beacon.Name = fmt.Sprintf("Tag%d-Mittens", last)
+	case "ibeacon":
+		beacon.IBeacon = &source.IBeacon{UUID: benchmarkUUID, Major: 1, Minor: uint16(last)}
+	}
+
+	return targets, beacon
+}
+
+func BenchmarkObserve(b *testing.B) {
+	for _, kind := range []string{"mac", "glob", "ibeacon"} {
+		for _, n := range []int{1, 10, 100} {
+			b.Run(fmt.Sprintf("%s/targets=%d", kind, n), func(b *testing.B) {
+				targets, beacon := benchmarkTargets(kind, n)
+				d := New(targets)
+				now := time.Now()
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if detections := d.Observe(beacon, now.Add(time.Duration(i)*time.Millisecond)); len(detections) == 0 {
+						b.Fatal("beacon didn't match a target")
+					}
+				}
+			})
+		}
+	}
+
+	// Beacons from devices that aren't targets are checked against every
+	// target, and are by far the most common.
+	b.Run("unmatched/targets=100", func(b *testing.B) {
+		targets, _ := benchmarkTargets("glob", 100)
+		d := New(targets)
+		beacon := source.Beacon{MAC: "11:22:33:44:55:66", RSSI: -80, Name: "Neighbour's Phone"}
+		now := time.Now()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if detections := d.Observe(beacon, now); detections != nil {
+				b.Fatal("beacon matched a target")
+			}
+		}
+	})
+}
+
+func BenchmarkMovingAverage(b *testing.B) {
+	for _, window := range []int{1, 5, 20} {
+		b.Run(fmt.Sprintf("window=%d", window), func(b *testing.B) {
+			m := newMovingAverage(window)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = m.Add(-60 - i%20)
+			}
+		})
+	}
+}
+
+// BenchmarkBeaconPath measures a beacon from decoding its payload to deciding
+// whether it rings the doorbell.
+func BenchmarkBeaconPath(b *testing.B) {
+	targets, _ := benchmarkTargets("ibeacon", 100)
+	d := New(targets)
+	now := time.Now()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		beacon, err := mqtt.DecodeJSON(benchmarkPayload)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if detections := d.Observe(*beacon, now.Add(time.Duration(i)*time.Millisecond)); len(detections) == 0 {
+			b.Fatal("beacon didn't match a target")
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package detector
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// Device is a snapshot of the state of a target device, taken at once so
+// that every part of it is consistent.
+type Device struct {
+	// Name is the name of the target.
+	Name string
+	// MAC is the MAC address the device was last seen with, if it has been
+	// seen.
+	MAC string
+	// LastSeen is when a beacon was last received from the device, or zero
+	// if it hasn't been seen.
+	LastSeen time.Time
+	// RSSI is the smoothed signal strength of the device's last beacon in
+	// dBm (zero if unknown).
+	RSSI int
+	// Present is whether the device is nearby, or nil if presence tracking
+	// is disabled for it.
+	Present *bool
+	// PresentSince is when the device arrived or departed.
+	PresentSince time.Time
+	// Battery is the battery level last reported by the device in percent,
+	// or nil if it hasn't reported one.
+	Battery *int
+	// BatteryLow is true if the battery level is below the target's low
+	// battery level.
+	BatteryLow bool
+	// BatteryUpdated is when the battery level was reported.
+	BatteryUpdated time.Time
+	// CooldownUntil is when the detection timeout of the device's last
+	// detection ends, and it can ring the doorbell again, or zero if it can
+	// ring it now.
+	CooldownUntil time.Time
+}
+
+// Devices returns a snapshot of the state of every target, sorted by name.
+func (d *Detector) Devices(now time.Time) []Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	states := d.states()
+	devices := make([]Device, 0, len(states))
+	for _, state := range states {
+		dev := Device{
+			Name:     state.conf.Name,
+			MAC:      state.lastMAC,
+			LastSeen: state.lastSeen,
+			RSSI:     state.lastRSSI,
+		}
+
+		if state.conf.AbsenceTimeout != 0 {
+			present := state.presence.present
+			dev.Present = &present
+			dev.PresentSince = state.presence.since
+		}
+
+		if state.battery.level != nil {
+			level := *state.battery.level
+			dev.Battery = &level
+			dev.BatteryLow = level < state.lowBatteryLevel()
+			dev.BatteryUpdated = state.battery.updated
+		}
+
+		if !state.lastDetected.IsZero() {
+			if until := state.lastDetected.Add(state.conf.DetectionTimeout); until.After(now) {
+				dev.CooldownUntil = until
+			}
+		}
+
+		devices = append(devices, dev)
+	}
+
+	slices.SortFunc(devices, func(a, b Device) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return devices
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package detector
+
+import (
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// presence tracks whether a target device is nearby.
+type presence struct {
+	present  bool
+	since    time.Time
+	lastSeen time.Time
+	// lastMAC is the MAC address the device was last seen with.
+	lastMAC string
+}
+
+// seen records that the target was seen and returns true if it was
+// previously away (or had never been seen). It always returns false if
+// presence tracking is disabled for the target.
+func (state *targetState) seen(mac string, now time.Time) bool {
+	if state.conf.AbsenceTimeout == 0 {
+		return false
+	}
+
+	p := &state.presence
+	p.lastSeen = now
+	p.lastMAC = mac
+
+	if p.present {
+		return false
+	}
+
+	p.present = true
+	p.since = now
+
+	return true
+}
+
+// Departures marks targets that haven't been seen within their absence
+// timeout as away, and returns a departure detection for each of them. The
+// detection timeout of targets that reset their cooldown on departure is
+// cleared.
+func (d *Detector) Departures(now time.Time) []*Detection {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var departures []*Detection
+	for _, state := range d.states() {
+		p := &state.presence
+		if !p.present || now.Sub(p.lastSeen) < state.conf.AbsenceTimeout {
+			continue
+		}
+
+		p.present = false
+		p.since = now
+
+		// A cat that changed its mind and came straight back should ring
+		// again, rather than be taken for the visit it just left.
+		if state.conf.ResetCooldownOnDeparture {
+			state.lastDetected = time.Time{}
+		}
+
+		det := &Detection{
+			Target: &state.conf,
+			MAC:    p.lastMAC,
+			Event:  latestconfig.EventDeparted,
+			Notify: state.conf.NotifyDeparture,
+		}
+		if !det.Notify {
+			det.Reason = "departure notifications disabled"
+		}
+
+		departures = append(departures, det)
+	}
+
+	return departures
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package detector
+
+import (
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// maxStationaryGap is the longest a target device may go unseen without
+// breaking its stationary streak. A tag lying in the garden beacons
+// continuously, whereas one on a roaming cat drifts in and out of range.
+const maxStationaryGap = 10 * time.Minute
+
+// stationary tracks how long a target device has been beaconing with a
+// near-constant signal strength.
+type stationary struct {
+	since    time.Time
+	lastSeen time.Time
+	// minRSSI and maxRSSI are the range of the smoothed signal strength
+	// since the streak started.
+	minRSSI  int
+	maxRSSI  int
+	reported bool
+}
+
+// checkStationary extends the target's stationary streak with a detection,
+// and returns a stationary detection the first time the streak exceeds the
+// target's stationary period. Button presses, gaps in the beacons and
+// changes in signal strength start a new streak.
+func (state *targetState) checkStationary(det *Detection, now time.Time) *Detection {
+	// Beacons without a signal strength can't tell if the device is moving.
+	if state.conf.StationaryAfter == 0 || det.RSSI == 0 {
+		return nil
+	}
+
+	s := &state.stationary
+
+	moved := det.Event == latestconfig.EventButtonPressed ||
+		s.since.IsZero() || now.Sub(s.lastSeen) > maxStationaryGap ||
+		max(s.maxRSSI, det.RSSI)-min(s.minRSSI, det.RSSI) > state.conf.StationaryRSSIRange
+	if moved {
+		*s = stationary{since: now, minRSSI: det.RSSI, maxRSSI: det.RSSI}
+	}
+
+	s.lastSeen = now
+	s.minRSSI = min(s.minRSSI, det.RSSI)
+	s.maxRSSI = max(s.maxRSSI, det.RSSI)
+
+	if s.reported || now.Sub(s.since) < state.conf.StationaryAfter {
+		return nil
+	}
+
+	s.reported = true
+
+	return &Detection{
+		Target: &state.conf,
+		MAC:    det.MAC,
+		Event:  latestconfig.EventStationary,
+		RSSI:   det.RSSI,
+		Notify: true,
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package event
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// Correlated is a custom event whose correlated event has occurred.
+type Correlated struct {
+	Derived
+	// MAC is the (unredacted) MAC address of the device the underlying event
+	// was raised for, if any.
+	MAC string
+}
+
+// Correlator holds back custom events until another event (eg. motion
+// reported by a camera) occurs within their window, before or after the
+// underlying event. It is safe for concurrent use.
+type Correlator struct {
+	mu sync.Mutex
+	// last holds when each event type last occurred.
+	last map[latestconfig.EventType]time.Time
+	// awaiting are the custom events waiting for their correlated events.
+	awaiting []awaiting
+}
+
+type awaiting struct {
+	Correlated
+	// deadline is when the custom event is dropped if none of its correlated
+	// events have occurred.
+	deadline time.Time
+}
+
+// NewCorrelator creates a new, empty correlator.
+func NewCorrelator() *Correlator {
+	return &Correlator{last: make(map[latestconfig.EventType]time.Time)}
+}
+
+// Correlate returns true if one of the derived event's correlated events
+// occurred within its window before the underlying event. Otherwise the
+// derived event is held until Observe sees one of them, or its window passes.
+func (c *Correlator) Correlate(derived Derived, mac string) bool {
+	with := derived.With
+	at := derived.Notification.Time
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.correlatedLocked(derived) {
+		return true
+	}
+
+	c.awaiting = slices.DeleteFunc(c.awaiting, func(a awaiting) bool {
+		return at.After(a.deadline)
+	})
+	c.awaiting = append(c.awaiting, awaiting{
+		Correlated: Correlated{Derived: derived, MAC: mac},
+		deadline:   at.Add(with.Within),
+	})
+
+	return false
+}
+
+// Correlated returns true if one of the derived event's correlated events
+// occurred within its window before the underlying event, without holding
+// the derived event back if not.
+func (c *Correlator) Correlated(derived Derived) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.correlatedLocked(derived)
+}
+
+func (c *Correlator) correlatedLocked(derived Derived) bool {
+	for _, e := range derived.With.Events {
+		if last, ok := c.last[e]; ok && derived.Notification.Time.Sub(last) <= derived.With.Within {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Observe records that an event occurred, returning the held custom events
+// it correlates with, which should now be raised.
+func (c *Correlator) Observe(event latestconfig.EventType, at time.Time) []Correlated {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if at.After(c.last[event]) {
+		c.last[event] = at
+	}
+
+	var correlated []Correlated
+	c.awaiting = slices.DeleteFunc(c.awaiting, func(a awaiting) bool {
+		if at.After(a.deadline) {
+			return true
+		}
+
+		if !slices.Contains(a.With.Events, event) {
+			return false
+		}
+
+		correlated = append(correlated, a.Correlated)
+		return true
+	})
+
+	return correlated
+}
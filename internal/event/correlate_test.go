@@ -0,0 +1,185 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package event
+
+import (
+	"testing"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+// observation is an event observed by the correlator, at an offset from the
+// underlying event.
+type observation struct {
+	event  latestconfig.EventType
+	offset time.Duration
+}
+
+func TestCorrelator(t *testing.T) {
+	const within = 30 * time.Second
+	motion := latestconfig.EventMotion
+	doorbell := latestconfig.EventDoorbellPressed
+
+	tests := []struct {
+		name string
+		// before are observed before the underlying event.
+		before []observation
+		// correlated is whether the underlying event is correlated as soon as
+		// it occurs.
+		correlated bool
+		// after are observed after the underlying event.
+		after []observation
+		// released is whether the held event is released by an observation
+		// after the underlying event.
+		released bool
+	}{
+		{
+			name:     "A then B within the window",
+			after:    []observation{{motion, 10 * time.Second}},
+			released: true,
+		},
+		{
+			name:     "A then B at the end of the window",
+			after:    []observation{{motion, within}},
+			released: true,
+		},
+		{
+			name:  "A then B just outside the window",
+			after: []observation{{motion, within + time.Nanosecond}},
+		},
+		{
+			name:       "B then A within the window",
+			before:     []observation{{motion, -10 * time.Second}},
+			correlated: true,
+		},
+		{
+			name:   "B then A just outside the window",
+			before: []observation{{motion, -within - time.Nanosecond}},
+		},
+		{
+			name:     "any of the correlated events",
+			after:    []observation{{doorbell, time.Second}},
+			released: true,
+		},
+		{
+			name:  "an unrelated event",
+			after: []observation{{latestconfig.EventDeparted, time.Second}},
+		},
+		{
+			name:       "the latest of repeated B before A",
+			before:     []observation{{motion, -time.Hour}, {motion, -time.Second}, {motion, -2 * time.Hour}},
+			correlated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCorrelator()
+			at := time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC)
+			derived := testDerived(at, within, motion, doorbell)
+
+			for _, o := range tt.before {
+				if released := c.Observe(o.event, at.Add(o.offset)); len(released) > 0 {
+					t.Fatalf("Observe(%s) before the underlying event released %d events", o.event, len(released))
+				}
+			}
+
+			if correlated := c.Correlate(derived, "AA:BB:CC:DD:EE:FF"); correlated != tt.correlated {
+				t.Fatalf("Correlate() = %v, want %v", correlated, tt.correlated)
+			}
+
+			var released []Correlated
+			for _, o := range tt.after {
+				released = append(released, c.Observe(o.event, at.Add(o.offset))...)
+			}
+
+			if got := len(released) > 0; got != tt.released {
+				t.Fatalf("released = %v, want %v", got, tt.released)
+			}
+
+			if tt.released {
+				if len(released) != 1 {
+					t.Fatalf("released %d events, want 1", len(released))
+				}
+
+				if released[0].Notification != derived.Notification || released[0].MAC != "AA:BB:CC:DD:EE:FF" {
+					t.Errorf("released %+v, want the held event", released[0])
+				}
+
+				// Each held event is only released once.
+				if again := c.Observe(motion, at.Add(time.Second)); len(again) > 0 {
+					t.Errorf("released %d events again", len(again))
+				}
+			}
+		})
+	}
+}
+
+func TestCorrelatorExpiry(t *testing.T) {
+	const within = 30 * time.Second
+	motion := latestconfig.EventMotion
+	at := time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC)
+
+	c := NewCorrelator()
+	stale := testDerived(at, within, motion)
+	if c.Correlate(stale, "") {
+		t.Fatal("Correlate() = true without a correlated event")
+	}
+
+	// Holding another event drops the held events whose windows have
+	// passed.
+	fresh := testDerived(at.Add(time.Minute), within, motion)
+	if c.Correlate(fresh, "") {
+		t.Fatal("Correlate() = true without a correlated event")
+	}
+
+	if len(c.awaiting) != 1 || c.awaiting[0].Notification != fresh.Notification {
+		t.Fatalf("held %d events, want only the fresh one", len(c.awaiting))
+	}
+
+	released := c.Observe(motion, at.Add(time.Minute+time.Second))
+	if len(released) != 1 || released[0].Notification != fresh.Notification {
+		t.Fatalf("Observe() released %d events, want only the fresh one", len(released))
+	}
+
+	// Observing any event drops the held events whose windows have passed.
+	if c.Correlate(testDerived(at.Add(2*time.Minute), within, motion), "") {
+		t.Fatal("Correlate() = true with a correlated event outside the window")
+	}
+
+	if released := c.Observe(latestconfig.EventDeparted, at.Add(3*time.Minute)); len(released) > 0 {
+		t.Fatalf("Observe() released %d events for an unrelated event", len(released))
+	}
+
+	if len(c.awaiting) != 0 {
+		t.Fatalf("held %d events after their windows passed, want 0", len(c.awaiting))
+	}
+}
+
+// testDerived returns a custom event, raised for an underlying event at the
+// given time, that is held back until one of the given events occurs within
+// the window.
+func testDerived(at time.Time, within time.Duration, events ...latestconfig.EventType) Derived {
+	return Derived{
+		Notification: &notifier.Notification{Event: "atTheDoor", Name: "Mittens", Time: at},
+		With:         &latestconfig.CorrelationConfig{Events: events, Within: within},
+	}
+}
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package event derives user-defined events from the built-in events.
+package event
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"slices"
+	"text/template"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+// Deriver derives the configured custom events.
+type Deriver struct {
+	events []*event
+}
+
+type event struct {
+	conf    latestconfig.EventConfig
+	message *template.Template
+}
+
+// Derived is a custom event derived from a built-in event.
+type Derived struct {
+	// Notification is the notification of the custom event.
+	Notification *notifier.Notification
+	// UnacknowledgedFor is how long the visit started by the built-in event
+	// must go unacknowledged before the custom event is raised. Zero raises
+	// it immediately.
+	UnacknowledgedFor time.Duration
+	// With, if not nil, holds the custom event back until one of the
+	// correlated events occurs within the window (see Correlator).
+	With *latestconfig.CorrelationConfig
+}
+
+// NewDeriver creates a deriver for the given custom event configurations.
+func NewDeriver(confs []latestconfig.EventConfig) (*Deriver, error) {
+	var d Deriver
+	for _, conf := range confs {
+		e := &event{conf: conf}
+
+		if conf.Message != "" {
+			var err error
+			e.message, err = template.New("message").Parse(conf.Message)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse message template of event %q: %w", conf.Name, err)
+			}
+		}
+
+		d.events = append(d.events, e)
+	}
+
+	return &d, nil
+}
+
+// Derive returns the custom events derived from the notification of a
+// built-in event.
+func (d *Deriver) Derive(n *notifier.Notification) []Derived {
+	var derived []Derived
+	for _, e := range d.events {
+		if !e.derivedFrom(n) {
+			continue
+		}
+
+		dn := *n
+		dn.Event = e.conf.Name
+
+		if e.message != nil {
+			var buf bytes.Buffer
+			if err := e.message.Execute(&buf, n); err != nil {
+				slog.Warn("Failed to execute event message template",
+					slog.String("event", string(e.conf.Name)), slog.Any("error", err))
+			} else {
+				dn.Message = buf.String()
+			}
+		}
+
+		derived = append(derived, Derived{
+			Notification:      &dn,
+			UnacknowledgedFor: e.conf.UnacknowledgedFor,
+			With:              e.conf.With,
+		})
+	}
+
+	return derived
+}
+
+func (e *event) derivedFrom(n *notifier.Notification) bool {
+	if !slices.Contains(e.conf.On, n.Event) {
+		return false
+	}
+
+	if len(e.conf.Targets) > 0 && !slices.Contains(e.conf.Targets, n.Name) {
+		return false
+	}
+
+	return e.conf.Between == nil || e.conf.Between.Contains(n.Time)
+}
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package history stores the detection history, in a local SQLite database
+// or a shared PostgreSQL database.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// Detection is a recorded detection of a target device.
+type Detection struct {
+	// Time is when the device was detected.
+	Time time.Time `json:"time"`
+	// Name is the name of the detected device.
+	Name string `json:"name"`
+	// MAC is the MAC address of the detected device.
+	MAC string `json:"mac"`
+	// RSSI is the signal strength of the detected device in dBm (zero if unknown).
+	RSSI int `json:"rssi,omitempty"`
+	// Event is the type of event (eg. "detected" or "buttonPressed").
+	Event string `json:"event"`
+	// Notified is true if the detection rang the doorbell.
+	Notified bool `json:"notified"`
+}
+
+// Query filters the detections returned by List.
+type Query struct {
+	// Since only returns detections after the given time (if non-zero).
+	Since time.Time
+	// MAC only returns detections of the device with the given MAC address.
+	MAC string
+	// Name only returns detections of the target with the given name.
+	Name string
+	// NotifiedOnly only returns detections that rang the doorbell.
+	NotifiedOnly bool
+	// Events only returns detections of the given event types (if any).
+	Events []string
+	// Limit is the maximum number of detections to return (zero for no limit).
+	Limit int
+	// Oldest returns the oldest detections first, rather than the most
+	// recent.
+	Oldest bool
+}
+
+// Store is a persistent store of detections.
+type Store interface {
+	// Record stores a detection.
+	Record(ctx context.Context, d *Detection) error
+	// List returns the detections matching the given query, most recent
+	// first.
+	List(ctx context.Context, q Query) ([]Detection, error)
+	// Each calls fn with each detection matching the given query in turn,
+	// without holding them all in memory, until fn returns an error.
+	Each(ctx context.Context, q Query, fn func(d Detection) error) error
+	// Close closes the store.
+	Close() error
+}
+
+// Open opens (or creates) the history store of the configured backend. The
+// SQLite backend stores the history in the database at the given path.
+func Open(conf latestconfig.HistoryConfig, path string) (Store, error) {
+	switch conf.Backend {
+	case latestconfig.HistoryBackendPostgres:
+		return openPostgres(conf.URL, conf.Household)
+	case latestconfig.HistoryBackendSQLite, "":
+		return openSQLite(path, conf.Household)
+	default:
+		return nil, fmt.Errorf("unsupported history backend: %s", conf.Backend)
+	}
+}
+
+// sqlStore is a store of detections in a SQL database, shared by the
+// backends as they only differ in how they're opened and migrated.
+type sqlStore struct {
+	db *sql.DB
+	// household is recorded with every detection, and only its detections
+	// are listed.
+	household string
+	// placeholder returns the placeholder of the nth (from 1) query
+	// argument.
+	placeholder func(n int) string
+}
+
+// Close closes the history database.
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// Record stores a detection.
+func (s *sqlStore) Record(ctx context.Context, d *Detection) error {
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO detections (household, time, name, mac, rssi, event, notified) VALUES ("+s.placeholders(1, 7)+")",
+		s.household, d.Time.UnixMilli(), d.Name, d.MAC, d.RSSI, d.Event, d.Notified)
+	if err != nil {
+		return fmt.Errorf("failed to record detection: %w", err)
+	}
+
+	return nil
+}
+
+// List returns the detections matching the given query, most recent first.
+func (s *sqlStore) List(ctx context.Context, q Query) ([]Detection, error) {
+	var detections []Detection
+	err := s.Each(ctx, q, func(d Detection) error {
+		detections = append(detections, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return detections, nil
+}
+
+// Each calls fn with each detection matching the given query in turn.
+func (s *sqlStore) Each(ctx context.Context, q Query, fn func(d Detection) error) error {
+	args := []any{s.household, q.Since.UnixMilli()}
+	query := "SELECT time, name, mac, rssi, event, notified FROM detections WHERE household = " +
+		s.placeholder(1) + " AND time >= " + s.placeholder(2)
+
+	if q.MAC != "" {
+		args = append(args, q.MAC)
+		query += " AND mac = " + s.placeholder(len(args))
+	}
+
+	if q.Name != "" {
+		args = append(args, q.Name)
+		query += " AND name = " + s.placeholder(len(args))
+	}
+
+	if q.NotifiedOnly {
+		args = append(args, true)
+		query += " AND notified = " + s.placeholder(len(args))
+	}
+
+	if len(q.Events) > 0 {
+		query += " AND event IN (" + s.placeholders(len(args)+1, len(q.Events)) + ")"
+		for _, event := range q.Events {
+			args = append(args, event)
+		}
+	}
+
+	if q.Oldest {
+		query += " ORDER BY time, id"
+	} else {
+		query += " ORDER BY time DESC"
+	}
+
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += " LIMIT " + s.placeholder(len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query detections: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d Detection
+		var timestamp int64
+		if err := rows.Scan(&timestamp, &d.Name, &d.MAC, &d.RSSI, &d.Event, &d.Notified); err != nil {
+			return fmt.Errorf("failed to scan detection: %w", err)
+		}
+		d.Time = time.UnixMilli(timestamp)
+
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// placeholders returns a comma separated list of count placeholders,
+// starting with the placeholder of the nth argument.
+func (s *sqlStore) placeholders(n, count int) string {
+	placeholders := make([]string, count)
+	for i := range placeholders {
+		placeholders[i] = s.placeholder(n + i)
+	}
+
+	return strings.Join(placeholders, ", ")
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package history
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresMigrationLock is the advisory lock held while migrating the
+// PostgreSQL schema, as several doorbells sharing the database may start at
+// the same time.
+const postgresMigrationLock = 0x6361742d646f6f72 // "cat-door"
+
+// postgresMigrations are applied in order to bring the PostgreSQL database
+// schema up to date. The number of applied migrations is stored in the
+// cat_doorbell_schema table.
+var postgresMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS detections (
+		id BIGSERIAL PRIMARY KEY,
+		household TEXT NOT NULL DEFAULT '',
+		time BIGINT NOT NULL,
+		name TEXT NOT NULL,
+		mac TEXT NOT NULL,
+		rssi INTEGER NOT NULL,
+		event TEXT NOT NULL DEFAULT 'detected',
+		notified BOOLEAN NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS detections_time ON detections (household, time);
+	CREATE INDEX IF NOT EXISTS detections_mac ON detections (household, mac, time);`,
+}
+
+// openPostgres opens the PostgreSQL history database at the given URL,
+// creating its tables if necessary.
+func openPostgres(url, household string) (*sqlStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+
+	if err := migratePostgres(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate history schema: %w", err)
+	}
+
+	return &sqlStore{
+		db:        db,
+		household: household,
+		placeholder: func(n int) string {
+			return "$" + strconv.Itoa(n)
+		},
+	}, nil
+}
+
+func migratePostgres(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+		return fmt.Errorf("failed to lock schema: %w", err)
+	}
+
+	if _, err := tx.Exec("CREATE TABLE IF NOT EXISTS cat_doorbell_schema (version INTEGER NOT NULL)"); err != nil {
+		return fmt.Errorf("failed to create schema version table: %w", err)
+	}
+
+	var version int
+	err = tx.QueryRow("SELECT version FROM cat_doorbell_schema").Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = tx.Exec("INSERT INTO cat_doorbell_schema (version) VALUES (0)")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	for i := version; i < len(postgresMigrations); i++ {
+		if _, err := tx.Exec(postgresMigrations[i]); err != nil {
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+	}
+
+	// The schema may have been migrated further by a newer doorbell sharing
+	// the database.
+	if version < len(postgresMigrations) {
+		if _, err := tx.Exec("UPDATE cat_doorbell_schema SET version = $1", len(postgresMigrations)); err != nil {
+			return fmt.Errorf("failed to set schema version: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migrations: %w", err)
+	}
+
+	return nil
+}
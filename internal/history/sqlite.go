@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package history
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are applied in order to bring the SQLite database schema
+// up to date. The index of the last applied migration (plus one) is stored in
+// the database's user_version.
+var sqliteMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS detections (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		time INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		mac TEXT NOT NULL,
+		rssi INTEGER NOT NULL,
+		notified INTEGER NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS detections_time ON detections (time);
+	CREATE INDEX IF NOT EXISTS detections_mac ON detections (mac, time);`,
+	`ALTER TABLE detections ADD COLUMN event TEXT NOT NULL DEFAULT 'detected';`,
+	`ALTER TABLE detections ADD COLUMN household TEXT NOT NULL DEFAULT '';`,
+}
+
+// openSQLite opens (or creates) the SQLite history database at the given
+// path.
+func openSQLite(path, household string) (*sqlStore, error) {
+	dsn := (&url.URL{
+		Scheme: "file",
+		Path:   path,
+		RawQuery: url.Values{
+			"_pragma": {"busy_timeout(5000)", "journal_mode(WAL)"},
+		}.Encode(),
+	}).String()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+
+	if err := migrateSQLite(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate history schema: %w", err)
+	}
+
+	return &sqlStore{
+		db:        db,
+		household: household,
+		placeholder: func(int) string {
+			return "?"
+		},
+	}, nil
+}
+
+func migrateSQLite(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	for i := version; i < len(sqliteMigrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+
+		if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to apply migration %d: %w", i+1, err)
+		}
+
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("failed to set schema version: %w", err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit migration %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
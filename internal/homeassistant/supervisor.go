@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package homeassistant integrates with the Home Assistant Supervisor, when
+// running as an add-on.
+package homeassistant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// supervisorURL is the address of the Supervisor API, as seen by add-ons.
+	supervisorURL = "http://supervisor"
+	// IngressProxyIP is the address Home Assistant ingress proxies requests
+	// from.
+	IngressProxyIP = "172.30.32.2"
+	// requestTimeout is how long to wait for the Supervisor to respond.
+	requestTimeout = 10 * time.Second
+)
+
+// ErrNotAddon is returned when the Supervisor token isn't available, ie. when
+// not running as an add-on.
+var ErrNotAddon = errors.New("SUPERVISOR_TOKEN is not set, is cat-doorbell running as a Home Assistant add-on?")
+
+// MQTTService is the MQTT broker provided by another add-on (eg. Mosquitto).
+type MQTTService struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	SSL      bool   `json:"ssl"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Address returns the broker address, in the form expected by the broker
+// configuration.
+func (s *MQTTService) Address() string {
+	scheme := "tcp"
+	if s.SSL {
+		scheme = "ssl"
+	}
+
+	return scheme + "://" + net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// DiscoverMQTT asks the Supervisor for the MQTT broker provided by another
+// add-on. The add-on must declare "services: [mqtt:want]".
+func DiscoverMQTT(ctx context.Context) (*MQTTService, error) {
+	token := os.Getenv("SUPERVISOR_TOKEN")
+	if token == "" {
+		return nil, ErrNotAddon
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, supervisorURL+"/services/mqtt", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query supervisor: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result  string      `json:"result"`
+		Message string      `json:"message"`
+		Data    MQTTService `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode supervisor response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || result.Result != "ok" {
+		return nil, fmt.Errorf("no MQTT service available (is the Mosquitto add-on installed?): %s: %s", resp.Status, result.Message)
+	}
+
+	if result.Data.Host == "" || result.Data.Port == 0 {
+		return nil, errors.New("supervisor returned an incomplete MQTT service")
+	}
+
+	return &result.Data, nil
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package keyed runs work in order for each key, and in parallel across keys.
+package keyed
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+)
+
+// Pool runs work on a fixed number of workers. Work is assigned to a worker
+// by its key, so work with the same key runs one at a time in the order it
+// was submitted, while work with different keys may run in parallel.
+type Pool struct {
+	queues []chan func()
+}
+
+// New creates a pool of workers, each of which queues up to depth pieces of
+// work before Submit blocks.
+func New(workers, depth int) *Pool {
+	p := &Pool{
+		queues: make([]chan func(), max(workers, 1)),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), depth)
+	}
+
+	return p
+}
+
+// Run runs the workers until the context is cancelled. Work that hasn't
+// started by then is abandoned.
+func (p *Pool) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, queue := range p.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case fn := <-queue:
+					// Both may be ready at once, and select picks at random.
+					if ctx.Err() != nil {
+						return
+					}
+
+					fn()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// Submit queues work to run after all previously submitted work with the
+// same key has finished. It blocks while the key's worker is full, and
+// returns an error if the context is cancelled first.
+func (p *Pool) Submit(ctx context.Context, key string, fn func()) error {
+	select {
+	case p.queue(key) <- fn:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Wait blocks until all previously submitted work has finished. Anything
+// written by that work is visible to the caller once Wait returns.
+func (p *Pool) Wait(ctx context.Context) error {
+	done := make(chan struct{}, len(p.queues))
+	for _, queue := range p.queues {
+		select {
+		case queue <- func() { done <- struct{}{} }:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for range p.queues {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Len returns the number of pieces of work waiting to run.
+func (p *Pool) Len() int {
+	var n int
+	for _, queue := range p.queues {
+		n += len(queue)
+	}
+
+	return n
+}
+
+// queue returns the queue of the worker that runs work with the given key.
+func (p *Pool) queue(key string) chan<- func() {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return p.queues[h.Sum32()%uint32(len(p.queues))]
+}
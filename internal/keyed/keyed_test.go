@@ -0,0 +1,234 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package keyed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// run runs the pool until the test finishes.
+func run(t *testing.T, p *Pool) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = p.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestPoolOrderWithinKey(t *testing.T) {
+	const (
+		keys       = 8
+		submitters = 4
+		submits    = 200
+	)
+
+	p := New(3, 4)
+	run(t, p)
+
+	// seen and running are only written by the key's work, which the race
+	// detector checks never runs concurrently.
+	type result struct {
+		seen    [submitters][]int
+		running atomic.Int32
+		overlap bool
+	}
+	results := make([]*result, keys)
+	for i := range results {
+		results[i] = &result{}
+	}
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for k := 0; k < keys; k++ {
+		for s := 0; s < submitters; s++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				r := results[k]
+				for i := 0; i < submits; i++ {
+					err := p.Submit(ctx, fmt.Sprintf("target-%d", k), func() {
+						if r.running.Add(1) > 1 {
+							r.overlap = true
+						}
+						r.seen[s] = append(r.seen[s], i)
+						r.running.Add(-1)
+					})
+					if err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if err := p.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for k, r := range results {
+		if r.overlap {
+			t.Errorf("work for key %d ran concurrently", k)
+		}
+
+		for s, seen := range r.seen {
+			if len(seen) != submits {
+				t.Fatalf("key %d, submitter %d: ran %d pieces of work, want %d", k, s, len(seen), submits)
+			}
+
+			for i, v := range seen {
+				if v != i {
+					t.Fatalf("key %d, submitter %d: work %d ran in position %d", k, s, v, i)
+				}
+			}
+		}
+	}
+}
+
+func TestPoolParallelAcrossKeys(t *testing.T) {
+	p := New(2, 1)
+	run(t, p)
+
+	// Find two keys that are run by different workers.
+	a, b := "target-0", ""
+	for i := 1; b == ""; i++ {
+		if key := fmt.Sprintf("target-%d", i); p.queue(key) != p.queue(a) {
+			b = key
+		}
+	}
+
+	// The work for a only finishes once the work for b has started, so it
+	// deadlocks unless they run in parallel.
+	started := make(chan struct{})
+	finished := make(chan struct{}, 2)
+
+	ctx := context.Background()
+	if err := p.Submit(ctx, a, func() {
+		select {
+		case <-started:
+		case <-time.After(5 * time.Second):
+		}
+		finished <- struct{}{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Submit(ctx, b, func() {
+		close(started)
+		finished <- struct{}{}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("work for different keys didn't run in parallel")
+	}
+
+	for i := 0; i < 2; i++ {
+		<-finished
+	}
+}
+
+func TestPoolWaitMakesWritesVisible(t *testing.T) {
+	p := New(4, 8)
+	run(t, p)
+
+	ctx := context.Background()
+	counts := make([]int, 16)
+	for i := range counts {
+		for j := 0; j < 10; j++ {
+			if err := p.Submit(ctx, fmt.Sprintf("target-%d", i), func() {
+				counts[i]++
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := p.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read without synchronization, which the race detector reports unless
+	// Wait orders the writes before it returns.
+	for i, n := range counts {
+		if n != 10 {
+			t.Errorf("key %d: ran %d pieces of work, want 10", i, n)
+		}
+	}
+}
+
+func TestPoolCancelAbandonsQueuedWork(t *testing.T) {
+	p := New(1, 4)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx)
+	}()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	if err := p.Submit(context.Background(), "target", func() {
+		close(started)
+		<-release
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	var ran atomic.Int32
+	for i := 0; i < 4; i++ {
+		if err := p.Submit(context.Background(), "target", func() {
+			ran.Add(1)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cancel()
+	close(release)
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() = %v, want %v", err, context.Canceled)
+	}
+
+	if n := ran.Load(); n != 0 {
+		t.Errorf("ran %d pieces of queued work after cancelling, want 0", n)
+	}
+
+}
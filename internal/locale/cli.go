@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package locale
+
+import (
+	"os"
+	"strings"
+)
+
+// CLI returns the translation of an English command line text (a help
+// heading, the usage of a command or flag, or part of an error message) into
+// a locale. Texts without a translation are returned unchanged.
+func CLI(locale, text string) string {
+	for _, tag := range candidates(locale) {
+		if catalog, ok := cliCatalogs[tag]; ok {
+			if translated, ok := catalog[text]; ok {
+				return translated
+			}
+
+			return text
+		}
+	}
+
+	return text
+}
+
+// FromEnvironment returns the locale of the user's environment, from the
+// LC_ALL, LC_MESSAGES or LANG variables (eg. "de_DE.UTF-8" is "de-DE"). It
+// returns an empty string if none are set, or the "C" locale is.
+func FromEnvironment() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		value, _, _ = strings.Cut(value, ".")
+		value, _, _ = strings.Cut(value, "@")
+		if value == "C" || value == "POSIX" {
+			return ""
+		}
+
+		return strings.ReplaceAll(value, "_", "-")
+	}
+
+	return ""
+}
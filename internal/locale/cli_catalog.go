@@ -0,0 +1,712 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package locale
+
+// cliCatalogs are the translations of the command line texts, keyed by the
+// English text.
+var cliCatalogs = map[string]map[string]string{
+	"nl": {
+		"NAME:":                   "NAAM:",
+		"USAGE:":                  "GEBRUIK:",
+		"VERSION:":                "VERSIE:",
+		"DESCRIPTION:":            "BESCHRIJVING:",
+		"CATEGORY:":               "CATEGORIE:",
+		"COMMANDS:":               "OPDRACHTEN:",
+		"GLOBAL OPTIONS:":         "ALGEMENE OPTIES:",
+		"OPTIONS:":                "OPTIES:",
+		"COPYRIGHT:":              "AUTEURSRECHT:",
+		"command":                 "opdracht",
+		"[global options]":        "[algemene opties]",
+		"[command options]":       "[opdrachtopties]",
+		"[arguments...]":          "[argumenten...]",
+		"default":                 "standaard",
+		"accepts multiple inputs": "kan worden herhaald",
+		"show help":               "toon de hulp",
+		"print the version":       "toon de versie",
+		"Shows a list of commands or help for one command": "Toont een lijst met opdrachten of de hulp bij één opdracht",
+		"Incorrect Usage:":                                             "Onjuist gebruik:",
+		"Failed to run the application":                                "Het programma kon niet worden uitgevoerd",
+		"flag provided but not defined":                                "onbekende optie",
+		"flag needs an argument":                                       "optie heeft een waarde nodig",
+		"cat-doorbell isn't running":                                   "cat-doorbell draait niet",
+		"another instance is already running":                          "er draait al een ander exemplaar",
+		"developer mode isn't enabled (start cat-doorbell with --dev)": "ontwikkelaarsmodus is niet ingeschakeld (start cat-doorbell met --dev)",
+		"failed to connect to control socket":                          "kan niet verbinden met de besturingssocket",
+		"target not found":                                             "apparaat niet gevonden",
+		"token not found":                                              "token niet gevonden",
+		"secret not found in keyring":                                  "geheim niet gevonden in de sleutelbos",
+		"failed to load configuration":                                 "kan de configuratie niet laden",
+		"no configuration file found":                                  "geen configuratiebestand gevonden",
+		"looked for":                                                   "gezocht naar",
+		"no such file or directory":                                    "bestand of map bestaat niet",
+		"permission denied":                                            "toegang geweigerd",
+		"connection refused":                                           "verbinding geweigerd",
+		"Receive a notification when the cat wants to come inside":     "Ontvang een melding als de kat naar binnen wil",
+		"Path to the configuration file":                               "Pad naar het configuratiebestand",
+		"Path to the shared configuration file, which the configuration file overrides": "Pad naar het gedeelde configuratiebestand, dat door het configuratiebestand wordt overschreven",
+		"Directory to store log files":                                                                                           "Map voor de logbestanden",
+		"Set the log verbosity level":                                                                                            "Niveau van detail van de logs",
+		"Format of log messages, \"text\" or \"json\"":                                                                           "Formaat van logberichten, \"text\" of \"json\"",
+		"Size in MiB at which the log file is rotated (0 disables rotation)":                                                     "Grootte in MiB waarbij het logbestand wordt geroteerd (0 schakelt roteren uit)",
+		"How long old log files are kept for (0 keeps them regardless of age)":                                                   "Hoe lang oude logbestanden worden bewaard (0 bewaart ze ongeacht hun leeftijd)",
+		"Combined size in MiB of the log files, above which the oldest are removed (0 for no limit)":                             "Totale grootte in MiB van de logbestanden, waarboven de oudste worden verwijderd (0 voor geen limiet)",
+		"Compress rotated log files":                                                                                             "Comprimeer geroteerde logbestanden",
+		"Path to the detection history database":                                                                                 "Pad naar de database met de detectiegeschiedenis",
+		"Path to the queue of notifications that couldn't be delivered yet":                                                      "Pad naar de wachtrij met meldingen die nog niet bezorgd konden worden",
+		"Run without a system tray icon or desktop notifications (auto-detected if there is no display)":                         "Draai zonder systeemvakpictogram of bureaubladmeldingen (automatisch als er geen beeldscherm is)",
+		"Override a configuration field, eg. --set broker.address=tcp://localhost:1883 (can be repeated)":                        "Overschrijf een configuratieveld, bijv. --set broker.address=tcp://localhost:1883 (kan worden herhaald)",
+		"Scan for devices using the host's Bluetooth adapter":                                                                    "Zoek naar apparaten met de Bluetooth-adapter van deze computer",
+		"Append every received beacon to a file, for replaying later with \"cat-doorbell replay\"":                               "Voeg elk ontvangen beacon toe aan een bestand, om later af te spelen met \"cat-doorbell replay\"",
+		"Path to the socket the running instance is controlled through":                                                          "Pad naar de socket waarmee het draaiende exemplaar wordt bestuurd",
+		"Check connectivity, audio, notifiers and payload parsing, print a JSON report and exit":                                 "Controleer de verbinding, het geluid, de meldingskanalen en het verwerken van payloads, toon een JSON-rapport en stop",
+		"Language of the command line help and messages (eg. nl), rather than the system locale":                                 "Taal van de hulp en berichten op de opdrachtregel (bijv. nl), in plaats van de systeemtaal",
+		"Create and inspect the configuration file":                                                                              "Maak en bekijk het configuratiebestand",
+		"Write a starter configuration file":                                                                                     "Schrijf een eerste configuratiebestand",
+		"Overwrite an existing configuration file":                                                                               "Overschrijf een bestaand configuratiebestand",
+		"MAC address of the cat's tag":                                                                                           "MAC-adres van de tag van de kat",
+		"Name of the cat":                                                                                                        "Naam van de kat",
+		"Validate the configuration file and report suspicious values":                                                           "Controleer het configuratiebestand en meld verdachte waarden",
+		"Treat warnings as errors":                                                                                               "Behandel waarschuwingen als fouten",
+		"Rewrite the configuration file using the latest schema version (comments are not preserved)":                            "Herschrijf het configuratiebestand met de nieuwste schemaversie (opmerkingen blijven niet behouden)",
+		"List the previous versions of the configuration file, kept whenever cat-doorbell rewrites it":                           "Toon de vorige versies van het configuratiebestand, die bewaard worden als cat-doorbell het herschrijft",
+		"Restore a previous version of the configuration file (by default, the most recent)":                                     "Herstel een vorige versie van het configuratiebestand (standaard de meest recente)",
+		"Manage the devices to listen for":                                                                                       "Beheer de apparaten waarnaar wordt geluisterd",
+		"Add a device":                                                                                                           "Voeg een apparaat toe",
+		"Remove a device":                                                                                                        "Verwijder een apparaat",
+		"List the configured devices":                                                                                            "Toon de geconfigureerde apparaten",
+		"MAC address of the device":                                                                                              "MAC-adres van het apparaat",
+		"Name of the device (eg. the cat's name)":                                                                                "Naam van het apparaat (bijv. de naam van de kat)",
+		"Notification message to display when the device is detected":                                                            "Meldingstekst die wordt getoond als het apparaat wordt gedetecteerd",
+		"Path to an MP3, WAV, OGG or FLAC file to play when the device is detected":                                              "Pad naar een MP3-, WAV-, OGG- of FLAC-bestand dat wordt afgespeeld als het apparaat wordt gedetecteerd",
+		"Override the default detection timeout for this device":                                                                 "Overschrijf de standaard detectietime-out voor dit apparaat",
+		"Accent colour used to distinguish the device (eg. #ff8800)":                                                             "Accentkleur om het apparaat te herkennen (bijv. #ff8800)",
+		"Glob pattern matched against the device's advertised local name":                                                        "Glob-patroon voor de geadverteerde naam van het apparaat",
+		"Service UUID advertised by the device":                                                                                  "Service-UUID die het apparaat adverteert",
+		"Show the history of detected devices":                                                                                   "Toon de geschiedenis van gedetecteerde apparaten",
+		"Only show detections after a duration ago (eg. 24h) or RFC 3339 timestamp":                                              "Toon alleen detecties na een tijdsduur geleden (bijv. 24h) of een RFC 3339-tijdstip",
+		"Only show detections of the device with the given MAC address":                                                          "Toon alleen detecties van het apparaat met het opgegeven MAC-adres",
+		"Include detections that didn't ring the doorbell":                                                                       "Neem ook detecties op die de deurbel niet lieten gaan",
+		"Maximum number of detections to show (0 for no limit)":                                                                  "Maximaal aantal te tonen detecties (0 voor geen limiet)",
+		"Output detections as JSON":                                                                                              "Toon detecties als JSON",
+		"Output detections as JSON, one per line":                                                                                "Toon detecties als JSON, één per regel",
+		"Start or stop maintenance mode in the running instance, eg. for a planned broker reboot":                                "Start of stop de onderhoudsmodus van het draaiende exemplaar, bijv. voor een geplande herstart van de broker",
+		"Start maintenance mode, for a duration (eg. 1h) or until stopped":                                                       "Start de onderhoudsmodus, voor een tijdsduur (bijv. 1h) of tot hij wordt gestopt",
+		"Stop maintenance mode (scheduled maintenance windows still apply)":                                                      "Stop de onderhoudsmodus (geplande onderhoudsvensters blijven gelden)",
+		"Start or stop expect mode in the running instance, which makes detection more sensitive while the cat is expected back": "Start of stop de verwachtmodus in de actieve instantie, die detectie gevoeliger maakt terwijl de kat terug wordt verwacht",
+		"Start expect mode, for a duration (eg. 30m) or the configured duration":                                                 "Start de verwachtmodus, voor een duur (bijv. 30m) of de geconfigureerde duur",
+		"Stop expect mode": "Stop de verwachtmodus",
+		"Pause notifications of the running instance, for a duration (eg. 1h) or until resumed":                               "Pauzeer de meldingen van het draaiende exemplaar, voor een tijdsduur (bijv. 1h) of tot ze worden hervat",
+		"Resume notifications of the running instance":                                                                        "Hervat de meldingen van het draaiende exemplaar",
+		"Show the status of the running instance":                                                                             "Toon de status van het draaiende exemplaar",
+		"Output the status as JSON":                                                                                           "Toon de status als JSON",
+		"Start or stop recording beacons in the running instance":                                                             "Start of stop het opnemen van beacons in het draaiende exemplaar",
+		"Start recording beacons, and print the path of the recording":                                                        "Start het opnemen van beacons en toon het pad van de opname",
+		"Stop recording beacons":                                                                                              "Stop het opnemen van beacons",
+		"Developer mode, which lets \"cat-doorbell dev\" inject faults into the broker connection":                            "Ontwikkelaarsmodus, waarmee \"cat-doorbell dev\" storingen in de brokerverbinding kan veroorzaken",
+		"Act on the named profile, rather than the doorbell of the configuration file":                                        "Werk met het opgegeven profiel, in plaats van de deurbel van het configuratiebestand",
+		"Inject faults into the running instance's broker connection (requires --dev)":                                        "Veroorzaak storingen in de brokerverbinding van het draaiende exemplaar (vereist --dev)",
+		"Drop the connection to the broker, as if it was lost":                                                                "Verbreek de verbinding met de broker, alsof die verloren ging",
+		"Drop the next COUNT messages received from the broker (0 stops dropping)":                                            "Negeer de volgende AANTAL berichten van de broker (0 stopt het negeren)",
+		"Delay every message received from the broker (0s for no delay)":                                                      "Vertraag elk bericht van de broker (0s voor geen vertraging)",
+		"Feed a recorded beacon stream through the detector and show the detections, without notifying":                       "Speel een opgenomen beaconstroom af door de detector en toon de detecties, zonder meldingen",
+		"Playback speed relative to the recording (eg. 10x), or \"max\" to replay as fast as possible":                        "Afspeelsnelheid ten opzichte van de opname (bijv. 10x), of \"max\" om zo snel mogelijk af te spelen",
+		"Gather recent logs, the configuration, version information and statistics into an archive to attach to a bug report": "Verzamel recente logboeken, de configuratie, versie-informatie en statistieken in een archief om bij een foutmelding te voegen",
+		"Secrets (passwords, tokens, keys, usernames, and the paths and queries of URLs) are scrubbed from\nthe configuration, and from the logs wherever they appear. MAC addresses are hashed with a salt\nthat is thrown away, so the same device can still be recognized across the report.": "Geheimen (wachtwoorden, tokens, sleutels, gebruikersnamen, en de paden en query's van URL's) worden\nuit de configuratie verwijderd, en overal waar ze in de logboeken voorkomen. MAC-adressen worden gehasht\nmet een zout dat wordt weggegooid, zodat hetzelfde apparaat in het hele rapport herkenbaar blijft.",
+		"Path of the archive (defaults to cat-doorbell-report-<time>.zip in the current directory)":                        "Pad van het archief (standaard cat-doorbell-report-<tijd>.zip in de huidige map)",
+		"Include the log files written to after a duration ago (eg. 24h) or RFC 3339 timestamp":                            "Neem de logboekbestanden op waarnaar is geschreven na een tijdsduur geleden (bijv. 24h) of een RFC 3339-tijdstempel",
+		"Include MAC addresses as they are, rather than hashed":                                                            "Neem MAC-adressen op zoals ze zijn, in plaats van gehasht",
+		"Ring the doorbell and notify for the detections, as if the beacons were being received":                           "Laat de deurbel gaan en meld de detecties, alsof de beacons nu worden ontvangen",
+		"How long to keep running after the last beacon, eg. for notifications to be delivered or departures to be raised": "Hoe lang er na het laatste beacon wordt doorgedraaid, bijv. om meldingen te bezorgen of vertrek te melden",
+		"Scan for BLE devices and publish their beacons to the MQTT broker":                                                "Zoek naar BLE-apparaten en publiceer hun beacons naar de MQTT-broker",
+		"Address of the MQTT broker (eg. tcp://localhost:1883)":                                                            "Adres van de MQTT-broker (bijv. tcp://localhost:1883)",
+		"MQTT topic to publish beacons to (overrides the configuration file)":                                              "MQTT-topic om beacons naar te publiceren (overschrijft het configuratiebestand)",
+		"Manage credentials stored in the operating system's keyring":                                                      "Beheer inloggegevens in de sleutelbos van het besturingssysteem",
+		"Store a secret, read from the terminal or standard input":                                                         "Sla een geheim op, gelezen van de terminal of standaardinvoer",
+		"Delete a secret": "Verwijder een geheim",
+		"Start cat-doorbell automatically at login (using systemd, launchd or a Windows startup entry)": "Start cat-doorbell automatisch bij het inloggen (met systemd, launchd of een Windows-opstartitem)",
+		"Register cat-doorbell to start at login":                                                       "Laat cat-doorbell starten bij het inloggen",
+		"Also start it now":                                      "Start het nu ook",
+		"Stop cat-doorbell starting at login":                    "Laat cat-doorbell niet meer starten bij het inloggen",
+		"Start the installed service":                            "Start de geïnstalleerde service",
+		"Stop the installed service":                             "Stop de geïnstalleerde service",
+		"Edit the broker, target and sound settings in a window": "Bewerk de instellingen voor broker, apparaten en geluid in een venster",
+		"Ring the doorbell for simulated beacons from a device, without a broker or Bluetooth adapter": "Laat de deurbel gaan voor gesimuleerde beacons van een apparaat, zonder broker of Bluetooth-adapter",
+		"Beacons are fed through detection as if they had been received, so detection settings,\ncustom events, actions and notifiers can be checked before mounting any hardware.\nDetections are notified as usual, but aren't recorded in the history.": "Beacons gaan door de detectie alsof ze ontvangen zijn, zodat detectie-instellingen,\neigen gebeurtenissen, acties en meldingskanalen getest kunnen worden voordat er hardware hangt.\nDetecties worden zoals gewoonlijk gemeld, maar niet in de geschiedenis opgeslagen.",
+		"MAC address of the simulated device":                                       "MAC-adres van het gesimuleerde apparaat",
+		"Signal strength of the simulated beacons in dBm":                           "Signaalsterkte van de gesimuleerde beacons in dBm",
+		"Number of beacons to send":                                                 "Aantal te versturen beacons",
+		"Time between beacons":                                                      "Tijd tussen beacons",
+		"Measure the throughput and latency of beacon handling with synthetic load": "Meet de doorvoer en vertraging van de beaconverwerking met synthetische belasting",
+		"Beacons from synthetic devices are fed through the beacon queue, detection and event handling,\neither directly or through the configured broker (with --broker), and the throughput, latency\npercentiles and dropped beacons are reported. The configured limits are used, notifications are\npaused and detections are recorded in a temporary history, so it can run alongside the doorbell.": "Beacons van synthetische apparaten gaan door de beaconwachtrij, detectie en gebeurtenisverwerking,\nrechtstreeks of via de geconfigureerde broker (met --broker), en de doorvoer, vertragingspercentielen\nen weggegooide beacons worden gemeld. De geconfigureerde limieten worden gebruikt, meldingen zijn\ngepauzeerd en detecties worden in een tijdelijke geschiedenis opgeslagen, zodat het naast de deurbel kan draaien.",
+		"Number of synthetic devices, which take turns sending beacons":                             "Aantal synthetische apparaten, die om beurten beacons versturen",
+		"Beacons sent per second (eg. 200/s, or 600/m)":                                             "Beacons per seconde (bijv. 200/s, of 600/m)",
+		"How long to send beacons for":                                                              "Hoe lang er beacons worden verstuurd",
+		"Detection timeout of the synthetic devices (0s makes every beacon a detection)":            "Detectietime-out van de synthetische apparaten (0s maakt van elk beacon een detectie)",
+		"Send the beacons through the configured broker, rather than directly":                      "Verstuur de beacons via de geconfigureerde broker, in plaats van rechtstreeks",
+		"How long to wait for the last beacons to be handled once they have all been sent":          "Hoe lang er gewacht wordt tot de laatste beacons verwerkt zijn nadat ze allemaal verstuurd zijn",
+		"Report a button press in the simulated beacons":                                            "Meld een druk op de knop in de gesimuleerde beacons",
+		"Show which events a hypothetical beacon would raise and why, without ringing the doorbell": "Toon welke gebeurtenissen een hypothetisch beacon zou veroorzaken en waarom, zonder de deurbel te laten rinkelen",
+		"If cat-doorbell is running, the beacon is evaluated against its current state (eg. when each\ntarget was last detected). Otherwise (or with --offline) it is evaluated against the configuration,\nas the first beacon received after starting. Nothing is notified, run or recorded either way.": "Als cat-doorbell draait, wordt het beacon beoordeeld tegen de huidige toestand (bijv. wanneer elk\napparaat voor het laatst is gedetecteerd). Anders (of met --offline) wordt het beoordeeld tegen de configuratie,\nals het eerste beacon na het starten. Er wordt in geen geval iets gemeld, uitgevoerd of vastgelegd.",
+		"Signal strength of the beacon in dBm (0 if unknown)":                                      "Signaalsterkte van het beacon in dBm (0 als onbekend)",
+		"Advertised local name of the device":                                                      "Geadverteerde lokale naam van het apparaat",
+		"When the beacon is received, as an RFC 3339 timestamp or a time of day today (eg. 22:30)": "Wanneer het beacon wordt ontvangen, als RFC 3339-tijdstempel of een tijdstip vandaag (bijv. 22:30)",
+		"Report a button press in the beacon":                                                      "Meld een druk op de knop in het beacon",
+		"Battery level reported by the beacon in percent":                                          "Batterijniveau dat het beacon meldt, in procent",
+		"Evaluate against the configuration, rather than the running instance":                     "Beoordeel tegen de configuratie, in plaats van het draaiende exemplaar",
+		"Output the evaluation as JSON":                                                            "Toon de beoordeling als JSON",
+		"Show how often and when each target rang the doorbell":                                    "Toon hoe vaak en wanneer elk apparaat aanbelde",
+		"Summarize visits after a duration ago (eg. 24h) or RFC 3339 timestamp":                    "Vat bezoeken samen na een tijdsduur geleden (bijv. 24h) of een RFC 3339-tijdstip",
+		"Only summarize the target with the given name (can be repeated)":                          "Vat alleen het apparaat met de opgegeven naam samen (kan worden herhaald)",
+		"Output statistics as JSON":                                                                "Toon statistieken als JSON",
+		"Send a test notification and report the result for each notifier":                         "Verstuur een testmelding en toon het resultaat per meldingskanaal",
+		"If cat-doorbell is running, it rings the doorbell for a fake detection of a target,\nend-to-end. Otherwise (or with --all or --notifier) a test notification is sent directly.\nEither way the notification is delivered as if a device had been detected, so only\nnotifiers subscribed to detection events receive it (unless --all is given).": "Als cat-doorbell draait, gaat de deurbel van begin tot eind voor een nepdetectie van een apparaat.\nAnders (of met --all of --notifier) wordt er direct een testmelding verstuurd.\nHoe dan ook wordt de melding bezorgd alsof er een apparaat is gedetecteerd, dus alleen\nmeldingskanalen die op detecties zijn geabonneerd ontvangen hem (tenzij --all is opgegeven).",
+		"Only test the notifier with the given name (can be repeated)":                                "Test alleen het meldingskanaal met de opgegeven naam (kan worden herhaald)",
+		"Send the test notification to every notifier, regardless of the events it is subscribed to":  "Verstuur de testmelding naar elk meldingskanaal, ongeacht de gebeurtenissen waarop het is geabonneerd",
+		"Name of the target the running instance fakes a detection of (defaults to the first target)": "Naam van het apparaat waarvoor het draaiende exemplaar een detectie nabootst (standaard het eerste)",
+		"Output the results as JSON": "Toon de resultaten als JSON",
+		"Manage the local certificate authority the web dashboard's certificate is issued by": "Beheer de lokale certificaatautoriteit die het certificaat van het webdashboard uitgeeft",
+		"Print the certificate of the local certificate authority, creating it if necessary":  "Toon het certificaat van de lokale certificaatautoriteit, en maak het zo nodig aan",
+		"Write the certificate to the given path, rather than standard output":                "Schrijf het certificaat naar het opgegeven pad in plaats van standaarduitvoer",
+		"Trust the local certificate authority on this computer":                              "Vertrouw de lokale certificaatautoriteit op deze computer",
+		"Manage the tokens used to access the web dashboard and API":                          "Beheer de tokens voor toegang tot het webdashboard en de API",
+		"Create a token, printing it to standard output":                                      "Maak een token aan en toon het op standaarduitvoer",
+		"Only allow the token to view the dashboard and read the API":                         "Sta het token alleen toe het dashboard te bekijken en de API te lezen",
+		"Revoke a token": "Trek een token in",
+		"List the names and access of the configured tokens":                "Toon de namen en rechten van de geconfigureerde tokens",
+		"Show the version, and how the binary was built":                    "Toon de versie en hoe het programma is gebouwd",
+		"Print which subsystems are built in and work on this host as JSON": "Toon als JSON welke onderdelen zijn ingebouwd en op deze computer werken",
+		"Output the build information as JSON":                              "Toon de build-informatie als JSON",
+	},
+	"de": {
+		"NAME:":                   "NAME:",
+		"USAGE:":                  "VERWENDUNG:",
+		"VERSION:":                "VERSION:",
+		"DESCRIPTION:":            "BESCHREIBUNG:",
+		"CATEGORY:":               "KATEGORIE:",
+		"COMMANDS:":               "BEFEHLE:",
+		"GLOBAL OPTIONS:":         "GLOBALE OPTIONEN:",
+		"OPTIONS:":                "OPTIONEN:",
+		"COPYRIGHT:":              "URHEBERRECHT:",
+		"command":                 "befehl",
+		"[global options]":        "[globale optionen]",
+		"[command options]":       "[befehlsoptionen]",
+		"[arguments...]":          "[argumente...]",
+		"default":                 "Standard",
+		"accepts multiple inputs": "kann wiederholt werden",
+		"show help":               "Hilfe anzeigen",
+		"print the version":       "Version anzeigen",
+		"Shows a list of commands or help for one command": "Zeigt eine Liste der Befehle oder die Hilfe zu einem Befehl",
+		"Incorrect Usage:":                                             "Falsche Verwendung:",
+		"Failed to run the application":                                "Das Programm konnte nicht ausgeführt werden",
+		"flag provided but not defined":                                "unbekannte Option",
+		"flag needs an argument":                                       "Option benötigt einen Wert",
+		"cat-doorbell isn't running":                                   "cat-doorbell läuft nicht",
+		"another instance is already running":                          "eine andere Instanz läuft bereits",
+		"developer mode isn't enabled (start cat-doorbell with --dev)": "der Entwicklermodus ist nicht aktiviert (cat-doorbell mit --dev starten)",
+		"failed to connect to control socket":                          "Verbindung zum Steuer-Socket fehlgeschlagen",
+		"target not found":                                             "Gerät nicht gefunden",
+		"token not found":                                              "Token nicht gefunden",
+		"secret not found in keyring":                                  "Geheimnis nicht im Schlüsselbund gefunden",
+		"failed to load configuration":                                 "Konfiguration konnte nicht geladen werden",
+		"no configuration file found":                                  "keine Konfigurationsdatei gefunden",
+		"looked for":                                                   "gesucht wurde nach",
+		"no such file or directory":                                    "Datei oder Verzeichnis nicht gefunden",
+		"permission denied":                                            "Zugriff verweigert",
+		"connection refused":                                           "Verbindung abgelehnt",
+		"Receive a notification when the cat wants to come inside":     "Benachrichtigung, wenn die Katze herein möchte",
+		"Path to the configuration file":                               "Pfad zur Konfigurationsdatei",
+		"Path to the shared configuration file, which the configuration file overrides": "Pfad zur gemeinsamen Konfigurationsdatei, die von der Konfigurationsdatei überschrieben wird",
+		"Directory to store log files":                                                                                           "Verzeichnis für die Protokolldateien",
+		"Set the log verbosity level":                                                                                            "Ausführlichkeit der Protokolle",
+		"Format of log messages, \"text\" or \"json\"":                                                                           "Format der Protokollmeldungen, \"text\" oder \"json\"",
+		"Size in MiB at which the log file is rotated (0 disables rotation)":                                                     "Größe in MiB, ab der die Protokolldatei rotiert wird (0 deaktiviert die Rotation)",
+		"How long old log files are kept for (0 keeps them regardless of age)":                                                   "Wie lange alte Protokolldateien aufbewahrt werden (0 behält sie unabhängig vom Alter)",
+		"Combined size in MiB of the log files, above which the oldest are removed (0 for no limit)":                             "Gesamtgröße der Protokolldateien in MiB, ab der die ältesten gelöscht werden (0 für keine Grenze)",
+		"Compress rotated log files":                                                                                             "Rotierte Protokolldateien komprimieren",
+		"Path to the detection history database":                                                                                 "Pfad zur Datenbank des Erkennungsverlaufs",
+		"Path to the queue of notifications that couldn't be delivered yet":                                                      "Pfad zur Warteschlange der noch nicht zugestellten Benachrichtigungen",
+		"Run without a system tray icon or desktop notifications (auto-detected if there is no display)":                         "Ohne Symbol im Infobereich oder Desktop-Benachrichtigungen ausführen (automatisch, wenn kein Bildschirm vorhanden ist)",
+		"Override a configuration field, eg. --set broker.address=tcp://localhost:1883 (can be repeated)":                        "Ein Konfigurationsfeld überschreiben, z. B. --set broker.address=tcp://localhost:1883 (kann wiederholt werden)",
+		"Scan for devices using the host's Bluetooth adapter":                                                                    "Mit dem Bluetooth-Adapter dieses Rechners nach Geräten suchen",
+		"Append every received beacon to a file, for replaying later with \"cat-doorbell replay\"":                               "Jedes empfangene Beacon an eine Datei anhängen, zum späteren Abspielen mit \"cat-doorbell replay\"",
+		"Path to the socket the running instance is controlled through":                                                          "Pfad zum Socket, über den die laufende Instanz gesteuert wird",
+		"Check connectivity, audio, notifiers and payload parsing, print a JSON report and exit":                                 "Verbindung, Audio, Benachrichtigungsdienste und Payload-Auswertung prüfen, einen JSON-Bericht ausgeben und beenden",
+		"Language of the command line help and messages (eg. nl), rather than the system locale":                                 "Sprache der Hilfe und Meldungen auf der Kommandozeile (z. B. nl), statt der Systemsprache",
+		"Create and inspect the configuration file":                                                                              "Konfigurationsdatei erstellen und prüfen",
+		"Write a starter configuration file":                                                                                     "Eine Start-Konfigurationsdatei schreiben",
+		"Overwrite an existing configuration file":                                                                               "Eine vorhandene Konfigurationsdatei überschreiben",
+		"MAC address of the cat's tag":                                                                                           "MAC-Adresse des Anhängers der Katze",
+		"Name of the cat":                                                                                                        "Name der Katze",
+		"Validate the configuration file and report suspicious values":                                                           "Konfigurationsdatei prüfen und verdächtige Werte melden",
+		"Treat warnings as errors":                                                                                               "Warnungen als Fehler behandeln",
+		"Rewrite the configuration file using the latest schema version (comments are not preserved)":                            "Konfigurationsdatei mit der neuesten Schemaversion neu schreiben (Kommentare gehen verloren)",
+		"List the previous versions of the configuration file, kept whenever cat-doorbell rewrites it":                           "Frühere Versionen der Konfigurationsdatei auflisten, die beim Neuschreiben durch cat-doorbell aufbewahrt werden",
+		"Restore a previous version of the configuration file (by default, the most recent)":                                     "Eine frühere Version der Konfigurationsdatei wiederherstellen (standardmäßig die neueste)",
+		"Manage the devices to listen for":                                                                                       "Geräte verwalten, auf die gehört wird",
+		"Add a device":                                                                                                           "Ein Gerät hinzufügen",
+		"Remove a device":                                                                                                        "Ein Gerät entfernen",
+		"List the configured devices":                                                                                            "Konfigurierte Geräte auflisten",
+		"MAC address of the device":                                                                                              "MAC-Adresse des Geräts",
+		"Name of the device (eg. the cat's name)":                                                                                "Name des Geräts (z. B. der Name der Katze)",
+		"Notification message to display when the device is detected":                                                            "Benachrichtigungstext, der angezeigt wird, wenn das Gerät erkannt wird",
+		"Path to an MP3, WAV, OGG or FLAC file to play when the device is detected":                                              "Pfad zu einer MP3-, WAV-, OGG- oder FLAC-Datei, die abgespielt wird, wenn das Gerät erkannt wird",
+		"Override the default detection timeout for this device":                                                                 "Standard-Erkennungszeitlimit für dieses Gerät überschreiben",
+		"Accent colour used to distinguish the device (eg. #ff8800)":                                                             "Akzentfarbe zur Unterscheidung des Geräts (z. B. #ff8800)",
+		"Glob pattern matched against the device's advertised local name":                                                        "Glob-Muster für den angekündigten Namen des Geräts",
+		"Service UUID advertised by the device":                                                                                  "Vom Gerät angekündigte Service-UUID",
+		"Show the history of detected devices":                                                                                   "Verlauf der erkannten Geräte anzeigen",
+		"Only show detections after a duration ago (eg. 24h) or RFC 3339 timestamp":                                              "Nur Erkennungen nach einer Dauer zuvor (z. B. 24h) oder einem RFC-3339-Zeitstempel anzeigen",
+		"Only show detections of the device with the given MAC address":                                                          "Nur Erkennungen des Geräts mit der angegebenen MAC-Adresse anzeigen",
+		"Include detections that didn't ring the doorbell":                                                                       "Auch Erkennungen einschließen, die nicht geklingelt haben",
+		"Maximum number of detections to show (0 for no limit)":                                                                  "Höchstzahl anzuzeigender Erkennungen (0 für keine Grenze)",
+		"Output detections as JSON":                                                                                              "Erkennungen als JSON ausgeben",
+		"Output detections as JSON, one per line":                                                                                "Erkennungen als JSON ausgeben, eine pro Zeile",
+		"Start or stop maintenance mode in the running instance, eg. for a planned broker reboot":                                "Wartungsmodus der laufenden Instanz starten oder beenden, z. B. für einen geplanten Neustart des Brokers",
+		"Start maintenance mode, for a duration (eg. 1h) or until stopped":                                                       "Wartungsmodus starten, für eine Dauer (z. B. 1h) oder bis er beendet wird",
+		"Stop maintenance mode (scheduled maintenance windows still apply)":                                                      "Wartungsmodus beenden (geplante Wartungsfenster gelten weiterhin)",
+		"Start or stop expect mode in the running instance, which makes detection more sensitive while the cat is expected back": "Erwartungsmodus in der laufenden Instanz starten oder beenden, der die Erkennung empfindlicher macht, während die Katze zurückerwartet wird",
+		"Start expect mode, for a duration (eg. 30m) or the configured duration":                                                 "Erwartungsmodus starten, für eine Dauer (z. B. 30m) oder die konfigurierte Dauer",
+		"Stop expect mode": "Erwartungsmodus beenden",
+		"Pause notifications of the running instance, for a duration (eg. 1h) or until resumed":                               "Benachrichtigungen der laufenden Instanz pausieren, für eine Dauer (z. B. 1h) oder bis sie fortgesetzt werden",
+		"Resume notifications of the running instance":                                                                        "Benachrichtigungen der laufenden Instanz fortsetzen",
+		"Show the status of the running instance":                                                                             "Status der laufenden Instanz anzeigen",
+		"Output the status as JSON":                                                                                           "Status als JSON ausgeben",
+		"Start or stop recording beacons in the running instance":                                                             "Aufzeichnung von Beacons in der laufenden Instanz starten oder beenden",
+		"Start recording beacons, and print the path of the recording":                                                        "Aufzeichnung von Beacons starten und den Pfad der Aufzeichnung ausgeben",
+		"Stop recording beacons":                                                                                              "Aufzeichnung von Beacons beenden",
+		"Developer mode, which lets \"cat-doorbell dev\" inject faults into the broker connection":                            "Entwicklermodus, in dem \"cat-doorbell dev\" Fehler in die Broker-Verbindung einspeisen kann",
+		"Act on the named profile, rather than the doorbell of the configuration file":                                        "Das angegebene Profil verwenden, statt der Türklingel der Konfigurationsdatei",
+		"Inject faults into the running instance's broker connection (requires --dev)":                                        "Fehler in die Broker-Verbindung der laufenden Instanz einspeisen (erfordert --dev)",
+		"Drop the connection to the broker, as if it was lost":                                                                "Die Verbindung zum Broker trennen, als wäre sie verloren gegangen",
+		"Drop the next COUNT messages received from the broker (0 stops dropping)":                                            "Die nächsten ANZAHL Nachrichten vom Broker verwerfen (0 beendet das Verwerfen)",
+		"Delay every message received from the broker (0s for no delay)":                                                      "Jede Nachricht vom Broker verzögern (0s für keine Verzögerung)",
+		"Feed a recorded beacon stream through the detector and show the detections, without notifying":                       "Einen aufgezeichneten Beacon-Strom durch die Erkennung schicken und die Erkennungen anzeigen, ohne zu benachrichtigen",
+		"Playback speed relative to the recording (eg. 10x), or \"max\" to replay as fast as possible":                        "Abspielgeschwindigkeit relativ zur Aufzeichnung (z. B. 10x), oder \"max\" für so schnell wie möglich",
+		"Gather recent logs, the configuration, version information and statistics into an archive to attach to a bug report": "Aktuelle Protokolle, die Konfiguration, Versionsinformationen und Statistiken in einem Archiv sammeln, das einem Fehlerbericht beigefügt werden kann",
+		"Secrets (passwords, tokens, keys, usernames, and the paths and queries of URLs) are scrubbed from\nthe configuration, and from the logs wherever they appear. MAC addresses are hashed with a salt\nthat is thrown away, so the same device can still be recognized across the report.": "Geheimnisse (Passwörter, Tokens, Schlüssel, Benutzernamen sowie Pfade und Abfragen von URLs) werden aus\nder Konfiguration entfernt, und aus den Protokollen, wo immer sie vorkommen. MAC-Adressen werden mit einem\nverworfenen Salt gehasht, sodass dasselbe Gerät im ganzen Bericht erkennbar bleibt.",
+		"Path of the archive (defaults to cat-doorbell-report-<time>.zip in the current directory)":                        "Pfad des Archivs (standardmäßig cat-doorbell-report-<Zeit>.zip im aktuellen Verzeichnis)",
+		"Include the log files written to after a duration ago (eg. 24h) or RFC 3339 timestamp":                            "Die Protokolldateien einschließen, in die nach einer Dauer zuvor (z. B. 24h) oder einem RFC-3339-Zeitstempel geschrieben wurde",
+		"Include MAC addresses as they are, rather than hashed":                                                            "MAC-Adressen unverändert statt gehasht einschließen",
+		"Ring the doorbell and notify for the detections, as if the beacons were being received":                           "Klingeln und die Erkennungen melden, als ob die Beacons gerade empfangen würden",
+		"How long to keep running after the last beacon, eg. for notifications to be delivered or departures to be raised": "Wie lange nach dem letzten Beacon weitergelaufen wird, z. B. damit Benachrichtigungen zugestellt oder Abgänge gemeldet werden",
+		"Scan for BLE devices and publish their beacons to the MQTT broker":                                                "Nach BLE-Geräten suchen und ihre Beacons an den MQTT-Broker senden",
+		"Address of the MQTT broker (eg. tcp://localhost:1883)":                                                            "Adresse des MQTT-Brokers (z. B. tcp://localhost:1883)",
+		"MQTT topic to publish beacons to (overrides the configuration file)":                                              "MQTT-Topic, an das die Beacons gesendet werden (überschreibt die Konfigurationsdatei)",
+		"Manage credentials stored in the operating system's keyring":                                                      "Zugangsdaten im Schlüsselbund des Betriebssystems verwalten",
+		"Store a secret, read from the terminal or standard input":                                                         "Ein Geheimnis speichern, gelesen vom Terminal oder der Standardeingabe",
+		"Delete a secret": "Ein Geheimnis löschen",
+		"Start cat-doorbell automatically at login (using systemd, launchd or a Windows startup entry)": "cat-doorbell bei der Anmeldung automatisch starten (mit systemd, launchd oder einem Windows-Autostart-Eintrag)",
+		"Register cat-doorbell to start at login":                                                       "cat-doorbell für den Start bei der Anmeldung registrieren",
+		"Also start it now":                                      "Auch jetzt starten",
+		"Stop cat-doorbell starting at login":                    "cat-doorbell nicht mehr bei der Anmeldung starten",
+		"Start the installed service":                            "Installierten Dienst starten",
+		"Stop the installed service":                             "Installierten Dienst beenden",
+		"Edit the broker, target and sound settings in a window": "Einstellungen für Broker, Geräte und Töne in einem Fenster bearbeiten",
+		"Ring the doorbell for simulated beacons from a device, without a broker or Bluetooth adapter": "Für simulierte Beacons eines Geräts klingeln, ohne Broker oder Bluetooth-Adapter",
+		"Beacons are fed through detection as if they had been received, so detection settings,\ncustom events, actions and notifiers can be checked before mounting any hardware.\nDetections are notified as usual, but aren't recorded in the history.": "Beacons werden durch die Erkennung geschickt, als wären sie empfangen worden, sodass Erkennungseinstellungen,\neigene Ereignisse, Aktionen und Benachrichtigungsdienste vor der Montage der Hardware geprüft werden können.\nErkennungen werden wie gewohnt gemeldet, aber nicht im Verlauf gespeichert.",
+		"MAC address of the simulated device":                                       "MAC-Adresse des simulierten Geräts",
+		"Signal strength of the simulated beacons in dBm":                           "Signalstärke der simulierten Beacons in dBm",
+		"Number of beacons to send":                                                 "Anzahl der zu sendenden Beacons",
+		"Time between beacons":                                                      "Zeit zwischen den Beacons",
+		"Measure the throughput and latency of beacon handling with synthetic load": "Durchsatz und Latenz der Beacon-Verarbeitung mit synthetischer Last messen",
+		"Beacons from synthetic devices are fed through the beacon queue, detection and event handling,\neither directly or through the configured broker (with --broker), and the throughput, latency\npercentiles and dropped beacons are reported. The configured limits are used, notifications are\npaused and detections are recorded in a temporary history, so it can run alongside the doorbell.": "Beacons synthetischer Geräte durchlaufen die Beacon-Warteschlange, Erkennung und Ereignisverarbeitung,\ndirekt oder über den konfigurierten Broker (mit --broker), und Durchsatz, Latenzperzentile\nund verworfene Beacons werden ausgegeben. Die konfigurierten Limits werden verwendet, Benachrichtigungen\nsind pausiert und Erkennungen werden in einem temporären Verlauf gespeichert, sodass es neben der Türklingel laufen kann.",
+		"Number of synthetic devices, which take turns sending beacons":                             "Anzahl synthetischer Geräte, die abwechselnd Beacons senden",
+		"Beacons sent per second (eg. 200/s, or 600/m)":                                             "Gesendete Beacons pro Sekunde (z. B. 200/s oder 600/m)",
+		"How long to send beacons for":                                                              "Wie lange Beacons gesendet werden",
+		"Detection timeout of the synthetic devices (0s makes every beacon a detection)":            "Erkennungszeitlimit der synthetischen Geräte (0s macht jeden Beacon zu einer Erkennung)",
+		"Send the beacons through the configured broker, rather than directly":                      "Die Beacons über den konfigurierten Broker senden, statt direkt",
+		"How long to wait for the last beacons to be handled once they have all been sent":          "Wie lange auf die Verarbeitung der letzten Beacons gewartet wird, nachdem alle gesendet wurden",
+		"Report a button press in the simulated beacons":                                            "Einen Tastendruck in den simulierten Beacons melden",
+		"Show which events a hypothetical beacon would raise and why, without ringing the doorbell": "Zeigen, welche Ereignisse ein hypothetisches Beacon auslösen würde und warum, ohne die Türklingel läuten zu lassen",
+		"If cat-doorbell is running, the beacon is evaluated against its current state (eg. when each\ntarget was last detected). Otherwise (or with --offline) it is evaluated against the configuration,\nas the first beacon received after starting. Nothing is notified, run or recorded either way.": "Wenn cat-doorbell läuft, wird das Beacon anhand seines aktuellen Zustands bewertet (z. B. wann jedes\nZiel zuletzt erkannt wurde). Andernfalls (oder mit --offline) wird es anhand der Konfiguration bewertet,\nals erstes Beacon nach dem Start. In keinem Fall wird etwas benachrichtigt, ausgeführt oder aufgezeichnet.",
+		"Signal strength of the beacon in dBm (0 if unknown)":                                      "Signalstärke des Beacons in dBm (0, falls unbekannt)",
+		"Advertised local name of the device":                                                      "Angekündigter lokaler Name des Geräts",
+		"When the beacon is received, as an RFC 3339 timestamp or a time of day today (eg. 22:30)": "Wann das Beacon empfangen wird, als RFC-3339-Zeitstempel oder Uhrzeit heute (z. B. 22:30)",
+		"Report a button press in the beacon":                                                      "Einen Tastendruck im Beacon melden",
+		"Battery level reported by the beacon in percent":                                          "Vom Beacon gemeldeter Akkustand in Prozent",
+		"Evaluate against the configuration, rather than the running instance":                     "Anhand der Konfiguration statt der laufenden Instanz bewerten",
+		"Output the evaluation as JSON":                                                            "Die Bewertung als JSON ausgeben",
+		"Show how often and when each target rang the doorbell":                                    "Anzeigen, wie oft und wann jedes Gerät geklingelt hat",
+		"Summarize visits after a duration ago (eg. 24h) or RFC 3339 timestamp":                    "Besuche nach einer Dauer zuvor (z. B. 24h) oder einem RFC-3339-Zeitstempel zusammenfassen",
+		"Only summarize the target with the given name (can be repeated)":                          "Nur das Gerät mit dem angegebenen Namen zusammenfassen (kann wiederholt werden)",
+		"Output statistics as JSON":                                                                "Statistiken als JSON ausgeben",
+		"Send a test notification and report the result for each notifier":                         "Eine Testbenachrichtigung senden und das Ergebnis für jeden Benachrichtigungsdienst melden",
+		"If cat-doorbell is running, it rings the doorbell for a fake detection of a target,\nend-to-end. Otherwise (or with --all or --notifier) a test notification is sent directly.\nEither way the notification is delivered as if a device had been detected, so only\nnotifiers subscribed to detection events receive it (unless --all is given).": "Wenn cat-doorbell läuft, klingelt es durchgehend für eine vorgetäuschte Erkennung eines Geräts.\nAndernfalls (oder mit --all oder --notifier) wird direkt eine Testbenachrichtigung gesendet.\nIn beiden Fällen wird die Benachrichtigung zugestellt, als wäre ein Gerät erkannt worden, daher\nerhalten sie nur Dienste, die Erkennungen abonniert haben (außer mit --all).",
+		"Only test the notifier with the given name (can be repeated)":                                "Nur den Benachrichtigungsdienst mit dem angegebenen Namen testen (kann wiederholt werden)",
+		"Send the test notification to every notifier, regardless of the events it is subscribed to":  "Die Testbenachrichtigung an jeden Dienst senden, unabhängig von den abonnierten Ereignissen",
+		"Name of the target the running instance fakes a detection of (defaults to the first target)": "Name des Geräts, dessen Erkennung die laufende Instanz vortäuscht (standardmäßig das erste)",
+		"Output the results as JSON": "Ergebnisse als JSON ausgeben",
+		"Manage the local certificate authority the web dashboard's certificate is issued by": "Lokale Zertifizierungsstelle verwalten, die das Zertifikat des Web-Dashboards ausstellt",
+		"Print the certificate of the local certificate authority, creating it if necessary":  "Zertifikat der lokalen Zertifizierungsstelle ausgeben und bei Bedarf erstellen",
+		"Write the certificate to the given path, rather than standard output":                "Zertifikat in den angegebenen Pfad statt auf die Standardausgabe schreiben",
+		"Trust the local certificate authority on this computer":                              "Der lokalen Zertifizierungsstelle auf diesem Rechner vertrauen",
+		"Manage the tokens used to access the web dashboard and API":                          "Tokens für den Zugriff auf das Web-Dashboard und die API verwalten",
+		"Create a token, printing it to standard output":                                      "Ein Token erstellen und auf der Standardausgabe ausgeben",
+		"Only allow the token to view the dashboard and read the API":                         "Dem Token nur das Ansehen des Dashboards und Lesen der API erlauben",
+		"Revoke a token": "Ein Token widerrufen",
+		"List the names and access of the configured tokens":                "Namen und Zugriffsrechte der konfigurierten Tokens auflisten",
+		"Show the version, and how the binary was built":                    "Version anzeigen und wie das Programm gebaut wurde",
+		"Print which subsystems are built in and work on this host as JSON": "Als JSON ausgeben, welche Teilsysteme eingebaut sind und auf diesem Rechner funktionieren",
+		"Output the build information as JSON":                              "Build-Informationen als JSON ausgeben",
+	},
+	"fr": {
+		"NAME:":                   "NOM :",
+		"USAGE:":                  "UTILISATION :",
+		"VERSION:":                "VERSION :",
+		"DESCRIPTION:":            "DESCRIPTION :",
+		"CATEGORY:":               "CATÉGORIE :",
+		"COMMANDS:":               "COMMANDES :",
+		"GLOBAL OPTIONS:":         "OPTIONS GLOBALES :",
+		"OPTIONS:":                "OPTIONS :",
+		"COPYRIGHT:":              "DROITS D'AUTEUR :",
+		"command":                 "commande",
+		"[global options]":        "[options globales]",
+		"[command options]":       "[options de la commande]",
+		"[arguments...]":          "[arguments...]",
+		"default":                 "par défaut",
+		"accepts multiple inputs": "peut être répétée",
+		"show help":               "afficher l'aide",
+		"print the version":       "afficher la version",
+		"Shows a list of commands or help for one command": "Affiche la liste des commandes ou l'aide d'une commande",
+		"Incorrect Usage:":                                             "Utilisation incorrecte :",
+		"Failed to run the application":                                "Échec de l'exécution du programme",
+		"flag provided but not defined":                                "option inconnue",
+		"flag needs an argument":                                       "l'option a besoin d'une valeur",
+		"cat-doorbell isn't running":                                   "cat-doorbell n'est pas lancé",
+		"another instance is already running":                          "une autre instance est déjà lancée",
+		"developer mode isn't enabled (start cat-doorbell with --dev)": "le mode développeur n'est pas activé (lancez cat-doorbell avec --dev)",
+		"failed to connect to control socket":                          "connexion au socket de contrôle impossible",
+		"target not found":                                             "appareil introuvable",
+		"token not found":                                              "jeton introuvable",
+		"secret not found in keyring":                                  "secret introuvable dans le trousseau",
+		"failed to load configuration":                                 "impossible de charger la configuration",
+		"no configuration file found":                                  "aucun fichier de configuration trouvé",
+		"looked for":                                                   "recherché",
+		"no such file or directory":                                    "fichier ou dossier introuvable",
+		"permission denied":                                            "permission refusée",
+		"connection refused":                                           "connexion refusée",
+		"Receive a notification when the cat wants to come inside":     "Recevoir une notification quand le chat veut rentrer",
+		"Path to the configuration file":                               "Chemin du fichier de configuration",
+		"Path to the shared configuration file, which the configuration file overrides": "Chemin du fichier de configuration partagé, que le fichier de configuration remplace",
+		"Directory to store log files":                                                                                           "Dossier des fichiers journaux",
+		"Set the log verbosity level":                                                                                            "Niveau de détail des journaux",
+		"Format of log messages, \"text\" or \"json\"":                                                                           "Format des messages du journal, « text » ou « json »",
+		"Size in MiB at which the log file is rotated (0 disables rotation)":                                                     "Taille en Mio à partir de laquelle le journal est archivé (0 désactive l'archivage)",
+		"How long old log files are kept for (0 keeps them regardless of age)":                                                   "Durée de conservation des anciens journaux (0 les conserve quel que soit leur âge)",
+		"Combined size in MiB of the log files, above which the oldest are removed (0 for no limit)":                             "Taille totale en Mio des journaux, au-delà de laquelle les plus anciens sont supprimés (0 pour aucune limite)",
+		"Compress rotated log files":                                                                                             "Compresser les journaux archivés",
+		"Path to the detection history database":                                                                                 "Chemin de la base de données de l'historique des détections",
+		"Path to the queue of notifications that couldn't be delivered yet":                                                      "Chemin de la file des notifications qui n'ont pas encore pu être envoyées",
+		"Run without a system tray icon or desktop notifications (auto-detected if there is no display)":                         "Fonctionner sans icône dans la barre système ni notifications de bureau (automatique en l'absence d'écran)",
+		"Override a configuration field, eg. --set broker.address=tcp://localhost:1883 (can be repeated)":                        "Remplacer un champ de la configuration, par ex. --set broker.address=tcp://localhost:1883 (peut être répétée)",
+		"Scan for devices using the host's Bluetooth adapter":                                                                    "Rechercher des appareils avec l'adaptateur Bluetooth de cet ordinateur",
+		"Append every received beacon to a file, for replaying later with \"cat-doorbell replay\"":                               "Ajouter chaque balise reçue à un fichier, pour la rejouer plus tard avec « cat-doorbell replay »",
+		"Path to the socket the running instance is controlled through":                                                          "Chemin du socket par lequel l'instance en cours est contrôlée",
+		"Check connectivity, audio, notifiers and payload parsing, print a JSON report and exit":                                 "Vérifier la connexion, le son, les canaux de notification et le décodage des données, afficher un rapport JSON et quitter",
+		"Language of the command line help and messages (eg. nl), rather than the system locale":                                 "Langue de l'aide et des messages en ligne de commande (par ex. nl), au lieu de celle du système",
+		"Create and inspect the configuration file":                                                                              "Créer et inspecter le fichier de configuration",
+		"Write a starter configuration file":                                                                                     "Écrire un fichier de configuration de départ",
+		"Overwrite an existing configuration file":                                                                               "Écraser un fichier de configuration existant",
+		"MAC address of the cat's tag":                                                                                           "Adresse MAC de la balise du chat",
+		"Name of the cat":                                                                                                        "Nom du chat",
+		"Validate the configuration file and report suspicious values":                                                           "Valider le fichier de configuration et signaler les valeurs suspectes",
+		"Treat warnings as errors":                                                                                               "Traiter les avertissements comme des erreurs",
+		"Rewrite the configuration file using the latest schema version (comments are not preserved)":                            "Réécrire le fichier de configuration avec la dernière version du schéma (les commentaires sont perdus)",
+		"List the previous versions of the configuration file, kept whenever cat-doorbell rewrites it":                           "Lister les versions précédentes du fichier de configuration, conservées à chaque réécriture par cat-doorbell",
+		"Restore a previous version of the configuration file (by default, the most recent)":                                     "Restaurer une version précédente du fichier de configuration (par défaut, la plus récente)",
+		"Manage the devices to listen for":                                                                                       "Gérer les appareils à écouter",
+		"Add a device":                                                                                                           "Ajouter un appareil",
+		"Remove a device":                                                                                                        "Supprimer un appareil",
+		"List the configured devices":                                                                                            "Lister les appareils configurés",
+		"MAC address of the device":                                                                                              "Adresse MAC de l'appareil",
+		"Name of the device (eg. the cat's name)":                                                                                "Nom de l'appareil (par ex. le nom du chat)",
+		"Notification message to display when the device is detected":                                                            "Message de notification affiché quand l'appareil est détecté",
+		"Path to an MP3, WAV, OGG or FLAC file to play when the device is detected":                                              "Chemin d'un fichier MP3, WAV, OGG ou FLAC à jouer quand l'appareil est détecté",
+		"Override the default detection timeout for this device":                                                                 "Remplacer le délai de détection par défaut pour cet appareil",
+		"Accent colour used to distinguish the device (eg. #ff8800)":                                                             "Couleur d'accent pour distinguer l'appareil (par ex. #ff8800)",
+		"Glob pattern matched against the device's advertised local name":                                                        "Motif glob comparé au nom annoncé par l'appareil",
+		"Service UUID advertised by the device":                                                                                  "UUID de service annoncé par l'appareil",
+		"Show the history of detected devices":                                                                                   "Afficher l'historique des appareils détectés",
+		"Only show detections after a duration ago (eg. 24h) or RFC 3339 timestamp":                                              "N'afficher que les détections depuis une durée (par ex. 24h) ou un horodatage RFC 3339",
+		"Only show detections of the device with the given MAC address":                                                          "N'afficher que les détections de l'appareil ayant cette adresse MAC",
+		"Include detections that didn't ring the doorbell":                                                                       "Inclure les détections qui n'ont pas fait sonner la sonnette",
+		"Maximum number of detections to show (0 for no limit)":                                                                  "Nombre maximal de détections à afficher (0 pour aucune limite)",
+		"Output detections as JSON":                                                                                              "Afficher les détections en JSON",
+		"Output detections as JSON, one per line":                                                                                "Afficher les détections en JSON, une par ligne",
+		"Start or stop maintenance mode in the running instance, eg. for a planned broker reboot":                                "Démarrer ou arrêter le mode maintenance de l'instance en cours, par ex. pour un redémarrage prévu du broker",
+		"Start maintenance mode, for a duration (eg. 1h) or until stopped":                                                       "Démarrer le mode maintenance, pour une durée (par ex. 1h) ou jusqu'à son arrêt",
+		"Stop maintenance mode (scheduled maintenance windows still apply)":                                                      "Arrêter le mode maintenance (les plages de maintenance planifiées restent actives)",
+		"Start or stop expect mode in the running instance, which makes detection more sensitive while the cat is expected back": "Démarrer ou arrêter le mode attente dans l'instance en cours, qui rend la détection plus sensible pendant que le chat est attendu",
+		"Start expect mode, for a duration (eg. 30m) or the configured duration":                                                 "Démarrer le mode attente, pour une durée (par ex. 30m) ou la durée configurée",
+		"Stop expect mode": "Arrêter le mode attente",
+		"Pause notifications of the running instance, for a duration (eg. 1h) or until resumed":                               "Suspendre les notifications de l'instance en cours, pour une durée (par ex. 1h) ou jusqu'à leur reprise",
+		"Resume notifications of the running instance":                                                                        "Reprendre les notifications de l'instance en cours",
+		"Show the status of the running instance":                                                                             "Afficher l'état de l'instance en cours",
+		"Output the status as JSON":                                                                                           "Afficher l'état en JSON",
+		"Start or stop recording beacons in the running instance":                                                             "Démarrer ou arrêter l'enregistrement des balises dans l'instance en cours",
+		"Start recording beacons, and print the path of the recording":                                                        "Démarrer l'enregistrement des balises et afficher le chemin de l'enregistrement",
+		"Stop recording beacons":                                                                                              "Arrêter l'enregistrement des balises",
+		"Developer mode, which lets \"cat-doorbell dev\" inject faults into the broker connection":                            "Mode développeur, qui permet à « cat-doorbell dev » d'injecter des pannes dans la connexion au broker",
+		"Act on the named profile, rather than the doorbell of the configuration file":                                        "Agir sur le profil indiqué, plutôt que sur la sonnette du fichier de configuration",
+		"Inject faults into the running instance's broker connection (requires --dev)":                                        "Injecter des pannes dans la connexion au broker de l'instance en cours (nécessite --dev)",
+		"Drop the connection to the broker, as if it was lost":                                                                "Couper la connexion au broker, comme si elle avait été perdue",
+		"Drop the next COUNT messages received from the broker (0 stops dropping)":                                            "Ignorer les NOMBRE prochains messages reçus du broker (0 arrête d'ignorer)",
+		"Delay every message received from the broker (0s for no delay)":                                                      "Retarder chaque message reçu du broker (0s pour aucun retard)",
+		"Feed a recorded beacon stream through the detector and show the detections, without notifying":                       "Faire passer un flux de balises enregistré par le détecteur et afficher les détections, sans notifier",
+		"Playback speed relative to the recording (eg. 10x), or \"max\" to replay as fast as possible":                        "Vitesse de lecture par rapport à l'enregistrement (par ex. 10x), ou « max » pour rejouer au plus vite",
+		"Gather recent logs, the configuration, version information and statistics into an archive to attach to a bug report": "Rassembler les journaux récents, la configuration, les informations de version et les statistiques dans une archive à joindre à un rapport de bogue",
+		"Secrets (passwords, tokens, keys, usernames, and the paths and queries of URLs) are scrubbed from\nthe configuration, and from the logs wherever they appear. MAC addresses are hashed with a salt\nthat is thrown away, so the same device can still be recognized across the report.": "Les secrets (mots de passe, jetons, clés, noms d'utilisateur, et les chemins et requêtes des URL) sont retirés\nde la configuration, et des journaux partout où ils apparaissent. Les adresses MAC sont hachées avec un sel\nqui est jeté, pour que le même appareil reste reconnaissable dans tout le rapport.",
+		"Path of the archive (defaults to cat-doorbell-report-<time>.zip in the current directory)":                        "Chemin de l'archive (par défaut cat-doorbell-report-<heure>.zip dans le répertoire courant)",
+		"Include the log files written to after a duration ago (eg. 24h) or RFC 3339 timestamp":                            "Inclure les fichiers journaux écrits après une durée passée (par ex. 24h) ou un horodatage RFC 3339",
+		"Include MAC addresses as they are, rather than hashed":                                                            "Inclure les adresses MAC telles quelles, plutôt que hachées",
+		"Ring the doorbell and notify for the detections, as if the beacons were being received":                           "Faire sonner la sonnette et notifier les détections, comme si les balises étaient reçues",
+		"How long to keep running after the last beacon, eg. for notifications to be delivered or departures to be raised": "Durée de fonctionnement après la dernière balise, par ex. pour envoyer les notifications ou signaler les départs",
+		"Scan for BLE devices and publish their beacons to the MQTT broker":                                                "Rechercher des appareils BLE et publier leurs balises sur le broker MQTT",
+		"Address of the MQTT broker (eg. tcp://localhost:1883)":                                                            "Adresse du broker MQTT (par ex. tcp://localhost:1883)",
+		"MQTT topic to publish beacons to (overrides the configuration file)":                                              "Sujet MQTT où publier les balises (remplace le fichier de configuration)",
+		"Manage credentials stored in the operating system's keyring":                                                      "Gérer les identifiants stockés dans le trousseau du système",
+		"Store a secret, read from the terminal or standard input":                                                         "Enregistrer un secret, lu depuis le terminal ou l'entrée standard",
+		"Delete a secret": "Supprimer un secret",
+		"Start cat-doorbell automatically at login (using systemd, launchd or a Windows startup entry)": "Lancer cat-doorbell automatiquement à la connexion (avec systemd, launchd ou une entrée de démarrage Windows)",
+		"Register cat-doorbell to start at login":                                                       "Enregistrer cat-doorbell pour qu'il se lance à la connexion",
+		"Also start it now":                                      "Le lancer aussi maintenant",
+		"Stop cat-doorbell starting at login":                    "Ne plus lancer cat-doorbell à la connexion",
+		"Start the installed service":                            "Démarrer le service installé",
+		"Stop the installed service":                             "Arrêter le service installé",
+		"Edit the broker, target and sound settings in a window": "Modifier les réglages du broker, des appareils et des sons dans une fenêtre",
+		"Ring the doorbell for simulated beacons from a device, without a broker or Bluetooth adapter": "Faire sonner la sonnette pour des balises simulées d'un appareil, sans broker ni adaptateur Bluetooth",
+		"Beacons are fed through detection as if they had been received, so detection settings,\ncustom events, actions and notifiers can be checked before mounting any hardware.\nDetections are notified as usual, but aren't recorded in the history.": "Les balises passent par la détection comme si elles avaient été reçues, afin de vérifier les réglages de détection,\nles événements personnalisés, les actions et les canaux de notification avant d'installer le matériel.\nLes détections sont notifiées normalement, mais ne sont pas enregistrées dans l'historique.",
+		"MAC address of the simulated device":                                       "Adresse MAC de l'appareil simulé",
+		"Signal strength of the simulated beacons in dBm":                           "Puissance du signal des balises simulées en dBm",
+		"Number of beacons to send":                                                 "Nombre de balises à envoyer",
+		"Time between beacons":                                                      "Délai entre les balises",
+		"Measure the throughput and latency of beacon handling with synthetic load": "Mesurer le débit et la latence du traitement des balises avec une charge synthétique",
+		"Beacons from synthetic devices are fed through the beacon queue, detection and event handling,\neither directly or through the configured broker (with --broker), and the throughput, latency\npercentiles and dropped beacons are reported. The configured limits are used, notifications are\npaused and detections are recorded in a temporary history, so it can run alongside the doorbell.": "Les balises d'appareils synthétiques passent par la file des balises, la détection et le traitement des événements,\ndirectement ou via le broker configuré (avec --broker), et le débit, les percentiles de latence\net les balises abandonnées sont affichés. Les limites configurées sont utilisées, les notifications sont\nen pause et les détections sont enregistrées dans un historique temporaire, pour pouvoir tourner à côté de la sonnette.",
+		"Number of synthetic devices, which take turns sending beacons":                             "Nombre d'appareils synthétiques, qui envoient des balises à tour de rôle",
+		"Beacons sent per second (eg. 200/s, or 600/m)":                                             "Balises envoyées par seconde (ex. 200/s, ou 600/m)",
+		"How long to send beacons for":                                                              "Durée d'envoi des balises",
+		"Detection timeout of the synthetic devices (0s makes every beacon a detection)":            "Délai de détection des appareils synthétiques (0s fait de chaque balise une détection)",
+		"Send the beacons through the configured broker, rather than directly":                      "Envoyer les balises via le broker configuré, plutôt que directement",
+		"How long to wait for the last beacons to be handled once they have all been sent":          "Temps d'attente du traitement des dernières balises une fois toutes envoyées",
+		"Report a button press in the simulated beacons":                                            "Signaler un appui sur le bouton dans les balises simulées",
+		"Show which events a hypothetical beacon would raise and why, without ringing the doorbell": "Afficher les événements qu'une balise hypothétique déclencherait et pourquoi, sans faire sonner la sonnette",
+		"If cat-doorbell is running, the beacon is evaluated against its current state (eg. when each\ntarget was last detected). Otherwise (or with --offline) it is evaluated against the configuration,\nas the first beacon received after starting. Nothing is notified, run or recorded either way.": "Si cat-doorbell est en cours d'exécution, la balise est évaluée selon son état actuel (par ex. quand chaque\ncible a été détectée pour la dernière fois). Sinon (ou avec --offline), elle est évaluée selon la configuration,\ncomme la première balise reçue après le démarrage. Dans tous les cas, rien n'est notifié, exécuté ni enregistré.",
+		"Signal strength of the beacon in dBm (0 if unknown)":                                      "Force du signal de la balise en dBm (0 si inconnue)",
+		"Advertised local name of the device":                                                      "Nom local annoncé par l'appareil",
+		"When the beacon is received, as an RFC 3339 timestamp or a time of day today (eg. 22:30)": "Quand la balise est reçue, sous forme d'horodatage RFC 3339 ou d'heure aujourd'hui (par ex. 22:30)",
+		"Report a button press in the beacon":                                                      "Signaler un appui sur le bouton dans la balise",
+		"Battery level reported by the beacon in percent":                                          "Niveau de batterie signalé par la balise, en pourcentage",
+		"Evaluate against the configuration, rather than the running instance":                     "Évaluer selon la configuration, plutôt que l'instance en cours d'exécution",
+		"Output the evaluation as JSON":                                                            "Afficher l'évaluation au format JSON",
+		"Show how often and when each target rang the doorbell":                                    "Afficher combien de fois et quand chaque appareil a sonné",
+		"Summarize visits after a duration ago (eg. 24h) or RFC 3339 timestamp":                    "Résumer les visites depuis une durée (par ex. 24h) ou un horodatage RFC 3339",
+		"Only summarize the target with the given name (can be repeated)":                          "Ne résumer que l'appareil portant ce nom (peut être répétée)",
+		"Output statistics as JSON":                                                                "Afficher les statistiques en JSON",
+		"Send a test notification and report the result for each notifier":                         "Envoyer une notification de test et afficher le résultat de chaque canal",
+		"If cat-doorbell is running, it rings the doorbell for a fake detection of a target,\nend-to-end. Otherwise (or with --all or --notifier) a test notification is sent directly.\nEither way the notification is delivered as if a device had been detected, so only\nnotifiers subscribed to detection events receive it (unless --all is given).": "Si cat-doorbell est lancé, il fait sonner la sonnette de bout en bout pour une fausse détection d'un appareil.\nSinon (ou avec --all ou --notifier), une notification de test est envoyée directement.\nDans les deux cas, la notification est envoyée comme si un appareil avait été détecté, donc seuls\nles canaux abonnés aux détections la reçoivent (sauf avec --all).",
+		"Only test the notifier with the given name (can be repeated)":                                "Ne tester que le canal portant ce nom (peut être répétée)",
+		"Send the test notification to every notifier, regardless of the events it is subscribed to":  "Envoyer la notification de test à chaque canal, quels que soient les événements auxquels il est abonné",
+		"Name of the target the running instance fakes a detection of (defaults to the first target)": "Nom de l'appareil dont l'instance en cours simule la détection (par défaut, le premier)",
+		"Output the results as JSON": "Afficher les résultats en JSON",
+		"Manage the local certificate authority the web dashboard's certificate is issued by": "Gérer l'autorité de certification locale qui émet le certificat du tableau de bord web",
+		"Print the certificate of the local certificate authority, creating it if necessary":  "Afficher le certificat de l'autorité de certification locale, en la créant si nécessaire",
+		"Write the certificate to the given path, rather than standard output":                "Écrire le certificat dans le chemin indiqué plutôt que sur la sortie standard",
+		"Trust the local certificate authority on this computer":                              "Faire confiance à l'autorité de certification locale sur cet ordinateur",
+		"Manage the tokens used to access the web dashboard and API":                          "Gérer les jetons d'accès au tableau de bord web et à l'API",
+		"Create a token, printing it to standard output":                                      "Créer un jeton et l'afficher sur la sortie standard",
+		"Only allow the token to view the dashboard and read the API":                         "N'autoriser le jeton qu'à consulter le tableau de bord et lire l'API",
+		"Revoke a token": "Révoquer un jeton",
+		"List the names and access of the configured tokens":                "Lister les noms et droits des jetons configurés",
+		"Show the version, and how the binary was built":                    "Afficher la version et la façon dont le programme a été compilé",
+		"Print which subsystems are built in and work on this host as JSON": "Afficher en JSON les sous-systèmes intégrés et fonctionnels sur cette machine",
+		"Output the build information as JSON":                              "Afficher les informations de compilation en JSON",
+	},
+	"es": {
+		"NAME:":                   "NOMBRE:",
+		"USAGE:":                  "USO:",
+		"VERSION:":                "VERSIÓN:",
+		"DESCRIPTION:":            "DESCRIPCIÓN:",
+		"CATEGORY:":               "CATEGORÍA:",
+		"COMMANDS:":               "COMANDOS:",
+		"GLOBAL OPTIONS:":         "OPCIONES GLOBALES:",
+		"OPTIONS:":                "OPCIONES:",
+		"COPYRIGHT:":              "DERECHOS DE AUTOR:",
+		"command":                 "comando",
+		"[global options]":        "[opciones globales]",
+		"[command options]":       "[opciones del comando]",
+		"[arguments...]":          "[argumentos...]",
+		"default":                 "predeterminado",
+		"accepts multiple inputs": "se puede repetir",
+		"show help":               "mostrar la ayuda",
+		"print the version":       "mostrar la versión",
+		"Shows a list of commands or help for one command": "Muestra la lista de comandos o la ayuda de un comando",
+		"Incorrect Usage:":                                             "Uso incorrecto:",
+		"Failed to run the application":                                "No se ha podido ejecutar el programa",
+		"flag provided but not defined":                                "opción desconocida",
+		"flag needs an argument":                                       "la opción necesita un valor",
+		"cat-doorbell isn't running":                                   "cat-doorbell no se está ejecutando",
+		"another instance is already running":                          "ya se está ejecutando otra instancia",
+		"developer mode isn't enabled (start cat-doorbell with --dev)": "el modo de desarrollador no está activado (inicie cat-doorbell con --dev)",
+		"failed to connect to control socket":                          "no se ha podido conectar al socket de control",
+		"target not found":                                             "dispositivo no encontrado",
+		"token not found":                                              "token no encontrado",
+		"secret not found in keyring":                                  "secreto no encontrado en el llavero",
+		"failed to load configuration":                                 "no se ha podido cargar la configuración",
+		"no configuration file found":                                  "no se ha encontrado ningún archivo de configuración",
+		"looked for":                                                   "se ha buscado",
+		"no such file or directory":                                    "no existe el archivo o el directorio",
+		"permission denied":                                            "permiso denegado",
+		"connection refused":                                           "conexión rechazada",
+		"Receive a notification when the cat wants to come inside":     "Recibe una notificación cuando el gato quiere entrar",
+		"Path to the configuration file":                               "Ruta del archivo de configuración",
+		"Path to the shared configuration file, which the configuration file overrides": "Ruta del archivo de configuración compartido, que el archivo de configuración sobrescribe",
+		"Directory to store log files":                                                                                           "Directorio de los archivos de registro",
+		"Set the log verbosity level":                                                                                            "Nivel de detalle de los registros",
+		"Format of log messages, \"text\" or \"json\"":                                                                           "Formato de los mensajes de registro, «text» o «json»",
+		"Size in MiB at which the log file is rotated (0 disables rotation)":                                                     "Tamaño en MiB a partir del cual se rota el registro (0 desactiva la rotación)",
+		"How long old log files are kept for (0 keeps them regardless of age)":                                                   "Cuánto tiempo se conservan los registros antiguos (0 los conserva sin importar su antigüedad)",
+		"Combined size in MiB of the log files, above which the oldest are removed (0 for no limit)":                             "Tamaño total en MiB de los registros, por encima del cual se eliminan los más antiguos (0 para no limitar)",
+		"Compress rotated log files":                                                                                             "Comprimir los registros rotados",
+		"Path to the detection history database":                                                                                 "Ruta de la base de datos del historial de detecciones",
+		"Path to the queue of notifications that couldn't be delivered yet":                                                      "Ruta de la cola de notificaciones que aún no se han podido entregar",
+		"Run without a system tray icon or desktop notifications (auto-detected if there is no display)":                         "Ejecutar sin icono en la bandeja del sistema ni notificaciones de escritorio (automático si no hay pantalla)",
+		"Override a configuration field, eg. --set broker.address=tcp://localhost:1883 (can be repeated)":                        "Sobrescribir un campo de la configuración, p. ej. --set broker.address=tcp://localhost:1883 (se puede repetir)",
+		"Scan for devices using the host's Bluetooth adapter":                                                                    "Buscar dispositivos con el adaptador Bluetooth de este equipo",
+		"Append every received beacon to a file, for replaying later with \"cat-doorbell replay\"":                               "Añadir cada baliza recibida a un archivo, para reproducirla después con «cat-doorbell replay»",
+		"Path to the socket the running instance is controlled through":                                                          "Ruta del socket con el que se controla la instancia en ejecución",
+		"Check connectivity, audio, notifiers and payload parsing, print a JSON report and exit":                                 "Comprobar la conexión, el audio, los canales de notificación y el análisis de datos, mostrar un informe JSON y salir",
+		"Language of the command line help and messages (eg. nl), rather than the system locale":                                 "Idioma de la ayuda y los mensajes de la línea de comandos (p. ej. nl), en lugar del idioma del sistema",
+		"Create and inspect the configuration file":                                                                              "Crear e inspeccionar el archivo de configuración",
+		"Write a starter configuration file":                                                                                     "Escribir un archivo de configuración inicial",
+		"Overwrite an existing configuration file":                                                                               "Sobrescribir un archivo de configuración existente",
+		"MAC address of the cat's tag":                                                                                           "Dirección MAC de la etiqueta del gato",
+		"Name of the cat":                                                                                                        "Nombre del gato",
+		"Validate the configuration file and report suspicious values":                                                           "Validar el archivo de configuración e informar de valores sospechosos",
+		"Treat warnings as errors":                                                                                               "Tratar las advertencias como errores",
+		"Rewrite the configuration file using the latest schema version (comments are not preserved)":                            "Reescribir el archivo de configuración con la última versión del esquema (los comentarios se pierden)",
+		"List the previous versions of the configuration file, kept whenever cat-doorbell rewrites it":                           "Listar las versiones anteriores del archivo de configuración, guardadas cada vez que cat-doorbell lo reescribe",
+		"Restore a previous version of the configuration file (by default, the most recent)":                                     "Restaurar una versión anterior del archivo de configuración (por defecto, la más reciente)",
+		"Manage the devices to listen for":                                                                                       "Gestionar los dispositivos a escuchar",
+		"Add a device":                                                                                                           "Añadir un dispositivo",
+		"Remove a device":                                                                                                        "Eliminar un dispositivo",
+		"List the configured devices":                                                                                            "Listar los dispositivos configurados",
+		"MAC address of the device":                                                                                              "Dirección MAC del dispositivo",
+		"Name of the device (eg. the cat's name)":                                                                                "Nombre del dispositivo (p. ej. el nombre del gato)",
+		"Notification message to display when the device is detected":                                                            "Mensaje de notificación que se muestra cuando se detecta el dispositivo",
+		"Path to an MP3, WAV, OGG or FLAC file to play when the device is detected":                                              "Ruta de un archivo MP3, WAV, OGG o FLAC que se reproduce cuando se detecta el dispositivo",
+		"Override the default detection timeout for this device":                                                                 "Sobrescribir el tiempo de espera de detección predeterminado para este dispositivo",
+		"Accent colour used to distinguish the device (eg. #ff8800)":                                                             "Color de acento para distinguir el dispositivo (p. ej. #ff8800)",
+		"Glob pattern matched against the device's advertised local name":                                                        "Patrón glob comparado con el nombre anunciado por el dispositivo",
+		"Service UUID advertised by the device":                                                                                  "UUID de servicio anunciado por el dispositivo",
+		"Show the history of detected devices":                                                                                   "Mostrar el historial de dispositivos detectados",
+		"Only show detections after a duration ago (eg. 24h) or RFC 3339 timestamp":                                              "Mostrar solo las detecciones desde hace una duración (p. ej. 24h) o una marca de tiempo RFC 3339",
+		"Only show detections of the device with the given MAC address":                                                          "Mostrar solo las detecciones del dispositivo con la dirección MAC indicada",
+		"Include detections that didn't ring the doorbell":                                                                       "Incluir las detecciones que no hicieron sonar el timbre",
+		"Maximum number of detections to show (0 for no limit)":                                                                  "Número máximo de detecciones a mostrar (0 para no limitar)",
+		"Output detections as JSON":                                                                                              "Mostrar las detecciones en JSON",
+		"Output detections as JSON, one per line":                                                                                "Mostrar las detecciones en JSON, una por línea",
+		"Start or stop maintenance mode in the running instance, eg. for a planned broker reboot":                                "Iniciar o detener el modo de mantenimiento de la instancia en ejecución, p. ej. para un reinicio previsto del broker",
+		"Start maintenance mode, for a duration (eg. 1h) or until stopped":                                                       "Iniciar el modo de mantenimiento, durante un tiempo (p. ej. 1h) o hasta que se detenga",
+		"Stop maintenance mode (scheduled maintenance windows still apply)":                                                      "Detener el modo de mantenimiento (las ventanas de mantenimiento programadas siguen aplicándose)",
+		"Start or stop expect mode in the running instance, which makes detection more sensitive while the cat is expected back": "Iniciar o detener el modo de espera en la instancia en ejecución, que hace la detección más sensible mientras se espera el regreso del gato",
+		"Start expect mode, for a duration (eg. 30m) or the configured duration":                                                 "Iniciar el modo de espera, durante un tiempo (p. ej. 30m) o el tiempo configurado",
+		"Stop expect mode": "Detener el modo de espera",
+		"Pause notifications of the running instance, for a duration (eg. 1h) or until resumed":                               "Pausar las notificaciones de la instancia en ejecución, durante un tiempo (p. ej. 1h) o hasta reanudarlas",
+		"Resume notifications of the running instance":                                                                        "Reanudar las notificaciones de la instancia en ejecución",
+		"Show the status of the running instance":                                                                             "Mostrar el estado de la instancia en ejecución",
+		"Output the status as JSON":                                                                                           "Mostrar el estado en JSON",
+		"Start or stop recording beacons in the running instance":                                                             "Iniciar o detener la grabación de balizas en la instancia en ejecución",
+		"Start recording beacons, and print the path of the recording":                                                        "Iniciar la grabación de balizas y mostrar la ruta de la grabación",
+		"Stop recording beacons":                                                                                              "Detener la grabación de balizas",
+		"Developer mode, which lets \"cat-doorbell dev\" inject faults into the broker connection":                            "Modo de desarrollador, que permite a «cat-doorbell dev» inyectar fallos en la conexión con el broker",
+		"Act on the named profile, rather than the doorbell of the configuration file":                                        "Actuar sobre el perfil indicado, en lugar del timbre del archivo de configuración",
+		"Inject faults into the running instance's broker connection (requires --dev)":                                        "Inyectar fallos en la conexión con el broker de la instancia en ejecución (requiere --dev)",
+		"Drop the connection to the broker, as if it was lost":                                                                "Cortar la conexión con el broker, como si se hubiera perdido",
+		"Drop the next COUNT messages received from the broker (0 stops dropping)":                                            "Descartar los próximos CANTIDAD mensajes recibidos del broker (0 deja de descartar)",
+		"Delay every message received from the broker (0s for no delay)":                                                      "Retrasar cada mensaje recibido del broker (0s para ningún retraso)",
+		"Feed a recorded beacon stream through the detector and show the detections, without notifying":                       "Pasar un flujo de balizas grabado por el detector y mostrar las detecciones, sin notificar",
+		"Playback speed relative to the recording (eg. 10x), or \"max\" to replay as fast as possible":                        "Velocidad de reproducción respecto a la grabación (p. ej. 10x), o «max» para reproducir lo más rápido posible",
+		"Gather recent logs, the configuration, version information and statistics into an archive to attach to a bug report": "Reunir los registros recientes, la configuración, la información de versión y las estadísticas en un archivo para adjuntar a un informe de error",
+		"Secrets (passwords, tokens, keys, usernames, and the paths and queries of URLs) are scrubbed from\nthe configuration, and from the logs wherever they appear. MAC addresses are hashed with a salt\nthat is thrown away, so the same device can still be recognized across the report.": "Los secretos (contraseñas, tokens, claves, nombres de usuario, y las rutas y consultas de las URL) se eliminan\nde la configuración, y de los registros dondequiera que aparezcan. Las direcciones MAC se cifran con una sal\nque se descarta, para que el mismo dispositivo siga siendo reconocible en todo el informe.",
+		"Path of the archive (defaults to cat-doorbell-report-<time>.zip in the current directory)":                        "Ruta del archivo (por defecto cat-doorbell-report-<hora>.zip en el directorio actual)",
+		"Include the log files written to after a duration ago (eg. 24h) or RFC 3339 timestamp":                            "Incluir los archivos de registro escritos después de una duración atrás (p. ej. 24h) o una marca de tiempo RFC 3339",
+		"Include MAC addresses as they are, rather than hashed":                                                            "Incluir las direcciones MAC tal cual, en lugar de con hash",
+		"Ring the doorbell and notify for the detections, as if the beacons were being received":                           "Hacer sonar el timbre y notificar las detecciones, como si se estuvieran recibiendo las balizas",
+		"How long to keep running after the last beacon, eg. for notifications to be delivered or departures to be raised": "Cuánto tiempo seguir ejecutándose tras la última baliza, p. ej. para entregar notificaciones o señalar salidas",
+		"Scan for BLE devices and publish their beacons to the MQTT broker":                                                "Buscar dispositivos BLE y publicar sus balizas en el broker MQTT",
+		"Address of the MQTT broker (eg. tcp://localhost:1883)":                                                            "Dirección del broker MQTT (p. ej. tcp://localhost:1883)",
+		"MQTT topic to publish beacons to (overrides the configuration file)":                                              "Tema MQTT en el que publicar las balizas (sobrescribe el archivo de configuración)",
+		"Manage credentials stored in the operating system's keyring":                                                      "Gestionar las credenciales guardadas en el llavero del sistema",
+		"Store a secret, read from the terminal or standard input":                                                         "Guardar un secreto, leído del terminal o de la entrada estándar",
+		"Delete a secret": "Eliminar un secreto",
+		"Start cat-doorbell automatically at login (using systemd, launchd or a Windows startup entry)": "Iniciar cat-doorbell automáticamente al iniciar sesión (con systemd, launchd o una entrada de inicio de Windows)",
+		"Register cat-doorbell to start at login":                                                       "Registrar cat-doorbell para que se inicie al iniciar sesión",
+		"Also start it now":                                      "Iniciarlo también ahora",
+		"Stop cat-doorbell starting at login":                    "Dejar de iniciar cat-doorbell al iniciar sesión",
+		"Start the installed service":                            "Iniciar el servicio instalado",
+		"Stop the installed service":                             "Detener el servicio instalado",
+		"Edit the broker, target and sound settings in a window": "Editar los ajustes del broker, los dispositivos y los sonidos en una ventana",
+		"Ring the doorbell for simulated beacons from a device, without a broker or Bluetooth adapter": "Hacer sonar el timbre con balizas simuladas de un dispositivo, sin broker ni adaptador Bluetooth",
+		"Beacons are fed through detection as if they had been received, so detection settings,\ncustom events, actions and notifiers can be checked before mounting any hardware.\nDetections are notified as usual, but aren't recorded in the history.": "Las balizas pasan por la detección como si se hubieran recibido, para comprobar los ajustes de detección,\nlos eventos personalizados, las acciones y los canales de notificación antes de instalar el hardware.\nLas detecciones se notifican como siempre, pero no se guardan en el historial.",
+		"MAC address of the simulated device":                                       "Dirección MAC del dispositivo simulado",
+		"Signal strength of the simulated beacons in dBm":                           "Intensidad de señal de las balizas simuladas en dBm",
+		"Number of beacons to send":                                                 "Número de balizas a enviar",
+		"Time between beacons":                                                      "Tiempo entre balizas",
+		"Measure the throughput and latency of beacon handling with synthetic load": "Medir el rendimiento y la latencia del procesamiento de balizas con carga sintética",
+		"Beacons from synthetic devices are fed through the beacon queue, detection and event handling,\neither directly or through the configured broker (with --broker), and the throughput, latency\npercentiles and dropped beacons are reported. The configured limits are used, notifications are\npaused and detections are recorded in a temporary history, so it can run alongside the doorbell.": "Las balizas de dispositivos sintéticos pasan por la cola de balizas, la detección y el procesamiento de eventos,\ndirectamente o a través del broker configurado (con --broker), y se muestran el rendimiento, los percentiles\nde latencia y las balizas descartadas. Se usan los límites configurados, las notificaciones se pausan\ny las detecciones se guardan en un historial temporal, para que pueda ejecutarse junto al timbre.",
+		"Number of synthetic devices, which take turns sending beacons":                             "Número de dispositivos sintéticos, que envían balizas por turnos",
+		"Beacons sent per second (eg. 200/s, or 600/m)":                                             "Balizas enviadas por segundo (p. ej. 200/s, o 600/m)",
+		"How long to send beacons for":                                                              "Durante cuánto tiempo se envían balizas",
+		"Detection timeout of the synthetic devices (0s makes every beacon a detection)":            "Tiempo de detección de los dispositivos sintéticos (0s convierte cada baliza en una detección)",
+		"Send the beacons through the configured broker, rather than directly":                      "Enviar las balizas a través del broker configurado, en lugar de directamente",
+		"How long to wait for the last beacons to be handled once they have all been sent":          "Cuánto esperar a que se procesen las últimas balizas una vez enviadas todas",
+		"Report a button press in the simulated beacons":                                            "Indicar una pulsación del botón en las balizas simuladas",
+		"Show which events a hypothetical beacon would raise and why, without ringing the doorbell": "Mostrar qué eventos generaría una baliza hipotética y por qué, sin hacer sonar el timbre",
+		"If cat-doorbell is running, the beacon is evaluated against its current state (eg. when each\ntarget was last detected). Otherwise (or with --offline) it is evaluated against the configuration,\nas the first beacon received after starting. Nothing is notified, run or recorded either way.": "Si cat-doorbell está en ejecución, la baliza se evalúa según su estado actual (p. ej. cuándo se detectó\npor última vez cada objetivo). Si no (o con --offline), se evalúa según la configuración,\ncomo la primera baliza recibida tras el inicio. En ningún caso se notifica, ejecuta ni registra nada.",
+		"Signal strength of the beacon in dBm (0 if unknown)":                                      "Intensidad de la señal de la baliza en dBm (0 si se desconoce)",
+		"Advertised local name of the device":                                                      "Nombre local anunciado por el dispositivo",
+		"When the beacon is received, as an RFC 3339 timestamp or a time of day today (eg. 22:30)": "Cuándo se recibe la baliza, como marca de tiempo RFC 3339 o una hora de hoy (p. ej. 22:30)",
+		"Report a button press in the beacon":                                                      "Indicar una pulsación del botón en la baliza",
+		"Battery level reported by the beacon in percent":                                          "Nivel de batería indicado por la baliza, en porcentaje",
+		"Evaluate against the configuration, rather than the running instance":                     "Evaluar según la configuración, en lugar de la instancia en ejecución",
+		"Output the evaluation as JSON":                                                            "Mostrar la evaluación como JSON",
+		"Show how often and when each target rang the doorbell":                                    "Mostrar cuántas veces y cuándo llamó cada dispositivo",
+		"Summarize visits after a duration ago (eg. 24h) or RFC 3339 timestamp":                    "Resumir las visitas desde hace una duración (p. ej. 24h) o una marca de tiempo RFC 3339",
+		"Only summarize the target with the given name (can be repeated)":                          "Resumir solo el dispositivo con el nombre indicado (se puede repetir)",
+		"Output statistics as JSON":                                                                "Mostrar las estadísticas en JSON",
+		"Send a test notification and report the result for each notifier":                         "Enviar una notificación de prueba e informar del resultado de cada canal",
+		"If cat-doorbell is running, it rings the doorbell for a fake detection of a target,\nend-to-end. Otherwise (or with --all or --notifier) a test notification is sent directly.\nEither way the notification is delivered as if a device had been detected, so only\nnotifiers subscribed to detection events receive it (unless --all is given).": "Si cat-doorbell se está ejecutando, hace sonar el timbre de principio a fin con una detección falsa de un dispositivo.\nSi no (o con --all o --notifier), se envía directamente una notificación de prueba.\nEn ambos casos la notificación se entrega como si se hubiera detectado un dispositivo, así que solo\nla reciben los canales suscritos a las detecciones (salvo con --all).",
+		"Only test the notifier with the given name (can be repeated)":                                "Probar solo el canal con el nombre indicado (se puede repetir)",
+		"Send the test notification to every notifier, regardless of the events it is subscribed to":  "Enviar la notificación de prueba a todos los canales, sin importar los eventos a los que estén suscritos",
+		"Name of the target the running instance fakes a detection of (defaults to the first target)": "Nombre del dispositivo cuya detección simula la instancia en ejecución (por defecto, el primero)",
+		"Output the results as JSON": "Mostrar los resultados en JSON",
+		"Manage the local certificate authority the web dashboard's certificate is issued by": "Gestionar la autoridad de certificación local que emite el certificado del panel web",
+		"Print the certificate of the local certificate authority, creating it if necessary":  "Mostrar el certificado de la autoridad de certificación local, creándola si es necesario",
+		"Write the certificate to the given path, rather than standard output":                "Escribir el certificado en la ruta indicada en lugar de la salida estándar",
+		"Trust the local certificate authority on this computer":                              "Confiar en la autoridad de certificación local en este equipo",
+		"Manage the tokens used to access the web dashboard and API":                          "Gestionar los tokens de acceso al panel web y a la API",
+		"Create a token, printing it to standard output":                                      "Crear un token y mostrarlo en la salida estándar",
+		"Only allow the token to view the dashboard and read the API":                         "Permitir al token solo ver el panel y leer la API",
+		"Revoke a token": "Revocar un token",
+		"List the names and access of the configured tokens":                "Listar los nombres y permisos de los tokens configurados",
+		"Show the version, and how the binary was built":                    "Mostrar la versión y cómo se compiló el programa",
+		"Print which subsystems are built in and work on this host as JSON": "Mostrar en JSON qué subsistemas están integrados y funcionan en este equipo",
+		"Output the build information as JSON":                              "Mostrar la información de compilación en JSON",
+	},
+}
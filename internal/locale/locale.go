@@ -0,0 +1,194 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package locale provides the bundled translations of the default
+// notification texts, and of the command line help and error messages.
+package locale
+
+import (
+	"slices"
+	"strings"
+)
+
+// Default is the locale used if none is configured.
+const Default = "en"
+
+// Messages are the default notification texts of a locale. Messages are Go
+// templates, executed with the name of the target (.Name), when the event
+// happened in local time (.Time) and so on.
+type Messages struct {
+	// Title is the title of doorbell notifications.
+	Title string
+	// AnomalyTitle is the title of notifications that ask for the cat to be
+	// checked on (eg. because it hasn't visited for a while).
+	AnomalyTitle string
+	// Detected is the message of "detected" events.
+	Detected string
+	// ButtonPressed is the message of "buttonPressed" events.
+	ButtonPressed string
+	// Arrived is the message of "arrived" events.
+	Arrived string
+	// Departed is the message of "departed" events.
+	Departed string
+	// Stationary is the message of "stationary" events.
+	Stationary string
+	// LowBattery is the message of "lowBattery" events, which also have the
+	// battery level in percent (.Battery).
+	LowBattery string
+	// Missing is the message of "missing" events, which also have the time
+	// the target last visited (.LastVisit).
+	Missing string
+	// UnusualVisit is the message of "unusualVisit" events.
+	UnusualVisit string
+	// Summary is the message of "summary" events, which also have the number
+	// of visits (.Visits), the busiest time of day (.BusiestFrom and
+	// .BusiestTo), the last visit (.LastVisit) and whether the summary is
+	// weekly (.Weekly).
+	Summary string
+	// GatewaySilent is the message of "gatewaySilent" events, which also
+	// have when a beacon was last received (.LastBeacon).
+	GatewaySilent string
+	// GatewayResumed is the message of "gatewayResumed" events.
+	GatewayResumed string
+	// DoorbellPressed is the message of "doorbellPressed" events, whose
+	// name is the name of the doorbell.
+	DoorbellPressed string
+	// Motion is the message of "motion" events.
+	Motion string
+}
+
+var bundled = map[string]Messages{
+	"en": {
+		Title:           "Doorbell",
+		AnomalyTitle:    "Check on the cat",
+		Detected:        "{{.Name}} came into range",
+		ButtonPressed:   "{{.Name}} pressed the button",
+		Arrived:         "{{.Name}} arrived",
+		Departed:        "{{.Name}} left",
+		Stationary:      "{{.Name}}'s tag hasn't moved for a while, has the collar come off?",
+		LowBattery:      "{{.Name}}'s tag battery is low ({{.Battery}}%)",
+		Missing:         `{{.Name}} hasn't visited since {{.LastVisit.Format "Mon 2 Jan 15:04"}}`,
+		UnusualVisit:    `{{.Name}} visited at an unusual time ({{.Time.Format "3:04PM"}})`,
+		Summary:         `{{.Name}} {{if not .Visits}}didn't ring{{else if eq .Visits 1}}rang once{{else}}rang {{.Visits}} times{{end}} {{if .Weekly}}this week{{else}}today{{end}}{{if eq .Visits 1}}, at {{.LastVisit.Format "3:04pm"}}{{else if .Visits}}, mostly between {{.BusiestFrom.Format "3pm"}}-{{.BusiestTo.Format "3pm"}}{{end}}`,
+		GatewaySilent:   `No beacons received since {{.LastBeacon.Format "15:04"}}, is the gateway working?`,
+		GatewayResumed:  "Beacons are being received again",
+		DoorbellPressed: "Someone is at the door ({{.Name}})",
+		Motion:          "Motion at the door",
+	},
+	"nl": {
+		Title:           "Deurbel",
+		AnomalyTitle:    "Kijk even naar de kat",
+		Detected:        "{{.Name}} staat voor de deur",
+		ButtonPressed:   "{{.Name}} heeft op de knop gedrukt",
+		Arrived:         "{{.Name}} is thuisgekomen",
+		Departed:        "{{.Name}} is vertrokken",
+		Stationary:      "De tag van {{.Name}} heeft al een tijd niet bewogen, is de halsband eraf gevallen?",
+		LowBattery:      "De batterij van de tag van {{.Name}} is bijna leeg ({{.Battery}}%)",
+		Missing:         `{{.Name}} is sinds {{.LastVisit.Format "02-01 15:04"}} niet meer langs geweest`,
+		UnusualVisit:    `{{.Name}} kwam op een ongebruikelijk tijdstip langs ({{.Time.Format "15:04"}})`,
+		Summary:         `{{.Name}} heeft {{if .Weekly}}deze week{{else}}vandaag{{end}} {{if not .Visits}}niet aangebeld{{else if eq .Visits 1}}één keer aangebeld, om {{.LastVisit.Format "15:04"}}{{else}}{{.Visits}} keer aangebeld, vooral tussen {{.BusiestFrom.Format "15"}} en {{.BusiestTo.Format "15"}} uur{{end}}`,
+		GatewaySilent:   `Sinds {{.LastBeacon.Format "15:04"}} geen beacons ontvangen, werkt de gateway nog?`,
+		GatewayResumed:  "Er worden weer beacons ontvangen",
+		DoorbellPressed: "Er staat iemand voor de deur ({{.Name}})",
+		Motion:          "Beweging bij de deur",
+	},
+	"de": {
+		Title:           "Türklingel",
+		AnomalyTitle:    "Schau nach der Katze",
+		Detected:        "{{.Name}} steht vor der Tür",
+		ButtonPressed:   "{{.Name}} hat den Knopf gedrückt",
+		Arrived:         "{{.Name}} ist angekommen",
+		Departed:        "{{.Name}} ist weggegangen",
+		Stationary:      "Der Anhänger von {{.Name}} hat sich länger nicht bewegt, ist das Halsband abgefallen?",
+		LowBattery:      "Die Batterie des Anhängers von {{.Name}} ist fast leer ({{.Battery}} %)",
+		Missing:         `{{.Name}} war seit {{.LastVisit.Format "02.01. 15:04"}} nicht mehr da`,
+		UnusualVisit:    `{{.Name}} kam zu einer ungewöhnlichen Zeit ({{.Time.Format "15:04"}})`,
+		Summary:         `{{.Name}} hat {{if .Weekly}}diese Woche{{else}}heute{{end}} {{if not .Visits}}nicht geklingelt{{else if eq .Visits 1}}einmal geklingelt, um {{.LastVisit.Format "15:04"}}{{else}}{{.Visits}}-mal geklingelt, meistens zwischen {{.BusiestFrom.Format "15"}} und {{.BusiestTo.Format "15"}} Uhr{{end}}`,
+		GatewaySilent:   `Seit {{.LastBeacon.Format "15:04"}} keine Beacons empfangen, funktioniert das Gateway noch?`,
+		GatewayResumed:  "Es werden wieder Beacons empfangen",
+		DoorbellPressed: "Jemand steht vor der Tür ({{.Name}})",
+		Motion:          "Bewegung an der Tür",
+	},
+	"fr": {
+		Title:           "Sonnette",
+		AnomalyTitle:    "Vérifiez que tout va bien",
+		Detected:        "{{.Name}} est devant la porte",
+		ButtonPressed:   "{{.Name}} a appuyé sur le bouton",
+		Arrived:         "{{.Name}} est de retour",
+		Departed:        "{{.Name}} a quitté la maison",
+		Stationary:      "Le collier de {{.Name}} n'a pas bougé depuis un moment, s'est-il détaché ?",
+		LowBattery:      "La pile du collier de {{.Name}} est faible ({{.Battery}} %)",
+		Missing:         `Aucune visite de {{.Name}} depuis le {{.LastVisit.Format "02/01 15:04"}}`,
+		UnusualVisit:    `Visite de {{.Name}} à une heure inhabituelle ({{.Time.Format "15:04"}})`,
+		Summary:         `{{.Name}} {{if not .Visits}}n'a pas sonné{{else if eq .Visits 1}}a sonné une fois{{else}}a sonné {{.Visits}} fois{{end}} {{if .Weekly}}cette semaine{{else}}aujourd'hui{{end}}{{if eq .Visits 1}}, à {{.LastVisit.Format "15:04"}}{{else if .Visits}}, surtout entre {{.BusiestFrom.Format "15"}} h et {{.BusiestTo.Format "15"}} h{{end}}`,
+		GatewaySilent:   `Aucune balise reçue depuis {{.LastBeacon.Format "15:04"}}, la passerelle fonctionne-t-elle ?`,
+		GatewayResumed:  "Les balises sont de nouveau reçues",
+		DoorbellPressed: "Quelqu'un est à la porte ({{.Name}})",
+		Motion:          "Mouvement devant la porte",
+	},
+	"es": {
+		Title:           "Timbre",
+		AnomalyTitle:    "Echa un vistazo al gato",
+		Detected:        "{{.Name}} está en la puerta",
+		ButtonPressed:   "{{.Name}} ha pulsado el botón",
+		Arrived:         "{{.Name}} ha llegado",
+		Departed:        "{{.Name}} se ha ido",
+		Stationary:      "La placa de {{.Name}} lleva un rato sin moverse, ¿se le ha caído el collar?",
+		LowBattery:      "La batería de la placa de {{.Name}} está baja ({{.Battery}} %)",
+		Missing:         `{{.Name}} no ha venido desde el {{.LastVisit.Format "02/01 15:04"}}`,
+		UnusualVisit:    `{{.Name}} ha venido a una hora inusual ({{.Time.Format "15:04"}})`,
+		Summary:         `{{.Name}} {{if not .Visits}}no ha llamado{{else if eq .Visits 1}}ha llamado una vez{{else}}ha llamado {{.Visits}} veces{{end}} {{if .Weekly}}esta semana{{else}}hoy{{end}}{{if eq .Visits 1}}, a las {{.LastVisit.Format "15:04"}}{{else if .Visits}}, sobre todo entre las {{.BusiestFrom.Format "15"}} y las {{.BusiestTo.Format "15"}} h{{end}}`,
+		GatewaySilent:   `No se reciben balizas desde las {{.LastBeacon.Format "15:04"}}, ¿funciona la pasarela?`,
+		GatewayResumed:  "Se vuelven a recibir balizas",
+		DoorbellPressed: "Hay alguien en la puerta ({{.Name}})",
+		Motion:          "Movimiento en la puerta",
+	},
+}
+
+// Lookup returns the messages of a locale (eg. "nl" or "nl-BE"). Regional
+// variants fall back to their language. It returns false if the locale isn't
+// bundled.
+func Lookup(locale string) (Messages, bool) {
+	for _, tag := range candidates(locale) {
+		if messages, ok := bundled[tag]; ok {
+			return messages, true
+		}
+	}
+
+	return Messages{}, false
+}
+
+// Supported returns the bundled locales, sorted.
+func Supported() []string {
+	locales := make([]string, 0, len(bundled))
+	for locale := range bundled {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+
+	return locales
+}
+
+// candidates returns the tags a locale is looked up by, the locale itself
+// followed by its language.
+func candidates(locale string) []string {
+	tag := strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+	lang, _, _ := strings.Cut(tag, "-")
+
+	return []string{tag, lang}
+}
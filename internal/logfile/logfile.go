@@ -0,0 +1,284 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package logfile writes log files, rotating and compressing them as they
+// grow, and removing old ones.
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures the rotation and cleanup of log files.
+type Options struct {
+	// MaxSize is the size (in bytes) at which the log file is rotated. Zero
+	// disables rotation.
+	MaxSize int64
+	// MaxAge is how long old log files are kept for. Zero keeps them
+	// regardless of their age.
+	MaxAge time.Duration
+	// MaxTotalSize is the combined size (in bytes) of the log files in the
+	// directory, above which the oldest are removed. Zero for no limit.
+	MaxTotalSize int64
+	// Compress gzips rotated log files.
+	Compress bool
+	// Pattern matches (see filepath.Match) the names of the log files in the
+	// directory that are removed once too old, including rotated and
+	// compressed ones. Other files (eg. the output of a service manager) are
+	// left alone. If empty, no log files are removed.
+	Pattern string
+}
+
+// Writer appends to a log file, rotating it once it grows larger than the
+// maximum size. Rotated files are named after the log file, with an
+// increasing number before the extension (eg. "app.1.log").
+type Writer struct {
+	dir  string
+	name string
+	opts Options
+	// maintenance is held while rotated files are compressed and old files
+	// are removed.
+	maintenance sync.Mutex
+
+	mu        sync.Mutex
+	f         *os.File
+	size      int64
+	rotations int
+}
+
+// Open opens (or creates) the log file with the given name in the directory,
+// and removes old log files.
+func Open(dir, name string, opts Options) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	w := &Writer{dir: dir, name: name, opts: opts}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	if err := w.cleanup(); err != nil {
+		_ = w.f.Close()
+		return nil, fmt.Errorf("failed to remove old logs: %w", err)
+	}
+
+	return w, nil
+}
+
+// Path returns the path of the log file being written.
+func (w *Writer) Path() string {
+	return filepath.Join(w.dir, w.name)
+}
+
+// Write appends to the log file, rotating it first if it would grow larger
+// than the maximum size.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.opts.MaxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.opts.MaxSize {
+		// Keep writing to the current file if it can't be rotated, rather
+		// than losing logs.
+		if err := w.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to rotate log file: %v\n", err)
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the log file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.f.Close()
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.Path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	w.f = f
+	w.size = fi.Size()
+
+	return nil
+}
+
+// rotate renames the log file and starts a new one. The rotated file is
+// compressed, and old log files removed, in the background. It must be
+// called with the writer locked.
+func (w *Writer) rotate() error {
+	// Windows can't rename open files.
+	if err := w.f.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+
+	ext := filepath.Ext(w.name)
+	rotated := filepath.Join(w.dir, fmt.Sprintf("%s.%d%s", strings.TrimSuffix(w.name, ext), w.rotations+1, ext))
+	renameErr := os.Rename(w.Path(), rotated)
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if renameErr != nil {
+		return fmt.Errorf("failed to rename log file: %w", renameErr)
+	}
+
+	w.rotations++
+
+	go func() {
+		if w.opts.Compress {
+			if err := w.compress(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to compress rotated log file: %v\n", err)
+			}
+		}
+
+		if err := w.cleanup(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove old logs: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// compress gzips the file at the given path, replacing it with a ".gz" file.
+func (w *Writer) compress(path string) error {
+	w.maintenance.Lock()
+	defer w.maintenance.Unlock()
+
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer src.Close()
+
+	// Compress to a temporary file, so an interrupted compression doesn't
+	// leave a truncated log behind.
+	dst, err := os.CreateTemp(w.dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(dst.Name())
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("failed to compress log file: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		_ = dst.Close()
+		return fmt.Errorf("failed to compress log file: %w", err)
+	}
+
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Rename(dst.Name(), path+".gz"); err != nil {
+		return fmt.Errorf("failed to replace log file: %w", err)
+	}
+
+	return os.Remove(path)
+}
+
+// cleanup removes log files that are older than the maximum age, and the
+// oldest log files while their combined size is above the maximum. The log
+// file being written is never removed.
+func (w *Writer) cleanup() error {
+	w.maintenance.Lock()
+	defer w.maintenance.Unlock()
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read logs directory: %w", err)
+	}
+
+	type logFile struct {
+		name    string
+		modTime time.Time
+		size    int64
+	}
+
+	var files []logFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+
+		if matched, _ := filepath.Match(w.opts.Pattern, name); !matched {
+			continue
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			// It was removed in the meantime.
+			continue
+		}
+
+		files = append(files, logFile{name: name, modTime: fi.ModTime(), size: fi.Size()})
+	}
+
+	// Newest first, so the oldest are removed once the total is exceeded.
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.After(files[j].modTime)
+	})
+
+	now := time.Now()
+	var total int64
+	for _, f := range files {
+		total += f.size
+		if f.name == w.name {
+			continue
+		}
+
+		expired := w.opts.MaxAge > 0 && now.Sub(f.modTime) > w.opts.MaxAge
+		if expired || (w.opts.MaxTotalSize > 0 && total > w.opts.MaxTotalSize) {
+			if err := os.Remove(filepath.Join(w.dir, f.name)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove old log file: %w", err)
+			}
+
+			total -= f.size
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package metrics exposes Prometheus metrics.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "cat_doorbell"
+	// shutdownTimeout is how long to wait for in-flight scrapes when the
+	// server is stopped.
+	shutdownTimeout = 5 * time.Second
+)
+
+// Metrics records the doorbell's activity.
+type Metrics struct {
+	registry *prometheus.Registry
+	// registerer registers metrics with the registry, labelled with the
+	// instance name.
+	registerer          prometheus.Registerer
+	beacons             prometheus.Counter
+	detections          *prometheus.CounterVec
+	notificationsSent   *prometheus.CounterVec
+	notificationsFailed *prometheus.CounterVec
+	mqttReconnects      prometheus.Counter
+	brokerConnected     *prometheus.GaugeVec
+	beaconsDropped      prometheus.Counter
+	soundLatency        prometheus.Histogram
+}
+
+// New creates a new set of metrics, labelled with the name of the doorbell
+// instance. The label isn't called "instance", as Prometheus sets that to the
+// scraped address.
+func New(instance string) *Metrics {
+	registry := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry:   registry,
+		registerer: prometheus.WrapRegistererWith(prometheus.Labels{"instance_name": instance}, registry),
+		beacons: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "beacons_received_total",
+			Help:      "Number of beacons received from any device.",
+		}),
+		detections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "detections_total",
+			Help:      "Number of detections that raised a notification, by target and event type.",
+		}, []string{"target", "event"}),
+		notificationsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "notifications_sent_total",
+			Help:      "Number of notifications delivered, by notifier.",
+		}, []string{"notifier"}),
+		notificationsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "notifications_failed_total",
+			Help:      "Number of notifications that failed to be delivered, by notifier.",
+		}, []string{"notifier"}),
+		mqttReconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "mqtt_reconnects_total",
+			Help:      "Number of times the connection to the MQTT broker was re-established.",
+		}),
+		brokerConnected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "mqtt_broker_connected",
+			Help:      "Whether the connection to each MQTT broker is up (1) or not (0), if fallback brokers are configured.",
+		}, []string{"address"}),
+		beaconsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "beacons_dropped_total",
+			Help:      "Number of beacons dropped because they couldn't be handled fast enough.",
+		}),
+		soundLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "sound_latency_seconds",
+			Help:      "Time from receiving a beacon to the doorbell sound being heard, at most.",
+			Buckets:   []float64{.025, .05, .1, .15, .2, .3, .5, 1, 2},
+		}),
+	}
+
+	m.registerer.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.beacons,
+		m.detections,
+		m.notificationsSent,
+		m.notificationsFailed,
+		m.mqttReconnects,
+		m.brokerConnected,
+		m.beaconsDropped,
+		m.soundLatency,
+	)
+
+	return m
+}
+
+// BeaconReceived records that a beacon was received.
+func (m *Metrics) BeaconReceived() {
+	m.beacons.Inc()
+}
+
+// SoundPlayed records how long it took for the doorbell sound to be heard
+// after the beacon was received.
+func (m *Metrics) SoundPlayed(latency time.Duration) {
+	m.soundLatency.Observe(latency.Seconds())
+}
+
+// BeaconDropped records that a beacon was dropped because the beacon queue
+// was full.
+func (m *Metrics) BeaconDropped() {
+	m.beaconsDropped.Inc()
+}
+
+// RegisterQueues exports the number of beacons and events waiting to be
+// handled, as reported by the given functions.
+func (m *Metrics) RegisterQueues(beacons, events func() int) {
+	m.registerer.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "beacon_queue_length",
+			Help:      "Number of received beacons waiting to be handled.",
+		}, func() float64 {
+			return float64(beacons())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "event_queue_length",
+			Help:      "Number of detected events waiting to be handled.",
+		}, func() float64 {
+			return float64(events())
+		}),
+	)
+}
+
+// RegisterMaintenance exports whether maintenance mode is active, as reported
+// by the given function, so alerts on the broker connection can be silenced.
+func (m *Metrics) RegisterMaintenance(active func() bool) {
+	m.registerer.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "maintenance",
+		Help:      "Whether maintenance mode is active (1) or not (0).",
+	}, func() float64 {
+		if active() {
+			return 1
+		}
+
+		return 0
+	}))
+}
+
+// Device is the state of a target device, as exported.
+type Device struct {
+	// Name is the name of the target.
+	Name string
+	// LastSeen is when a beacon was last received from the device, or zero
+	// if it hasn't been seen.
+	LastSeen time.Time
+	// RSSI is the smoothed signal strength of the device's last beacon in
+	// dBm (zero if unknown).
+	RSSI int
+	// Present is whether the device is nearby, or nil if presence tracking
+	// is disabled for it.
+	Present *bool
+	// Battery is the battery level last reported by the device, or nil if it
+	// hasn't reported one.
+	Battery *int
+	// CooldownUntil is when the device can ring the doorbell again, or zero
+	// if it can ring it now.
+	CooldownUntil time.Time
+	// Visiting is true if the device rang the doorbell for the
+	// unacknowledged visit.
+	Visiting bool
+}
+
+// RegisterDevices exports the state of each target device, as reported by
+// the given function when the metrics are scraped.
+func (m *Metrics) RegisterDevices(devices func() []Device) {
+	m.registerer.MustRegister(&deviceCollector{devices: devices})
+}
+
+var (
+	lastSeenDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "target_last_seen_timestamp_seconds"),
+		"Unix time a beacon was last received from each target.", []string{"target"}, nil)
+	rssiDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "target_rssi_dbm"),
+		"Smoothed signal strength of the last beacon received from each target.", []string{"target"}, nil)
+	presentDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "target_present"),
+		"Whether each target with presence tracking is nearby (1) or away (0).", []string{"target"}, nil)
+	batteryDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "target_battery_percent"),
+		"Battery level last reported by each target.", []string{"target"}, nil)
+	cooldownDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "target_cooldown_seconds"),
+		"Time until each target can ring the doorbell again.", []string{"target"}, nil)
+	visitingDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "target_visiting"),
+		"Whether each target rang the doorbell for the unacknowledged visit (1) or not (0).", []string{"target"}, nil)
+)
+
+// deviceCollector collects the state of each target device from a single
+// snapshot, so the metrics of a scrape are consistent with each other.
+type deviceCollector struct {
+	devices func() []Device
+}
+
+func (c *deviceCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{lastSeenDesc, rssiDesc, presentDesc, batteryDesc, cooldownDesc, visitingDesc} {
+		ch <- desc
+	}
+}
+
+func (c *deviceCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+
+	for _, dev := range c.devices() {
+		gauge := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, dev.Name)
+		}
+
+		if !dev.LastSeen.IsZero() {
+			gauge(lastSeenDesc, float64(dev.LastSeen.UnixNano())/1e9)
+		}
+
+		if dev.RSSI != 0 {
+			gauge(rssiDesc, float64(dev.RSSI))
+		}
+
+		if dev.Present != nil {
+			gauge(presentDesc, boolValue(*dev.Present))
+		}
+
+		if dev.Battery != nil {
+			gauge(batteryDesc, float64(*dev.Battery))
+		}
+
+		gauge(cooldownDesc, max(dev.CooldownUntil.Sub(now), 0).Seconds())
+		gauge(visitingDesc, boolValue(dev.Visiting))
+	}
+}
+
+// boolValue returns 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+// Detected records a detection that raised a notification.
+func (m *Metrics) Detected(target, event string) {
+	m.detections.WithLabelValues(target, event).Inc()
+}
+
+// NotificationDelivered records the outcome of delivering a notification.
+func (m *Metrics) NotificationDelivered(notifier string, err error) {
+	if err != nil {
+		m.notificationsFailed.WithLabelValues(notifier).Inc()
+		return
+	}
+
+	m.notificationsSent.WithLabelValues(notifier).Inc()
+}
+
+// MQTTReconnected records that the connection to the MQTT broker was
+// re-established.
+func (m *Metrics) MQTTReconnected() {
+	m.mqttReconnects.Inc()
+}
+
+// BrokerConnected records whether the connection to one of several MQTT
+// brokers is up.
+func (m *Metrics) BrokerConnected(address string, connected bool) {
+	var value float64
+	if connected {
+		value = 1
+	}
+
+	m.brokerConnected.WithLabelValues(address).Set(value)
+}
+
+// Serve serves the metrics on the given address until the context is
+// cancelled.
+func (m *Metrics) Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Failed to shut down metrics server", slog.Any("error", err))
+		}
+	}()
+
+	slog.Info("Serving metrics", slog.String("address", addr))
+
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve metrics: %w", err)
+	}
+
+	return ctx.Err()
+}
@@ -0,0 +1,86 @@
+//go:build !nogui
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/gen2brain/beeep"
+)
+
+func init() {
+	newDesktop = func(iconPath string) Notifier {
+		return NewDesktop(iconPath)
+	}
+}
+
+// snapshotRetention is how long camera snapshots are kept on disk for the
+// notification daemon to load.
+const snapshotRetention = time.Minute
+
+// Desktop raises local desktop notifications.
+type Desktop struct {
+	iconPath string
+}
+
+// NewDesktop creates a new desktop notifier using the icon at the given path.
+func NewDesktop(iconPath string) *Desktop {
+	return &Desktop{iconPath: iconPath}
+}
+
+func (d *Desktop) Notify(_ context.Context, n *Notification) error {
+	iconPath := d.iconPath
+	if n.Snapshot != nil {
+		path, err := writeSnapshot(n)
+		if err != nil {
+			slog.Warn("Failed to save camera snapshot, using the default icon", slog.Any("error", err))
+		} else {
+			time.AfterFunc(snapshotRetention, func() {
+				_ = os.Remove(path)
+			})
+
+			iconPath = path
+		}
+	}
+
+	return beeep.Notify(n.Title, n.Message, iconPath)
+}
+
+// writeSnapshot writes the camera snapshot of the notification to a
+// temporary file, and returns its path.
+func writeSnapshot(n *Notification) (string, error) {
+	f, err := os.CreateTemp("", "cat-doorbell-snapshot-*"+n.Snapshot.Extension())
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(n.Snapshot.Data); err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write snapshot file: %w", err)
+	}
+
+	return f.Name(), nil
+}
@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/camera"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/webpush"
+)
+
+// Priority is the importance of a notification.
+type Priority int
+
+const (
+	// PriorityNormal is the priority of most notifications.
+	PriorityNormal Priority = 0
+	// PriorityLow is for notifications that can wait (eg. "check on the
+	// cat"). Notifiers that support it deliver them quietly.
+	PriorityLow Priority = -1
+)
+
+// ScreenLock is whether the screen is locked.
+type ScreenLock string
+
+const (
+	// ScreenLockUnknown is when the lock state couldn't be determined.
+	ScreenLockUnknown ScreenLock = ""
+	// ScreenLocked is when the screen is locked.
+	ScreenLocked ScreenLock = "locked"
+	// ScreenUnlocked is when the screen is unlocked.
+	ScreenUnlocked ScreenLock = "unlocked"
+)
+
+// Notification is an alert raised when a target device is detected.
+type Notification struct {
+	// Event is the type of event that raised the notification.
+	Event latestconfig.EventType `json:"event"`
+	// Title is the title of the notification.
+	Title string `json:"title"`
+	// Message is the body of the notification.
+	Message string `json:"message"`
+	// Name is the name of the detected device.
+	Name string `json:"name"`
+	// Color is the accent colour of the detected device (eg. "#ff8800").
+	Color string `json:"color,omitempty"`
+	// MAC is the MAC address of the detected device.
+	MAC string `json:"mac"`
+	// RSSI is the signal strength of the detected device in dBm (zero if unknown).
+	RSSI int `json:"rssi,omitempty"`
+	// Time is when the device was detected.
+	Time time.Time `json:"time"`
+	// Priority is the importance of the notification.
+	Priority Priority `json:"priority,omitempty"`
+	// Instance is the name of the doorbell that raised the notification.
+	Instance string `json:"instance,omitempty"`
+	// Snapshot is a still image from the doorstep camera, if one was taken.
+	Snapshot *camera.Snapshot `json:"snapshot,omitempty"`
+	// Screen is whether the screen was locked when the notification was
+	// raised, which decides the notifiers it is delivered to.
+	Screen ScreenLock `json:"-"`
+}
+
+// Notifier delivers notifications to a single channel.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// Result is the outcome of delivering a notification to a single notifier.
+type Result struct {
+	// Notifier is the name of the notifier.
+	Notifier string
+	// Latency is how long delivery took.
+	Latency time.Duration
+	// Err is the error returned by the notifier, if delivery failed.
+	Err error
+	// Queued is true if the notification was queued, to be delivered once
+	// the notifier's service is reachable again.
+	Queued bool
+}
+
+// Dispatcher delivers notifications to all configured notifiers.
+type Dispatcher struct {
+	notifiers []dispatchedNotifier
+	// queue stores notifications that couldn't be delivered, or is nil if
+	// they are dropped.
+	queue *Queue
+}
+
+type dispatchedNotifier struct {
+	Notifier
+	name   string
+	events []latestconfig.EventType
+	// screen is the lock state the notifier is triggered in, or unknown if
+	// it is triggered in either.
+	screen ScreenLock
+	// queued is true if undeliverable notifications are queued, rather than
+	// dropped.
+	queued bool
+	// title and message override the notification's text, if specified.
+	title   *template.Template
+	message *template.Template
+	// skipIf is when the notifier is skipped because other notifiers
+	// delivered the notification, or nil if it never is.
+	skipIf *skipRule
+}
+
+// skipRule skips a notifier if any of the notifiers it names delivered the
+// notification.
+type skipRule struct {
+	delivered []string
+	// screen is the lock state the notifier is skipped in, or unknown if it
+	// is skipped in either.
+	screen ScreenLock
+}
+
+// NewDispatcher creates a dispatcher for the given notifier configurations.
+// The icon path is used for desktop notifications, and web push
+// notifications are sent to the subscriptions of the push service (if any).
+// If a queue is given, notifications that phone notifiers (Telegram, Pushover
+// and ntfy) couldn't deliver because their service was unreachable are queued
+// on it.
+func NewDispatcher(confs []latestconfig.NotifierConfig, iconPath string, push *webpush.Service, queue *Queue) (*Dispatcher, error) {
+	d := Dispatcher{queue: queue}
+	for _, conf := range confs {
+		n, err := newNotifier(conf, iconPath, push)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notifier %q: %w", conf.Name, err)
+		}
+
+		title, err := parseTemplate("title", conf.Title)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notifier %q: %w", conf.Name, err)
+		}
+
+		message, err := parseTemplate("message", conf.Message)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notifier %q: %w", conf.Name, err)
+		}
+
+		var skipIf *skipRule
+		if conf.SkipIf != nil {
+			skipIf = &skipRule{delivered: conf.SkipIf.Delivered, screen: ScreenLock(conf.SkipIf.Screen)}
+		}
+
+		d.notifiers = append(d.notifiers, dispatchedNotifier{
+			Notifier: n,
+			name:     conf.Name,
+			events:   conf.Events,
+			screen:   ScreenLock(conf.Screen),
+			queued:   queue != nil && (conf.Telegram != nil || conf.Pushover != nil || conf.Ntfy != nil),
+			title:    title,
+			message:  message,
+			skipIf:   skipIf,
+		})
+	}
+
+	return &d, nil
+}
+
+// Notify delivers the notification to every notifier subscribed to its event
+// type (and screen lock state) concurrently, logging any failures. Notifiers
+// with skip rules wait for the notifiers they refer to, and are skipped if
+// any of those delivered it. It returns once all notifiers have completed.
+func (d *Dispatcher) Notify(ctx context.Context, n *Notification) []Result {
+	return d.deliver(ctx, n, true, func(notifier dispatchedNotifier) bool {
+		return notifier.subscribed(n)
+	})
+}
+
+// Subscribed returns the names of the notifiers Notify would deliver the
+// notification to, in the order they were configured, without delivering
+// it. Notifiers with skip rules are included, as whether they are skipped
+// depends on the delivery.
+func (d *Dispatcher) Subscribed(n *Notification) []string {
+	var names []string
+	for _, notifier := range d.notifiers {
+		if notifier.subscribed(n) {
+			names = append(names, notifier.name)
+		}
+	}
+
+	return names
+}
+
+// subscribed returns whether the notifier is subscribed to the
+// notification's event type (and screen lock state).
+func (notifier dispatchedNotifier) subscribed(n *Notification) bool {
+	if notifier.screen != ScreenLockUnknown && n.Screen != ScreenLockUnknown && notifier.screen != n.Screen {
+		return false
+	}
+
+	return len(notifier.events) == 0 || slices.Contains(notifier.events, n.Event)
+}
+
+// ScreenAware returns whether any notifier is only triggered while the screen
+// is locked or unlocked, so notifications need the lock state.
+func (d *Dispatcher) ScreenAware() bool {
+	return slices.ContainsFunc(d.notifiers, func(notifier dispatchedNotifier) bool {
+		return notifier.screen != ScreenLockUnknown || (notifier.skipIf != nil && notifier.skipIf.screen != ScreenLockUnknown)
+	})
+}
+
+// Broadcast delivers the notification to every notifier concurrently,
+// regardless of the events they are subscribed to and their skip rules.
+func (d *Dispatcher) Broadcast(ctx context.Context, n *Notification) []Result {
+	return d.deliver(ctx, n, false, func(dispatchedNotifier) bool { return true })
+}
+
+// deliver sends the notification to the selected notifiers and returns the
+// results in the order the notifiers were configured. Skipped notifiers
+// have no result.
+func (d *Dispatcher) deliver(ctx context.Context, n *Notification, skip bool, selected func(dispatchedNotifier) bool) []Result {
+	results := make([]*Result, len(d.notifiers))
+
+	// done[i] is closed once the i-th notifier has completed (or wasn't
+	// selected), and its result can be read.
+	done := make([]chan struct{}, len(d.notifiers))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	var wg sync.WaitGroup
+	for i, notifier := range d.notifiers {
+		if !selected(notifier) {
+			close(done[i])
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(done[i])
+
+			if skip && notifier.skipIf != nil {
+				if by, ok := d.deliveredBy(notifier.skipIf, n, results, done); ok {
+					slog.Info("Skipping notifier, the notification was already delivered",
+						slog.String("notifier", notifier.name), slog.String("deliveredBy", by))
+					return
+				}
+			}
+
+			start := time.Now()
+			queued, err := d.deliverTo(ctx, notifier, n)
+			if err != nil {
+				slog.Warn("Failed to send notification",
+					slog.String("notifier", notifier.name), slog.Bool("queued", queued), slog.Any("error", err))
+			}
+
+			results[i] = &Result{
+				Notifier: notifier.name,
+				Latency:  time.Since(start),
+				Err:      err,
+				Queued:   queued,
+			}
+		}()
+	}
+	wg.Wait()
+
+	var delivered []Result
+	for _, r := range results {
+		if r != nil {
+			delivered = append(delivered, *r)
+		}
+	}
+
+	return delivered
+}
+
+// deliveredBy waits for the notifiers a skip rule refers to, and returns the
+// name of the one that delivered the notification, if the rule applies.
+func (d *Dispatcher) deliveredBy(rule *skipRule, n *Notification, results []*Result, done []chan struct{}) (string, bool) {
+	if rule.screen != ScreenLockUnknown && rule.screen != n.Screen {
+		return "", false
+	}
+
+	for i, other := range d.notifiers {
+		if !slices.Contains(rule.delivered, other.name) {
+			continue
+		}
+
+		<-done[i]
+		if r := results[i]; r != nil && r.Err == nil && !r.Queued {
+			return other.name, true
+		}
+	}
+
+	return "", false
+}
+
+// deliverTo sends the notification to a single notifier. If the notifier's
+// service is unreachable, the notification is queued (if the notifier
+// supports it). Notifications are queued behind any earlier ones, and
+// delivered together with them.
+func (d *Dispatcher) deliverTo(ctx context.Context, notifier dispatchedNotifier, n *Notification) (bool, error) {
+	if !notifier.queued {
+		return false, notifier.Notify(ctx, notifier.render(n))
+	}
+
+	if len(d.queue.queued(notifier.name)) == 0 {
+		err := notifier.Notify(ctx, notifier.render(n))
+		if err == nil || !unreachable(err) {
+			return false, err
+		}
+
+		if queueErr := d.queue.add(notifier.name, n); queueErr != nil {
+			slog.Warn("Failed to queue notification", slog.String("notifier", notifier.name), slog.Any("error", queueErr))
+			return false, err
+		}
+
+		return true, err
+	}
+
+	if err := d.queue.add(notifier.name, n); err != nil {
+		return false, fmt.Errorf("failed to queue notification: %w", err)
+	}
+
+	return d.flush(ctx, notifier)
+}
+
+// newDesktop creates a desktop notifier, or is nil if desktop notifications
+// were left out of the build (with the "nogui" tag).
+var newDesktop func(iconPath string) Notifier
+
+func newNotifier(conf latestconfig.NotifierConfig, iconPath string, push *webpush.Service) (Notifier, error) {
+	switch {
+	case conf.Desktop != nil:
+		if newDesktop == nil {
+			return nil, errors.New("desktop notifications are not supported by this build")
+		}
+
+		return newDesktop(iconPath), nil
+	case conf.Telegram != nil:
+		return NewTelegram(conf.Telegram), nil
+	case conf.Pushover != nil:
+		return NewPushover(conf.Pushover), nil
+	case conf.Ntfy != nil:
+		return NewNtfy(conf.Ntfy), nil
+	case conf.Webhook != nil:
+		return NewWebhook(conf.Webhook)
+	case conf.WebPush != nil:
+		return NewWebPush(conf.WebPush, push), nil
+	default:
+		return nil, errors.New("no notifier type specified")
+	}
+}
+
+var httpClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// statusError is returned when a service responds with an unsuccessful
+// status code.
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.code)
+}
+
+// checkResponse returns an error if the HTTP response indicates failure.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &statusError{code: resp.StatusCode}
+	}
+
+	return nil
+}
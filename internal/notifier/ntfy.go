@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+const defaultNtfyServer = "https://ntfy.sh"
+
+// Ntfy sends notifications to an ntfy topic.
+type Ntfy struct {
+	conf *latestconfig.NtfyConfig
+}
+
+// NewNtfy creates a new ntfy notifier.
+func NewNtfy(conf *latestconfig.NtfyConfig) *Ntfy {
+	return &Ntfy{conf: conf}
+}
+
+func (nt *Ntfy) Notify(ctx context.Context, n *Notification) error {
+	server := nt.conf.Server
+	if server == "" {
+		server = defaultNtfyServer
+	}
+
+	url := strings.TrimSuffix(server, "/") + "/" + nt.conf.Topic
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(n.Message))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Title", n.Title)
+	req.Header.Set("Tags", "cat")
+	if nt.conf.Markdown {
+		req.Header.Set("Markdown", "yes")
+	}
+	priority := nt.conf.Priority
+	if n.Priority == PriorityLow {
+		// Low priority notifications are sent with at most ntfy's "low"
+		// priority (2).
+		if priority == 0 || priority > 2 {
+			priority = 2
+		}
+	}
+	if priority != 0 {
+		req.Header.Set("Priority", strconv.Itoa(priority))
+	}
+	if nt.conf.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+nt.conf.Token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
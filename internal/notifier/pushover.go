@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+const pushoverURL = "https://api.pushover.net/1/messages.json"
+
+// Pushover sends notifications using the Pushover API.
+type Pushover struct {
+	conf *latestconfig.PushoverConfig
+}
+
+// NewPushover creates a new Pushover notifier.
+func NewPushover(conf *latestconfig.PushoverConfig) *Pushover {
+	return &Pushover{conf: conf}
+}
+
+func (p *Pushover) Notify(ctx context.Context, n *Notification) error {
+	form := url.Values{
+		"token":     {p.conf.Token},
+		"user":      {p.conf.UserKey},
+		"title":     {n.Title},
+		"message":   {n.Message},
+		"timestamp": {strconv.FormatInt(n.Time.Unix(), 10)},
+	}
+	priority := p.conf.Priority
+	if n.Priority == PriorityLow {
+		// Low priority notifications are delivered without a sound or
+		// vibration.
+		priority = min(priority, -1)
+	}
+	if priority != 0 {
+		form.Set("priority", strconv.Itoa(priority))
+	}
+	if p.conf.Sound != "" {
+		form.Set("sound", p.conf.Sound)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, pushoverURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
@@ -0,0 +1,259 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Queue durably stores the notifications that notifiers couldn't deliver
+// because their service was unreachable, until they can be delivered.
+type Queue struct {
+	path string
+	// flushing is held while queued notifications are being delivered, so
+	// they are only delivered once.
+	flushing sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string][]*Notification
+}
+
+// OpenQueue opens (or creates) the queue stored at the given path.
+func OpenQueue(path string) (*Queue, error) {
+	q := &Queue{
+		path:    path,
+		pending: make(map[string][]*Notification),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read notification queue: %w", err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &q.pending); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal notification queue: %w", err)
+		}
+	}
+
+	return q, nil
+}
+
+// add appends a notification to the named notifier's queue.
+func (q *Queue) add(notifier string, n *Notification) error {
+	// Snapshots are too large to keep around.
+	queued := *n
+	queued.Snapshot = nil
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending[notifier] = append(q.pending[notifier], &queued)
+
+	return q.save()
+}
+
+// queued returns the notifications queued for the named notifier, oldest
+// first.
+func (q *Queue) queued(notifier string) []*Notification {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.pending[notifier]
+}
+
+// remove removes the oldest count notifications from the named notifier's
+// queue.
+func (q *Queue) remove(notifier string, count int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if remaining := q.pending[notifier][count:]; len(remaining) > 0 {
+		q.pending[notifier] = remaining
+	} else {
+		delete(q.pending, notifier)
+	}
+
+	return q.save()
+}
+
+// expire removes notifications queued before the given time.
+func (q *Queue) expire(before time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var expired int
+	for notifier, pending := range q.pending {
+		for len(pending) > 0 && pending[0].Time.Before(before) {
+			pending = pending[1:]
+			expired++
+		}
+
+		if len(pending) > 0 {
+			q.pending[notifier] = pending
+		} else {
+			delete(q.pending, notifier)
+		}
+	}
+
+	if expired == 0 {
+		return nil
+	}
+
+	slog.Warn("Dropped undelivered notifications", slog.Int("count", expired))
+
+	return q.save()
+}
+
+// save atomically writes the queue to disk. It must be called with the
+// queue locked.
+func (q *Queue) save() error {
+	data, err := json.Marshal(q.pending)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification queue: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create notification queue directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(q.path), "."+filepath.Base(q.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), q.path); err != nil {
+		return fmt.Errorf("failed to replace notification queue: %w", err)
+	}
+
+	return nil
+}
+
+// Flush retries delivery of the queued notifications, dropping those queued
+// for longer than maxAge.
+func (d *Dispatcher) Flush(ctx context.Context, maxAge time.Duration) {
+	if d.queue == nil {
+		return
+	}
+
+	if err := d.queue.expire(time.Now().Add(-maxAge)); err != nil {
+		slog.Warn("Failed to expire queued notifications", slog.Any("error", err))
+	}
+
+	for _, notifier := range d.notifiers {
+		if !notifier.queued {
+			continue
+		}
+
+		if _, err := d.flush(ctx, notifier); err != nil {
+			slog.Debug("Failed to deliver queued notifications",
+				slog.String("notifier", notifier.name), slog.Any("error", err))
+		}
+	}
+}
+
+// flush delivers the notifications queued for the notifier as a single
+// digest. It returns whether they are still queued, because the notifier's
+// service is still unreachable.
+func (d *Dispatcher) flush(ctx context.Context, notifier dispatchedNotifier) (bool, error) {
+	d.queue.flushing.Lock()
+	defer d.queue.flushing.Unlock()
+
+	pending := d.queue.queued(notifier.name)
+	if len(pending) == 0 {
+		return false, nil
+	}
+
+	err := notifier.Notify(ctx, notifier.digest(pending))
+	if err != nil && unreachable(err) {
+		return true, err
+	}
+
+	if err != nil {
+		slog.Warn("Dropped undelivered notifications",
+			slog.String("notifier", notifier.name), slog.Int("count", len(pending)), slog.Any("error", err))
+	} else {
+		slog.Info("Delivered queued notifications",
+			slog.String("notifier", notifier.name), slog.Int("count", len(pending)))
+	}
+
+	if err := d.queue.remove(notifier.name, len(pending)); err != nil {
+		slog.Warn("Failed to remove delivered notifications from the queue", slog.Any("error", err))
+	}
+
+	return false, err
+}
+
+// digest renders the queued notifications as a single notification, with a
+// line for each of them. The latest notification provides the title.
+func (notifier dispatchedNotifier) digest(pending []*Notification) *Notification {
+	if len(pending) == 1 {
+		return notifier.render(pending[0])
+	}
+
+	lines := make([]string, len(pending))
+	for i, n := range pending {
+		lines[i] = fmt.Sprintf("%s %s", n.Time.Local().Format("15:04"), notifier.render(n).Message)
+	}
+
+	digest := *notifier.render(pending[len(pending)-1])
+	digest.Message = strings.Join(lines, "\n")
+	for _, n := range pending {
+		digest.Priority = max(digest.Priority, n.Priority)
+	}
+
+	return &digest
+}
+
+// unreachable reports whether the error means the notifier's service
+// couldn't be reached (or is temporarily failing), so delivery should be
+// retried later.
+func unreachable(err error) bool {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= 500 || statusErr.code == 429
+	}
+
+	return false
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// Telegram sends notifications using a Telegram bot.
+type Telegram struct {
+	conf *latestconfig.TelegramConfig
+}
+
+// NewTelegram creates a new Telegram notifier.
+func NewTelegram(conf *latestconfig.TelegramConfig) *Telegram {
+	return &Telegram{conf: conf}
+}
+
+func (t *Telegram) Notify(ctx context.Context, n *Notification) error {
+	if n.Snapshot != nil {
+		return t.sendPhoto(ctx, n)
+	}
+
+	message := map[string]string{
+		"chat_id": t.conf.ChatID,
+		"text":    fmt.Sprintf("%s\n%s", n.Title, n.Message),
+	}
+	if t.conf.ParseMode != "" {
+		message["parse_mode"] = t.conf.ParseMode
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", t.conf.BotToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
+
+// sendPhoto sends the camera snapshot of the notification, with the message
+// as its caption.
+func (t *Telegram) sendPhoto(ctx context.Context, n *Notification) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	if err := w.WriteField("chat_id", t.conf.ChatID); err != nil {
+		return fmt.Errorf("failed to write chat ID: %w", err)
+	}
+
+	if err := w.WriteField("caption", fmt.Sprintf("%s\n%s", n.Title, n.Message)); err != nil {
+		return fmt.Errorf("failed to write caption: %w", err)
+	}
+
+	if t.conf.ParseMode != "" {
+		if err := w.WriteField("parse_mode", t.conf.ParseMode); err != nil {
+			return fmt.Errorf("failed to write parse mode: %w", err)
+		}
+	}
+
+	part, err := w.CreateFormFile("photo", "snapshot"+n.Snapshot.Extension())
+	if err != nil {
+		return fmt.Errorf("failed to create photo part: %w", err)
+	}
+
+	if _, err := part.Write(n.Snapshot.Data); err != nil {
+		return fmt.Errorf("failed to write photo: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish message: %w", err)
+	}
+
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendPhoto", t.conf.BotToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send photo: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the functions available to notification templates, in
+// addition to the built-in ones (eg. "html").
+var templateFuncs = template.FuncMap{
+	"truncate": truncate,
+	"markdown": escapeMarkdown,
+}
+
+// markdownEscaper escapes the characters that are special in Telegram's
+// MarkdownV2 formatting.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// escapeMarkdown escapes text (eg. a target's name) for inclusion in a
+// Markdown formatted message.
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// truncate shortens text to at most n characters, ending it with an ellipsis
+// if it was shortened.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if n <= 0 || len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n-1]) + "…"
+}
+
+// parseTemplate parses a notification template, or returns nil if the text
+// is empty.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// render returns the notification as the notifier sends it, with its title
+// and message templates applied. Templates that fail to execute leave the
+// default text in place.
+func (d *dispatchedNotifier) render(n *Notification) *Notification {
+	if d.title == nil && d.message == nil {
+		return n
+	}
+
+	rendered := *n
+	for _, t := range []struct {
+		tmpl *template.Template
+		text *string
+	}{
+		{d.title, &rendered.Title},
+		{d.message, &rendered.Message},
+	} {
+		if t.tmpl == nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := t.tmpl.Execute(&buf, n); err != nil {
+			slog.Warn("Failed to execute notification template",
+				slog.String("notifier", d.name), slog.String("template", t.tmpl.Name()), slog.Any("error", err))
+			continue
+		}
+
+		*t.text = buf.String()
+	}
+
+	return &rendered
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"text/template"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/locale"
+)
+
+// TextData is the data the title and message templates of notifications are
+// executed with.
+type TextData struct {
+	// Name is the name of the target.
+	Name string
+	// MAC is the MAC address of the target (redacted if configured).
+	MAC string
+	// RSSI is the signal strength in dBm (zero if unknown).
+	RSSI int
+	// Time is when the event happened, in local time.
+	Time time.Time
+	// CountToday is the number of times the target has rung the doorbell
+	// today.
+	CountToday int
+	// LastVisit is when the target last visited (for "missing" events).
+	LastVisit time.Time
+	// Battery is the battery level of the target in percent (for
+	// "lowBattery" events).
+	Battery int
+	// Visits is the number of times the target rang the doorbell over the
+	// summarized period (for "summary" events).
+	Visits int
+	// BusiestFrom and BusiestTo are the start and end of the time of day
+	// the target visited most at over the summarized period (for "summary"
+	// events). Only their times of day are meaningful.
+	BusiestFrom time.Time
+	BusiestTo   time.Time
+	// Weekly is true if the summarized period is a week rather than a day
+	// (for "summary" events).
+	Weekly bool
+	// LastBeacon is when a beacon was last received (for "gatewaySilent"
+	// events).
+	LastBeacon time.Time
+	// Instance is the name of the doorbell, filled in by Render.
+	Instance string
+}
+
+// Texts renders the titles and messages of notifications, from the
+// templates of each target and the defaults of the configured locale.
+type Texts struct {
+	defaults map[latestconfig.EventType]eventText
+	targets  map[string]map[latestconfig.EventType]eventText
+	instance string
+}
+
+type eventText struct {
+	title   *template.Template
+	message *template.Template
+}
+
+// NewTexts parses the notification templates of the given configuration.
+func NewTexts(conf *latestconfig.Config) (*Texts, error) {
+	messages, ok := locale.Lookup(conf.Locale)
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale: %s", conf.Locale)
+	}
+
+	defaults, err := parseEventTexts(messages.Title, messages.AnomalyTitle, map[latestconfig.EventType]string{
+		latestconfig.EventDetected:        messages.Detected,
+		latestconfig.EventButtonPressed:   messages.ButtonPressed,
+		latestconfig.EventArrived:         messages.Arrived,
+		latestconfig.EventDeparted:        messages.Departed,
+		latestconfig.EventStationary:      messages.Stationary,
+		latestconfig.EventLowBattery:      messages.LowBattery,
+		latestconfig.EventMissing:         messages.Missing,
+		latestconfig.EventUnusualVisit:    messages.UnusualVisit,
+		latestconfig.EventSummary:         messages.Summary,
+		latestconfig.EventGatewaySilent:   messages.GatewaySilent,
+		latestconfig.EventGatewayResumed:  messages.GatewayResumed,
+		latestconfig.EventDoorbellPressed: messages.DoorbellPressed,
+		latestconfig.EventMotion:          messages.Motion,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("locale %q: %w", conf.Locale, err)
+	}
+
+	t := &Texts{
+		defaults: defaults,
+		targets:  make(map[string]map[latestconfig.EventType]eventText, len(conf.Targets)),
+		instance: conf.InstanceName(),
+	}
+
+	for _, target := range conf.Targets {
+		t.targets[target.Name], err = parseEventTexts(target.Notification.Title, messages.AnomalyTitle, map[latestconfig.EventType]string{
+			latestconfig.EventDetected:      target.Notification.Message,
+			latestconfig.EventButtonPressed: target.Notification.ButtonMessage,
+			latestconfig.EventArrived:       target.Notification.ArrivalMessage,
+			latestconfig.EventDeparted:      target.Notification.DepartureMessage,
+			latestconfig.EventStationary:    target.Notification.StationaryMessage,
+			latestconfig.EventLowBattery:    target.Notification.LowBatteryMessage,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %w", target.Name, err)
+		}
+	}
+
+	return t, nil
+}
+
+// parseEventTexts parses the message template of each event type. Events
+// that ask for the cat to be checked on are titled with the anomaly title.
+func parseEventTexts(title, anomalyTitle string, messages map[latestconfig.EventType]string) (map[latestconfig.EventType]eventText, error) {
+	titleTmpl, err := parseTemplate("title", title)
+	if err != nil {
+		return nil, err
+	}
+
+	anomalyTitleTmpl, err := parseTemplate("title", anomalyTitle)
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make(map[latestconfig.EventType]eventText, len(messages))
+	for event, message := range messages {
+		text := eventText{title: titleTmpl}
+		switch event {
+		case latestconfig.EventStationary, latestconfig.EventMissing, latestconfig.EventUnusualVisit:
+			text.title = anomalyTitleTmpl
+		}
+
+		text.message, err = parseTemplate(string(event)+" message", message)
+		if err != nil {
+			return nil, err
+		}
+
+		texts[event] = text
+	}
+
+	return texts, nil
+}
+
+// Render returns the title and message of a notification for an event of
+// the named target. Texts the target doesn't have, and templates that fail to
+// execute, fall back to the locale's defaults.
+func (t *Texts) Render(name string, event latestconfig.EventType, data *TextData) (string, string) {
+	data.Instance = t.instance
+
+	text, ok := t.targets[name][event]
+	if !ok {
+		text = t.defaults[event]
+	}
+
+	return t.execute(text.title, t.defaults[event].title, data),
+		t.execute(text.message, t.defaults[event].message, data)
+}
+
+func (t *Texts) execute(tmpl, fallback *template.Template, data *TextData) string {
+	for _, tmpl := range []*template.Template{tmpl, fallback} {
+		if tmpl == nil {
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			slog.Warn("Failed to execute notification template",
+				slog.String("name", data.Name), slog.String("template", tmpl.Name()), slog.Any("error", err))
+			continue
+		}
+
+		return buf.String()
+	}
+
+	return ""
+}
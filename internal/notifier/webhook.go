@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+const (
+	// timestampHeader is the header holding the Unix time a signed webhook
+	// request was sent at.
+	timestampHeader = "X-Cat-Doorbell-Timestamp"
+	// signatureHeader is the header holding the signature of a signed
+	// webhook request, as "sha256=" followed by the hex encoded HMAC-SHA256
+	// of the timestamp, a ".", and the request body.
+	signatureHeader = "X-Cat-Doorbell-Signature"
+)
+
+// Webhook sends notifications to a generic HTTP endpoint.
+type Webhook struct {
+	conf *latestconfig.WebhookConfig
+	body *template.Template
+
+	// sendMu is held while a batch is sent, so that batches are sent one at
+	// a time, in order. Notifiers wait for their batch to be sent, so a slow
+	// endpoint holds back the workers delivering notifications rather than
+	// requests piling up.
+	sendMu sync.Mutex
+	mu     sync.Mutex
+	// batch holds the notifications waiting to be sent, if batching.
+	batch *webhookBatch
+}
+
+// webhookBatch is a batch of notifications waiting to be sent together.
+type webhookBatch struct {
+	notifications []*Notification
+	// sent is closed once the batch has been sent, after which err holds
+	// the result.
+	sent  chan struct{}
+	err   error
+	timer *time.Timer
+}
+
+// NewWebhook creates a new webhook notifier. If the configuration specifies a
+// body template, it is executed with the notification as its data (or the
+// list of notifications, if batching), otherwise the notification is sent as
+// JSON.
+func NewWebhook(conf *latestconfig.WebhookConfig) (*Webhook, error) {
+	w := &Webhook{conf: conf}
+
+	if conf.Body != "" {
+		var err error
+		w.body, err = template.New("body").Funcs(templateFuncs).Funcs(template.FuncMap{
+			"json": func(v any) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Parse(conf.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse body template: %w", err)
+		}
+	}
+
+	return w, nil
+}
+
+func (w *Webhook) Notify(ctx context.Context, n *Notification) error {
+	if w.conf.Batch != nil {
+		return w.notifyBatched(ctx, n)
+	}
+
+	return w.send(ctx, n)
+}
+
+// notifyBatched adds the notification to the next batch, and waits for the
+// batch to be sent. The batch is sent once it is full, or once its first
+// notification has waited for the maximum delay.
+func (w *Webhook) notifyBatched(ctx context.Context, n *Notification) error {
+	w.mu.Lock()
+	batch := w.batch
+	if batch == nil {
+		batch = &webhookBatch{sent: make(chan struct{})}
+		batch.timer = time.AfterFunc(w.conf.Batch.MaxDelay, func() {
+			w.flush(batch)
+		})
+		w.batch = batch
+	}
+
+	batch.notifications = append(batch.notifications, n)
+	full := len(batch.notifications) >= w.conf.Batch.MaxSize
+	if full {
+		batch.timer.Stop()
+		w.batch = nil
+	}
+	w.mu.Unlock()
+
+	if full {
+		go w.sendBatch(batch)
+	}
+
+	select {
+	case <-batch.sent:
+		return batch.err
+	case <-ctx.Done():
+		w.remove(batch, n)
+		return ctx.Err()
+	}
+}
+
+// remove takes the notification back out of the batch, if the batch hasn't
+// been sent yet.
+func (w *Webhook) remove(batch *webhookBatch, n *Notification) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.batch != batch {
+		return
+	}
+
+	batch.notifications = slices.DeleteFunc(batch.notifications, func(other *Notification) bool {
+		return other == n
+	})
+
+	if len(batch.notifications) == 0 {
+		batch.timer.Stop()
+		w.batch = nil
+	}
+}
+
+// flush sends the batch once it has waited for the maximum delay, unless it
+// has already been sent (or emptied).
+func (w *Webhook) flush(batch *webhookBatch) {
+	w.mu.Lock()
+	if w.batch != batch {
+		w.mu.Unlock()
+		return
+	}
+	w.batch = nil
+	w.mu.Unlock()
+
+	w.sendBatch(batch)
+}
+
+// sendBatch sends the notifications of a batch in one request.
+func (w *Webhook) sendBatch(batch *webhookBatch) {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	// The batch is sent on behalf of several notifications, so it isn't
+	// bound to any one of their contexts.
+	batch.err = w.send(context.Background(), batch.notifications)
+	close(batch.sent)
+}
+
+// send sends a request with the given notification (or list of
+// notifications) as its body.
+func (w *Webhook) send(ctx context.Context, data any) error {
+	var body bytes.Buffer
+	if w.body != nil {
+		if err := w.body.Execute(&body, data); err != nil {
+			return fmt.Errorf("failed to execute body template: %w", err)
+		}
+	} else {
+		if err := json.NewEncoder(&body).Encode(data); err != nil {
+			return fmt.Errorf("failed to marshal notification: %w", err)
+		}
+	}
+
+	method := w.conf.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, w.conf.URL, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if w.conf.SigningSecret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(timestampHeader, timestamp)
+		req.Header.Set(signatureHeader, "sha256="+sign(w.conf.SigningSecret, timestamp, body.Bytes()))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(resp)
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the timestamp and body of a
+// webhook request, keyed with the signing secret.
+func sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
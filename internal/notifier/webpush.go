@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/webpush"
+)
+
+// WebPush sends push notifications to the browsers subscribed on the web
+// dashboard.
+type WebPush struct {
+	conf *latestconfig.WebPushConfig
+	push *webpush.Service
+}
+
+// webPushMessage is the payload of a push notification, which the
+// dashboard's service worker displays.
+type webPushMessage struct {
+	Event   latestconfig.EventType `json:"event"`
+	Title   string                 `json:"title"`
+	Message string                 `json:"message"`
+	Name    string                 `json:"name,omitempty"`
+	Time    time.Time              `json:"time"`
+}
+
+// NewWebPush creates a new web push notifier, sending notifications to the
+// subscriptions of the given service. Without a service (ie. when
+// cat-doorbell isn't running), notifications can't be sent.
+func NewWebPush(conf *latestconfig.WebPushConfig, push *webpush.Service) *WebPush {
+	return &WebPush{conf: conf, push: push}
+}
+
+func (wp *WebPush) Notify(ctx context.Context, n *Notification) error {
+	if wp.push == nil {
+		return errors.New("web push notifications can only be sent while cat-doorbell is running")
+	}
+
+	payload, err := json.Marshal(webPushMessage{
+		Event:   n.Event,
+		Title:   n.Title,
+		Message: n.Message,
+		Name:    n.Name,
+		Time:    n.Time,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	urgency := webpush.UrgencyHigh
+	if n.Priority == PriorityLow {
+		urgency = webpush.UrgencyLow
+	}
+
+	return wp.push.Broadcast(ctx, payload, webpush.Options{
+		Subject: wp.conf.Subject,
+		TTL:     wp.conf.TTL,
+		Urgency: urgency,
+	})
+}
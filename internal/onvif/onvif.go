@@ -0,0 +1,374 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package onvif receives events (eg. motion) from ONVIF cameras, using a
+// pull point subscription.
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+const (
+	// pullTimeout is how long the camera may hold a pull request open while
+	// waiting for events.
+	pullTimeout = 30 * time.Second
+	// subscriptionLifetime is how long the subscription lasts unless it is
+	// renewed, so cameras clean up after us if we go away.
+	subscriptionLifetime = 2 * time.Minute
+	// requestTimeout is how long requests other than pulls may take.
+	requestTimeout = 10 * time.Second
+	// retryInterval is how long to wait before subscribing again after the
+	// subscription failed.
+	retryInterval = 10 * time.Second
+	// maxResponseSize is the largest response that will be read.
+	maxResponseSize = 1 << 20
+)
+
+const (
+	actionCreatePullPoint = "http://www.onvif.org/ver10/events/wsdl/EventPortType/CreatePullPointSubscriptionRequest"
+	actionPullMessages    = "http://www.onvif.org/ver10/events/wsdl/PullPointSubscription/PullMessagesRequest"
+	actionRenew           = "http://docs.oasis-open.org/wsn/bw-2/SubscriptionManager/RenewRequest"
+	actionUnsubscribe     = "http://docs.oasis-open.org/wsn/bw-2/SubscriptionManager/UnsubscribeRequest"
+	actionGetCapabilities = "http://www.onvif.org/ver10/device/wsdl/GetCapabilities"
+)
+
+// Event is an event raised by the camera.
+type Event struct {
+	// Topic is the topic of the event (eg.
+	// "tns1:RuleEngine/CellMotionDetector/Motion").
+	Topic string
+	// Time is when the camera raised the event.
+	Time time.Time
+	// Active is true unless the event reports that a state (eg. motion) has
+	// ended.
+	Active bool
+}
+
+// Client subscribes to the events of an ONVIF camera.
+type Client struct {
+	conf *latestconfig.ONVIFConfig
+}
+
+// New creates a new ONVIF client.
+func New(conf *latestconfig.ONVIFConfig) *Client {
+	return &Client{conf: conf}
+}
+
+// Run sends the camera's events to the given channel until the context is
+// cancelled. The subscription is renewed as needed, and created again if it
+// fails (eg. because the camera restarted).
+func (c *Client) Run(ctx context.Context, events chan<- Event) error {
+	for {
+		err := c.subscribe(ctx, events)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		slog.Warn("ONVIF event subscription failed, retrying",
+			slog.String("url", c.conf.URL), slog.Duration("after", retryInterval), slog.Any("error", err))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (c *Client) subscribe(ctx context.Context, events chan<- Event) error {
+	eventsURL, err := c.eventServiceURL(ctx)
+	if err != nil {
+		return err
+	}
+
+	subscriptionURL, err := c.createPullPoint(ctx, eventsURL)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), requestTimeout)
+		defer cancel()
+
+		var resp struct{}
+		if err := c.call(ctx, subscriptionURL, actionUnsubscribe, `<Unsubscribe xmlns="http://docs.oasis-open.org/wsn/b-2"/>`, &resp); err != nil {
+			slog.Debug("Failed to unsubscribe from ONVIF events", slog.Any("error", err))
+		}
+	}()
+
+	slog.Info("Subscribed to ONVIF events", slog.String("url", c.conf.URL))
+
+	renewed := time.Now()
+	for {
+		messages, err := c.pullMessages(ctx, subscriptionURL)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			// The current state of every property is reported when
+			// subscribing, which isn't news.
+			if m.Message.PropertyOperation == "Initialized" {
+				continue
+			}
+
+			select {
+			case events <- m.event():
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		if time.Since(renewed) > subscriptionLifetime/2 {
+			if err := c.renew(ctx, subscriptionURL); err != nil {
+				return err
+			}
+			renewed = time.Now()
+		}
+	}
+}
+
+// eventServiceURL returns the address of the camera's event service.
+func (c *Client) eventServiceURL(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var resp struct {
+		XAddr string `xml:"GetCapabilitiesResponse>Capabilities>Events>XAddr"`
+	}
+	body := `<GetCapabilities xmlns="http://www.onvif.org/ver10/device/wsdl"><Category>Events</Category></GetCapabilities>`
+	if err := c.call(ctx, c.conf.URL, actionGetCapabilities, body, &resp); err != nil {
+		return "", fmt.Errorf("failed to get capabilities: %w", err)
+	}
+
+	if resp.XAddr == "" {
+		return "", errors.New("camera doesn't support events")
+	}
+
+	return strings.TrimSpace(resp.XAddr), nil
+}
+
+// createPullPoint creates a pull point subscription, returning its address.
+func (c *Client) createPullPoint(ctx context.Context, eventsURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var resp struct {
+		Address string `xml:"CreatePullPointSubscriptionResponse>SubscriptionReference>Address"`
+	}
+	body := fmt.Sprintf(`<CreatePullPointSubscription xmlns="http://www.onvif.org/ver10/events/wsdl"><InitialTerminationTime>%s</InitialTerminationTime></CreatePullPointSubscription>`,
+		xmlDuration(subscriptionLifetime))
+	if err := c.call(ctx, eventsURL, actionCreatePullPoint, body, &resp); err != nil {
+		return "", fmt.Errorf("failed to create pull point subscription: %w", err)
+	}
+
+	if resp.Address == "" {
+		return "", errors.New("failed to create pull point subscription: no subscription address")
+	}
+
+	return strings.TrimSpace(resp.Address), nil
+}
+
+// pullMessages waits for events from the subscription.
+func (c *Client) pullMessages(ctx context.Context, subscriptionURL string) ([]notificationMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, pullTimeout+requestTimeout)
+	defer cancel()
+
+	var resp struct {
+		Messages []notificationMessage `xml:"PullMessagesResponse>NotificationMessage"`
+	}
+	body := fmt.Sprintf(`<PullMessages xmlns="http://www.onvif.org/ver10/events/wsdl"><Timeout>%s</Timeout><MessageLimit>100</MessageLimit></PullMessages>`,
+		xmlDuration(pullTimeout))
+	if err := c.call(ctx, subscriptionURL, actionPullMessages, body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to pull messages: %w", err)
+	}
+
+	return resp.Messages, nil
+}
+
+// renew extends the lifetime of the subscription.
+func (c *Client) renew(ctx context.Context, subscriptionURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var resp struct{}
+	body := fmt.Sprintf(`<Renew xmlns="http://docs.oasis-open.org/wsn/b-2"><TerminationTime>%s</TerminationTime></Renew>`,
+		xmlDuration(subscriptionLifetime))
+	if err := c.call(ctx, subscriptionURL, actionRenew, body, &resp); err != nil {
+		return fmt.Errorf("failed to renew subscription: %w", err)
+	}
+
+	return nil
+}
+
+// call sends a SOAP request, decoding the body of the response into resp.
+func (c *Client) call(ctx context.Context, url, action, body string, resp any) error {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://www.w3.org/2005/08/addressing"><s:Header>`)
+	fmt.Fprintf(&buf, `<a:Action s:mustUnderstand="1">%s</a:Action><a:To s:mustUnderstand="1">%s</a:To>`, escape(action), escape(url))
+	if c.conf.Username != "" {
+		security, err := usernameToken(c.conf.Username, c.conf.Password, time.Now())
+		if err != nil {
+			return err
+		}
+		buf.WriteString(security)
+	}
+	buf.WriteString(`</s:Header><s:Body>`)
+	buf.WriteString(body)
+	buf.WriteString(`</s:Body></s:Envelope>`)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", fmt.Sprintf(`application/soap+xml; charset=utf-8; action="%s"`, action))
+
+	httpResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var envelope struct {
+		Body struct {
+			Inner []byte `xml:",innerxml"`
+			Fault *struct {
+				Reason string `xml:"Reason>Text"`
+			} `xml:"Fault"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		if httpResp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status code: %d", httpResp.StatusCode)
+		}
+
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if envelope.Body.Fault != nil {
+		return fmt.Errorf("camera returned a fault: %s", strings.TrimSpace(envelope.Body.Fault.Reason))
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", httpResp.StatusCode)
+	}
+
+	// Decode the contents of the body, wrapped in an element of its own so
+	// that resp's paths are relative to the body.
+	wrapped := append(append([]byte("<Body>"), envelope.Body.Inner...), "</Body>"...)
+	if err := xml.Unmarshal(wrapped, resp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+type notificationMessage struct {
+	Topic   string `xml:"Topic"`
+	Message struct {
+		UtcTime           string `xml:"UtcTime,attr"`
+		PropertyOperation string `xml:"PropertyOperation,attr"`
+		Items             []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:"Value,attr"`
+		} `xml:"Data>SimpleItem"`
+	} `xml:"Message>Message"`
+}
+
+// event returns the event a notification message reports. Events whose data
+// are all false (eg. IsMotion="false") report that a state has ended.
+func (m *notificationMessage) event() Event {
+	e := Event{
+		Topic:  strings.TrimSpace(m.Topic),
+		Time:   time.Now(),
+		Active: true,
+	}
+
+	if t, err := time.Parse(time.RFC3339, m.Message.UtcTime); err == nil {
+		e.Time = t
+	}
+
+	var hasFalse bool
+	for _, item := range m.Message.Items {
+		switch strings.ToLower(item.Value) {
+		case "true":
+			return e
+		case "false":
+			hasFalse = true
+		}
+	}
+	e.Active = !hasFalse
+
+	return e
+}
+
+// usernameToken returns a WS-Security header authenticating with the given
+// credentials, using a password digest.
+func usernameToken(username, password string, now time.Time) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	created := now.UTC().Format(time.RFC3339)
+
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(password))
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	return fmt.Sprintf(`<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">`+
+		`<UsernameToken><Username>%s</Username>`+
+		`<Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%s</Password>`+
+		`<Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">%s</Nonce>`+
+		`<Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%s</Created>`+
+		`</UsernameToken></Security>`,
+		escape(username), digest, base64.StdEncoding.EncodeToString(nonce), created), nil
+}
+
+// xmlDuration formats a duration as an XML schema duration (eg. "PT30S").
+func xmlDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int(d.Seconds()))
+}
+
+func escape(s string) string {
+	var buf strings.Builder
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package pulse
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// MicrophoneInUse returns whether any application is recording from a
+// microphone (or other input device, but not a monitor of an output device)
+// through the PulseAudio or PipeWire sound server.
+func MicrophoneInUse() (bool, error) {
+	sources, err := Pactl("list", "short", "sources")
+	if err != nil {
+		return false, err
+	}
+
+	outputs, err := Pactl("list", "source-outputs")
+	if err != nil {
+		return false, err
+	}
+
+	return recordingFrom(outputs, monitorSources(sources)), nil
+}
+
+// monitorSources returns the indexes of the sources that monitor an output
+// device, in the output of "pactl list short sources".
+func monitorSources(out []byte) map[string]bool {
+	monitors := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && strings.HasSuffix(fields[1], ".monitor") {
+			monitors[fields[0]] = true
+		}
+	}
+
+	return monitors
+}
+
+// recordingFrom returns whether any stream (source output) that isn't paused
+// is recording from a source other than the given monitors, in the output of
+// "pactl list source-outputs".
+func recordingFrom(out []byte, monitors map[string]bool) bool {
+	var source string
+	var corked bool
+	recording := func() bool {
+		return source != "" && !monitors[source] && !corked
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Source Output #") {
+			if recording() {
+				return true
+			}
+			source, corked = "", false
+		} else if index, ok := strings.CutPrefix(line, "Source: "); ok {
+			source = index
+		} else if line == "Corked: yes" {
+			corked = true
+		}
+	}
+
+	return recording()
+}
+
+// Pactl runs the PulseAudio command line tool, which PipeWire also provides,
+// and returns its output.
+func Pactl(args ...string) ([]byte, error) {
+	cmd := exec.Command("pactl", args...)
+	// The output is parsed, so it mustn't be translated.
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to run pactl: %w: %s", err, msg)
+		}
+
+		return nil, fmt.Errorf("failed to run pactl: %w", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package secret
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// secretServiceName is the well-known D-Bus name of the secret service.
+const secretServiceName = "org.freedesktop.secrets"
+
+// Available returns an error if the keyring can't be used, ie. no secret
+// service (eg. GNOME Keyring) is running or can be started on the session
+// bus. Looking up a secret would unlock the keyring, which may prompt the
+// user, so only the bus is asked.
+func Available() error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect to session bus: %w", err)
+	}
+
+	var running bool
+	if err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, secretServiceName).Store(&running); err != nil {
+		return fmt.Errorf("failed to look up secret service: %w", err)
+	}
+	if running {
+		return nil
+	}
+
+	var activatable []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable); err != nil {
+		return fmt.Errorf("failed to look up secret service: %w", err)
+	}
+	for _, name := range activatable {
+		if name == secretServiceName {
+			return nil
+		}
+	}
+
+	return errors.New("no secret service (eg. GNOME Keyring) on the session bus")
+}
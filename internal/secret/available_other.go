@@ -0,0 +1,42 @@
+//go:build !linux
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package secret
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+)
+
+// probe is the name of an entry that is never stored, looked up to check
+// that the keyring is available.
+const probe = "availability-probe"
+
+// Available returns an error if the keyring can't be used. It looks up an
+// entry that is never stored, so no secret is read.
+func Available() error {
+	if _, err := keyring.Get(service, probe); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("keyring isn't available: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package secret stores credentials in the operating system's keyring.
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+
+	"github.com/zalando/go-keyring"
+)
+
+// service is the keyring service that secrets are stored under.
+const service = "cat-doorbell"
+
+// BrokerPassword is the name of the secret holding the MQTT broker password.
+const BrokerPassword = "broker-password"
+
+// Names are the names of the supported secrets.
+var Names = []string{BrokerPassword}
+
+// ErrNotFound is returned when a secret is not present in the keyring.
+var ErrNotFound = errors.New("secret not found in keyring")
+
+// Get returns the value of the named secret.
+func Get(name string) (string, error) {
+	value, err := keyring.Get(service, name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, name)
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get secret %q from keyring: %w", name, err)
+	}
+
+	return value, nil
+}
+
+// Set stores the value of the named secret.
+func Set(name, value string) error {
+	if err := CheckName(name); err != nil {
+		return err
+	}
+
+	if err := keyring.Set(service, name, value); err != nil {
+		return fmt.Errorf("failed to store secret %q in keyring: %w", name, err)
+	}
+
+	return nil
+}
+
+// Delete removes the named secret.
+func Delete(name string) error {
+	if err := CheckName(name); err != nil {
+		return err
+	}
+
+	if err := keyring.Delete(service, name); errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	} else if err != nil {
+		return fmt.Errorf("failed to delete secret %q from keyring: %w", name, err)
+	}
+
+	return nil
+}
+
+// Backend returns the name of the keyring secrets are stored in on this
+// platform.
+func Backend() string {
+	switch runtime.GOOS {
+	case "linux", "freebsd", "openbsd":
+		return "secret-service"
+	case "darwin":
+		return "keychain"
+	case "windows":
+		return "wincred"
+	default:
+		return "unsupported"
+	}
+}
+
+// CheckName returns an error if the name isn't that of a supported secret.
+func CheckName(name string) error {
+	if !slices.Contains(Names, name) {
+		return fmt.Errorf("unknown secret %q (expected one of %v)", name, Names)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package session
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dpeckett/cat-doorbell/internal/pulse"
+)
+
+// InCall returns what suggests the user is on a call ("microphone" or
+// "camera"), or an empty string if neither is in use.
+func InCall() (string, error) {
+	if cameraInUse() {
+		return "camera", nil
+	}
+
+	mic, err := pulse.MicrophoneInUse()
+	if err != nil {
+		return "", fmt.Errorf("failed to check if the microphone is in use: %w", err)
+	}
+
+	if mic {
+		return "microphone", nil
+	}
+
+	return "", nil
+}
+
+// cameraInUse returns whether any process has a video device (eg.
+// /dev/video0) open. Only the processes of the current user can be checked,
+// which includes any call they are on.
+func cameraInUse() bool {
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if target, err := os.Readlink(fd); err == nil && strings.HasPrefix(target, "/dev/video") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package session reports whether the user is at the machine, from the state
+// of their desktop session.
+package session
+
+// State is the state of the user's desktop session.
+type State string
+
+const (
+	// Active is an unlocked session the user is using.
+	Active State = "active"
+	// Idle is an unlocked session the user hasn't used for a while, or one
+	// that isn't in the foreground of its seat (eg. after switching user).
+	Idle State = "idle"
+	// Locked is a session whose screen is locked.
+	Locked State = "locked"
+	// None is when the user has no desktop session on this machine.
+	None State = "none"
+)
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package session
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// Current returns whether the screen is locked, from the console users
+// reported by the I/O Registry. The session is otherwise assumed to be active,
+// as macOS doesn't report whether it is idle.
+func Current(ctx context.Context) (State, error) {
+	out, err := exec.CommandContext(ctx, "ioreg", "-n", "Root", "-d1").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read the I/O Registry: %w", err)
+	}
+
+	if bytes.Contains(out, []byte(`"CGSSessionScreenIsLocked"=Yes`)) {
+		return Locked, nil
+	}
+
+	return Active, nil
+}
@@ -0,0 +1,149 @@
+//go:build linux
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	logindDest         = "org.freedesktop.login1"
+	logindPath         = "/org/freedesktop/login1"
+	logindSession      = "org.freedesktop.login1.Session"
+	logindListSessions = "org.freedesktop.login1.Manager.ListSessions"
+	propertiesGetAll   = "org.freedesktop.DBus.Properties.GetAll"
+)
+
+// sessionProperties are the properties of a logind session that decide its
+// state.
+type sessionProperties struct {
+	Type       string
+	Class      string
+	Active     bool
+	LockedHint bool
+	IdleHint   bool
+}
+
+// Current returns the state of the user's desktop sessions, as reported by
+// systemd-logind. If the user has several (eg. on different seats), the most
+// present state is returned.
+func Current(ctx context.Context) (State, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to the system bus: %w", err)
+	}
+
+	// Each session is the id, uid, user name, seat and object path.
+	var sessions []struct {
+		ID   string
+		UID  uint32
+		User string
+		Seat string
+		Path dbus.ObjectPath
+	}
+	if err := conn.Object(logindDest, logindPath).CallWithContext(ctx, logindListSessions, 0).Store(&sessions); err != nil {
+		return "", fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	state := None
+	uid := uint32(os.Getuid())
+	for _, s := range sessions {
+		// Remote (eg. SSH) sessions aren't attached to a seat.
+		if s.UID != uid || s.Seat == "" {
+			continue
+		}
+
+		props, err := properties(ctx, conn, s.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to get properties of session %s: %w", s.ID, err)
+		}
+
+		if props.Class != "user" || !isGraphical(props.Type) {
+			continue
+		}
+
+		state = mostPresent(state, props.state())
+	}
+
+	return state, nil
+}
+
+// properties returns the properties of the logind session at path.
+func properties(ctx context.Context, conn *dbus.Conn, path dbus.ObjectPath) (*sessionProperties, error) {
+	var all map[string]dbus.Variant
+	if err := conn.Object(logindDest, path).CallWithContext(ctx, propertiesGetAll, 0, logindSession).Store(&all); err != nil {
+		return nil, err
+	}
+
+	var props sessionProperties
+	for name, dst := range map[string]any{
+		"Type":       &props.Type,
+		"Class":      &props.Class,
+		"Active":     &props.Active,
+		"LockedHint": &props.LockedHint,
+		"IdleHint":   &props.IdleHint,
+	} {
+		if v, ok := all[name]; ok {
+			if err := v.Store(dst); err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+		}
+	}
+
+	return &props, nil
+}
+
+// state returns the state of the session.
+func (p *sessionProperties) state() State {
+	switch {
+	case p.LockedHint:
+		return Locked
+	case !p.Active || p.IdleHint:
+		return Idle
+	default:
+		return Active
+	}
+}
+
+// isGraphical returns whether a logind session type is a desktop session.
+func isGraphical(sessionType string) bool {
+	switch sessionType {
+	case "x11", "wayland", "mir":
+		return true
+	default:
+		return false
+	}
+}
+
+// mostPresent returns whichever state suggests the user is closest to being
+// at the machine.
+func mostPresent(a, b State) State {
+	rank := map[State]int{None: 0, Locked: 1, Idle: 2, Active: 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+
+	return a
+}
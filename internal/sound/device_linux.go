@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sound
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dpeckett/cat-doorbell/internal/pulse"
+)
+
+// Device is an audio output device.
+type Device struct {
+	// Name identifies the device in the configuration.
+	Name string
+	// Description is the human readable name of the device.
+	Description string
+}
+
+// Devices returns the output devices (sinks) of the PulseAudio or PipeWire
+// sound server.
+func Devices() ([]Device, error) {
+	out, err := pulse.Pactl("list", "sinks")
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if name, ok := strings.CutPrefix(line, "Name: "); ok {
+			devices = append(devices, Device{Name: name, Description: name})
+		} else if description, ok := strings.CutPrefix(line, "Description: "); ok && len(devices) > 0 {
+			devices[len(devices)-1].Description = description
+		}
+	}
+
+	return devices, nil
+}
+
+// selectDevice makes the speaker's stream play through the given sink, when
+// it is created. ALSA's default device is routed to the sound server, which
+// places new streams on the sink named by PULSE_SINK.
+func selectDevice(name string) {
+	_ = os.Setenv("PULSE_SINK", name)
+}
+
+// moveToDevice moves the speaker's stream to the given sink, or to the
+// default sink if the name is empty.
+func moveToDevice(name string) error {
+	if name == "" {
+		name = "@DEFAULT_SINK@"
+	}
+
+	out, err := pulse.Pactl("list", "sink-inputs")
+	if err != nil {
+		return err
+	}
+
+	id, ok := findSinkInput(out, os.Getpid())
+	if !ok {
+		return errors.New("the speaker's stream is not connected to a PulseAudio or PipeWire sound server")
+	}
+
+	if _, err := pulse.Pactl("move-sink-input", id, name); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// findSinkInput returns the index of the stream (sink input) opened by the
+// given process, in the output of "pactl list sink-inputs".
+func findSinkInput(out []byte, pid int) (string, bool) {
+	wantPID := "application.process.id = " + strconv.Quote(strconv.Itoa(pid))
+
+	var id string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if index, ok := strings.CutPrefix(line, "Sink Input #"); ok {
+			id = index
+		} else if line == wantPID && id != "" {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// sinkInputVolumeRE matches the raw volume of each channel in the output of
+// "pactl list sink-inputs", eg. "front-left: 65536 /  100% / 0.00 dB".
+var sinkInputVolumeRE = regexp.MustCompile(`[\w-]+:\s*(\d+)\s*/`)
+
+// duckOthers lowers the volume of the streams of other applications to the
+// given fraction of their volume. It returns a function that restores their
+// volume.
+func duckOthers(fraction float64) (func() error, error) {
+	out, err := pulse.Pactl("list", "sink-inputs")
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := otherSinkInputVolumes(out, os.Getpid())
+
+	var errs []error
+	ducked := make(map[string][]string, len(volumes))
+	for id, volume := range volumes {
+		lowered := make([]string, len(volume))
+		for i, v := range volume {
+			lowered[i] = strconv.Itoa(int(float64(v) * fraction))
+		}
+
+		if _, err := pulse.Pactl(append([]string{"set-sink-input-volume", id}, lowered...)...); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		original := make([]string, len(volume))
+		for i, v := range volume {
+			original[i] = strconv.Itoa(v)
+		}
+		ducked[id] = original
+	}
+
+	restore := func() error {
+		var errs []error
+		for id, original := range ducked {
+			// Streams that have since ended can't be restored, and don't need
+			// to be.
+			if _, err := pulse.Pactl(append([]string{"set-sink-input-volume", id}, original...)...); err != nil &&
+				!strings.Contains(err.Error(), "No such entity") {
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+
+	return restore, errors.Join(errs...)
+}
+
+// otherSinkInputVolumes returns the raw volume of each channel of the
+// streams (sink inputs) not opened by the given process, by index, in the
+// output of "pactl list sink-inputs".
+func otherSinkInputVolumes(out []byte, pid int) map[string][]int {
+	ownPID := "application.process.id = " + strconv.Quote(strconv.Itoa(pid))
+
+	volumes := make(map[string][]int)
+	var id string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if index, ok := strings.CutPrefix(line, "Sink Input #"); ok {
+			id = index
+		} else if volume, ok := strings.CutPrefix(line, "Volume: "); ok && id != "" {
+			for _, m := range sinkInputVolumeRE.FindAllStringSubmatch(volume, -1) {
+				if v, err := strconv.Atoi(m[1]); err == nil {
+					volumes[id] = append(volumes[id], v)
+				}
+			}
+		} else if line == ownPID {
+			delete(volumes, id)
+			id = ""
+		}
+	}
+
+	return volumes
+}
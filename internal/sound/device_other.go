@@ -0,0 +1,57 @@
+//go:build !linux
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sound
+
+import (
+	"errors"
+	"runtime"
+)
+
+// errDevicesUnsupported is returned when output devices can't be selected on
+// this platform.
+var errDevicesUnsupported = errors.New("selecting an audio output device is not supported on " + runtime.GOOS)
+
+// Device is an audio output device.
+type Device struct {
+	// Name identifies the device in the configuration.
+	Name string
+	// Description is the human readable name of the device.
+	Description string
+}
+
+// Devices returns the audio output devices.
+func Devices() ([]Device, error) {
+	return nil, errDevicesUnsupported
+}
+
+// duckOthers returns an error, the volume of other applications can't be
+// changed.
+func duckOthers(fraction float64) (func() error, error) {
+	return nil, errors.New("lowering the volume of other applications is not supported on " + runtime.GOOS)
+}
+
+// selectDevice does nothing, the default output device is always used.
+func selectDevice(name string) {}
+
+// moveToDevice returns an error, the default output device is always used.
+func moveToDevice(name string) error {
+	return errDevicesUnsupported
+}
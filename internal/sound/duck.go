@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sound
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// othersVolume is the volume other applications are lowered to while
+// sounds are playing, as a fraction of their volume.
+const othersVolume = 0.25
+
+// ducker lowers the audio of other applications while sounds are playing,
+// and restores it once they have all finished. The number of playing sounds
+// is counted synchronously (so it can be updated while the speaker is
+// locked), while the sound server is updated in the background.
+type ducker struct {
+	mu      sync.Mutex
+	playing int
+	closed  bool
+	wake    chan struct{}
+	done    chan struct{}
+}
+
+func newDucker() *ducker {
+	d := &ducker{
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+
+	go d.run()
+
+	return d
+}
+
+// add changes the number of playing sounds that duck other applications.
+func (d *ducker) add(delta int) {
+	d.mu.Lock()
+	d.playing += delta
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close restores the audio of other applications, and stops the ducker.
+func (d *ducker) close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+
+	<-d.done
+}
+
+func (d *ducker) run() {
+	defer close(d.done)
+
+	var restore func() error
+	for range d.wake {
+		d.mu.Lock()
+		duck := d.playing > 0 && !d.closed
+		closed := d.closed
+		d.mu.Unlock()
+
+		switch {
+		case duck && restore == nil:
+			var err error
+			restore, err = duckOthers(othersVolume)
+			if err != nil {
+				slog.Warn("Failed to lower the volume of other applications", slog.Any("error", err))
+			}
+		case !duck && restore != nil:
+			if err := restore(); err != nil {
+				slog.Warn("Failed to restore the volume of other applications", slog.Any("error", err))
+			}
+			restore = nil
+		}
+
+		if closed {
+			return
+		}
+	}
+}
@@ -0,0 +1,455 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package sound plays doorbell sounds through an audio output device.
+package sound
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/assets"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+	"github.com/gopxl/beep/v2/flac"
+	"github.com/gopxl/beep/v2/mp3"
+	"github.com/gopxl/beep/v2/speaker"
+	"github.com/gopxl/beep/v2/vorbis"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+// sampleRate is the sample rate of the speaker, sounds with a different
+// sample rate are resampled.
+const sampleRate = beep.SampleRate(44100)
+
+// DefaultBufferSize is the default length of the speaker's buffer.
+const DefaultBufferSize = 100 * time.Millisecond
+
+// maxBufferedLength is the length of the longest sound that is decoded into
+// memory ahead of time. Longer sounds are decoded while they play.
+const maxBufferedLength = 30 * time.Second
+
+// duckVolume is how much the volume of a playing sound is lowered by when
+// it is ducked, as a power of two (ie. to a quarter of its amplitude).
+const duckVolume = 2
+
+// WhilePlaying is what to do when a sound is played while another sound is
+// still playing.
+type WhilePlaying string
+
+const (
+	// WhilePlayingMix plays both sounds at the same time.
+	WhilePlayingMix WhilePlaying = "mix"
+	// WhilePlayingDuck lowers the volume of the playing sound.
+	WhilePlayingDuck WhilePlaying = "duck"
+	// WhilePlayingSkip doesn't play the new sound.
+	WhilePlayingSkip WhilePlaying = "skip"
+)
+
+// Options configures a player.
+type Options struct {
+	// Device is the name of the output device to play sounds through, or
+	// empty for the default device.
+	Device string
+	// Volume is the playback volume, where 1 leaves the volume unchanged.
+	Volume float64
+	// WhilePlaying is what to do when a sound is played while another sound
+	// is still playing. Defaults to mixing them.
+	WhilePlaying WhilePlaying
+	// BufferSize is the length of the speaker's buffer, which delays every
+	// sound by up to as much. Shorter buffers may stutter on busy machines.
+	// It can't be changed once the player is created. Defaults to
+	// DefaultBufferSize.
+	BufferSize time.Duration
+	// DuckOthers lowers the volume of other applications (eg. music) while
+	// sounds are playing. Only supported on Linux, with a PulseAudio or
+	// PipeWire sound server.
+	DuckOthers bool
+	// Schedule changes the sound played, or its volume, during times of day.
+	// The first entry containing the time a sound is played applies.
+	Schedule []latestconfig.SoundScheduleConfig
+}
+
+// scheduled returns the sound to play instead of the one at path, and the
+// volume to play it at, at the given time.
+func (o *Options) scheduled(path string, now time.Time) (string, float64) {
+	for _, s := range o.Schedule {
+		if !s.Contains(now) {
+			continue
+		}
+
+		if s.File != "" {
+			path = s.File
+		}
+
+		if s.Volume != nil {
+			return path, *s.Volume
+		}
+
+		break
+	}
+
+	return path, o.Volume
+}
+
+// output is the audio output the speaker plays through.
+type output interface {
+	Init(sampleRate beep.SampleRate, bufferSize int) error
+	Play(s ...beep.Streamer)
+	Lock()
+	Unlock()
+	Close()
+}
+
+// speakerOutput plays through the audio output device.
+type speakerOutput struct{}
+
+func (speakerOutput) Init(sampleRate beep.SampleRate, bufferSize int) error {
+	return speaker.Init(sampleRate, bufferSize)
+}
+
+func (speakerOutput) Play(s ...beep.Streamer) { speaker.Play(s...) }
+func (speakerOutput) Lock()                   { speaker.Lock() }
+func (speakerOutput) Unlock()                 { speaker.Unlock() }
+func (speakerOutput) Close()                  { speaker.Close() }
+
+// out is the output sounds are played through, replaced in tests.
+var out output = speakerOutput{}
+
+// speakerMu guards speakerUsers, the number of players using the speaker.
+// The speaker is global, so it is initialized by the first player and
+// closed once the last player is closed.
+var (
+	speakerMu    sync.Mutex
+	speakerUsers int
+	// speakerBufferSize is the length of the speaker's buffer, set by the
+	// first player.
+	speakerBufferSize time.Duration
+)
+
+// Player plays sound files.
+type Player struct {
+	mu   sync.Mutex
+	opts Options
+	// playing holds the volume effects of the sounds that are playing. They
+	// must only be modified while the speaker is locked.
+	playing map[*effects.Volume]struct{}
+	// bufferSize is the length of the speaker's buffer.
+	bufferSize time.Duration
+	// buffers holds the preloaded sounds, decoded and resampled, by path.
+	buffers map[string]*beep.Buffer
+	// others lowers the volume of other applications.
+	others *ducker
+}
+
+// NewPlayer initializes the speaker (unless another player already has) and
+// returns a player with the given options. Players share the speaker, so its
+// output device and buffer size are those of the first player.
+func NewPlayer(opts Options) (*Player, error) {
+	speakerMu.Lock()
+	defer speakerMu.Unlock()
+
+	if speakerUsers == 0 {
+		// The output device can only be chosen before the speaker is
+		// initialized, later changes move the speaker's stream instead.
+		if opts.Device != "" {
+			selectDevice(opts.Device)
+		}
+
+		bufferSize := opts.BufferSize
+		if bufferSize <= 0 {
+			bufferSize = DefaultBufferSize
+		}
+
+		if err := out.Init(sampleRate, sampleRate.N(bufferSize)); err != nil {
+			return nil, fmt.Errorf("failed to initialize speaker: %w", err)
+		}
+
+		speakerBufferSize = bufferSize
+	}
+	speakerUsers++
+
+	return &Player{
+		opts:       opts,
+		playing:    make(map[*effects.Volume]struct{}),
+		bufferSize: speakerBufferSize,
+		buffers:    make(map[string]*beep.Buffer),
+		others:     newDucker(),
+	}, nil
+}
+
+// Latency returns how long it takes at most for a sound to be heard once it
+// starts playing, ie. the length of the speaker's buffer.
+func (p *Player) Latency() time.Duration {
+	return p.bufferSize
+}
+
+// Preload decodes the sounds at the given paths (an empty path being the
+// embedded doorbell sound) into memory, so they start playing without
+// delay. Previously preloaded sounds that aren't listed are dropped, so
+// sound files that have changed are decoded again. Sounds that are too long
+// to keep in memory are skipped.
+func (p *Player) Preload(paths ...string) error {
+	p.mu.Lock()
+	previous := p.buffers
+	p.mu.Unlock()
+
+	buffers := make(map[string]*beep.Buffer, len(paths))
+	seen := make(map[string]bool, len(paths))
+	var errs []error
+	for _, path := range paths {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		buf, err := load(path)
+		if err != nil {
+			errs = append(errs, err)
+			// Keep playing the previous version of a sound that can no
+			// longer be loaded.
+			buf = previous[path]
+		}
+
+		if buf != nil {
+			buffers[path] = buf
+		}
+	}
+
+	p.mu.Lock()
+	p.buffers = buffers
+	p.mu.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// Update changes the options of the player, moving the speaker to another
+// output device if it changed. The volume applies to sounds played from now
+// on.
+func (p *Player) Update(opts Options) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if opts.Device != p.opts.Device {
+		if err := moveToDevice(opts.Device); err != nil {
+			return fmt.Errorf("failed to change output device: %w", err)
+		}
+	}
+
+	p.opts = opts
+
+	return nil
+}
+
+// Close restores the volume of other applications, and closes the speaker
+// if no other player is using it.
+func (p *Player) Close() {
+	p.others.close()
+
+	speakerMu.Lock()
+	defer speakerMu.Unlock()
+
+	speakerUsers--
+	if speakerUsers == 0 {
+		out.Close()
+	}
+}
+
+// Play starts playing the MP3, WAV, OGG (Vorbis) or FLAC file at the given
+// path, or the embedded doorbell sound if no path is specified, unless the
+// schedule replaces it at this time of day. Preloaded sounds are played from
+// memory, others are decoded while they play.
+func (p *Player) Play(path string) error {
+	p.mu.Lock()
+	opts := p.opts
+	path, level := opts.scheduled(path, time.Now())
+	buf := p.buffers[path]
+	p.mu.Unlock()
+
+	var streamer beep.Streamer
+	closeFn := func() {}
+	if buf != nil {
+		streamer = buf.Streamer(0, buf.Len())
+	} else {
+		s, err := open(path)
+		if err != nil {
+			return err
+		}
+
+		streamer, closeFn = s, func() { _ = s.Close() }
+	}
+
+	volume := &effects.Volume{
+		Streamer: streamer,
+		Base:     2,
+		Volume:   math.Log2(level),
+		Silent:   level == 0,
+	}
+
+	out.Lock()
+	if len(p.playing) > 0 {
+		switch opts.WhilePlaying {
+		case WhilePlayingSkip:
+			out.Unlock()
+			closeFn()
+			return nil
+		case WhilePlayingDuck:
+			for playing := range p.playing {
+				playing.Volume -= duckVolume
+			}
+		}
+	}
+	p.playing[volume] = struct{}{}
+	out.Unlock()
+
+	duckOthers := opts.DuckOthers
+	if duckOthers {
+		p.others.add(1)
+	}
+
+	out.Play(beep.Seq(volume, beep.Callback(func() {
+		// Callbacks run with the speaker locked.
+		delete(p.playing, volume)
+		closeFn()
+
+		if duckOthers {
+			p.others.add(-1)
+		}
+	})))
+
+	return nil
+}
+
+// resampledStreamer is a decoded sound, resampled to the speaker's sample
+// rate.
+type resampledStreamer struct {
+	beep.Streamer
+	// length is the length of the sound, or zero if it is unknown.
+	length time.Duration
+	close  func() error
+}
+
+func (s *resampledStreamer) Close() error {
+	return s.close()
+}
+
+// open opens and decodes a sound file (or the embedded doorbell sound if
+// the path is empty), resampled to the speaker's sample rate.
+func open(path string) (*resampledStreamer, error) {
+	var f io.ReadCloser
+	var err error
+	if path != "" {
+		f, err = os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open sound file: %w", err)
+		}
+	} else {
+		path = "doorbell.mp3"
+		f, err = assets.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open embedded sound asset: %w", err)
+		}
+	}
+
+	s, format, err := decode(path, f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	rs := &resampledStreamer{
+		Streamer: s,
+		length:   format.SampleRate.D(s.Len()),
+		close: func() error {
+			return errors.Join(s.Close(), f.Close())
+		},
+	}
+	if format.SampleRate != sampleRate {
+		rs.Streamer = beep.Resample(4, format.SampleRate, sampleRate, s)
+	}
+
+	return rs, nil
+}
+
+// load decodes a sound file (or the embedded doorbell sound if the path is
+// empty) into memory. It returns nil if the sound is too long to keep in
+// memory.
+func load(path string) (*beep.Buffer, error) {
+	s, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	if s.length > maxBufferedLength {
+		return nil, nil
+	}
+
+	buf := beep.NewBuffer(beep.Format{SampleRate: sampleRate, NumChannels: 2, Precision: 2})
+	buf.Append(s)
+
+	return buf, nil
+}
+
+// decode decodes the sound file based on its extension.
+func decode(path string, f io.ReadCloser) (beep.StreamSeekCloser, beep.Format, error) {
+	var s beep.StreamSeekCloser
+	var format beep.Format
+	var err error
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".mp3":
+		s, format, err = mp3.Decode(f)
+	case ".wav":
+		s, format, err = wav.Decode(f)
+	case ".ogg":
+		s, format, err = vorbis.Decode(f)
+	case ".flac":
+		s, format, err = flac.Decode(f)
+	default:
+		return nil, beep.Format{}, fmt.Errorf("unsupported sound file format: %q", ext)
+	}
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("failed to decode sound file: %w", err)
+	}
+
+	return s, format, nil
+}
+
+// Backend returns the name of the audio API sounds are played through on
+// this platform.
+func Backend() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "alsa"
+	case "darwin":
+		return "coreaudio"
+	case "windows":
+		return "wasapi"
+	default:
+		return "unsupported"
+	}
+}
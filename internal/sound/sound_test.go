@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package sound
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/constants"
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+// nullOutput stands in for the audio output device. Like the speaker, it
+// pulls a buffer's worth of samples from the mixer each time the previous
+// buffer has played, and records when sounds start and stop being heard.
+type nullOutput struct {
+	mu    sync.Mutex
+	mixer beep.Mixer
+	stop  chan struct{}
+	done  chan struct{}
+	// heard receives when a sound starts being heard, and quiet when it
+	// stops.
+	heard chan time.Time
+	quiet chan struct{}
+}
+
+func newNullOutput() *nullOutput {
+	return &nullOutput{
+		heard: make(chan time.Time, 16),
+		quiet: make(chan struct{}, 16),
+	}
+}
+
+func (o *nullOutput) Init(sampleRate beep.SampleRate, bufferSize int) error {
+	o.stop = make(chan struct{})
+	o.done = make(chan struct{})
+
+	period := sampleRate.D(bufferSize)
+	samples := make([][2]float64, bufferSize)
+
+	go func() {
+		defer close(o.done)
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		var playing bool
+		for {
+			select {
+			case <-o.stop:
+				return
+			case <-ticker.C:
+			}
+
+			o.mu.Lock()
+			o.mixer.Stream(samples)
+			o.mu.Unlock()
+
+			// The samples are heard once the buffer they were streamed into
+			// has played.
+			sound := !silent(samples)
+			if sound && !playing {
+				o.heard <- time.Now().Add(period)
+			} else if !sound && playing {
+				o.quiet <- struct{}{}
+			}
+			playing = sound
+		}
+	}()
+
+	return nil
+}
+
+func (o *nullOutput) Play(s ...beep.Streamer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.mixer.Add(s...)
+}
+
+func (o *nullOutput) Lock()   { o.mu.Lock() }
+func (o *nullOutput) Unlock() { o.mu.Unlock() }
+
+func (o *nullOutput) Close() {
+	close(o.stop)
+	<-o.done
+}
+
+func silent(samples [][2]float64) bool {
+	for _, s := range samples {
+		if s[0] != 0 || s[1] != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeTone writes a WAV file of a constant tone, which is heard from its
+// first sample.
+func writeTone(t *testing.T, length time.Duration) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tone.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	format := beep.Format{SampleRate: sampleRate, NumChannels: 2, Precision: 2}
+	tone := beep.Take(format.SampleRate.N(length), beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		for i := range samples {
+			samples[i] = [2]float64{0.5, 0.5}
+		}
+
+		return len(samples), true
+	}))
+
+	if err := wav.Encode(f, tone, format); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// TestPlayLatency checks that a preloaded sound is heard within the
+// doorbell's latency budget of it being played, with the default buffer
+// size.
+func TestPlayLatency(t *testing.T) {
+	o := newNullOutput()
+	out = o
+	t.Cleanup(func() { out = speakerOutput{} })
+
+	path := writeTone(t, 50*time.Millisecond)
+
+	p, err := NewPlayer(Options{Volume: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Preload(path); err != nil {
+		t.Fatal(err)
+	}
+
+	var worst time.Duration
+	for i := 0; i < 10; i++ {
+		played := time.Now()
+		if err := p.Play(path); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case heard := <-o.heard:
+			worst = max(worst, heard.Sub(played))
+		case <-time.After(time.Second):
+			t.Fatal("the sound wasn't heard")
+		}
+
+		select {
+		case <-o.quiet:
+		case <-time.After(time.Second):
+			t.Fatal("the sound didn't finish")
+		}
+	}
+
+	t.Logf("worst latency of %s with a %s buffer", worst, p.Latency())
+
+	if worst > constants.SoundLatencyBudget {
+		t.Errorf("preloaded sound was heard %s after playing it, over the budget of %s", worst, constants.SoundLatencyBudget)
+	}
+}
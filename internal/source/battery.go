@@ -0,0 +1,136 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package source
+
+import "encoding/binary"
+
+const (
+	// BatteryServiceUUID is the standard Battery Service, whose service data
+	// is the battery level.
+	BatteryServiceUUID = "0000180f-0000-1000-8000-00805f9b34fb"
+	// EnvironmentalSensingServiceUUID is the service UUID that the ATC1441
+	// and pvvx custom firmwares of Xiaomi thermometers advertise their
+	// readings as service data of.
+	EnvironmentalSensingServiceUUID = "0000181a-0000-1000-8000-00805f9b34fb"
+	// MiBeaconServiceUUID is the service UUID that Xiaomi devices advertise
+	// MiBeacon frames as service data of.
+	MiBeaconServiceUUID = "0000fe95-0000-1000-8000-00805f9b34fb"
+)
+
+// miBeaconBatteryObject is the MiBeacon object type of battery levels.
+const miBeaconBatteryObject = 0x100a
+
+// ParseBattery parses the battery level (in percent) from service data
+// advertised with the given (normalized) service UUID. It supports the
+// standard Battery Service, the ATC1441 and pvvx thermometer formats and
+// unencrypted Xiaomi MiBeacon frames. It returns false if the data doesn't
+// contain a battery level.
+func ParseBattery(serviceUUID string, data []byte) (int, bool) {
+	var level int
+	switch serviceUUID {
+	case BatteryServiceUUID:
+		if len(data) < 1 {
+			return 0, false
+		}
+		level = int(data[0])
+	case EnvironmentalSensingServiceUUID:
+		switch {
+		// ATC1441: MAC (6), temperature (2), humidity (1), battery level (1),
+		// battery voltage (2), counter (1).
+		case len(data) == 13:
+			level = int(data[9])
+		// pvvx: MAC (6), temperature (2), humidity (2), battery voltage (2),
+		// battery level (1), counter (1), flags (1).
+		case len(data) >= 15:
+			level = int(data[12])
+		default:
+			return 0, false
+		}
+	case MiBeaconServiceUUID:
+		var ok bool
+		level, ok = parseMiBeaconBattery(data)
+		if !ok {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	if level > 100 {
+		return 0, false
+	}
+
+	return level, true
+}
+
+// parseMiBeaconBattery returns the battery level object of an unencrypted
+// MiBeacon frame, if it has one.
+func parseMiBeaconBattery(data []byte) (int, bool) {
+	// Frame control (2), product ID (2), frame counter (1).
+	if len(data) < 5 {
+		return 0, false
+	}
+
+	frameControl := binary.LittleEndian.Uint16(data)
+	if frameControl&0x0008 != 0 || frameControl&0x0040 == 0 {
+		// Encrypted, or without objects.
+		return 0, false
+	}
+
+	data = data[5:]
+	if frameControl&0x0010 != 0 {
+		// MAC address.
+		if len(data) < 6 {
+			return 0, false
+		}
+		data = data[6:]
+	}
+
+	if frameControl&0x0020 != 0 {
+		// Capability, followed by the I/O capability if it is flagged.
+		if len(data) < 1 {
+			return 0, false
+		}
+		skip := 1
+		if data[0]&0x20 != 0 {
+			skip += 2
+		}
+		if len(data) < skip {
+			return 0, false
+		}
+		data = data[skip:]
+	}
+
+	// Objects: type (2), length (1), value.
+	for len(data) >= 3 {
+		objectType := binary.LittleEndian.Uint16(data)
+		length := int(data[2])
+		if len(data) < 3+length {
+			return 0, false
+		}
+
+		if objectType == miBeaconBatteryObject && length >= 1 {
+			return int(data[3]), true
+		}
+
+		data = data[3+length:]
+	}
+
+	return 0, false
+}
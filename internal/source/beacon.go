@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package source
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// appleCompanyID is the Bluetooth SIG company identifier used by
+	// iBeacon manufacturer data.
+	appleCompanyID = 0x004c
+	// EddystoneServiceUUID is the 16-bit service UUID that Eddystone frames
+	// are advertised as service data of.
+	EddystoneServiceUUID = "0000feaa-0000-1000-8000-00805f9b34fb"
+)
+
+// IBeacon is the identity advertised by an Apple iBeacon.
+type IBeacon struct {
+	// UUID is the proximity UUID in canonical lowercase form.
+	UUID string
+	// Major is the major identifier.
+	Major uint16
+	// Minor is the minor identifier.
+	Minor uint16
+}
+
+// Eddystone is the identity advertised in an Eddystone-UID frame.
+type Eddystone struct {
+	// Namespace is the 10-byte namespace as lowercase hex.
+	Namespace string
+	// Instance is the 6-byte instance as lowercase hex.
+	Instance string
+}
+
+// ParseIBeacon parses iBeacon manufacturer data (excluding the company ID).
+// Nil is returned if the data is not an iBeacon advertisement.
+func ParseIBeacon(companyID uint16, data []byte) *IBeacon {
+	// Type (0x02), length (0x15), UUID (16), major (2), minor (2), TX power (1).
+	if companyID != appleCompanyID || len(data) < 22 || data[0] != 0x02 || data[1] != 0x15 {
+		return nil
+	}
+
+	return &IBeacon{
+		UUID:  formatUUID(data[2:18]),
+		Major: binary.BigEndian.Uint16(data[18:20]),
+		Minor: binary.BigEndian.Uint16(data[20:22]),
+	}
+}
+
+// ParseEddystone parses Eddystone service data. Nil is returned if the data
+// is not an Eddystone-UID frame.
+func ParseEddystone(data []byte) *Eddystone {
+	// Frame type (0x00), TX power (1), namespace (10), instance (6).
+	if len(data) < 18 || data[0] != 0x00 {
+		return nil
+	}
+
+	return &Eddystone{
+		Namespace: hex.EncodeToString(data[2:12]),
+		Instance:  hex.EncodeToString(data[12:18]),
+	}
+}
+
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return fmt.Sprintf("%s-%s-%s-%s-%s", s[0:8], s[8:12], s[12:16], s[16:20], s[20:32])
+}
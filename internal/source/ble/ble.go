@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ble
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"tinygo.org/x/bluetooth"
+)
+
+var _ source.Source = (*Source)(nil)
+
+// Source receives beacons by scanning for advertisements using the host's
+// Bluetooth adapter.
+type Source struct {
+	adapter      *bluetooth.Adapter
+	serviceUUIDs map[string]bluetooth.UUID
+	buttons      map[string]*button
+}
+
+// New creates a new local BLE scanner beacon source. Advertisements are
+// checked for the given (normalized) service UUIDs, and the devices with the
+// given (normalized) MAC addresses are connected to in order to listen for
+// button presses.
+func New(serviceUUIDs, buttonMACs []string) (*Source, error) {
+	s := &Source{
+		adapter:      bluetooth.DefaultAdapter,
+		serviceUUIDs: make(map[string]bluetooth.UUID, len(serviceUUIDs)),
+		buttons:      make(map[string]*button, len(buttonMACs)),
+	}
+
+	for _, mac := range buttonMACs {
+		s.buttons[mac] = &button{mac: mac}
+	}
+
+	for _, uuidStr := range serviceUUIDs {
+		uuid, err := bluetooth.ParseUUID(uuidStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse service UUID %q: %w", uuidStr, err)
+		}
+
+		s.serviceUUIDs[uuidStr] = uuid
+	}
+
+	return s, nil
+}
+
+func (s *Source) Run(ctx context.Context, beacons chan<- source.Beacon) error {
+	if err := s.adapter.Enable(); err != nil {
+		return fmt.Errorf("failed to enable bluetooth adapter: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		if err := s.adapter.StopScan(); err != nil {
+			slog.Warn("Failed to stop bluetooth scan", slog.Any("error", err))
+		}
+	}()
+
+	slog.Info("Scanning for bluetooth devices")
+
+	err := s.adapter.Scan(func(_ *bluetooth.Adapter, result bluetooth.ScanResult) {
+		b := source.Beacon{
+			MAC:    result.Address.String(),
+			RSSI:   int(result.RSSI),
+			Name:   result.LocalName(),
+			Origin: "bluetooth",
+		}
+
+		for _, md := range result.ManufacturerData() {
+			if ib := source.ParseIBeacon(md.CompanyID, md.Data); ib != nil {
+				b.IBeacon = ib
+				break
+			}
+		}
+
+		for _, sd := range result.ServiceData() {
+			uuid := sd.UUID.String()
+			if uuid == source.EddystoneServiceUUID && b.Eddystone == nil {
+				b.Eddystone = source.ParseEddystone(sd.Data)
+			}
+
+			if level, ok := source.ParseBattery(uuid, sd.Data); ok && b.Battery == nil {
+				b.Battery = &level
+			}
+		}
+
+		for uuidStr, uuid := range s.serviceUUIDs {
+			if result.HasServiceUUID(uuid) {
+				b.ServiceUUIDs = append(b.ServiceUUIDs, uuidStr)
+			}
+		}
+
+		if btn, ok := s.buttons[b.MAC]; ok {
+			btn.advertised(ctx, s.adapter, result.Address, beacons)
+		}
+
+		select {
+		case beacons <- b:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to scan for bluetooth devices: %w", err)
+	}
+
+	return ctx.Err()
+}
+
+// CheckAdapter enables the host's Bluetooth adapter, returning an error if it
+// isn't available.
+func CheckAdapter() error {
+	if err := bluetooth.DefaultAdapter.Enable(); err != nil {
+		return fmt.Errorf("failed to enable bluetooth adapter: %w", err)
+	}
+
+	return nil
+}
+
+// Backend returns the name of the Bluetooth stack used to scan for devices on
+// this platform.
+func Backend() string {
+	switch runtime.GOOS {
+	case "linux":
+		return "bluez"
+	case "darwin":
+		return "corebluetooth"
+	case "windows":
+		return "winrt"
+	default:
+		return "unsupported"
+	}
+}
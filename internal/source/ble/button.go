@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package ble
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"tinygo.org/x/bluetooth"
+)
+
+// minReconnectInterval is the minimum time between connection attempts to a
+// button device.
+const minReconnectInterval = 10 * time.Second
+
+var (
+	// iTag style keyfinders notify button presses on this characteristic.
+	buttonServiceUUID        = bluetooth.New16BitUUID(0xffe0)
+	buttonCharacteristicUUID = bluetooth.New16BitUUID(0xffe1)
+)
+
+// button tracks the connection to a keyfinder tag with a button.
+type button struct {
+	mac string
+
+	mu          sync.Mutex
+	connecting  bool
+	lastAttempt time.Time
+}
+
+// advertised is called when an advertisement is received from the button
+// device. Keyfinders stop advertising while connected, so an advertisement
+// means we need to (re)connect.
+func (btn *button) advertised(ctx context.Context, adapter *bluetooth.Adapter, addr bluetooth.Address, beacons chan<- source.Beacon) {
+	btn.mu.Lock()
+	defer btn.mu.Unlock()
+
+	if btn.connecting || time.Since(btn.lastAttempt) < minReconnectInterval {
+		return
+	}
+
+	btn.connecting = true
+	btn.lastAttempt = time.Now()
+
+	// Connecting blocks, so it can't be done from within the scan callback.
+	go func() {
+		defer func() {
+			btn.mu.Lock()
+			btn.connecting = false
+			btn.mu.Unlock()
+		}()
+
+		if err := btn.connect(ctx, adapter, addr, beacons); err != nil {
+			slog.Warn("Failed to connect to button device",
+				slog.String("mac", btn.mac), slog.Any("error", err))
+		}
+	}()
+}
+
+func (btn *button) connect(ctx context.Context, adapter *bluetooth.Adapter, addr bluetooth.Address, beacons chan<- source.Beacon) error {
+	slog.Debug("Connecting to button device", slog.String("mac", btn.mac))
+
+	device, err := adapter.Connect(addr, bluetooth.ConnectionParams{})
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+
+	services, err := device.DiscoverServices([]bluetooth.UUID{buttonServiceUUID})
+	if err != nil || len(services) == 0 {
+		_ = device.Disconnect()
+		return errors.Join(errors.New("failed to discover button service"), err)
+	}
+
+	chars, err := services[0].DiscoverCharacteristics([]bluetooth.UUID{buttonCharacteristicUUID})
+	if err != nil || len(chars) == 0 {
+		_ = device.Disconnect()
+		return errors.Join(errors.New("failed to discover button characteristic"), err)
+	}
+
+	if err := chars[0].EnableNotifications(func(_ []byte) {
+		select {
+		case beacons <- source.Beacon{MAC: btn.mac, Button: true, Origin: "bluetooth"}:
+		case <-ctx.Done():
+		}
+	}); err != nil {
+		_ = device.Disconnect()
+		return fmt.Errorf("failed to enable button notifications: %w", err)
+	}
+
+	slog.Info("Listening for button presses", slog.String("mac", btn.mac))
+
+	go func() {
+		<-ctx.Done()
+		_ = device.Disconnect()
+	}()
+
+	return nil
+}
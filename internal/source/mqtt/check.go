@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"fmt"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// samplePayloads are example beacons in each payload format, used to check
+// that subscriptions are able to decode messages.
+var samplePayloads = map[latestconfig.PayloadFormat]string{
+	latestconfig.PayloadFormatRaw:             "AA:BB:CC:DD:EE:FF",
+	latestconfig.PayloadFormatJSON:            `{"mac":"AA:BB:CC:DD:EE:FF","rssi":-60}`,
+	latestconfig.PayloadFormatOpenMQTTGateway: `{"id":"AA:BB:CC:DD:EE:FF","rssi":-60}`,
+	latestconfig.PayloadFormatESPHome:         `{"address":"AA:BB:CC:DD:EE:FF","rssi":-60}`,
+}
+
+// CheckConnection connects to the broker and disconnects again, returning an
+// error if the broker can't be reached.
+func CheckConnection(conf latestconfig.BrokerConfig) error {
+	client, err := connect(context.Background(), conf, connectOptions{})
+	if err != nil {
+		return err
+	}
+	client.Disconnect()
+
+	return nil
+}
+
+// CheckTopic decodes (and if required decrypts) a sample beacon in the
+// payload format of the given topic.
+func CheckTopic(conf latestconfig.BrokerConfig, t latestconfig.TopicConfig) error {
+	decode, err := getDecoder(t.PayloadFormat)
+	if err != nil {
+		return err
+	}
+
+	payload := []byte(samplePayloads[t.PayloadFormat])
+	if t.Encrypted {
+		key, err := parseKey(conf.EncryptionKey)
+		if err != nil {
+			return err
+		}
+
+		sealed, err := seal(key, payload)
+		if err != nil {
+			return err
+		}
+
+		payload, err = unseal(key, sealed)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := decode(payload)
+	if err != nil {
+		return err
+	}
+
+	if b.MAC != "AA:BB:CC:DD:EE:FF" {
+		return fmt.Errorf("decoded unexpected MAC address: %q", b.MAC)
+	}
+
+	return nil
+}
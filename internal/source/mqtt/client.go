@@ -0,0 +1,270 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/secret"
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Status is the state of the connection to the MQTT broker.
+type Status struct {
+	// Connected is true if the connection is up.
+	Connected bool
+	// Reconnecting is true if the connection is down and is being retried.
+	Reconnecting bool
+	// Err is why the connection is down, if known.
+	Err error
+	// Address is the address of the broker that is connected to, or is
+	// being connected to.
+	Address string
+	// Brokers holds the status of the broker and each of its fallbacks, in
+	// order of priority, if fallbacks are configured.
+	Brokers []BrokerStatus
+}
+
+// BrokerStatus is the state of the connection to one of several brokers.
+type BrokerStatus struct {
+	// Address is the address of the broker.
+	Address string
+	// Connected is true if the connection to the broker is up.
+	Connected bool
+	// Err is why the broker couldn't be reached, if known.
+	Err error
+}
+
+// conn is a connection to an MQTT broker, using either MQTT 3.1.1 or MQTT 5.
+type conn interface {
+	// Subscribe subscribes to a topic, calling the subscription's handler
+	// with every message published to it.
+	Subscribe(sub subscription) error
+	// Publish publishes a message, returning once it has been sent (or
+	// acknowledged, for QoS 1 and 2). Retained messages are kept by the
+	// broker, and sent to later subscribers.
+	Publish(ctx context.Context, topic string, qos byte, retain bool, payload []byte) error
+	// Disconnect closes the connection.
+	Disconnect()
+}
+
+// subscription is a topic subscription, made whenever the client connects.
+type subscription struct {
+	topic string
+	qos   byte
+	// userProperties are sent with the subscription (MQTT 5 only).
+	userProperties map[string]string
+	handler        func(topic string, payload []byte)
+}
+
+// connectOptions configures how connect connects to the broker.
+type connectOptions struct {
+	// retry keeps retrying the initial connection (at the configured connect
+	// retry interval) until the context is cancelled, rather than returning
+	// an error.
+	retry bool
+	// onConnect, if not nil, is called whenever the connection is
+	// established (eg. to subscribe to topics).
+	onConnect func(c conn)
+	// onStatus, if not nil, is called whenever the connection is
+	// established or lost.
+	onStatus func(status Status)
+	// clientIDSuffix is appended to the client ID, so that a second
+	// connection doesn't take over the session of the first.
+	clientIDSuffix string
+}
+
+// credentials identify the client to the broker.
+type credentials struct {
+	clientID string
+	username string
+	password string
+}
+
+// dial is how the source connects to a broker, replaced in tests.
+var dial = connect
+
+// connect creates a new MQTT client and connects it to the configured broker.
+func connect(ctx context.Context, conf latestconfig.BrokerConfig, copts connectOptions) (conn, error) {
+	var err error
+	instance := conf.Instance
+	if instance == "" {
+		if instance, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get hostname: %w", err)
+		}
+	}
+
+	password := conf.Password
+	if conf.PasswordFrom == latestconfig.SecretSourceKeyring {
+		password, err = secret.Get(secret.BrokerPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get broker password: %w", err)
+		}
+	}
+
+	// Persistent sessions are identified by the client ID, so it must be
+	// stable across restarts.
+	clientID := conf.ClientID
+	if clientID == "" {
+		if *conf.CleanSession {
+			clientID = fmt.Sprintf("%s-%d", instance, os.Getpid())
+		} else {
+			clientID = "cat-doorbell-" + instance
+		}
+	}
+	clientID += copts.clientIDSuffix
+
+	var tlsConf *tls.Config
+	if conf.TLS != nil {
+		tlsConf, err = newTLSConfig(conf.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if conf.Proxy != "" {
+		proxyURL, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy URL: %w", err)
+		}
+
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	if copts.onStatus == nil {
+		copts.onStatus = func(Status) {}
+	}
+
+	creds := credentials{clientID: clientID, username: conf.Username, password: password}
+	if conf.ProtocolVersion == latestconfig.ProtocolVersion5 {
+		return connectV5(ctx, conf, creds, tlsConf, proxy, copts)
+	}
+
+	return connectV311(ctx, conf, creds, tlsConf, proxy, copts)
+}
+
+// v311Conn is a connection to an MQTT 3.1.1 broker.
+type v311Conn struct {
+	client paho.Client
+}
+
+// connectV311 connects to the broker using MQTT 3.1.1.
+func connectV311(ctx context.Context, conf latestconfig.BrokerConfig, creds credentials,
+	tlsConf *tls.Config, proxy func(*http.Request) (*url.URL, error), copts connectOptions) (conn, error) {
+	opts := paho.NewClientOptions().
+		AddBroker(conf.Address).
+		SetClientID(creds.clientID).
+		SetUsername(creds.username).
+		SetPassword(creds.password).
+		SetAutoReconnect(*conf.AutoReconnect).
+		SetMaxReconnectInterval(conf.ConnectRetryInterval).
+		SetKeepAlive(conf.KeepAlive).
+		SetCleanSession(*conf.CleanSession).
+		SetOrderMatters(*conf.OrderMatters).
+		SetWebsocketOptions(&paho.WebsocketOptions{Proxy: proxy})
+
+	if tlsConf != nil {
+		opts.SetTLSConfig(tlsConf)
+	}
+
+	onStatus := copts.onStatus
+
+	opts.OnConnect = func(client paho.Client) {
+		slog.Info("Connected to MQTT broker", slog.String("address", conf.Address))
+		onStatus(Status{Connected: true, Address: conf.Address})
+
+		if copts.onConnect != nil {
+			copts.onConnect(&v311Conn{client: client})
+		}
+	}
+
+	opts.OnConnectionLost = func(_ paho.Client, err error) {
+		slog.Warn("Lost connection to MQTT broker",
+			slog.String("address", conf.Address), slog.Any("error", err), slog.Bool("reconnecting", *conf.AutoReconnect))
+		onStatus(Status{Reconnecting: *conf.AutoReconnect, Err: err, Address: conf.Address})
+	}
+
+	opts.OnReconnecting = func(paho.Client, *paho.ClientOptions) {
+		slog.Info("Reconnecting to MQTT broker", slog.String("address", conf.Address))
+	}
+
+	client := paho.NewClient(opts)
+	for {
+		token := client.Connect()
+		select {
+		case <-token.Done():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		err := token.Error()
+		if err == nil {
+			return &v311Conn{client: client}, nil
+		}
+
+		if !copts.retry {
+			return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+		}
+
+		slog.Warn("Failed to connect to MQTT broker, retrying",
+			slog.String("address", conf.Address), slog.Any("error", err),
+			slog.Duration("retryInterval", conf.ConnectRetryInterval))
+		onStatus(Status{Reconnecting: true, Err: err, Address: conf.Address})
+
+		select {
+		case <-time.After(conf.ConnectRetryInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *v311Conn) Subscribe(sub subscription) error {
+	token := c.client.Subscribe(sub.topic, sub.qos, func(_ paho.Client, msg paho.Message) {
+		sub.handler(msg.Topic(), msg.Payload())
+	})
+	if token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	return nil
+}
+
+func (c *v311Conn) Publish(ctx context.Context, topic string, qos byte, retain bool, payload []byte) error {
+	token := c.client.Publish(topic, qos, retain, payload)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *v311Conn) Disconnect() {
+	c.client.Disconnect(250)
+}
@@ -0,0 +1,269 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/gorilla/websocket"
+)
+
+// subscribeTimeout is how long to wait for the broker to acknowledge a
+// subscription.
+const subscribeTimeout = 10 * time.Second
+
+// v5Conn is a connection to an MQTT 5 broker.
+type v5Conn struct {
+	router *paho.StandardRouter
+	// orderMatters handles messages one at a time, in the order they were
+	// received.
+	orderMatters bool
+
+	mu sync.Mutex
+	cm *autopaho.ConnectionManager
+	// routed holds the topics whose messages are routed to a handler, as
+	// subscriptions are repeated on every connection.
+	routed map[string]bool
+}
+
+// connectV5 connects to the broker using MQTT 5. Like MQTT 3.1.1
+// connections, the connection is re-established when it is lost (if auto
+// reconnect is enabled).
+func connectV5(ctx context.Context, conf latestconfig.BrokerConfig, creds credentials,
+	tlsConf *tls.Config, proxy func(*http.Request) (*url.URL, error), copts connectOptions) (conn, error) {
+	address, err := url.Parse(conf.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse broker address: %w", err)
+	}
+
+	c := &v5Conn{
+		router:       paho.NewStandardRouter(),
+		orderMatters: *conf.OrderMatters,
+		routed:       make(map[string]bool),
+	}
+
+	onStatus := copts.onStatus
+
+	// The first connection either succeeds, or (unless retrying) its failure
+	// fails the connect call.
+	connected := make(chan struct{})
+	failed := make(chan error, 1)
+	var connectedOnce sync.Once
+	isConnected := func() bool {
+		select {
+		case <-connected:
+			return true
+		default:
+			return false
+		}
+	}
+
+	lost := func(err error) {
+		slog.Warn("Lost connection to MQTT broker",
+			slog.String("address", conf.Address), slog.Any("error", err), slog.Bool("reconnecting", *conf.AutoReconnect))
+		onStatus(Status{Reconnecting: *conf.AutoReconnect, Err: err, Address: conf.Address})
+
+		if !*conf.AutoReconnect {
+			go c.Disconnect()
+		}
+	}
+
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{address},
+		TlsCfg:                        tlsConf,
+		KeepAlive:                     uint16(conf.KeepAlive / time.Second),
+		CleanStartOnInitialConnection: *conf.CleanSession,
+		SessionExpiryInterval:         sessionExpiryInterval(conf),
+		ConnectRetryDelay:             conf.ConnectRetryInterval,
+		WebSocketCfg: &autopaho.WebSocketConfig{
+			Dialer: func(_ *url.URL, tlsConf *tls.Config) *websocket.Dialer {
+				d := *websocket.DefaultDialer
+				d.Proxy = proxy
+				d.TLSClientConfig = tlsConf
+				d.Subprotocols = []string{"mqtt"}
+				return &d
+			},
+		},
+		ConnectUsername: creds.username,
+		ConnectPassword: []byte(creds.password),
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+			slog.Info("Connected to MQTT broker",
+				slog.String("address", conf.Address), slog.String("protocolVersion", string(conf.ProtocolVersion)))
+			onStatus(Status{Connected: true, Address: conf.Address})
+
+			// This can be called before NewConnection returns.
+			c.setManager(cm)
+			connectedOnce.Do(func() { close(connected) })
+
+			if copts.onConnect != nil {
+				copts.onConnect(c)
+			}
+		},
+		OnConnectError: func(err error) {
+			if !copts.retry && !isConnected() {
+				select {
+				case failed <- err:
+				default:
+				}
+				return
+			}
+
+			slog.Warn("Failed to connect to MQTT broker, retrying",
+				slog.String("address", conf.Address), slog.Any("error", err),
+				slog.Duration("retryInterval", conf.ConnectRetryInterval))
+			onStatus(Status{Reconnecting: true, Err: err, Address: conf.Address})
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: creds.clientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					if c.orderMatters {
+						c.router.Route(pr.Packet.Packet())
+					} else {
+						go c.router.Route(pr.Packet.Packet())
+					}
+
+					return true, nil
+				},
+			},
+			OnClientError: lost,
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				err := fmt.Errorf("disconnected by broker (reason code %d)", d.ReasonCode)
+				if d.Properties != nil && d.Properties.ReasonString != "" {
+					err = fmt.Errorf("disconnected by broker: %s", d.Properties.ReasonString)
+				}
+
+				lost(err)
+			},
+		},
+	}
+
+	// The connection manager outlives the context, which only bounds the
+	// initial connection.
+	cm, err := autopaho.NewConnection(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	c.setManager(cm)
+
+	select {
+	case <-connected:
+		return c, nil
+	case err := <-failed:
+		c.Disconnect()
+		return nil, fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	case <-ctx.Done():
+		c.Disconnect()
+		return nil, ctx.Err()
+	}
+}
+
+// sessionExpiryInterval returns how long, in seconds, the broker should keep
+// the session after the connection is closed.
+func sessionExpiryInterval(conf latestconfig.BrokerConfig) uint32 {
+	if *conf.CleanSession {
+		return 0
+	}
+
+	// MQTT 3.1.1 sessions never expire, which is also the default for MQTT
+	// 5 sessions that aren't clean.
+	if conf.SessionExpiryInterval == 0 {
+		return math.MaxUint32
+	}
+
+	return uint32(min(conf.SessionExpiryInterval/time.Second, math.MaxUint32))
+}
+
+func (c *v5Conn) setManager(cm *autopaho.ConnectionManager) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cm = cm
+}
+
+func (c *v5Conn) manager() *autopaho.ConnectionManager {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cm
+}
+
+func (c *v5Conn) Subscribe(sub subscription) error {
+	c.mu.Lock()
+	if !c.routed[sub.topic] {
+		c.router.RegisterHandler(sub.topic, func(p *paho.Publish) {
+			sub.handler(p.Topic, p.Payload)
+		})
+		c.routed[sub.topic] = true
+	}
+	c.mu.Unlock()
+
+	s := &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: sub.topic, QoS: sub.qos}},
+	}
+
+	if len(sub.userProperties) > 0 {
+		s.Properties = &paho.SubscribeProperties{}
+
+		keys := make([]string, 0, len(sub.userProperties))
+		for k := range sub.userProperties {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			s.Properties.User.Add(k, sub.userProperties[k])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+
+	_, err := c.manager().Subscribe(ctx, s)
+	return err
+}
+
+func (c *v5Conn) Publish(ctx context.Context, topic string, qos byte, retain bool, payload []byte) error {
+	_, err := c.manager().Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		QoS:     qos,
+		Retain:  retain,
+		Payload: payload,
+	})
+	return err
+}
+
+func (c *v5Conn) Disconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	_ = c.manager().Disconnect(ctx)
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const nonceSize = 24
+
+// parseKey decodes a base64 encoded 256-bit pre-shared key.
+func parseKey(encoded string) (*[32]byte, error) {
+	keyBytes, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encryption key: %w", err)
+	}
+
+	if len(keyBytes) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(keyBytes))
+	}
+
+	var key [32]byte
+	copy(key[:], keyBytes)
+
+	return &key, nil
+}
+
+// seal encrypts and authenticates the given payload, prefixing it with a
+// random nonce.
+func seal(key *[32]byte, payload []byte) ([]byte, error) {
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return secretbox.Seal(nonce[:], payload, &nonce, key), nil
+}
+
+// unseal decrypts and authenticates a payload produced by seal.
+func unseal(key *[32]byte, box []byte) ([]byte, error) {
+	if len(box) < nonceSize+secretbox.Overhead {
+		return nil, errors.New("encrypted payload is too short")
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], box[:nonceSize])
+
+	payload, ok := secretbox.Open(nil, box[nonceSize:], &nonce, key)
+	if !ok {
+		return nil, errors.New("failed to decrypt payload")
+	}
+
+	return payload, nil
+}
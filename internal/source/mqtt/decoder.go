@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+)
+
+// decoder decodes an MQTT message payload into a beacon.
+type decoder func(payload []byte) (*source.Beacon, error)
+
+func getDecoder(format latestconfig.PayloadFormat) (decoder, error) {
+	switch format {
+	case latestconfig.PayloadFormatRaw:
+		return decodeRaw, nil
+	case latestconfig.PayloadFormatJSON, latestconfig.PayloadFormatOpenMQTTGateway, latestconfig.PayloadFormatESPHome:
+		return DecodeJSON, nil
+	default:
+		return nil, fmt.Errorf("unsupported payload format: %s", format)
+	}
+}
+
+func decodeRaw(payload []byte) (*source.Beacon, error) {
+	return &source.Beacon{MAC: source.NormalizePayload(payload)}, nil
+}
+
+// jsonBeacon is a superset of the fields published by OpenMQTTGateway
+// (BTtoMQTT) and ESPHome BLE trackers.
+type jsonBeacon struct {
+	MAC     string `json:"mac,omitempty"`
+	ID      string `json:"id,omitempty"`
+	Address string `json:"address,omitempty"`
+	RSSI    int    `json:"rssi,omitempty"`
+	Name    string `json:"name,omitempty"`
+	// ServiceUUIDs is only published by cat-doorbell's scanner mode.
+	ServiceUUIDs []string `json:"serviceUUIDs,omitempty"`
+	Button       bool     `json:"button,omitempty"`
+	// UUID, Major and Minor identify iBeacons (OpenMQTTGateway).
+	UUID  string `json:"uuid,omitempty"`
+	Major *int   `json:"major,omitempty"`
+	Minor *int   `json:"minor,omitempty"`
+	// Namespace and Instance identify Eddystone-UID beacons
+	// (OpenMQTTGateway).
+	Namespace string `json:"namespace,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	// ManufacturerData and ServiceData are the raw advertisement data, as
+	// hex, published by OpenMQTTGateway when it can't decode a beacon.
+	ManufacturerData string `json:"manufacturerdata,omitempty"`
+	ServiceData      string `json:"servicedata,omitempty"`
+	ServiceDataUUID  string `json:"servicedatauuid,omitempty"`
+	// Battery is the battery level in percent, published by OpenMQTTGateway
+	// for the sensors it decodes (and by scanner mode).
+	Battery *int `json:"batt,omitempty"`
+}
+
+// DecodeJSON decodes a beacon in the JSON payload format.
+func DecodeJSON(payload []byte) (*source.Beacon, error) {
+	var msg jsonBeacon
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON payload: %w", err)
+	}
+
+	b := source.Beacon{
+		MAC:    msg.MAC,
+		RSSI:   msg.RSSI,
+		Name:   msg.Name,
+		Button: msg.Button,
+	}
+
+	for _, uuid := range msg.ServiceUUIDs {
+		if normalized, err := util.NormalizeUUID(uuid); err == nil {
+			b.ServiceUUIDs = append(b.ServiceUUIDs, normalized)
+		}
+	}
+
+	b.IBeacon = msg.iBeacon()
+	b.Eddystone = msg.eddystone()
+	b.Battery = msg.battery()
+
+	if b.MAC == "" {
+		b.MAC = msg.ID
+	}
+	if b.MAC == "" {
+		b.MAC = msg.Address
+	}
+	if b.MAC == "" {
+		return nil, errors.New("payload does not contain a MAC address")
+	}
+
+	return &b, nil
+}
+
+// iBeacon returns the iBeacon identity in the message, either decoded by the
+// gateway or parsed from the raw manufacturer data.
+func (msg *jsonBeacon) iBeacon() *source.IBeacon {
+	if msg.UUID != "" && msg.Major != nil && msg.Minor != nil {
+		uuid, err := util.NormalizeUUID(msg.UUID)
+		if err != nil || *msg.Major < 0 || *msg.Major > 0xffff || *msg.Minor < 0 || *msg.Minor > 0xffff {
+			return nil
+		}
+
+		return &source.IBeacon{UUID: uuid, Major: uint16(*msg.Major), Minor: uint16(*msg.Minor)}
+	}
+
+	// The company ID is prefixed in little endian byte order.
+	data, err := hex.DecodeString(msg.ManufacturerData)
+	if err != nil || len(data) < 2 {
+		return nil
+	}
+
+	return source.ParseIBeacon(binary.LittleEndian.Uint16(data), data[2:])
+}
+
+// eddystone returns the Eddystone-UID identity in the message, either
+// decoded by the gateway or parsed from the raw service data.
+func (msg *jsonBeacon) eddystone() *source.Eddystone {
+	if msg.Namespace != "" {
+		return &source.Eddystone{
+			Namespace: strings.ToLower(strings.TrimPrefix(msg.Namespace, "0x")),
+			Instance:  strings.ToLower(strings.TrimPrefix(msg.Instance, "0x")),
+		}
+	}
+
+	if uuid, err := util.NormalizeUUID(strings.TrimPrefix(msg.ServiceDataUUID, "0x")); err != nil || uuid != source.EddystoneServiceUUID {
+		return nil
+	}
+
+	data, err := hex.DecodeString(msg.ServiceData)
+	if err != nil {
+		return nil
+	}
+
+	return source.ParseEddystone(data)
+}
+
+// battery returns the battery level in the message, either decoded by the
+// gateway or parsed from the raw service data.
+func (msg *jsonBeacon) battery() *int {
+	if msg.Battery != nil {
+		if *msg.Battery < 0 || *msg.Battery > 100 {
+			return nil
+		}
+
+		return msg.Battery
+	}
+
+	uuid, err := util.NormalizeUUID(strings.TrimPrefix(msg.ServiceDataUUID, "0x"))
+	if err != nil {
+		return nil
+	}
+
+	data, err := hex.DecodeString(msg.ServiceData)
+	if err != nil {
+		return nil
+	}
+
+	level, ok := source.ParseBattery(uuid, data)
+	if !ok {
+		return nil
+	}
+
+	return &level
+}
+
+// EncodeJSON encodes a beacon in the JSON payload format, as published by
+// scanner mode.
+func EncodeJSON(b *source.Beacon) ([]byte, error) {
+	msg := jsonBeacon{
+		MAC:          b.MAC,
+		RSSI:         b.RSSI,
+		Name:         b.Name,
+		ServiceUUIDs: b.ServiceUUIDs,
+		Button:       b.Button,
+		Battery:      b.Battery,
+	}
+
+	if b.IBeacon != nil {
+		major, minor := int(b.IBeacon.Major), int(b.IBeacon.Minor)
+		msg.UUID, msg.Major, msg.Minor = b.IBeacon.UUID, &major, &minor
+	}
+
+	if b.Eddystone != nil {
+		msg.Namespace, msg.Instance = b.Eddystone.Namespace, b.Eddystone.Instance
+	}
+
+	return json.Marshal(msg)
+}
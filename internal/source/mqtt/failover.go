@@ -0,0 +1,305 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"golang.org/x/sync/errgroup"
+)
+
+// duplicateWindow is how long a beacon received through one broker is
+// remembered for, to recognize copies of it received through other brokers.
+const duplicateWindow = 5 * time.Second
+
+// runFailover receives beacons from the first reachable broker, in order of
+// priority, failing over to the next broker when the connection is lost.
+// While connected to a fallback broker, the higher priority brokers are
+// checked every failback interval, and the connection fails back to the first
+// of them that is reachable.
+func (s *Source) runFailover(ctx context.Context, brokers []latestconfig.BrokerConfig, beacons chan<- source.Beacon) error {
+	tracker := newStatusTracker(brokers, true, s.reportStatus)
+
+	for {
+		var failedBack bool
+		for i, conf := range brokers {
+			// Fail over to the next broker when the connection is lost,
+			// rather than reconnecting to the same one.
+			autoReconnect := false
+			conf.AutoReconnect = &autoReconnect
+
+			update := tracker.updater(i)
+
+			var err error
+			failedBack, err = s.runFailoverBroker(ctx, brokers[:i], conf, beacons, update)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if failedBack {
+				update(Status{Address: conf.Address})
+				break
+			}
+
+			update(Status{Err: err, Address: conf.Address})
+
+			slog.Warn("Failing over from MQTT broker",
+				slog.String("address", conf.Address), slog.Any("error", err))
+		}
+
+		if failedBack {
+			continue
+		}
+
+		slog.Warn("Failed to connect to any MQTT broker, retrying",
+			slog.Duration("retryInterval", s.conf.ConnectRetryInterval))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.conf.ConnectRetryInterval):
+		}
+	}
+}
+
+// runFailoverBroker receives beacons from a broker until the connection is
+// lost, or one of the higher priority brokers becomes reachable (returning
+// true).
+func (s *Source) runFailoverBroker(ctx context.Context, higher []latestconfig.BrokerConfig, conf latestconfig.BrokerConfig,
+	beacons chan<- source.Beacon, onStatus func(status Status)) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var failedBack atomic.Bool
+	if len(higher) > 0 {
+		go func() {
+			if s.waitForFailback(ctx, higher) {
+				failedBack.Store(true)
+				cancel()
+			}
+		}()
+	}
+
+	err := s.runBroker(ctx, conf, false, beacons, onStatus)
+
+	return failedBack.Load(), err
+}
+
+// waitForFailback checks the given brokers every failback interval, until
+// one of them is reachable (returning true) or the context is cancelled.
+func (s *Source) waitForFailback(ctx context.Context, brokers []latestconfig.BrokerConfig) bool {
+	ticker := time.NewTicker(s.conf.FailbackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		for _, conf := range brokers {
+			client, err := connect(ctx, conf, connectOptions{})
+			if err != nil {
+				slog.Debug("Higher priority MQTT broker is still unreachable",
+					slog.String("address", conf.Address), slog.Any("error", err))
+				continue
+			}
+			client.Disconnect()
+
+			slog.Info("Failing back to MQTT broker", slog.String("address", conf.Address))
+
+			return true
+		}
+	}
+}
+
+// runAll receives beacons from every broker at once, dropping copies of
+// beacons received through more than one of them.
+func (s *Source) runAll(ctx context.Context, brokers []latestconfig.BrokerConfig, beacons chan<- source.Beacon) error {
+	tracker := newStatusTracker(brokers, false, s.reportStatus)
+	dedup := newDeduplicator(len(brokers))
+
+	g, ctx := errgroup.WithContext(ctx)
+	for i, conf := range brokers {
+		received := make(chan source.Beacon)
+
+		g.Go(func() error {
+			return s.runBroker(ctx, conf, true, received, tracker.updater(i))
+		})
+
+		g.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case b := <-received:
+					if dedup.duplicate(i, b, time.Now()) {
+						slog.Debug("Dropping beacon received through several brokers",
+							slog.String("mac", b.MAC), slog.String("address", conf.Address))
+						continue
+					}
+
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case beacons <- b:
+					}
+				}
+			}
+		})
+	}
+
+	return g.Wait()
+}
+
+// statusTracker combines the status of each of several brokers into the
+// status of the source.
+type statusTracker struct {
+	mu           sync.Mutex
+	brokers      []BrokerStatus
+	reconnecting []bool
+	// failover is true if the brokers are connected to one at a time, so
+	// the source is always reconnecting while none is connected.
+	failover bool
+	onStatus func(status Status)
+}
+
+func newStatusTracker(brokers []latestconfig.BrokerConfig, failover bool, onStatus func(status Status)) *statusTracker {
+	t := &statusTracker{
+		brokers:      make([]BrokerStatus, len(brokers)),
+		reconnecting: make([]bool, len(brokers)),
+		failover:     failover,
+		onStatus:     onStatus,
+	}
+	for i, conf := range brokers {
+		t.brokers[i].Address = conf.Address
+	}
+
+	return t
+}
+
+// updater returns the function the status of the i'th broker is reported
+// to.
+func (t *statusTracker) updater(i int) func(status Status) {
+	return func(status Status) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		t.brokers[i].Connected = status.Connected
+		t.brokers[i].Err = status.Err
+		t.reconnecting[i] = status.Reconnecting
+
+		combined := Status{
+			Address:      t.brokers[0].Address,
+			Reconnecting: t.failover || slices.Contains(t.reconnecting, true),
+			Brokers:      slices.Clone(t.brokers),
+		}
+		for _, b := range t.brokers {
+			if b.Connected {
+				combined = Status{Connected: true, Address: b.Address, Brokers: combined.Brokers}
+				break
+			}
+
+			if combined.Err == nil {
+				combined.Err = b.Err
+			}
+		}
+
+		t.onStatus(combined)
+	}
+}
+
+// beaconKey identifies identical beacons.
+type beaconKey struct {
+	mac     string
+	rssi    int
+	name    string
+	button  bool
+	battery int
+	origin  string
+}
+
+// copies counts the copies of a beacon received through each broker.
+type copies struct {
+	counts []int
+	last   time.Time
+}
+
+// deduplicator recognizes copies of beacons received through more than one
+// broker.
+type deduplicator struct {
+	mu      sync.Mutex
+	brokers int
+	seen    map[beaconKey]*copies
+	pruned  time.Time
+}
+
+func newDeduplicator(brokers int) *deduplicator {
+	return &deduplicator{
+		brokers: brokers,
+		seen:    make(map[beaconKey]*copies),
+	}
+}
+
+// duplicate returns whether a beacon received through the given broker is a
+// copy of one already received through another broker. Identical beacons
+// (eg. a device advertising the same thing twice) are only dropped once each
+// broker has delivered as many of them as the others.
+func (d *deduplicator) duplicate(broker int, b source.Beacon, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if now.Sub(d.pruned) >= duplicateWindow {
+		for key, c := range d.seen {
+			if now.Sub(c.last) >= duplicateWindow {
+				delete(d.seen, key)
+			}
+		}
+		d.pruned = now
+	}
+
+	key := beaconKey{mac: b.MAC, rssi: b.RSSI, name: b.Name, button: b.Button, battery: -1, origin: b.Origin}
+	if b.Battery != nil {
+		key.battery = *b.Battery
+	}
+
+	c, ok := d.seen[key]
+	if !ok || now.Sub(c.last) >= duplicateWindow {
+		c = &copies{counts: make([]int, d.brokers)}
+		d.seen[key] = c
+	}
+	c.last = now
+	c.counts[broker]++
+
+	for i, n := range c.counts {
+		if i != broker && n >= c.counts[broker] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// errFaultDisconnect is why the connection was lost, when it was disconnected
+// by an injected fault.
+var errFaultDisconnect = errors.New("disconnected by fault injection")
+
+// Faults injects faults into the connection to the broker, so the doorbell's
+// resilience can be exercised without breaking the broker or the network. A
+// nil Faults injects nothing.
+type Faults struct {
+	mu sync.Mutex
+	// disconnect is closed (and replaced) to disconnect from the broker.
+	disconnect chan struct{}
+	drop       int
+	latency    time.Duration
+}
+
+// FaultState describes the faults being injected.
+type FaultState struct {
+	// Drop is how many more received messages will be dropped.
+	Drop int
+	// Latency is how long each received message is delayed before it is
+	// handled.
+	Latency time.Duration
+}
+
+// NewFaults creates a new fault injector, initially injecting no faults.
+func NewFaults() *Faults {
+	return &Faults{disconnect: make(chan struct{})}
+}
+
+// Disconnect drops the connection to the broker(s), as if it was lost. The
+// connection is re-established after the connect retry interval if auto
+// reconnect is enabled, otherwise the next broker is failed over to.
+func (f *Faults) Disconnect() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	close(f.disconnect)
+	f.disconnect = make(chan struct{})
+}
+
+// Drop drops the next n received messages.
+func (f *Faults) Drop(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.drop = max(n, 0)
+}
+
+// SetLatency delays each received message by the given duration before it is
+// handled (zero for no delay).
+func (f *Faults) SetLatency(latency time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.latency = max(latency, 0)
+}
+
+// State returns the faults being injected.
+func (f *Faults) State() FaultState {
+	if f == nil {
+		return FaultState{}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return FaultState{Drop: f.drop, Latency: f.latency}
+}
+
+// disconnected returns a channel that is closed when the connection should be
+// dropped.
+func (f *Faults) disconnected() <-chan struct{} {
+	if f == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.disconnect
+}
+
+// wrap returns a message handler that injects the configured faults before
+// calling the given handler.
+func (f *Faults) wrap(ctx context.Context, handler func(topic string, payload []byte)) func(topic string, payload []byte) {
+	if f == nil {
+		return handler
+	}
+
+	return func(topic string, payload []byte) {
+		f.mu.Lock()
+		dropped := f.drop > 0
+		if dropped {
+			f.drop--
+		}
+		latency := f.latency
+		f.mu.Unlock()
+
+		if dropped {
+			slog.Debug("Dropped MQTT message by fault injection", slog.String("topic", topic))
+			return
+		}
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		handler(topic, payload)
+	}
+}
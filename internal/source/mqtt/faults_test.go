@@ -0,0 +1,327 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/control"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+)
+
+const beaconTopic = "doorbell/beacons"
+
+// fakeConn is a connection to a fake broker, which delivers the messages it
+// is given to the subscribed handlers.
+type fakeConn struct {
+	mu           sync.Mutex
+	subs         []subscription
+	disconnected bool
+}
+
+func (c *fakeConn) Subscribe(sub subscription) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.subs = append(c.subs, sub)
+	return nil
+}
+
+func (c *fakeConn) Publish(context.Context, string, byte, bool, []byte) error {
+	return nil
+}
+
+func (c *fakeConn) Disconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.disconnected = true
+}
+
+// deliver delivers a message as if it was published to the broker, returning
+// once it has been handled.
+func (c *fakeConn) deliver(topic string, payload string) {
+	c.mu.Lock()
+	subs := c.subs
+	disconnected := c.disconnected
+	c.mu.Unlock()
+
+	if disconnected {
+		return
+	}
+
+	for _, sub := range subs {
+		if sub.topic == topic {
+			sub.handler(topic, []byte(payload))
+		}
+	}
+}
+
+func (c *fakeConn) isDisconnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.disconnected
+}
+
+// faultDoorbell injects faults requested over the control socket, the way
+// the doorbell does in developer mode.
+type faultDoorbell struct {
+	control.Doorbell
+	faults *Faults
+}
+
+func (d *faultDoorbell) InjectFaults(injection control.FaultInjection) (control.Faults, error) {
+	if d.faults == nil {
+		return control.Faults{}, control.ErrDeveloperMode
+	}
+
+	if injection.Drop != nil {
+		d.faults.Drop(*injection.Drop)
+	}
+
+	if injection.Latency != nil {
+		d.faults.SetLatency(*injection.Latency)
+	}
+
+	if injection.Disconnect {
+		d.faults.Disconnect()
+	}
+
+	state := d.faults.State()
+	return control.Faults{Drop: state.Drop, Latency: state.Latency}, nil
+}
+
+// faultHarness is a source connected to a fake broker, with faults injected
+// over the control socket.
+type faultHarness struct {
+	client   *control.Client
+	conns    chan *fakeConn
+	beacons  chan source.Beacon
+	statuses chan Status
+}
+
+func startFaultHarness(t *testing.T, faults *Faults) *faultHarness {
+	t.Helper()
+
+	h := &faultHarness{
+		conns:    make(chan *fakeConn, 4),
+		beacons:  make(chan source.Beacon, 16),
+		statuses: make(chan Status, 16),
+	}
+
+	dial = func(_ context.Context, _ latestconfig.BrokerConfig, copts connectOptions) (conn, error) {
+		c := &fakeConn{}
+		copts.onConnect(c)
+		copts.onStatus(Status{Connected: true})
+
+		h.conns <- c
+		return c, nil
+	}
+	t.Cleanup(func() { dial = connect })
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	path := filepath.Join(t.TempDir(), "control.sock")
+	srv, err := control.Listen(path, &faultDoorbell{faults: faults})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	autoReconnect := true
+	conf := latestconfig.BrokerConfig{
+		Address:              "tcp://broker.invalid:1883",
+		AutoReconnect:        &autoReconnect,
+		ConnectRetryInterval: 10 * time.Millisecond,
+		Topics: []latestconfig.TopicConfig{
+			{Topic: beaconTopic, PayloadFormat: latestconfig.PayloadFormatRaw},
+		},
+	}
+	s := New(conf, func(status Status) { h.statuses <- status }, nil, nil, faults)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_ = srv.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = s.Run(ctx, h.beacons)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+		_ = srv.Close()
+	})
+
+	h.client = control.NewClient(path)
+	return h
+}
+
+// conn waits for the source to connect to the fake broker.
+func (h *faultHarness) conn(t *testing.T) *fakeConn {
+	t.Helper()
+
+	select {
+	case c := <-h.conns:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("the source didn't connect to the broker")
+		return nil
+	}
+}
+
+func (h *faultHarness) inject(t *testing.T, injection control.FaultInjection) *control.Faults {
+	t.Helper()
+
+	faults, err := h.client.InjectFaults(context.Background(), injection)
+	if err != nil {
+		t.Fatalf("InjectFaults() failed: %v", err)
+	}
+
+	return faults
+}
+
+// received returns the MACs of the beacons received so far.
+func (h *faultHarness) received() []string {
+	var macs []string
+	for {
+		select {
+		case b := <-h.beacons:
+			macs = append(macs, b.MAC)
+		default:
+			return macs
+		}
+	}
+}
+
+func TestFaultsDrop(t *testing.T) {
+	h := startFaultHarness(t, NewFaults())
+	c := h.conn(t)
+
+	drop := 2
+	if got := h.inject(t, control.FaultInjection{Drop: &drop}); got.Drop != 2 {
+		t.Errorf("InjectFaults() drop = %d, want 2", got.Drop)
+	}
+
+	for _, mac := range []string{"AA:00:00:00:00:01", "AA:00:00:00:00:02", "AA:00:00:00:00:03", "AA:00:00:00:00:04"} {
+		c.deliver(beaconTopic, mac)
+	}
+
+	got := h.received()
+	want := []string{"AA:00:00:00:00:03", "AA:00:00:00:00:04"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("received %v, want %v", got, want)
+	}
+
+	if got := h.inject(t, control.FaultInjection{}); got.Drop != 0 {
+		t.Errorf("InjectFaults() drop = %d after dropping, want 0", got.Drop)
+	}
+}
+
+func TestFaultsLatency(t *testing.T) {
+	const latency = 200 * time.Millisecond
+
+	h := startFaultHarness(t, NewFaults())
+	c := h.conn(t)
+
+	delay := latency
+	if got := h.inject(t, control.FaultInjection{Latency: &delay}); got.Latency != latency {
+		t.Errorf("InjectFaults() latency = %s, want %s", got.Latency, latency)
+	}
+
+	start := time.Now()
+	go c.deliver(beaconTopic, "AA:00:00:00:00:01")
+
+	select {
+	case <-h.beacons:
+		if elapsed := time.Since(start); elapsed < latency {
+			t.Errorf("message was handled after %s, want at least %s", elapsed, latency)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delayed message wasn't handled")
+	}
+
+	delay = 0
+	h.inject(t, control.FaultInjection{Latency: &delay})
+
+	start = time.Now()
+	c.deliver(beaconTopic, "AA:00:00:00:00:02")
+
+	if got := h.received(); len(got) != 1 {
+		t.Fatalf("received %v once the latency was removed, want one message", got)
+	}
+	if elapsed := time.Since(start); elapsed >= latency {
+		t.Errorf("message was handled after %s once the latency was removed", elapsed)
+	}
+}
+
+func TestFaultsDisconnect(t *testing.T) {
+	h := startFaultHarness(t, NewFaults())
+	first := h.conn(t)
+
+	h.inject(t, control.FaultInjection{Disconnect: true})
+
+	second := h.conn(t)
+	if !first.isDisconnected() {
+		t.Error("the connection wasn't dropped")
+	}
+
+	var lost bool
+	for len(h.statuses) > 0 {
+		if status := <-h.statuses; status.Reconnecting && errors.Is(status.Err, errFaultDisconnect) {
+			lost = true
+		}
+	}
+	if !lost {
+		t.Error("the lost connection wasn't reported")
+	}
+
+	first.deliver(beaconTopic, "AA:00:00:00:00:01")
+	second.deliver(beaconTopic, "AA:00:00:00:00:02")
+
+	got := h.received()
+	if len(got) != 1 || got[0] != "AA:00:00:00:00:02" {
+		t.Errorf("received %v after reconnecting, want [AA:00:00:00:00:02]", got)
+	}
+}
+
+func TestFaultsDeveloperMode(t *testing.T) {
+	h := startFaultHarness(t, nil)
+	c := h.conn(t)
+
+	drop := 1
+	if _, err := h.client.InjectFaults(context.Background(), control.FaultInjection{Drop: &drop}); err == nil {
+		t.Error("InjectFaults() succeeded outside developer mode")
+	}
+
+	c.deliver(beaconTopic, "AA:00:00:00:00:01")
+
+	if got := h.received(); len(got) != 1 {
+		t.Errorf("received %v outside developer mode, want one message", got)
+	}
+}
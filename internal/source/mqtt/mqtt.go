@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+)
+
+var _ source.Source = (*Source)(nil)
+
+// Source receives beacons published to an MQTT broker.
+type Source struct {
+	conf          latestconfig.BrokerConfig
+	onStatus      func(status Status)
+	onAcknowledge func()
+	onExpect      func(start bool, duration time.Duration)
+	faults        *Faults
+}
+
+// New creates a new MQTT beacon source. If onStatus is not nil it is called
+// whenever the connection to the broker is established or lost. If
+// onAcknowledge is not nil it is called whenever the configured acknowledge
+// button is pressed. If onExpect is not nil it is called whenever expect
+// mode is started (for the given duration, or zero for the configured
+// duration) or stopped on the configured expect topic. If faults is not nil,
+// the faults it is asked to inject are injected into the connection.
+func New(conf latestconfig.BrokerConfig, onStatus func(status Status), onAcknowledge func(), onExpect func(start bool, duration time.Duration), faults *Faults) *Source {
+	return &Source{conf: conf, onStatus: onStatus, onAcknowledge: onAcknowledge, onExpect: onExpect, faults: faults}
+}
+
+func (s *Source) Run(ctx context.Context, beacons chan<- source.Beacon) error {
+	brokers := s.conf.Brokers()
+	if len(brokers) == 1 {
+		return s.runBroker(ctx, brokers[0], true, beacons, s.reportStatus)
+	}
+
+	if s.conf.Mode == latestconfig.BrokerModeAll {
+		return s.runAll(ctx, brokers, beacons)
+	}
+
+	return s.runFailover(ctx, brokers, beacons)
+}
+
+// reportStatus reports the status of the connection to the broker(s).
+func (s *Source) reportStatus(status Status) {
+	if s.onStatus != nil {
+		s.onStatus(status)
+	}
+}
+
+// runBroker receives beacons from a broker until the context is cancelled,
+// or the connection is lost and not reconnected. If retry is false an error
+// is returned if the broker can't be connected to, rather than retrying.
+func (s *Source) runBroker(ctx context.Context, conf latestconfig.BrokerConfig, retry bool,
+	beacons chan<- source.Beacon, onStatus func(status Status)) error {
+	subscriptions, err := s.subscriptions(ctx, beacons)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, 1)
+	reportErr := func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	copts := connectOptions{
+		retry: retry,
+		// Subscribe on every connection, as subscriptions are lost when the
+		// broker restarts (or discards the session).
+		onConnect: func(client conn) {
+			for _, sub := range subscriptions {
+				if err := client.Subscribe(sub); err != nil {
+					reportErr(fmt.Errorf("failed to subscribe to MQTT topic %q: %w", sub.topic, err))
+					return
+				}
+
+				slog.Debug("Subscribed to MQTT topic", slog.String("topic", sub.topic), slog.Int("qos", int(sub.qos)))
+			}
+		},
+		onStatus: func(status Status) {
+			onStatus(status)
+
+			if !status.Connected && !status.Reconnecting {
+				reportErr(fmt.Errorf("lost connection to MQTT broker: %w", status.Err))
+			}
+		},
+	}
+
+	client, err := dial(ctx, conf, copts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		client.Disconnect()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case <-s.faults.disconnected():
+		}
+
+		// Drop the connection as if it was lost, and reconnect the way the
+		// client would have.
+		client.Disconnect()
+
+		slog.Warn("Lost connection to MQTT broker",
+			slog.String("address", conf.Address), slog.Any("error", errFaultDisconnect),
+			slog.Bool("reconnecting", *conf.AutoReconnect))
+		onStatus(Status{Reconnecting: *conf.AutoReconnect, Err: errFaultDisconnect, Address: conf.Address})
+
+		if !*conf.AutoReconnect {
+			return fmt.Errorf("lost connection to MQTT broker: %w", errFaultDisconnect)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(conf.ConnectRetryInterval):
+		}
+
+		copts.retry = true
+		client, err = dial(ctx, conf, copts)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// subscriptions returns the subscriptions for the configured topics.
+func (s *Source) subscriptions(ctx context.Context, beacons chan<- source.Beacon) ([]subscription, error) {
+	var key *[32]byte
+	if s.conf.EncryptionKey != "" {
+		var err error
+		key, err = parseKey(s.conf.EncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var subscriptions []subscription
+	for _, t := range s.conf.Topics {
+		decode, err := getDecoder(t.PayloadFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		encrypted := t.Encrypted
+		subscriptions = append(subscriptions, subscription{
+			topic:          t.Topic,
+			qos:            t.QoS,
+			userProperties: t.UserProperties,
+			handler: func(topic string, payload []byte) {
+				if encrypted {
+					var err error
+					payload, err = unseal(key, payload)
+					if err != nil {
+						slog.Debug("Failed to decrypt beacon",
+							slog.String("topic", topic), slog.Any("error", err))
+						return
+					}
+				}
+
+				b, err := decode(payload)
+				if err != nil {
+					slog.Debug("Failed to decode beacon",
+						slog.String("topic", topic), slog.Any("error", err))
+					return
+				}
+				b.Origin = topic
+
+				select {
+				case beacons <- *b:
+				case <-ctx.Done():
+				}
+			},
+		})
+	}
+
+	if b := s.conf.AcknowledgeButton; b != nil && s.onAcknowledge != nil {
+		subscriptions = append(subscriptions, subscription{
+			topic: b.Topic,
+			qos:   1,
+			handler: func(topic string, payload []byte) {
+				if !isButtonPress(payload, b.Action) {
+					slog.Debug("Ignoring acknowledge button message", slog.String("topic", topic))
+					return
+				}
+
+				s.onAcknowledge()
+			},
+		})
+	}
+
+	if s.conf.ExpectTopic != "" && s.onExpect != nil {
+		subscriptions = append(subscriptions, subscription{
+			topic: s.conf.ExpectTopic,
+			qos:   1,
+			handler: func(topic string, payload []byte) {
+				start, duration, ok := parseExpectCommand(payload)
+				if !ok {
+					slog.Warn("Ignoring invalid expect command",
+						slog.String("topic", topic), slog.String("payload", string(payload)))
+					return
+				}
+
+				s.onExpect(start, duration)
+			},
+		})
+	}
+
+	for i := range subscriptions {
+		subscriptions[i].handler = s.faults.wrap(ctx, subscriptions[i].handler)
+	}
+
+	return subscriptions, nil
+}
+
+// parseExpectCommand parses a message published to the expect topic, which
+// is "start" (or "on") to start expect mode for the configured duration, a
+// duration (eg. "30m") to start it for that long, or "stop" (or "off") to
+// stop it.
+func parseExpectCommand(payload []byte) (start bool, duration time.Duration, ok bool) {
+	switch command := strings.ToLower(strings.TrimSpace(string(payload))); command {
+	case "start", "on":
+		return true, 0, true
+	case "stop", "off":
+		return false, 0, true
+	default:
+		duration, err := time.ParseDuration(command)
+		if err != nil || duration <= 0 {
+			return false, 0, false
+		}
+
+		return true, duration, true
+	}
+}
+
+// isButtonPress checks whether a message published by a button matches the
+// expected action. The payload is either the bare action (eg. "single") or a
+// JSON object with an "action" field (as published by Zigbee2MQTT).
+func isButtonPress(payload []byte, action string) bool {
+	if action == "" {
+		return true
+	}
+
+	if strings.TrimSpace(string(payload)) == action {
+		return true
+	}
+
+	var msg struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return false
+	}
+
+	return msg.Action == action
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+)
+
+// Publisher publishes beacons to an MQTT broker in the JSON payload format. If
+// a broker encryption key is configured, payloads are encrypted.
+type Publisher struct {
+	conf  latestconfig.BrokerConfig
+	topic string
+}
+
+// NewPublisher creates a new beacon publisher for the given topic.
+func NewPublisher(conf latestconfig.BrokerConfig, topic string) *Publisher {
+	return &Publisher{conf: conf, topic: topic}
+}
+
+// Run publishes beacons received on the given channel until the context is
+// cancelled.
+func (p *Publisher) Run(ctx context.Context, beacons <-chan source.Beacon) error {
+	var key *[32]byte
+	if p.conf.EncryptionKey != "" {
+		var err error
+		key, err = parseKey(p.conf.EncryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := connect(ctx, p.conf, connectOptions{retry: true})
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case b := <-beacons:
+			payload, err := EncodeJSON(&b)
+			if err != nil {
+				return fmt.Errorf("failed to encode beacon: %w", err)
+			}
+
+			if key != nil {
+				payload, err = seal(key, payload)
+				if err != nil {
+					return fmt.Errorf("failed to encrypt beacon: %w", err)
+				}
+			}
+
+			// Beacons are frequent and disposable, so they are published
+			// with QoS 0 (not acknowledged), and failures aren't retried.
+			if err := client.Publish(ctx, p.topic, 0, false, payload); err != nil {
+				slog.Warn("Failed to publish beacon", slog.Any("error", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// errNotConnected is returned when publishing before the client has
+// connected to the broker.
+var errNotConnected = errors.New("not connected to MQTT broker")
+
+// Client publishes and subscribes to topics other than the beacon topics,
+// over its own connection to the broker.
+type Client struct {
+	conf latestconfig.BrokerConfig
+	name string
+
+	mu            sync.Mutex
+	conn          conn
+	subscriptions []subscription
+}
+
+// NewClient creates a client, whose client ID is the configured one with the
+// name appended.
+func NewClient(conf latestconfig.BrokerConfig, name string) *Client {
+	return &Client{conf: conf, name: name}
+}
+
+// Subscribe calls the handler with every message published to the topic. It
+// must be called before Run.
+func (c *Client) Subscribe(topic string, handler func(payload []byte)) {
+	c.subscriptions = append(c.subscriptions, subscription{
+		topic: topic,
+		qos:   1,
+		handler: func(_ string, payload []byte) {
+			handler(payload)
+		},
+	})
+}
+
+// Run connects to the broker, retrying until it succeeds, and stays
+// connected until the context is cancelled.
+func (c *Client) Run(ctx context.Context) error {
+	client, err := connect(ctx, c.conf, connectOptions{
+		retry:          true,
+		clientIDSuffix: "-" + c.name,
+		onConnect: func(client conn) {
+			for _, sub := range c.subscriptions {
+				if err := client.Subscribe(sub); err != nil {
+					slog.Warn("Failed to subscribe to MQTT topic", slog.String("topic", sub.topic), slog.Any("error", err))
+				}
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+
+	c.mu.Lock()
+	c.conn = client
+	c.mu.Unlock()
+
+	<-ctx.Done()
+
+	c.mu.Lock()
+	c.conn = nil
+	c.mu.Unlock()
+
+	return ctx.Err()
+}
+
+// Publish publishes a retained message with QoS 1, so that the latest
+// message is sent to subscribers as soon as they subscribe.
+func (c *Client) Publish(ctx context.Context, topic string, payload []byte) error {
+	c.mu.Lock()
+	client := c.conn
+	c.mu.Unlock()
+
+	if client == nil {
+		return errNotConnected
+	}
+
+	if err := client.Publish(ctx, topic, 1, true, payload); err != nil {
+		return fmt.Errorf("failed to publish to MQTT topic %q: %w", topic, err)
+	}
+
+	return nil
+}
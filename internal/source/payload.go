@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package source
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NormalizePayload cleans up a raw beacon payload as published by various
+// scanners, trimming surrounding whitespace, NUL terminators, byte order marks
+// and quotes (eg. a JSON encoded string).
+func NormalizePayload(payload []byte) string {
+	s := strings.TrimPrefix(string(payload), "\uFEFF")
+	s = strings.TrimFunc(s, isPayloadSpace)
+
+	if len(s) >= 2 {
+		switch {
+		case s[0] == '"' && s[len(s)-1] == '"':
+			if unquoted, err := strconv.Unquote(s); err == nil {
+				s = unquoted
+			} else {
+				s = s[1 : len(s)-1]
+			}
+		case s[0] == '\'' && s[len(s)-1] == '\'':
+			s = s[1 : len(s)-1]
+		}
+	}
+
+	return strings.TrimFunc(s, isPayloadSpace)
+}
+
+func isPayloadSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\r', '\n', '\v', '\f', '\x00':
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package source
+
+import (
+	"testing"
+
+	"github.com/dpeckett/cat-doorbell/internal/util"
+)
+
+func TestNormalizePayload(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"bare", "aa:bb:cc:dd:ee:ff", "aa:bb:cc:dd:ee:ff"},
+		{"empty", "", ""},
+		{"json string", `"aa:bb:cc:dd:ee:ff"`, "aa:bb:cc:dd:ee:ff"},
+		{"json string with escapes", `"aa:bb:cc:dd:ee:ff\n"`, "aa:bb:cc:dd:ee:ff"},
+		{"single quoted", "'aa:bb:cc:dd:ee:ff'", "aa:bb:cc:dd:ee:ff"},
+		{"invalid json string", `"aa:bb\qcc"`, `aa:bb\qcc`},
+		{"lone quote", `"`, `"`},
+		{"trailing newline", "aa:bb:cc:dd:ee:ff\n", "aa:bb:cc:dd:ee:ff"},
+		{"trailing crlf", "aa:bb:cc:dd:ee:ff\r\n", "aa:bb:cc:dd:ee:ff"},
+		{"nul terminated", "aa:bb:cc:dd:ee:ff\x00", "aa:bb:cc:dd:ee:ff"},
+		{"nul padded", "aa:bb:cc:dd:ee:ff\x00\x00\x00", "aa:bb:cc:dd:ee:ff"},
+		{"byte order mark", "\ufeffaa:bb:cc:dd:ee:ff", "aa:bb:cc:dd:ee:ff"},
+		{"surrounding whitespace", " \t aa:bb:cc:dd:ee:ff \t ", "aa:bb:cc:dd:ee:ff"},
+		{"whitespace inside quotes", `" aa:bb:cc:dd:ee:ff "`, "aa:bb:cc:dd:ee:ff"},
+		{"mixed case", "Aa:bB:CC:dd:Ee:fF", "Aa:bB:CC:dd:Ee:fF"},
+		{"everything", "\ufeff \"AA:bb:CC:dd:EE:ff\"\r\n\x00", "AA:bb:CC:dd:EE:ff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizePayload([]byte(tt.payload)); got != tt.want {
+				t.Errorf("NormalizePayload(%q) = %q, want %q", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNormalizePayloadMAC checks that messy payloads for the same beacon all
+// match the same configured target, once the MAC address is normalized.
+func TestNormalizePayloadMAC(t *testing.T) {
+	const want = "AA:BB:CC:DD:EE:FF"
+
+	payloads := []string{
+		"aa:bb:cc:dd:ee:ff",
+		"Aa:bB:cC:Dd:eE:Ff",
+		`"aa:bb:cc:dd:ee:ff"`,
+		"aa-bb-cc-dd-ee-ff\n",
+		"AABBCCDDEEFF\r\n",
+		"aa:bb:cc:dd:ee:ff\x00",
+		"\ufeffaa:bb:cc:dd:ee:ff",
+		"  'aa:bb:cc:dd:ee:ff'  ",
+	}
+
+	for _, payload := range payloads {
+		got, err := util.NormalizeMAC(NormalizePayload([]byte(payload)))
+		if err != nil {
+			t.Errorf("NormalizeMAC(NormalizePayload(%q)) failed: %v", payload, err)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("NormalizeMAC(NormalizePayload(%q)) = %q, want %q", payload, got, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package source
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+)
+
+// Queue holds received beacons until they can be handled. When it is full,
+// the oldest beacon is dropped to make room for the newest, so a flood of
+// beacons can't exhaust memory. Button presses are only dropped if the queue
+// holds nothing else.
+type Queue struct {
+	size    int
+	dropped func(b Beacon)
+	length  atomic.Int64
+}
+
+// NewQueue creates a queue holding up to size beacons. The dropped function,
+// if not nil, is called with every beacon that is dropped.
+func NewQueue(size int, dropped func(b Beacon)) *Queue {
+	return &Queue{
+		size:    max(size, 1),
+		dropped: dropped,
+	}
+}
+
+// Run queues the beacons received from in, and sends them to out in the
+// order they were received, until the context is cancelled.
+func (q *Queue) Run(ctx context.Context, in <-chan Beacon, out chan<- Beacon) error {
+	var beacons []Beacon
+	for {
+		q.length.Store(int64(len(beacons)))
+
+		// Only try to send when there is something to send.
+		var next chan<- Beacon
+		var head Beacon
+		if len(beacons) > 0 {
+			next, head = out, beacons[0]
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case b := <-in:
+			if len(beacons) >= q.size {
+				i := slices.IndexFunc(beacons, func(b Beacon) bool {
+					return !b.Button
+				})
+				if i == -1 {
+					i = 0
+				}
+
+				if q.dropped != nil {
+					q.dropped(beacons[i])
+				}
+				beacons = slices.Delete(beacons, i, i+1)
+			}
+
+			beacons = append(beacons, b)
+		case next <- head:
+			beacons = beacons[1:]
+		}
+	}
+}
+
+// Len returns the number of beacons waiting in the queue.
+func (q *Queue) Len() int {
+	return int(q.length.Load())
+}
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package replay records beacon streams to newline delimited JSON files, and
+// reads them back for replaying.
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/source/mqtt"
+)
+
+// maxLineSize is the longest line accepted in a recording.
+const maxLineSize = 64 << 10
+
+// Record is a beacon in a recording.
+type Record struct {
+	// Time is when the beacon was received.
+	Time time.Time
+	// Beacon is the received beacon.
+	Beacon source.Beacon
+}
+
+// metadata is the fields added to the JSON payload format of each beacon in
+// a recording.
+type metadata struct {
+	Time   time.Time `json:"time"`
+	Origin string    `json:"origin,omitempty"`
+}
+
+// Recorder appends beacons to a recording.
+type Recorder struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewRecorder opens the recording at the given path, creating it if it
+// doesn't exist. Beacons are appended to any existing recording.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	return &Recorder{f: f}, nil
+}
+
+// Record appends a beacon, received at the given time, to the recording.
+func (r *Recorder) Record(b *source.Beacon, t time.Time) error {
+	payload, err := mqtt.EncodeJSON(b)
+	if err != nil {
+		return fmt.Errorf("failed to encode beacon: %w", err)
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return fmt.Errorf("failed to decode beacon: %w", err)
+	}
+
+	meta, err := json.Marshal(metadata{Time: t, Origin: b.Origin})
+	if err != nil {
+		return fmt.Errorf("failed to encode beacon metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(meta, &fields); err != nil {
+		return fmt.Errorf("failed to decode beacon metadata: %w", err)
+	}
+
+	line, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the recording.
+func (r *Recorder) Close() error {
+	return r.f.Close()
+}
+
+// Reader reads the records in a recording, in order.
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewReader creates a reader for the recording read from r.
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxLineSize)
+
+	return &Reader{scanner: scanner}
+}
+
+// Next returns the next record in the recording, or io.EOF once every record
+// has been read. Blank lines are skipped.
+func (r *Reader) Next() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := r.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var meta metadata
+		if err := json.Unmarshal(line, &meta); err != nil {
+			return nil, fmt.Errorf("line %d: failed to decode record: %w", r.line, err)
+		}
+
+		if meta.Time.IsZero() {
+			return nil, fmt.Errorf("line %d: record has no time", r.line)
+		}
+
+		b, err := mqtt.DecodeJSON(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		b.Origin = meta.Origin
+
+		return &Record{Time: meta.Time, Beacon: *b}, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	return nil, io.EOF
+}
+
+// Source replays a recording as a beacon source, pacing the beacons as they
+// were received.
+type Source struct {
+	r     *Reader
+	speed float64
+}
+
+// NewSource creates a source replaying the recording read from r, at the
+// given speed relative to the recording (or as fast as possible if it is
+// zero).
+func NewSource(r *Reader, speed float64) *Source {
+	return &Source{r: r, speed: speed}
+}
+
+// Run sends the recorded beacons, and returns once the last one has been
+// sent.
+func (s *Source) Run(ctx context.Context, beacons chan<- source.Beacon) error {
+	var start time.Time
+	wallStart := time.Now()
+	for {
+		rec, err := s.r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if start.IsZero() {
+			start = rec.Time
+		}
+
+		// Pace beacons relative to the start of the replay, so that delays
+		// don't accumulate.
+		if s.speed > 0 {
+			due := wallStart.Add(time.Duration(float64(rec.Time.Sub(start)) / s.speed))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Until(due)):
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case beacons <- rec.Beacon:
+		}
+	}
+}
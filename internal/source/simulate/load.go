@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package simulate
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/source"
+)
+
+// loadNamePrefix prefixes the sequence numbers beacons sent by a load are
+// named with.
+const loadNamePrefix = "cat-doorbell-load-"
+
+// Load sends beacons from a number of devices in turn, at a fixed rate, to
+// generate synthetic load.
+type Load struct {
+	devices  int
+	interval time.Duration
+	duration time.Duration
+	sent     func(b source.Beacon)
+}
+
+// NewLoad creates a source that sends rate beacons per second, from each of
+// the devices in turn, for the given duration. If specified, sent is called
+// with each beacon just before it is sent.
+func NewLoad(devices int, rate float64, duration time.Duration, sent func(b source.Beacon)) *Load {
+	return &Load{
+		devices:  devices,
+		interval: time.Duration(float64(time.Second) / rate),
+		duration: duration,
+		sent:     sent,
+	}
+}
+
+// LoadMAC returns the MAC address of the nth device of a load. It is a
+// locally administered address, so it can't belong to a real device.
+func LoadMAC(n int) string {
+	return fmt.Sprintf("02:CA:7D:00:%02X:%02X", (n>>8)&0xff, n&0xff)
+}
+
+// Sequence returns the sequence number of a beacon sent by a load, from
+// zero, or false if the beacon wasn't sent by a load.
+func Sequence(b source.Beacon) (int, bool) {
+	s, ok := strings.CutPrefix(b.Name, loadNamePrefix)
+	if !ok {
+		return 0, false
+	}
+
+	seq, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+
+	return seq, true
+}
+
+// Run sends the beacons, each named after its sequence number, and returns
+// once the duration has passed. Beacons are sent on schedule, so if sending
+// falls behind, the following beacons are sent without waiting.
+func (l *Load) Run(ctx context.Context, beacons chan<- source.Beacon) error {
+	start := time.Now()
+
+	for seq := 0; ; seq++ {
+		next := time.Duration(seq) * l.interval
+		if next >= l.duration {
+			return nil
+		}
+
+		if wait := time.Until(start.Add(next)); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		b := source.Beacon{
+			MAC:    LoadMAC(seq % l.devices),
+			RSSI:   -60,
+			Name:   loadNamePrefix + strconv.Itoa(seq),
+			Origin: Origin,
+		}
+
+		if l.sent != nil {
+			l.sent(b)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case beacons <- b:
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package simulate generates beacons, for testing a setup without any
+// hardware.
+package simulate
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/source"
+)
+
+// Origin is the origin of simulated beacons.
+const Origin = "simulate"
+
+// Source sends the same beacon a number of times, at a fixed interval.
+type Source struct {
+	beacon   source.Beacon
+	count    int
+	interval time.Duration
+}
+
+// New creates a source that sends count copies of the beacon, interval
+// apart.
+func New(b source.Beacon, count int, interval time.Duration) *Source {
+	b.Origin = Origin
+
+	return &Source{
+		beacon:   b,
+		count:    count,
+		interval: interval,
+	}
+}
+
+// Run sends the beacons, and returns once the last one has been sent.
+func (s *Source) Run(ctx context.Context, beacons chan<- source.Beacon) error {
+	for i := range s.count {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(s.interval):
+			}
+		}
+
+		slog.Info("Sending simulated beacon",
+			slog.String("mac", s.beacon.MAC), slog.Int("rssi", s.beacon.RSSI),
+			slog.Int("n", i+1), slog.Int("count", s.count))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case beacons <- s.beacon:
+		}
+	}
+
+	return nil
+}
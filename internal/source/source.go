@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package source
+
+import "context"
+
+// Beacon is an advertisement received from a BLE device.
+type Beacon struct {
+	// MAC is the MAC address of the device.
+	MAC string
+	// RSSI is the received signal strength in dBm (zero if unknown).
+	RSSI int
+	// Name is the advertised local name of the device, if known.
+	Name string
+	// ServiceUUIDs are the (normalized) service UUIDs advertised by the
+	// device. Sources may only report UUIDs they were asked to look for.
+	ServiceUUIDs []string
+	// IBeacon is the iBeacon identity advertised by the device, if any.
+	IBeacon *IBeacon
+	// Eddystone is the Eddystone-UID identity advertised by the device, if
+	// any.
+	Eddystone *Eddystone
+	// Button is true if the beacon reports a button press on the device.
+	Button bool
+	// Battery is the battery level of the device in percent, if the beacon
+	// reports it.
+	Battery *int
+	// Origin describes where the beacon was received from, eg. the MQTT
+	// topic it was published to.
+	Origin string
+}
+
+// Source is a provider of BLE beacons.
+type Source interface {
+	// Run sends received beacons to the given channel until the context is
+	// cancelled or an unrecoverable error occurs.
+	Run(ctx context.Context, beacons chan<- Beacon) error
+}
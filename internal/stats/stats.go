@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package stats summarizes the visits of targets recorded in the detection
+// history.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+)
+
+// busiestHours is the length of the busiest time of day reported for each
+// target, in hours.
+const busiestHours = 2
+
+// visitEvents are the event types that count as visits.
+var visitEvents = []string{string(latestconfig.EventDetected), string(latestconfig.EventButtonPressed)}
+
+// Summary summarizes the visits of each target over a period.
+type Summary struct {
+	// From is the start of the period.
+	From time.Time `json:"from"`
+	// To is the end of the period.
+	To time.Time `json:"to"`
+	// Days is the number of days the period covers, rounded up.
+	Days int `json:"days"`
+	// Targets holds the statistics of each target.
+	Targets []Target `json:"targets"`
+}
+
+// Target holds the visit statistics of a target.
+type Target struct {
+	// Name is the name of the target.
+	Name string `json:"name"`
+	// Visits is the number of times the target rang the doorbell.
+	Visits int `json:"visits"`
+	// PerDay is the average number of visits per day.
+	PerDay float64 `json:"perDay"`
+	// Busiest is the time of day the target visited most at, or nil if it
+	// didn't visit.
+	Busiest *Window `json:"busiest,omitempty"`
+	// AverageGap is the average time between visits, or zero if the target
+	// visited less than twice.
+	AverageGap time.Duration `json:"averageGap"`
+	// LastVisit is when the target last visited, or nil if it didn't visit.
+	LastVisit *time.Time `json:"lastVisit,omitempty"`
+	// Hourly is the number of visits in each hour of the day.
+	Hourly [24]int `json:"hourly"`
+}
+
+// Window is a range of hours of the day.
+type Window struct {
+	// From is the hour of the day the window starts at.
+	From int `json:"from"`
+	// To is the hour of the day the window ends at (exclusive). It is less
+	// than From if the window spans midnight.
+	To int `json:"to"`
+	// Visits is the number of visits within the window.
+	Visits int `json:"visits"`
+}
+
+func (w Window) String() string {
+	return fmt.Sprintf("%02d:00-%02d:00", w.From, w.To)
+}
+
+// Load summarizes the visits between from and to recorded in the history.
+// Every named target is summarized, even if it didn't visit, followed by any
+// other targets that visited (eg. ones that have since been renamed). If
+// only is true, other targets are left out.
+func Load(ctx context.Context, store history.Store, names []string, only bool, from, to time.Time) (*Summary, error) {
+	visits, err := store.List(ctx, history.Query{
+		Since:        from,
+		NotifiedOnly: true,
+		Events:       visitEvents,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list visits: %w", err)
+	}
+
+	visits = slices.DeleteFunc(visits, func(v history.Detection) bool {
+		return v.Time.After(to) || (only && !slices.Contains(names, v.Name))
+	})
+
+	return Compute(visits, names, from, to), nil
+}
+
+// Compute summarizes the given visits, which must be between from and to.
+// Hours of the day are in the location of to.
+func Compute(visits []history.Detection, names []string, from, to time.Time) *Summary {
+	s := &Summary{
+		From: from,
+		To:   to,
+		Days: max(1, int(math.Ceil(to.Sub(from).Hours()/24))),
+	}
+
+	byName := make(map[string][]time.Time)
+	var others []string
+	for _, v := range visits {
+		if _, ok := byName[v.Name]; !ok && !slices.Contains(names, v.Name) {
+			others = append(others, v.Name)
+		}
+		byName[v.Name] = append(byName[v.Name], v.Time.In(to.Location()))
+	}
+	slices.Sort(others)
+
+	for _, name := range slices.Concat(names, others) {
+		s.Targets = append(s.Targets, computeTarget(name, byName[name], s.Days))
+	}
+
+	return s
+}
+
+func computeTarget(name string, times []time.Time, days int) Target {
+	t := Target{
+		Name:   name,
+		Visits: len(times),
+		PerDay: float64(len(times)) / float64(days),
+	}
+
+	if len(times) == 0 {
+		return t
+	}
+
+	slices.SortFunc(times, func(a, b time.Time) int { return a.Compare(b) })
+
+	for _, visit := range times {
+		t.Hourly[visit.Hour()]++
+	}
+
+	last := times[len(times)-1]
+	t.LastVisit = &last
+
+	if len(times) > 1 {
+		t.AverageGap = last.Sub(times[0]) / time.Duration(len(times)-1)
+	}
+
+	// Find the busiest window, which may span midnight. Of equally busy
+	// windows, the one starting at the busier hour is preferred.
+	for from := range 24 {
+		w := Window{From: from, To: (from + busiestHours) % 24}
+		for hour := range busiestHours {
+			w.Visits += t.Hourly[(from+hour)%24]
+		}
+
+		if t.Busiest == nil || w.Visits > t.Busiest.Visits ||
+			(w.Visits == t.Busiest.Visits && t.Hourly[from] > t.Hourly[t.Busiest.From]) {
+			t.Busiest = &w
+		}
+	}
+
+	return t
+}
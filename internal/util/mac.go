@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// macSeparators removes the separators MAC addresses may be written with.
+var macSeparators = strings.NewReplacer(":", "", "-", "", ".", "")
+
+// NormalizeMAC parses a MAC address with or without separators (":", "-" or
+// ".") in any case, and returns it in the canonical "AA:BB:CC:DD:EE:FF" form.
+// It is called for every beacon, so it avoids allocating where it can.
+func NormalizeMAC(mac string) (string, error) {
+	digits := macSeparators.Replace(strings.TrimSpace(mac))
+
+	var addr [6]byte
+	if len(digits) != 2*len(addr) {
+		return "", fmt.Errorf("invalid MAC address %q: expected 6 hexadecimal octets", mac)
+	}
+	if _, err := hex.Decode(addr[:], []byte(digits)); err != nil {
+		return "", fmt.Errorf("invalid MAC address %q: expected 6 hexadecimal octets", mac)
+	}
+
+	const upperHex = "0123456789ABCDEF"
+
+	var canonical [17]byte
+	for i, b := range addr {
+		if i > 0 {
+			canonical[3*i-1] = ':'
+		}
+		canonical[3*i] = upperHex[b>>4]
+		canonical[3*i+1] = upperHex[b&0x0f]
+	}
+
+	return string(canonical[:]), nil
+}
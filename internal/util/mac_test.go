@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import "testing"
+
+func TestNormalizeMAC(t *testing.T) {
+	tests := []struct {
+		mac  string
+		want string
+		ok   bool
+	}{
+		{"AA:BB:CC:DD:EE:FF", "AA:BB:CC:DD:EE:FF", true},
+		{"aa:bb:cc:dd:ee:ff", "AA:BB:CC:DD:EE:FF", true},
+		{"00-11-22-33-44-55", "00:11:22:33:44:55", true},
+		{"0a1b.2c3d.4e5f", "0A:1B:2C:3D:4E:5F", true},
+		{"a0b1c2d3e4f5", "A0:B1:C2:D3:E4:F5", true},
+		{" aa:bb:cc:dd:ee:ff\n", "AA:BB:CC:DD:EE:FF", true},
+		{"", "", false},
+		{"aa:bb:cc:dd:ee", "", false},
+		{"aa:bb:cc:dd:ee:ff:00", "", false},
+		{"aa:bb:cc:dd:ee:fg", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeMAC(tt.mac)
+		if (err == nil) != tt.ok {
+			t.Errorf("NormalizeMAC(%q) error = %v, want ok %t", tt.mac, err, tt.ok)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("NormalizeMAC(%q) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkNormalizeMAC(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := NormalizeMAC("aa:bb:cc:dd:ee:ff"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+)
+
+// MACRedactor replaces MAC addresses with a salted hash, so devices can still
+// be correlated without revealing their identifiers. A nil *MACRedactor
+// leaves MAC addresses unchanged.
+type MACRedactor struct {
+	salt []byte
+}
+
+// NewMACRedactor creates a new MAC redactor using the given salt.
+func NewMACRedactor(salt string) *MACRedactor {
+	return &MACRedactor{salt: []byte(salt)}
+}
+
+// Redact returns the hashed form of the given MAC address.
+func (r *MACRedactor) Redact(mac string) string {
+	if r == nil {
+		return mac
+	}
+
+	if normalized, err := NormalizeMAC(mac); err == nil {
+		mac = normalized
+	}
+
+	h := hmac.New(sha256.New, r.salt)
+	_, _ = h.Write([]byte(mac))
+
+	return "mac-" + hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// ReplaceAttr is a slog.HandlerOptions.ReplaceAttr function that redacts the
+// values of "mac" attributes.
+func (r *MACRedactor) ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if r != nil && a.Key == "mac" && a.Value.Kind() == slog.KindString {
+		a.Value = slog.StringValue(r.Redact(a.Value.String()))
+	}
+
+	return a
+}
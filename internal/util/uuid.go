@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// bluetoothBaseUUID is the suffix used to expand 16 and 32-bit Bluetooth UUIDs.
+const bluetoothBaseUUID = "-0000-1000-8000-00805f9b34fb"
+
+// NormalizeUUID parses a Bluetooth UUID, either in its 16-bit (eg. "180f"),
+// 32-bit, or 128-bit form, and returns it in the canonical lowercase 128-bit
+// form.
+func NormalizeUUID(uuid string) (string, error) {
+	digits := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(uuid), "-", ""))
+
+	if _, err := hex.DecodeString(digits); err != nil {
+		return "", fmt.Errorf("invalid UUID %q: %w", uuid, err)
+	}
+
+	switch len(digits) {
+	case 4:
+		return "0000" + digits + bluetoothBaseUUID, nil
+	case 8:
+		return digits + bluetoothBaseUUID, nil
+	case 32:
+		return digits[0:8] + "-" + digits[8:12] + "-" + digits[12:16] + "-" + digits[16:20] + "-" + digits[20:32], nil
+	default:
+		return "", fmt.Errorf("invalid UUID %q: expected 16, 32 or 128 bits", uuid)
+	}
+}
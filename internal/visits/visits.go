@@ -0,0 +1,378 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package visits keeps track of visit sessions, so that the doorbell rings
+// once for each visit, even across restarts and several instances.
+package visits
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Session is a visit of a target, from the doorbell ringing for it until it
+// hasn't been seen for its detection timeout.
+type Session struct {
+	// ID identifies the session.
+	ID string `json:"id"`
+	// Name is the name of the visiting target.
+	Name string `json:"name"`
+	// Instance is the name of the instance that rang the doorbell.
+	Instance string `json:"instance"`
+	// MAC is the MAC address of the visiting device. It is only stored
+	// locally, and isn't shared with other instances.
+	MAC string `json:"mac,omitempty"`
+	// Started is when the doorbell rang.
+	Started time.Time `json:"started"`
+	// LastSeen is when the target was last seen during the visit.
+	LastSeen time.Time `json:"lastSeen"`
+	// Acknowledged is true once the visit has been acknowledged.
+	Acknowledged bool `json:"acknowledged,omitempty"`
+	// Reminders are the custom events that have been raised because the
+	// visit went unacknowledged.
+	Reminders []string `json:"reminders,omitempty"`
+}
+
+// Active returns whether the visit is still in progress at the given time,
+// ie. the target has been seen within the timeout.
+func (s *Session) Active(now time.Time, timeout time.Duration) bool {
+	return now.Sub(s.LastSeen) < timeout
+}
+
+// precedes returns whether the session started before another session of
+// the same visit. Ties are broken by instance name, and then by ID, so that
+// every instance settles them the same way.
+func (s *Session) precedes(other *Session) bool {
+	switch {
+	case !s.Started.Equal(other.Started):
+		return s.Started.Before(other.Started)
+	case s.Instance != other.Instance:
+		return s.Instance < other.Instance
+	default:
+		return s.ID < other.ID
+	}
+}
+
+func (s *Session) clone() Session {
+	c := *s
+	c.Reminders = slices.Clone(s.Reminders)
+	return c
+}
+
+func (s *Session) equal(other *Session) bool {
+	return s.ID == other.ID && s.MAC == other.MAC && s.LastSeen.Equal(other.LastSeen) &&
+		s.Acknowledged == other.Acknowledged && slices.Equal(s.Reminders, other.Reminders)
+}
+
+// Store holds the latest visit session of each target, persisted to a file
+// so that they survive restarts.
+type Store struct {
+	path     string
+	instance string
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	// dirty is true if sessions were extended since they were last saved.
+	dirty bool
+	// peerSeen is true once a session of another instance has been seen.
+	peerSeen bool
+}
+
+// Open opens (or creates) the store at the given path. Sessions started
+// through it are attributed to the named instance.
+func Open(path, instance string) (*Store, error) {
+	s := &Store{
+		path:     path,
+		instance: instance,
+		sessions: make(map[string]*Session),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read visit sessions: %w", err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.sessions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal visit sessions: %w", err)
+		}
+	}
+
+	for _, session := range s.sessions {
+		if session.Instance != instance {
+			s.peerSeen = true
+		}
+	}
+
+	return s, nil
+}
+
+// Instance returns the name of the instance sessions are started by.
+func (s *Store) Instance() string {
+	return s.instance
+}
+
+// PeerSeen returns whether a session of another instance has been seen (and
+// so whether another instance may ring the doorbell for the same visits).
+func (s *Store) PeerSeen() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.peerSeen
+}
+
+// Current returns the latest session of the named target, if any.
+func (s *Store) Current(name string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[name]
+	if !ok {
+		return Session{}, false
+	}
+
+	return session.clone(), true
+}
+
+// Sessions returns the latest session of each target, sorted by name.
+func (s *Store) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session.clone())
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Name < sessions[j].Name
+	})
+
+	return sessions
+}
+
+// Start starts a new session of the named target, rung by this instance,
+// replacing its previous session. The session is returned even if it
+// couldn't be saved.
+func (s *Store) Start(name, mac string, now time.Time) (Session, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Session{}, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	session := &Session{
+		ID:       hex.EncodeToString(id),
+		Name:     name,
+		Instance: s.instance,
+		MAC:      mac,
+		Started:  now,
+		LastSeen: now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[name] = session
+
+	return session.clone(), s.save()
+}
+
+// Seen extends the session of the named target to the given time, unless it
+// had already ended by then. It returns the session and whether it was
+// extended. Targets are seen constantly during a visit, so the extension
+// isn't saved until Flush is called (or another change is saved).
+func (s *Store) Seen(name string, at time.Time, timeout time.Duration) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[name]
+	if !ok || !at.After(session.LastSeen) || !session.Active(at, timeout) {
+		return Session{}, false
+	}
+
+	session.LastSeen = at
+	s.dirty = true
+
+	return session.clone(), true
+}
+
+// Flush saves the sessions extended since they were last saved.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+
+	return s.save()
+}
+
+// Acknowledge marks the session with the given ID as acknowledged. It
+// returns the session and whether it was changed.
+func (s *Store) Acknowledge(id string) (Session, bool, error) {
+	return s.update(id, func(session *Session) bool {
+		if session.Acknowledged {
+			return false
+		}
+
+		session.Acknowledged = true
+		return true
+	})
+}
+
+// Remind records that a custom event was raised because the visit of the
+// session with the given ID went unacknowledged. It returns the session and
+// whether it was changed.
+func (s *Store) Remind(id, event string) (Session, bool, error) {
+	return s.update(id, func(session *Session) bool {
+		if slices.Contains(session.Reminders, event) {
+			return false
+		}
+
+		session.Reminders = append(session.Reminders, event)
+		return true
+	})
+}
+
+// update applies a change to the session with the given ID, if it is still
+// the latest session of its target, and saves it if it was changed.
+func (s *Store) update(id string, change func(session *Session) bool) (Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, session := range s.sessions {
+		if session.ID != id {
+			continue
+		}
+
+		if !change(session) {
+			return session.clone(), false, nil
+		}
+
+		return session.clone(), true, s.save()
+	}
+
+	return Session{}, false, nil
+}
+
+// Merge merges a session shared by another instance, given the detection
+// timeout of its target. Sessions of the same visit are settled in favour of
+// the one that started first, and a session of a later visit replaces the
+// earlier one. It returns the resulting session of the target, and whether it
+// was changed.
+func (s *Store) Merge(remote Session, timeout time.Duration) (Session, bool, error) {
+	if remote.ID == "" || remote.Name == "" {
+		return Session{}, false, errors.New("invalid visit session: missing ID or name")
+	}
+
+	// MAC addresses aren't shared, in case the instances redact them
+	// differently.
+	remote.MAC = ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Instances receive their own sessions back from the broker.
+	if remote.Instance != s.instance {
+		s.peerSeen = true
+	}
+
+	local, ok := s.sessions[remote.Name]
+	switch {
+	case !ok || remote.Started.After(local.LastSeen.Add(timeout)):
+		merged := remote.clone()
+		s.sessions[remote.Name] = &merged
+
+		return merged.clone(), true, s.save()
+	case local.ID != remote.ID && local.Started.After(remote.LastSeen.Add(timeout)):
+		return local.clone(), false, nil
+	}
+
+	merged := local.clone()
+	switch {
+	case local.ID == remote.ID:
+		merged.Acknowledged = local.Acknowledged || remote.Acknowledged
+		for _, event := range remote.Reminders {
+			if !slices.Contains(merged.Reminders, event) {
+				merged.Reminders = append(merged.Reminders, event)
+			}
+		}
+	case remote.precedes(local):
+		merged = remote.clone()
+	}
+
+	if remote.LastSeen.After(merged.LastSeen) {
+		merged.LastSeen = remote.LastSeen
+	}
+	if local.LastSeen.After(merged.LastSeen) {
+		merged.LastSeen = local.LastSeen
+	}
+
+	if merged.equal(local) {
+		return merged, false, nil
+	}
+
+	s.sessions[remote.Name] = &merged
+
+	return merged.clone(), true, s.save()
+}
+
+// save writes the sessions to the store's file. The caller must hold the
+// lock.
+func (s *Store) save() error {
+	data, err := json.Marshal(s.sessions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal visit sessions: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create visit sessions directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace visit sessions: %w", err)
+	}
+	s.dirty = false
+
+	return nil
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package visits
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSeenSavedOnFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "visits.json")
+
+	s, err := Open(path, "hallway")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)
+	if _, err := s.Start("Mittens", "AA:BB:CC:DD:EE:FF", start); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if _, extended := s.Seen("Mittens", start.Add(time.Duration(i)*time.Second), time.Minute); !extended {
+			t.Fatalf("Seen() didn't extend the session after %ds", i)
+		}
+	}
+
+	if data, err := os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if string(data) != string(saved) {
+		t.Error("Seen() saved the extended session before Flush()")
+	}
+
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() failed: %v", err)
+	}
+
+	reopened, err := Open(path, "hallway")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, ok := reopened.Current("Mittens")
+	if !ok {
+		t.Fatal("session wasn't saved")
+	}
+	if want := start.Add(5 * time.Second); !session.LastSeen.Equal(want) {
+		t.Errorf("saved LastSeen = %s, want %s", session.LastSeen, want)
+	}
+}
+
+func TestPeerSeen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "visits.json")
+
+	s, err := Open(path, "hallway")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 5, 1, 22, 0, 0, 0, time.UTC)
+	own, err := s.Start("Mittens", "AA:BB:CC:DD:EE:FF", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Instances receive their own sessions back from the broker.
+	if _, _, err := s.Merge(own, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if s.PeerSeen() {
+		t.Error("PeerSeen() = true after merging an own session")
+	}
+
+	peer := Session{ID: "0123456789abcdef", Name: "Socks", Instance: "kitchen", Started: start, LastSeen: start}
+	if _, _, err := s.Merge(peer, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if !s.PeerSeen() {
+		t.Error("PeerSeen() = false after merging a session of another instance")
+	}
+
+	reopened, err := Open(path, "hallway")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reopened.PeerSeen() {
+		t.Error("PeerSeen() = false after reopening a store with a session of another instance")
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+
+	"github.com/dpeckett/cat-doorbell/internal/constants"
+	"github.com/grandcat/zeroconf"
+)
+
+// serviceType is the DNS-SD service type the server is advertised as.
+const serviceType = "_cat-doorbell._tcp"
+
+// advertise announces the server on the local network using mDNS, until the
+// context is cancelled.
+func (s *Server) advertise(ctx context.Context) error {
+	host, portStr, err := net.SplitHostPort(s.conf.ListenAddress)
+	if err != nil {
+		return fmt.Errorf("invalid listen address: %w", err)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port == 0 {
+		return fmt.Errorf("can't advertise listen address %q without a fixed port", s.conf.ListenAddress)
+	}
+
+	if isLoopback(host) {
+		slog.Warn("Not advertising web server listening on a loopback address",
+			slog.String("address", s.conf.ListenAddress))
+		return nil
+	}
+
+	instance := s.doorbell.Status().Instance
+
+	txt := []string{
+		"instance=" + instance,
+		"version=" + constants.Version,
+		"api=/api/v1",
+		"tls=" + strconv.FormatBool(s.conf.TLS != nil),
+		"auth=" + strconv.FormatBool(s.authRequired()),
+	}
+
+	server, err := zeroconf.Register(fmt.Sprintf("Cat Doorbell on %s", instance), serviceType, "local.", port, txt, nil)
+	if err != nil {
+		return fmt.Errorf("failed to advertise web server: %w", err)
+	}
+	defer server.Shutdown()
+
+	slog.Info("Advertising web server", slog.String("service", serviceType), slog.Int("port", port))
+
+	<-ctx.Done()
+
+	return nil
+}
+
+// isLoopback returns true if the host is only reachable from this machine.
+func isLoopback(host string) bool {
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,467 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/history"
+)
+
+const (
+	// defaultDetectionsLimit is the number of detections returned by the
+	// detections endpoint if no limit is given.
+	defaultDetectionsLimit = 100
+	// keepaliveInterval is how often a comment is sent on idle event streams,
+	// so proxies don't close them.
+	keepaliveInterval = 30 * time.Second
+)
+
+// Status is a snapshot of the doorbell state.
+type Status struct {
+	// Instance is the name of the doorbell.
+	Instance string `json:"instance"`
+	// Broker is the address of the MQTT broker, if any.
+	Broker string `json:"broker,omitempty"`
+	// Connected is true if the MQTT broker connection is up.
+	Connected bool `json:"connected"`
+	// Reconnecting is true if the MQTT broker connection is down and is
+	// being retried.
+	Reconnecting bool `json:"reconnecting,omitempty"`
+	// BrokerError is why the MQTT broker connection is down, if known.
+	BrokerError string `json:"brokerError,omitempty"`
+	// Brokers holds the status of the MQTT broker and each of its
+	// fallbacks, in order of priority, if fallbacks are configured.
+	Brokers []BrokerStatus `json:"brokers,omitempty"`
+	// Paused is true if notifications are paused.
+	Paused bool `json:"paused"`
+	// PausedUntil is when notifications will resume, if they are paused for
+	// a limited time.
+	PausedUntil *time.Time `json:"pausedUntil,omitempty"`
+	// Devices holds the state of each target device, sorted by name.
+	Devices []Device `json:"devices,omitempty"`
+	// Presence holds the presence of targets with presence tracking enabled.
+	Presence []Presence `json:"presence,omitempty"`
+	// Batteries holds the battery levels reported by targets.
+	Batteries []Battery `json:"batteries,omitempty"`
+	// Visit is the unacknowledged visit, if any.
+	Visit *Visit `json:"visit,omitempty"`
+	// GatewaySilent is true if no beacons have been received for the
+	// gateway timeout.
+	GatewaySilent bool `json:"gatewaySilent,omitempty"`
+	// Origins holds when a beacon was last received from each origin (eg.
+	// MQTT topic).
+	Origins []Origin `json:"origins,omitempty"`
+	// Maintenance is true if maintenance mode is active.
+	Maintenance bool `json:"maintenance,omitempty"`
+	// MaintenanceUntil is when maintenance mode ends, if it was started
+	// manually for a limited time.
+	MaintenanceUntil *time.Time `json:"maintenanceUntil,omitempty"`
+	// ExpectingUntil is when expect mode ends, if it is active.
+	ExpectingUntil *time.Time `json:"expectingUntil,omitempty"`
+}
+
+// Origin is where beacons are received from, eg. an MQTT topic.
+type Origin struct {
+	// Origin names where beacons are received from.
+	Origin string `json:"origin"`
+	// LastBeacon is when a beacon was last received from the origin.
+	LastBeacon time.Time `json:"lastBeacon"`
+}
+
+// Device is the state of a target device.
+type Device struct {
+	// Name is the name of the target.
+	Name string `json:"name"`
+	// LastSeen is when a beacon was last received from the device, if it
+	// has been seen.
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+	// RSSI is the smoothed signal strength of the device's last beacon in
+	// dBm, if known.
+	RSSI int `json:"rssi,omitempty"`
+	// Present is whether the device is nearby, if presence tracking is
+	// enabled for it.
+	Present *bool `json:"present,omitempty"`
+	// Since is when the device arrived or departed, if presence tracking is
+	// enabled for it.
+	Since *time.Time `json:"since,omitempty"`
+	// Battery is the battery level last reported by the device in percent,
+	// if it has reported one.
+	Battery *int `json:"battery,omitempty"`
+	// BatteryLow is true if the battery level is below the target's low
+	// battery level.
+	BatteryLow bool `json:"batteryLow,omitempty"`
+	// CooldownUntil is when the device can ring the doorbell again, if its
+	// last detection's timeout hasn't ended yet.
+	CooldownUntil *time.Time `json:"cooldownUntil,omitempty"`
+	// Visiting is true if the device rang the doorbell for the
+	// unacknowledged visit.
+	Visiting bool `json:"visiting,omitempty"`
+}
+
+// Presence is whether a target device is currently nearby.
+type Presence struct {
+	// Name is the name of the target.
+	Name string `json:"name"`
+	// Present is true if the device has been seen within its absence timeout.
+	Present bool `json:"present"`
+	// Since is when the device arrived or departed.
+	Since time.Time `json:"since"`
+}
+
+// BrokerStatus is the state of the connection to one of several MQTT brokers.
+type BrokerStatus struct {
+	// Address is the address of the broker.
+	Address string `json:"address"`
+	// Connected is true if the connection to the broker is up.
+	Connected bool `json:"connected"`
+	// Error is why the broker couldn't be reached, if known.
+	Error string `json:"error,omitempty"`
+}
+
+// Battery is the battery level last reported by a target device.
+type Battery struct {
+	// Name is the name of the target.
+	Name string `json:"name"`
+	// Level is the battery level in percent.
+	Level int `json:"level"`
+	// Low is true if the level is below the target's low battery level.
+	Low bool `json:"low,omitempty"`
+	// Updated is when the level was reported.
+	Updated time.Time `json:"updated"`
+}
+
+// Visit is a doorbell ring that hasn't been acknowledged yet.
+type Visit struct {
+	// Name is the name of the visiting target.
+	Name string `json:"name"`
+	// Time is when the doorbell rang.
+	Time time.Time `json:"time"`
+}
+
+type pauseRequest struct {
+	// Duration is how long to pause notifications (or start maintenance or
+	// expect mode) for (eg. "30m"). If not specified, it lasts until resumed
+	// (or stopped), or for the configured duration in expect mode.
+	Duration string `json:"duration,omitempty"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.doorbell.Status())
+}
+
+func (s *Server) handleDetections(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := history.Query{
+		NotifiedOnly: params.Get("all") != "true",
+		Events:       params["event"],
+		Limit:        defaultDetectionsLimit,
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		q.Limit, err = strconv.Atoi(limit)
+		if err != nil || q.Limit < 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", limit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if since := params.Get("since"); since != "" {
+		var err error
+		q.Since, err = parseSince(since, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	detections, err := s.history.List(r.Context(), q)
+	if err != nil {
+		slog.Warn("Failed to list detections", slog.Any("error", err))
+		http.Error(w, "failed to list detections", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range detections {
+		detections[i].MAC = s.doorbell.RedactMAC(detections[i].MAC)
+	}
+
+	if detections == nil {
+		detections = []history.Detection{}
+	}
+
+	writeJSON(w, detections)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	var req pauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.doorbell.Pause(duration)
+
+	writeJSON(w, s.doorbell.Status())
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.doorbell.Resume()
+
+	writeJSON(w, s.doorbell.Status())
+}
+
+func (s *Server) handleStartMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req pauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.doorbell.StartMaintenance(duration)
+
+	writeJSON(w, s.doorbell.Status())
+}
+
+func (s *Server) handleStopMaintenance(w http.ResponseWriter, r *http.Request) {
+	s.doorbell.StopMaintenance()
+
+	writeJSON(w, s.doorbell.Status())
+}
+
+func (s *Server) handleStartExpecting(w http.ResponseWriter, r *http.Request) {
+	var req pauseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			http.Error(w, fmt.Sprintf("invalid duration %q", req.Duration), http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.doorbell.StartExpecting(duration)
+
+	writeJSON(w, s.doorbell.Status())
+}
+
+func (s *Server) handleStopExpecting(w http.ResponseWriter, r *http.Request) {
+	s.doorbell.StopExpecting()
+
+	writeJSON(w, s.doorbell.Status())
+}
+
+// handleEvents streams events as they are recorded, using Server-Sent Events.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := s.doorbell.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.Warn("Failed to marshal event", slog.Any("error", err))
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data); err != nil {
+				return
+			}
+		}
+
+		flusher.Flush()
+	}
+}
+
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := history.Query{
+		NotifiedOnly: params.Get("all") != "true",
+		Events:       params["event"],
+		Oldest:       true,
+	}
+
+	if since := params.Get("since"); since != "" {
+		var err error
+		q.Since, err = parseSince(since, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	follow := params.Get("follow") == "true"
+
+	flusher, ok := w.(http.Flusher)
+	if follow && !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribe before exporting, so that detections recorded while
+	// exporting aren't missed. Events only wake the export, which reads
+	// them from the history, so none are lost if the client falls behind.
+	var events <-chan history.Detection
+	if follow {
+		var unsubscribe func()
+		events, unsubscribe = s.doorbell.Subscribe()
+		defer unsubscribe()
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+
+	// Each export resumes from the time of the last detection written,
+	// skipping the detections at that time that were already written.
+	var last time.Time
+	var writtenAtLast int
+	export := func() error {
+		skip := writtenAtLast
+		return s.history.Each(r.Context(), q, func(d history.Detection) error {
+			if skip > 0 && d.Time.Equal(last) {
+				skip--
+				return nil
+			}
+
+			if d.Time.Equal(last) {
+				writtenAtLast++
+			} else {
+				last, writtenAtLast = d.Time, 1
+			}
+
+			d.MAC = s.doorbell.RedactMAC(d.MAC)
+
+			// Writes block while the client isn't reading, which holds
+			// back reading the history.
+			return enc.Encode(d)
+		})
+	}
+
+	for {
+		if err := export(); err != nil {
+			if r.Context().Err() == nil {
+				slog.Warn("Failed to export detections", slog.Any("error", err))
+			}
+			return
+		}
+
+		if !follow {
+			return
+		}
+
+		flusher.Flush()
+
+		if !last.IsZero() {
+			q.Since = last
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-events:
+		}
+
+		// Several events may have been published since the stream was woken.
+		for len(events) > 0 {
+			<-events
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write response", slog.Any("error", err))
+	}
+}
+
+// parseSince parses either a duration before now (eg. "24h") or an RFC 3339
+// timestamp.
+func parseSince(since string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since value %q: expected a duration or RFC 3339 timestamp", since)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dpeckett/cat-doorbell/internal/homeassistant"
+)
+
+const (
+	// tokenPrefix identifies cat-doorbell API tokens (eg. for secret
+	// scanners).
+	tokenPrefix = "cdb_"
+	// tokenCookie is the cookie that remembers a token presented to the
+	// dashboard as a query parameter, so links within it keep working.
+	tokenCookie = "cat_doorbell_token"
+)
+
+// GenerateToken returns a new random API token.
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hash of an API token, as stored in the configuration.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// authRequired returns true if any tokens are configured.
+func (s *Server) authRequired() bool {
+	return s.conf.Token != "" || len(s.conf.Tokens) > 0
+}
+
+// validToken returns true if the token is the shared token, or matches one of
+// the configured token hashes, and whether the token is read-only.
+func (s *Server) validToken(token string) (valid, readOnly bool) {
+	if token == "" {
+		return false, false
+	}
+
+	valid = s.conf.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.conf.Token)) == 1
+
+	hash := []byte(HashToken(token))
+	for _, t := range s.conf.Tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			valid = true
+			readOnly = t.ReadOnly
+		}
+	}
+
+	return valid, readOnly
+}
+
+// permitted returns true if a token may make the request, read-only tokens
+// may only make requests that don't change anything. Evaluating a beacon is
+// a POST, for its body, but changes nothing.
+func permitted(r *http.Request, readOnly bool) bool {
+	return !readOnly || r.Method == http.MethodGet || r.Method == http.MethodHead ||
+		r.URL.Path == "/api/v1/evaluate"
+}
+
+// fromIngress returns true if the request was proxied by Home Assistant
+// ingress, which authenticates users itself, and ingress is trusted.
+func (s *Server) fromIngress(r *http.Request) bool {
+	if !s.conf.HomeAssistantIngress {
+		return false
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	return err == nil && host == homeassistant.IngressProxyIP
+}
+
+// authorize wraps a handler to require one of the configured tokens, if any.
+// Tokens are accepted as a bearer token, a "token" query parameter, or the
+// cookie set when a query parameter token is presented.
+func (s *Server) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authRequired() || s.fromIngress(r) {
+			next(w, r)
+			return
+		}
+
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			valid, readOnly := s.validToken(token)
+			if !valid {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			if !permitted(r, readOnly) {
+				http.Error(w, "token is read-only", http.StatusForbidden)
+				return
+			}
+
+			next(w, r)
+			return
+		}
+
+		if token := r.URL.Query().Get("token"); token != "" {
+			valid, readOnly := s.validToken(token)
+			if !valid {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+
+			if !permitted(r, readOnly) {
+				http.Error(w, "token is read-only", http.StatusForbidden)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     tokenCookie,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   s.conf.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+
+			next(w, r)
+			return
+		}
+
+		if cookie, err := r.Cookie(tokenCookie); err == nil {
+			if valid, readOnly := s.validToken(cookie.Value); valid {
+				if !permitted(r, readOnly) {
+					http.Error(w, "token is read-only", http.StatusForbidden)
+					return
+				}
+
+				next(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("WWW-Authenticate", `Bearer realm="cat-doorbell"`)
+		http.Error(w, "missing token", http.StatusUnauthorized)
+	}
+}
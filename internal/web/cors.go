@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// originPolicy wraps a handler to apply the configured CORS and framing
+// policies. Requests that change state from origins that aren't allowed are
+// rejected, so other sites can't use a browser to, eg. pause notifications.
+func (s *Server) originPolicy(next http.Handler) http.Handler {
+	frameAncestors := "frame-ancestors " + strings.Join(append([]string{"'self'"}, s.conf.FrameAncestors...), " ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", frameAncestors)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		allowed := s.corsAllowed(origin)
+		if allowed {
+			if slices.Contains(s.conf.CORS.AllowedOrigins, "*") {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			if s.conf.CORS.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		// Preflight requests.
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(s.conf.CORS.MaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if !allowed && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsAllowed returns true if the origin may call the API.
+func (s *Server) corsAllowed(origin string) bool {
+	if s.conf.CORS == nil {
+		return false
+	}
+
+	origin = strings.ToLower(origin)
+	return slices.Contains(s.conf.CORS.AllowedOrigins, "*") || slices.Contains(s.conf.CORS.AllowedOrigins, origin)
+}
+
+// sameOrigin returns true if the origin is the server itself.
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
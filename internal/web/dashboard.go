@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+)
+
+// recentVisitsLimit is the number of visits listed on the dashboard.
+const recentVisitsLimit = 20
+
+// visit is a notified detection, for display on the dashboard.
+type visit struct {
+	history.Detection
+	// Color is the accent colour of the device.
+	Color string
+}
+
+type dashboardData struct {
+	Heatmap *heatmap
+	Recent  []visit
+}
+
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	visits, err := s.history.List(r.Context(), history.Query{
+		Since:        heatmapStart(now),
+		NotifiedOnly: true,
+		Events:       []string{string(latestconfig.EventDetected)},
+	})
+	if err != nil {
+		slog.Warn("Failed to list visits", slog.Any("error", err))
+		http.Error(w, "failed to list visits", http.StatusInternalServerError)
+		return
+	}
+
+	recent, err := s.history.List(r.Context(), history.Query{
+		NotifiedOnly: true,
+		Limit:        recentVisitsLimit,
+	})
+	if err != nil {
+		slog.Warn("Failed to list recent detections", slog.Any("error", err))
+		http.Error(w, "failed to list recent detections", http.StatusInternalServerError)
+		return
+	}
+
+	colors := s.doorbell.TargetColors()
+
+	data := dashboardData{
+		Heatmap: newHeatmap(visits, now),
+	}
+	for _, d := range recent {
+		data.Recent = append(data.Recent, visit{Detection: d, Color: colors[d.Name]})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := s.tmpl.ExecuteTemplate(w, "dashboard.html", data); err != nil {
+		slog.Warn("Failed to render dashboard", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidBeacon is returned when a beacon to evaluate is invalid (eg. its
+// MAC address can't be parsed).
+var ErrInvalidBeacon = errors.New("invalid beacon")
+
+// Beacon is a hypothetical beacon to evaluate.
+type Beacon struct {
+	// MAC is the MAC address of the device.
+	MAC string `json:"mac"`
+	// RSSI is the received signal strength in dBm, or zero if unknown.
+	RSSI int `json:"rssi,omitempty"`
+	// Name is the advertised local name of the device, if any.
+	Name string `json:"name,omitempty"`
+	// Time is when the beacon is received. Defaults to now.
+	Time *time.Time `json:"time,omitempty"`
+	// Button is true if the beacon reports a button press on the device.
+	Button bool `json:"button,omitempty"`
+	// Battery is the battery level of the device in percent, if the beacon
+	// reports it.
+	Battery *int `json:"battery,omitempty"`
+}
+
+// Evaluation is what receiving a beacon would do, worked out without
+// ringing the doorbell, notifying, running actions or changing any state.
+type Evaluation struct {
+	// Time is when the beacon was taken to be received.
+	Time time.Time `json:"time"`
+	// MAC is the normalized MAC address of the device.
+	MAC string `json:"mac"`
+	// Target is the name of the target the device matches, if any.
+	Target string `json:"target,omitempty"`
+	// Overlaps are the names of the other targets the device matches, which
+	// the target takes precedence over.
+	Overlaps []string `json:"overlaps,omitempty"`
+	// Paused is true if notifications are paused.
+	Paused bool `json:"paused,omitempty"`
+	// Events are the events the beacon would raise, in order, followed by
+	// the custom events derived from each.
+	Events []EvaluatedEvent `json:"events"`
+}
+
+// EvaluatedEvent is an event a beacon would raise.
+type EvaluatedEvent struct {
+	// Event is the type of event.
+	Event string `json:"event"`
+	// DerivedFrom is the event a custom event is derived from.
+	DerivedFrom string `json:"derivedFrom,omitempty"`
+	// RSSI is the smoothed received signal strength in dBm (zero if
+	// unknown).
+	RSSI int `json:"rssi,omitempty"`
+	// Notify is true if the event would be notified.
+	Notify bool `json:"notify"`
+	// Reason is why the event wouldn't be notified (yet).
+	Reason string `json:"reason,omitempty"`
+	// Ring is true if the event would ring the doorbell.
+	Ring bool `json:"ring,omitempty"`
+	// Notifiers are the notifiers subscribed to the event.
+	Notifiers []string `json:"notifiers,omitempty"`
+	// Actions are the actions the event would run.
+	Actions []string `json:"actions,omitempty"`
+	// RateLimitedActions are the actions the event triggers, that wouldn't
+	// run because they ran too recently.
+	RateLimitedActions []string `json:"rateLimitedActions,omitempty"`
+}
+
+func (s *Server) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	var b Beacon
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	evaluation, err := s.doorbell.Evaluate(r.Context(), b)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrInvalidBeacon) {
+			status = http.StatusBadRequest
+		}
+
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	evaluation.MAC = s.doorbell.RedactMAC(evaluation.MAC)
+
+	writeJSON(w, evaluation)
+}
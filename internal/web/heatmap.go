@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/history"
+)
+
+// heatmapWeeks is the number of weeks shown in the calendar heatmap.
+const heatmapWeeks = 26
+
+// heatmapLevels is the number of shades used for non-zero counts.
+const heatmapLevels = 4
+
+type heatmapCell struct {
+	// Label describes the cell (eg. "Mon 2 Jan: 3 visits").
+	Label string
+	// Count is the number of visits.
+	Count int
+	// Level is the shade of the cell, from 0 (no visits) to heatmapLevels.
+	Level int
+}
+
+type heatmap struct {
+	// Calendar holds a column of seven days (Sunday first) for each week,
+	// oldest first. Days in the future are nil.
+	Calendar [][]*heatmapCell
+	// Hourly holds a row of 24 hours for each day of the week, Sunday first.
+	Hourly [7][24]heatmapCell
+	// Weekdays are the names of the days of the week, Sunday first.
+	Weekdays [7]string
+	// Total is the total number of visits.
+	Total int
+}
+
+// heatmapStart returns the start of the first day in the calendar heatmap,
+// which is always a Sunday.
+func heatmapStart(now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return today.AddDate(0, 0, -int(today.Weekday())-7*(heatmapWeeks-1))
+}
+
+// newHeatmap counts the visits by day and by hour of the week.
+func newHeatmap(visits []history.Detection, now time.Time) *heatmap {
+	start := heatmapStart(now)
+
+	h := &heatmap{Total: len(visits)}
+	for i := range h.Weekdays {
+		h.Weekdays[i] = time.Weekday(i).String()[:3]
+	}
+
+	daily := make(map[string]int)
+	for _, v := range visits {
+		t := v.Time.In(now.Location())
+		daily[t.Format(time.DateOnly)]++
+		h.Hourly[t.Weekday()][t.Hour()].Count++
+	}
+
+	var maxDaily int
+	for _, count := range daily {
+		maxDaily = max(maxDaily, count)
+	}
+
+	for week := 0; week < heatmapWeeks; week++ {
+		days := make([]*heatmapCell, 7)
+		for weekday := range days {
+			date := start.AddDate(0, 0, 7*week+weekday)
+			if date.After(now) {
+				continue
+			}
+
+			count := daily[date.Format(time.DateOnly)]
+			days[weekday] = &heatmapCell{
+				Label: fmt.Sprintf("%s: %s", date.Format("Mon 2 Jan"), visitsLabel(count)),
+				Count: count,
+				Level: level(count, maxDaily),
+			}
+		}
+
+		h.Calendar = append(h.Calendar, days)
+	}
+
+	var maxHourly int
+	for weekday := range h.Hourly {
+		for hour := range h.Hourly[weekday] {
+			maxHourly = max(maxHourly, h.Hourly[weekday][hour].Count)
+		}
+	}
+
+	for weekday := range h.Hourly {
+		for hour := range h.Hourly[weekday] {
+			cell := &h.Hourly[weekday][hour]
+			cell.Label = fmt.Sprintf("%s %02d:00: %s", h.Weekdays[weekday], hour, visitsLabel(cell.Count))
+			cell.Level = level(cell.Count, maxHourly)
+		}
+	}
+
+	return h
+}
+
+// level returns the shade for the count, relative to the maximum count.
+func level(count, maxCount int) int {
+	if count == 0 {
+		return 0
+	}
+
+	return max(1, (count*heatmapLevels+maxCount-1)/maxCount)
+}
+
+func visitsLabel(count int) string {
+	if count == 1 {
+		return "1 visit"
+	}
+
+	return fmt.Sprintf("%d visits", count)
+}
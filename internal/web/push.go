@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/dpeckett/cat-doorbell/internal/assets"
+	"github.com/dpeckett/cat-doorbell/internal/webpush"
+)
+
+// static holds the files that make the dashboard an installable progressive
+// web app. They don't reveal anything about the household, so are served
+// without a token (browsers fetch manifests without credentials).
+//
+//go:embed static/*
+var static embed.FS
+
+func (s *Server) handleManifest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/manifest+json")
+	http.ServeFileFS(w, r, static, "static/manifest.webmanifest")
+}
+
+func (s *Server) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	// Browsers check for an updated service worker on each visit.
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFileFS(w, r, static, "static/sw.js")
+}
+
+func (s *Server) handleIcon(w http.ResponseWriter, r *http.Request) {
+	icon, err := assets.ReadFile("cat-icon.png")
+	if err != nil {
+		slog.Warn("Failed to read icon", slog.Any("error", err))
+		http.Error(w, "failed to read icon", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	_, _ = w.Write(icon)
+}
+
+// pushKey is the response to a request for the web push key.
+type pushKey struct {
+	// PublicKey is the VAPID public key browsers subscribe with, base64url
+	// encoded.
+	PublicKey string `json:"publicKey"`
+}
+
+func (s *Server) handlePushKey(w http.ResponseWriter, r *http.Request) {
+	if !s.doorbell.PushEnabled() {
+		http.Error(w, "web push is not enabled", http.StatusNotFound)
+		return
+	}
+
+	key, err := s.push.PublicKey()
+	if err != nil {
+		slog.Warn("Failed to get web push key", slog.Any("error", err))
+		http.Error(w, "failed to get web push key", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, pushKey{PublicKey: key})
+}
+
+func (s *Server) handlePushSubscribe(w http.ResponseWriter, r *http.Request) {
+	if !s.doorbell.PushEnabled() {
+		http.Error(w, "web push is not enabled", http.StatusNotFound)
+		return
+	}
+
+	var sub webpush.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := sub.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("invalid subscription: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.push.Subscribe(sub); err != nil {
+		slog.Warn("Failed to add push subscription", slog.Any("error", err))
+		http.Error(w, "failed to add subscription", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("Browser subscribed to push notifications", slog.String("remoteAddr", r.RemoteAddr))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unsubscribeRequest is the body of a request to remove a push subscription.
+type unsubscribeRequest struct {
+	// Endpoint is the endpoint of the subscription.
+	Endpoint string `json:"endpoint"`
+}
+
+func (s *Server) handlePushUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	var req unsubscribeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	removed, err := s.push.Unsubscribe(req.Endpoint)
+	if err != nil {
+		slog.Warn("Failed to remove push subscription", slog.Any("error", err))
+		http.Error(w, "failed to remove subscription", http.StatusInternalServerError)
+		return
+	}
+
+	if !removed {
+		http.Error(w, "subscription not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package web serves the web dashboard and REST API.
+package web
+
+import (
+	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/webpush"
+)
+
+//go:embed templates/*
+var templates embed.FS
+
+// shutdownTimeout is how long to wait for in-flight requests when the server
+// is stopped.
+const shutdownTimeout = 5 * time.Second
+
+// Doorbell is the doorbell state exposed by the server.
+type Doorbell interface {
+	// TargetColors returns the accent colour of each target, by name.
+	TargetColors() map[string]string
+	// Acknowledge acknowledges the current visit, returning the name of the
+	// visiting target or false if there was no visit to acknowledge.
+	Acknowledge(ctx context.Context, origin string) (string, bool)
+	// PressDoorbell rings the doorbell on behalf of another doorbell,
+	// returning false if there is no doorbell with the given name.
+	PressDoorbell(ctx context.Context, name string) bool
+	// Status returns a snapshot of the doorbell state.
+	Status() Status
+	// Pause suppresses notifications for the given duration, or until Resume
+	// is called if the duration is zero.
+	Pause(duration time.Duration)
+	// Resume re-enables notifications.
+	Resume()
+	// StartMaintenance starts maintenance mode for the given duration, or
+	// until StopMaintenance is called if the duration is zero.
+	StartMaintenance(duration time.Duration)
+	// StopMaintenance ends manually started maintenance mode.
+	StopMaintenance()
+	// StartExpecting starts expect mode for the given duration, or for the
+	// configured duration if it is zero.
+	StartExpecting(duration time.Duration)
+	// StopExpecting ends expect mode early.
+	StopExpecting()
+	// Subscribe returns a channel that receives every recorded event, and a
+	// function to unsubscribe.
+	Subscribe() (<-chan history.Detection, func())
+	// RedactMAC redacts a MAC address according to the privacy configuration.
+	RedactMAC(mac string) string
+	// PushEnabled returns true if browsers may subscribe to web push
+	// notifications.
+	PushEnabled() bool
+	// Evaluate works out what receiving a beacon would do, without doing
+	// it.
+	Evaluate(ctx context.Context, b Beacon) (Evaluation, error)
+}
+
+// Server serves the web dashboard.
+type Server struct {
+	conf     latestconfig.WebConfig
+	history  history.Store
+	push     *webpush.Service
+	doorbell Doorbell
+	tmpl     *template.Template
+	// certDir is where the generated certificate (and local certificate
+	// authority) is stored, if TLS is enabled without a certificate.
+	certDir string
+
+	certMu sync.Mutex
+	// cert is the certificate being served, if TLS is enabled.
+	cert *tls.Certificate
+}
+
+// New creates a new web dashboard server. Browsers that enable notifications
+// are subscribed to the push service, and generated certificates are stored
+// in certDir.
+func New(conf latestconfig.WebConfig, store history.Store, push *webpush.Service, doorbell Doorbell, certDir string) (*Server, error) {
+	tmpl, err := template.New("").Funcs(template.FuncMap{
+		"add": func(a, b int) int { return a + b },
+		"mul": func(a, b int) int { return a * b },
+		"mod": func(a, b int) int { return a % b },
+		"hours": func() []int {
+			hours := make([]int, 24)
+			for i := range hours {
+				hours[i] = i
+			}
+			return hours
+		},
+	}).ParseFS(templates, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+
+	return &Server{
+		conf:     conf,
+		history:  store,
+		push:     push,
+		doorbell: doorbell,
+		tmpl:     tmpl,
+		certDir:  certDir,
+	}, nil
+}
+
+// Run serves the dashboard until the context is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.authorize(s.handleDashboard))
+	mux.HandleFunc("POST /webhook/acknowledge", s.authorize(s.handleAcknowledge))
+	mux.HandleFunc("POST /webhook/doorbell/{name}", s.authorize(s.handleDoorbell))
+	mux.HandleFunc("GET /api/v1/status", s.authorize(s.handleStatus))
+	mux.HandleFunc("GET /api/v1/detections", s.authorize(s.handleDetections))
+	mux.HandleFunc("GET /api/v1/events", s.authorize(s.handleEvents))
+	mux.HandleFunc("GET /api/v1/export", s.authorize(s.handleExport))
+	mux.HandleFunc("POST /api/v1/pause", s.authorize(s.handlePause))
+	mux.HandleFunc("POST /api/v1/resume", s.authorize(s.handleResume))
+	mux.HandleFunc("POST /api/v1/maintenance/start", s.authorize(s.handleStartMaintenance))
+	mux.HandleFunc("POST /api/v1/maintenance/stop", s.authorize(s.handleStopMaintenance))
+	mux.HandleFunc("POST /api/v1/expect/start", s.authorize(s.handleStartExpecting))
+	mux.HandleFunc("POST /api/v1/expect/stop", s.authorize(s.handleStopExpecting))
+	mux.HandleFunc("POST /api/v1/evaluate", s.authorize(s.handleEvaluate))
+	mux.HandleFunc("GET /api/v1/push/key", s.authorize(s.handlePushKey))
+	mux.HandleFunc("POST /api/v1/push/subscribe", s.authorize(s.handlePushSubscribe))
+	mux.HandleFunc("POST /api/v1/push/unsubscribe", s.authorize(s.handlePushUnsubscribe))
+	mux.HandleFunc("GET /manifest.webmanifest", s.handleManifest)
+	mux.HandleFunc("GET /sw.js", s.handleServiceWorker)
+	mux.HandleFunc("GET /icon.png", s.handleIcon)
+	mux.HandleFunc("GET /ca.crt", s.handleCA)
+
+	srv := &http.Server{
+		Addr:              s.conf.ListenAddress,
+		Handler:           s.originPolicy(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Cancel long-lived requests (ie. event streams) on shutdown.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	if s.conf.TLS != nil {
+		if _, err := s.getCertificate(nil); err != nil {
+			return err
+		}
+
+		srv.TLSConfig = &tls.Config{
+			GetCertificate: s.getCertificate,
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Failed to shut down web server", slog.Any("error", err))
+		}
+	}()
+
+	if s.conf.Advertise {
+		go func() {
+			if err := s.advertise(ctx); err != nil {
+				slog.Warn("Failed to advertise web server", slog.Any("error", err))
+			}
+		}()
+	}
+
+	slog.Info("Serving web dashboard", slog.String("address", s.conf.ListenAddress),
+		slog.Bool("tls", s.conf.TLS != nil), slog.Bool("auth", s.authRequired()))
+
+	if !s.authRequired() {
+		if host, _, _ := net.SplitHostPort(s.conf.ListenAddress); !isLoopback(host) {
+			slog.Warn("Web server is reachable from the network without authentication, create a token with \"cat-doorbell token create\"")
+		}
+	}
+
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve web dashboard: %w", err)
+	}
+
+	return ctx.Err()
+}
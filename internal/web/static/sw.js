@@ -0,0 +1,39 @@
+// Service worker for the cat-doorbell dashboard, which displays web push
+// notifications and opens the dashboard when one is clicked.
+
+self.addEventListener('install', () => self.skipWaiting());
+
+self.addEventListener('activate', (event) => event.waitUntil(self.clients.claim()));
+
+self.addEventListener('push', (event) => {
+  let msg = { title: 'Cat Doorbell', message: '' };
+  if (event.data) {
+    try {
+      msg = event.data.json();
+    } catch (e) {
+      msg.message = event.data.text();
+    }
+  }
+
+  event.waitUntil(self.registration.showNotification(msg.title, {
+    body: msg.message,
+    icon: '/icon.png',
+    badge: '/icon.png',
+    tag: msg.name ? `${msg.event}:${msg.name}` : msg.event,
+    timestamp: msg.time ? Date.parse(msg.time) : Date.now(),
+  }));
+});
+
+self.addEventListener('notificationclick', (event) => {
+  event.notification.close();
+
+  event.waitUntil(self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then((clients) => {
+    for (const client of clients) {
+      if ('focus' in client) {
+        return client.focus();
+      }
+    }
+
+    return self.clients.openWindow('/');
+  }));
+});
@@ -0,0 +1,379 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// selfSignedValidity is how long self-signed certificates are valid for.
+	selfSignedValidity = 5 * 365 * 24 * time.Hour
+	// issuedValidity is how long certificates issued by the local
+	// certificate authority are valid for. Browsers (and Apple devices in
+	// particular) reject longer lived server certificates.
+	issuedValidity = 397 * 24 * time.Hour
+	// caValidity is how long the local certificate authority is valid for.
+	caValidity = 10 * 365 * 24 * time.Hour
+	// renewBefore is how long before expiry generated certificates are
+	// replaced.
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// authority is the local certificate authority.
+type authority struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// LocalCA returns the certificate of the local certificate authority stored
+// in certDir, creating the authority if it doesn't exist yet.
+func LocalCA(certDir string) (*x509.Certificate, error) {
+	ca, err := loadAuthority(certDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return ca.cert, nil
+}
+
+// getCertificate returns the certificate to serve, replacing a generated
+// certificate once it is due for renewal.
+func (s *Server) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.certMu.Lock()
+	defer s.certMu.Unlock()
+
+	if s.cert != nil && (s.conf.TLS.CertFile != "" || time.Until(s.cert.Leaf.NotAfter) > renewBefore) {
+		return s.cert, nil
+	}
+
+	cert, err := s.loadCertificate()
+	if err != nil {
+		if s.cert != nil {
+			slog.Warn("Failed to renew certificate", slog.Any("error", err))
+			return s.cert, nil
+		}
+
+		return nil, err
+	}
+
+	s.cert = &cert
+	return s.cert, nil
+}
+
+// loadCertificate loads the configured certificate, or a generated
+// certificate (generating it if necessary) if none is configured. Generated
+// certificates are self-signed, or issued by the local certificate
+// authority.
+func (s *Server) loadCertificate() (tls.Certificate, error) {
+	if s.conf.TLS.CertFile != "" {
+		cert, err := loadKeyPair(s.conf.TLS.CertFile, s.conf.TLS.KeyFile)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+
+		return cert, nil
+	}
+
+	certPath := filepath.Join(s.certDir, "cert.pem")
+	keyPath := filepath.Join(s.certDir, "key.pem")
+
+	var ca *authority
+	if s.conf.TLS.LocalCA {
+		var err error
+		ca, err = loadAuthority(s.certDir)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+
+		certPath = filepath.Join(s.certDir, "issued-cert.pem")
+		keyPath = filepath.Join(s.certDir, "issued-key.pem")
+	}
+
+	cert, err := loadKeyPair(certPath, keyPath)
+	if err == nil && s.current(cert.Leaf, ca) {
+		return cert, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Replacing unreadable certificate", slog.Any("error", err))
+	}
+
+	if err := generateCertificate(certPath, keyPath, s.conf.TLS.Hosts, ca); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert, err = loadKeyPair(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	sum := sha256.Sum256(cert.Leaf.Raw)
+	if ca != nil {
+		slog.Info("Issued certificate from the local certificate authority",
+			slog.String("path", certPath), slog.Time("notAfter", cert.Leaf.NotAfter))
+	} else {
+		slog.Info("Generated self-signed certificate",
+			slog.String("path", certPath), slog.String("fingerprint", hex.EncodeToString(sum[:])))
+	}
+
+	return cert, nil
+}
+
+// current returns true if a generated certificate can still be served: it
+// isn't due for renewal, is valid for the configured hosts, and was issued by
+// the local certificate authority (if any).
+func (s *Server) current(cert *x509.Certificate, ca *authority) bool {
+	if time.Until(cert.NotAfter) <= renewBefore {
+		return false
+	}
+
+	for _, host := range s.conf.TLS.Hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+
+	return ca == nil || cert.CheckSignatureFrom(ca.cert) == nil
+}
+
+// loadKeyPair loads a certificate and its private key, parsing the leaf
+// certificate.
+func loadKeyPair(certPath, keyPath string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// loadAuthority loads the local certificate authority from certDir, creating
+// it if it doesn't exist.
+func loadAuthority(certDir string) (*authority, error) {
+	certPath := filepath.Join(certDir, "ca.pem")
+	keyPath := filepath.Join(certDir, "ca-key.pem")
+
+	pair, err := loadKeyPair(certPath, keyPath)
+	if err == nil {
+		key, ok := pair.PrivateKey.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("failed to load certificate authority: unsupported private key")
+		}
+
+		return &authority{cert: pair.Leaf, key: key}, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load certificate authority: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "cat-doorbell CA (" + hostname + ")", Organization: []string{"cat-doorbell"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate authority: %w", err)
+	}
+
+	if err := writeKeyPair(certPath, keyPath, der, key); err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate authority: %w", err)
+	}
+
+	sum := sha256.Sum256(der)
+	slog.Info("Created local certificate authority",
+		slog.String("path", certPath), slog.String("fingerprint", hex.EncodeToString(sum[:])))
+
+	return &authority{cert: cert, key: key}, nil
+}
+
+// generateCertificate writes a new certificate, valid for the host's name and
+// addresses and the given hosts, and its private key to the given paths. The
+// certificate is issued by the certificate authority, or self-signed if it is
+// nil.
+func generateCertificate(certPath, keyPath string, hosts []string, ca *authority) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate private key: %w", err)
+	}
+
+	serial, err := serialNumber()
+	if err != nil {
+		return err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname, Organization: []string{"cat-doorbell"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{hostname, hostname + ".local", "localhost"},
+		IPAddresses:           hostAddresses(),
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	parent, signer := template, crypto.Signer(key)
+	if ca != nil {
+		template.NotAfter = now.Add(issuedValidity)
+		parent, signer = ca.cert, ca.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return fmt.Errorf("failed to create certificate: %w", err)
+	}
+
+	return writeKeyPair(certPath, keyPath, der, key)
+}
+
+// serialNumber returns a random certificate serial number.
+func serialNumber() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	return serial, nil
+}
+
+// writeKeyPair writes a DER encoded certificate and its private key, PEM
+// encoded, to the given paths.
+func writeKeyPair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0o700); err != nil {
+		return fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	return nil
+}
+
+// handleCA serves the certificate of the local certificate authority, so
+// phones and tablets can download and install it.
+func (s *Server) handleCA(w http.ResponseWriter, r *http.Request) {
+	if s.conf.TLS == nil || !s.conf.TLS.LocalCA {
+		http.NotFound(w, r)
+		return
+	}
+
+	ca, err := LocalCA(s.certDir)
+	if err != nil {
+		slog.Warn("Failed to load certificate authority", slog.Any("error", err))
+		http.Error(w, "failed to load certificate authority", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	w.Header().Set("Content-Disposition", `attachment; filename="cat-doorbell-ca.crt"`)
+	_, _ = w.Write(ca.Raw)
+}
+
+// hostAddresses returns the IP addresses of the host's network interfaces.
+func hostAddresses() []net.IP {
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		slog.Warn("Failed to list network addresses", slog.Any("error", err))
+		return ips
+	}
+
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+
+	return ips
+}
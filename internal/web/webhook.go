@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+type acknowledgeResponse struct {
+	// Name is the name of the target whose visit was acknowledged.
+	Name string `json:"name"`
+}
+
+// handleAcknowledge acknowledges the current visit on behalf of an external
+// system (eg. a Home Assistant automation or a smart button by the door).
+func (s *Server) handleAcknowledge(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.doorbell.Acknowledge(r.Context(), "webhook")
+	if !ok {
+		http.Error(w, "no visit to acknowledge", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(acknowledgeResponse{Name: name}); err != nil {
+		slog.Warn("Failed to write response", slog.Any("error", err))
+	}
+}
+
+// handleDoorbell rings the doorbell when another doorbell (eg. a Ring or
+// Reolink video doorbell) is pressed. The request body, whose format differs
+// between doorbells, is ignored.
+func (s *Server) handleDoorbell(w http.ResponseWriter, r *http.Request) {
+	// Notifications are delivered after the response has been written.
+	if !s.doorbell.PressDoorbell(context.WithoutCancel(r.Context()), r.PathValue("name")) {
+		http.Error(w, "unknown doorbell", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,535 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+// Package webpush sends Web Push messages to browsers, without a third-party
+// service. Messages are encrypted as described in RFC 8291, and signed with
+// the application server (VAPID) key described in RFC 8292.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// keyFile is the name of the file the VAPID private key is stored in.
+	keyFile = "vapid.pem"
+	// subscriptionsFile is the name of the file subscriptions are stored in.
+	subscriptionsFile = "subscriptions.json"
+	// recordSize is the record size advertised in the encrypted content
+	// header. Messages are always sent as a single record.
+	recordSize = 4096
+	// maxPayloadSize is the largest payload that fits in a single record,
+	// after the padding delimiter and authentication tag.
+	maxPayloadSize = recordSize - 17
+	// tokenLifetime is how long the signed VAPID tokens are valid for (at
+	// most 24 hours).
+	tokenLifetime = 12 * time.Hour
+)
+
+// Urgency is how urgently a message should be delivered, push services may
+// delay less urgent messages to save the device's battery.
+type Urgency string
+
+const (
+	UrgencyLow    Urgency = "low"
+	UrgencyNormal Urgency = "normal"
+	UrgencyHigh   Urgency = "high"
+)
+
+// Subscription is a browser's push subscription, as returned by
+// PushSubscription.toJSON().
+type Subscription struct {
+	// Endpoint is the push service URL messages are sent to.
+	Endpoint string `json:"endpoint"`
+	// Keys are the browser's public key and authentication secret, messages
+	// are encrypted with.
+	Keys SubscriptionKeys `json:"keys"`
+}
+
+type SubscriptionKeys struct {
+	// P256dh is the browser's P-256 public key, base64url encoded.
+	P256dh string `json:"p256dh"`
+	// Auth is the browser's authentication secret, base64url encoded.
+	Auth string `json:"auth"`
+}
+
+// Validate checks that the subscription can be sent messages.
+func (s *Subscription) Validate() error {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("invalid endpoint %q: expected an https URL", s.Endpoint)
+	}
+
+	if _, err := ecdh.P256().NewPublicKey(decode(s.Keys.P256dh)); err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	if len(decode(s.Keys.Auth)) != 16 {
+		return errors.New("invalid auth secret: expected 16 bytes")
+	}
+
+	return nil
+}
+
+// Options are the delivery options of a message.
+type Options struct {
+	// Subject is a contact for the application server (a "mailto:" or
+	// "https:" URL), push services may use it to report problems.
+	Subject string
+	// TTL is how long the push service keeps the message if the browser
+	// isn't reachable.
+	TTL time.Duration
+	// Urgency is how urgently the message should be delivered.
+	Urgency Urgency
+}
+
+// Service stores the VAPID key and the subscriptions of the browsers that
+// receive messages.
+type Service struct {
+	dir    string
+	client *http.Client
+
+	mu            sync.Mutex
+	key           *ecdsa.PrivateKey
+	subscriptions []Subscription
+}
+
+// Open opens the service stored in the given directory. The VAPID key is
+// generated the first time it is needed.
+func Open(dir string) (*Service, error) {
+	s := &Service{
+		dir:    dir,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, subscriptionsFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read push subscriptions: %w", err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.subscriptions); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal push subscriptions: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// PublicKey returns the VAPID public key, base64url encoded, which browsers
+// subscribe with.
+func (s *Service) PublicKey() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.vapidKey()
+	if err != nil {
+		return "", err
+	}
+
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		return "", fmt.Errorf("failed to convert VAPID key: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(pub.Bytes()), nil
+}
+
+// Subscribe adds (or replaces) a subscription.
+func (s *Service) Subscribe(sub Subscription) error {
+	if err := sub.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscriptions = slices.DeleteFunc(s.subscriptions, func(existing Subscription) bool {
+		return existing.Endpoint == sub.Endpoint
+	})
+	s.subscriptions = append(s.subscriptions, sub)
+
+	return s.save()
+}
+
+// Unsubscribe removes the subscription with the given endpoint, returning
+// false if there was no such subscription.
+func (s *Service) Unsubscribe(endpoint string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.subscriptions)
+	s.subscriptions = slices.DeleteFunc(s.subscriptions, func(sub Subscription) bool {
+		return sub.Endpoint == endpoint
+	})
+	if len(s.subscriptions) == n {
+		return false, nil
+	}
+
+	return true, s.save()
+}
+
+// Subscriptions returns the current subscriptions.
+func (s *Service) Subscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.subscriptions)
+}
+
+// Broadcast sends the payload to every subscription. Subscriptions the push
+// service reports have expired (or been unsubscribed) are removed.
+func (s *Service) Broadcast(ctx context.Context, payload []byte, opts Options) error {
+	var errs []error
+	for _, sub := range s.Subscriptions() {
+		err := s.Send(ctx, sub, payload, opts)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Gone() {
+			slog.Info("Removing expired push subscription", slog.String("endpoint", sub.Endpoint))
+
+			if _, err := s.Unsubscribe(sub.Endpoint); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// StatusError is returned when a push service rejects a message.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.Code)
+}
+
+// Gone returns true if the subscription no longer exists.
+func (e *StatusError) Gone() bool {
+	return e.Code == http.StatusNotFound || e.Code == http.StatusGone
+}
+
+// Send encrypts the payload for the subscription, and sends it to its push
+// service.
+func (s *Service) Send(ctx context.Context, sub Subscription, payload []byte, opts Options) error {
+	if len(payload) > maxPayloadSize {
+		return fmt.Errorf("payload too large: %d bytes (at most %d)", len(payload), maxPayloadSize)
+	}
+
+	body, err := encrypt(sub, payload)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	authorization, err := s.authorization(sub.Endpoint, opts.Subject)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(opts.TTL.Seconds())))
+	if opts.Urgency != "" {
+		req.Header.Set("Urgency", string(opts.Urgency))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &StatusError{Code: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// authorization returns the VAPID Authorization header for messages sent to
+// the endpoint.
+func (s *Service) authorization(endpoint, subject string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse endpoint: %w", err)
+	}
+
+	s.mu.Lock()
+	key, err := s.vapidKey()
+	s.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": time.Now().Add(tokenLifetime).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal claims: %w", err)
+	}
+
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, sig, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	// JWS signatures are the fixed size concatenation of r and s.
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	sig.FillBytes(signature[32:])
+
+	pub, err := key.PublicKey.ECDH()
+	if err != nil {
+		return "", fmt.Errorf("failed to convert VAPID key: %w", err)
+	}
+
+	return fmt.Sprintf("vapid t=%s.%s, k=%s", unsigned, base64.RawURLEncoding.EncodeToString(signature),
+		base64.RawURLEncoding.EncodeToString(pub.Bytes())), nil
+}
+
+// vapidKey returns the VAPID private key, generating it if it doesn't exist
+// yet. Must be called with the lock held.
+func (s *Service) vapidKey() (*ecdsa.PrivateKey, error) {
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	path := filepath.Join(s.dir, keyFile)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("failed to decode VAPID key: %s is not PEM encoded", path)
+		}
+
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse VAPID key: %w", err)
+		}
+
+		s.key = key
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read VAPID key: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate VAPID key: %w", err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal VAPID key: %w", err)
+	}
+
+	if err := writeFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, fmt.Errorf("failed to write VAPID key: %w", err)
+	}
+
+	slog.Info("Generated web push key", slog.String("path", path))
+
+	s.key = key
+	return key, nil
+}
+
+// save writes the subscriptions to disk. Must be called with the lock held.
+func (s *Service) save() error {
+	data, err := json.Marshal(s.subscriptions)
+	if err != nil {
+		return fmt.Errorf("failed to marshal push subscriptions: %w", err)
+	}
+
+	if err := writeFile(filepath.Join(s.dir, subscriptionsFile), data); err != nil {
+		return fmt.Errorf("failed to write push subscriptions: %w", err)
+	}
+
+	return nil
+}
+
+// writeFile atomically replaces the file at the given path, which is only
+// readable by the current user.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	return nil
+}
+
+// encrypt encrypts the payload for the subscription as a single aes128gcm
+// record (RFC 8291), with a new key and salt.
+func encrypt(sub Subscription, payload []byte) ([]byte, error) {
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	return encryptWith(sub, payload, asPrivate, salt)
+}
+
+// encryptWith encrypts the payload for the subscription with the given
+// application server key and salt.
+func encryptWith(sub Subscription, payload []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	uaPublic, err := ecdh.P256().NewPublicKey(decode(sub.Keys.P256dh))
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	authSecret := decode(sub.Keys.Auth)
+	if len(authSecret) != 16 {
+		return nil, errors.New("invalid auth secret: expected 16 bytes")
+	}
+
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic.Bytes()...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm, err := expand(hkdf.Extract(sha256.New, sharedSecret, authSecret), keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	prk := hkdf.Extract(sha256.New, ikm, salt)
+	cek, err := expand(prk, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := expand(prk, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	// The header is the salt, record size and the server's public key.
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	// A single (last) record is delimited by 0x02, without padding.
+	plaintext := append(slices.Clone(payload), 0x02)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// expand derives length bytes of keying material with HKDF-Expand.
+func expand(prk, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, prk, info), out); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	return out, nil
+}
+
+// decode decodes a base64url value, with or without padding (browsers differ).
+func decode(s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil
+	}
+
+	return b
+}
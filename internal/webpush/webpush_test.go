@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package webpush
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/base64"
+	"testing"
+)
+
+// TestEncryptKnownAnswer checks encryption against the example in RFC 8291
+// section 5.
+func TestEncryptKnownAnswer(t *testing.T) {
+	const (
+		plaintext = "When I grow up, I want to be a watermelon"
+		asPrivate = "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"
+		asPublic  = "BP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A8"
+		uaPublic  = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+		salt      = "DGv6ra1nlYgDCS1FRnbzlw"
+		auth      = "BTBZMqHH6r4Tts7J_aSIgg"
+		want      = "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	)
+
+	key, err := ecdh.P256().NewPrivateKey(decode(asPrivate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()); got != asPublic {
+		t.Fatalf("application server public key = %s, want %s", got, asPublic)
+	}
+
+	sub := Subscription{
+		Endpoint: "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV",
+		Keys:     SubscriptionKeys{P256dh: uaPublic, Auth: auth},
+	}
+
+	got, err := encryptWith(sub, []byte(plaintext), key, decode(salt))
+	if err != nil {
+		t.Fatalf("encryptWith() failed: %v", err)
+	}
+
+	if !bytes.Equal(got, decode(want)) {
+		t.Errorf("encryptWith() = %s, want %s", base64.RawURLEncoding.EncodeToString(got), want)
+	}
+}
+
+func TestEncryptInvalidKeys(t *testing.T) {
+	const (
+		uaPublic = "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"
+		auth     = "BTBZMqHH6r4Tts7J_aSIgg"
+	)
+
+	tests := []struct {
+		name string
+		keys SubscriptionKeys
+	}{
+		{"missing p256dh key", SubscriptionKeys{Auth: auth}},
+		{"truncated p256dh key", SubscriptionKeys{P256dh: uaPublic[:40], Auth: auth}},
+		{"missing auth secret", SubscriptionKeys{P256dh: uaPublic}},
+		{"short auth secret", SubscriptionKeys{P256dh: uaPublic, Auth: auth[:10]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := encrypt(Subscription{Keys: tt.keys}, []byte("hello")); err == nil {
+				t.Error("encrypt() succeeded, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/dpeckett/cat-doorbell/internal/config"
+	"github.com/dpeckett/cat-doorbell/internal/control"
+	"github.com/dpeckett/cat-doorbell/internal/locale"
+	"github.com/dpeckett/cat-doorbell/internal/secret"
+	"github.com/urfave/cli/v2"
+)
+
+// commandUsageTemplate is urfave/cli's usage line of the command help, which
+// is inlined so its placeholders can be translated.
+const commandUsageTemplate = `{{if .UsageText}}{{wrap .UsageText 3}}{{else}}{{.HelpName}}{{if .VisibleFlags}} [command options]{{end}}{{if .ArgsUsage}} {{.ArgsUsage}}{{else}}{{if .Args}} [arguments...]{{end}}{{end}}{{end}}`
+
+// errorTexts are the parts of common error messages that are translated.
+var errorTexts = []string{
+	control.ErrNotRunning.Error(),
+	control.ErrAlreadyRunning.Error(),
+	control.ErrDeveloperMode.Error(),
+	config.ErrTargetNotFound.Error(),
+	config.ErrTokenNotFound.Error(),
+	secret.ErrNotFound.Error(),
+	"failed to connect to control socket",
+	"failed to load configuration",
+	"no configuration file found",
+	"looked for",
+	"no such file or directory",
+	"permission denied",
+	"connection refused",
+	"flag provided but not defined",
+	"flag needs an argument",
+}
+
+// cliLang returns the language of the command line help and messages, from
+// the --lang flag if it is given, or otherwise the user's environment. The
+// arguments are scanned before they are parsed, as the help may be shown
+// while parsing them.
+func cliLang(args []string) string {
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+
+		switch {
+		case arg == "--lang" || arg == "-lang":
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		case strings.HasPrefix(arg, "--lang="):
+			return strings.TrimPrefix(arg, "--lang=")
+		case strings.HasPrefix(arg, "-lang="):
+			return strings.TrimPrefix(arg, "-lang=")
+		}
+	}
+
+	return locale.FromEnvironment()
+}
+
+// localizeApp translates the help templates, and the usage and description
+// of the application's commands and flags (including the built-in help
+// command and flags), into a language.
+func localizeApp(app *cli.App, lang string) {
+	if _, ok := locale.Lookup(lang); !ok {
+		return
+	}
+
+	t := func(text string) string {
+		return locale.CLI(lang, text)
+	}
+
+	headings := strings.NewReplacer(
+		"NAME:", t("NAME:"),
+		"USAGE:", t("USAGE:"),
+		"VERSION:", t("VERSION:"),
+		"DESCRIPTION:", t("DESCRIPTION:"),
+		"CATEGORY:", t("CATEGORY:"),
+		"COMMANDS:", t("COMMANDS:"),
+		"GLOBAL OPTIONS:", t("GLOBAL OPTIONS:"),
+		"OPTIONS:", t("OPTIONS:"),
+		"COPYRIGHT:", t("COPYRIGHT:"),
+		"[global options]", t("[global options]"),
+		"command [command options]", t("command")+" "+t("[command options]"),
+		"[command options]", t("[command options]"),
+		"[arguments...]", t("[arguments...]"),
+	)
+
+	cli.AppHelpTemplate = headings.Replace(cli.AppHelpTemplate)
+	cli.CommandHelpTemplate = headings.Replace(strings.ReplaceAll(cli.CommandHelpTemplate,
+		`{{template "usageTemplate" .}}`, commandUsageTemplate))
+	cli.SubcommandHelpTemplate = headings.Replace(cli.SubcommandHelpTemplate)
+
+	stringify := cli.FlagStringer
+	details := strings.NewReplacer(
+		"(default: ", "("+t("default")+": ",
+		"(accepts multiple inputs)", "("+t("accepts multiple inputs")+")",
+	)
+	cli.FlagStringer = func(f cli.Flag) string {
+		return details.Replace(stringify(f))
+	}
+
+	// The built-in help command and flags are added to the application when
+	// it is set up, and are shared with its commands.
+	app.Setup()
+
+	app.Usage = t(app.Usage)
+	app.Description = t(app.Description)
+	localizeFlags(app.Flags, t)
+	localizeCommands(app.Commands, t)
+
+	onUsageError := func(c *cli.Context, err error, isSubcommand bool) error {
+		fmt.Fprintf(c.App.Writer, "%s %s\n\n", t("Incorrect Usage:"), localizeError(lang, err))
+		if isSubcommand {
+			_ = cli.ShowCommandHelp(c.Lineage()[1], c.Command.Name)
+		} else {
+			_ = cli.ShowAppHelp(c)
+		}
+
+		return err
+	}
+
+	app.OnUsageError = onUsageError
+	walkCommands(app.Commands, func(cmd *cli.Command) {
+		cmd.OnUsageError = onUsageError
+	})
+}
+
+// localizeCommands translates the usage and description of commands, their
+// subcommands and flags.
+func localizeCommands(cmds []*cli.Command, t func(string) string) {
+	walkCommands(cmds, func(cmd *cli.Command) {
+		cmd.Usage = t(cmd.Usage)
+		cmd.Description = t(cmd.Description)
+		localizeFlags(cmd.Flags, t)
+	})
+}
+
+// localizeFlags translates the usage of flags. Every flag type has a Usage
+// field, but no common way of setting it.
+func localizeFlags(flags []cli.Flag, t func(string) string) {
+	for _, f := range flags {
+		v := reflect.ValueOf(f)
+		if v.Kind() == reflect.Pointer {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+
+		if usage := v.FieldByName("Usage"); usage.IsValid() && usage.CanSet() && usage.Kind() == reflect.String {
+			usage.SetString(t(usage.String()))
+		}
+	}
+}
+
+// walkCommands calls fn for each command and, recursively, its subcommands.
+func walkCommands(cmds []*cli.Command, fn func(cmd *cli.Command)) {
+	for _, cmd := range cmds {
+		fn(cmd)
+		walkCommands(cmd.Subcommands, fn)
+	}
+}
+
+// localizeError returns the message of an error, with the parts of common
+// error messages translated into a language.
+func localizeError(lang string, err error) string {
+	msg := err.Error()
+	if lang == "" {
+		return msg
+	}
+
+	for _, text := range errorTexts {
+		msg = strings.ReplaceAll(msg, text, locale.CLI(lang, text))
+	}
+
+	return msg
+}
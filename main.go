@@ -19,38 +19,23 @@
 package main
 
 import (
-	"context"
-	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strings"
-	"sync"
 	"syscall"
 	"time"
 
 	"github.com/adrg/xdg"
-	"github.com/dpeckett/cat-doorbell/internal/assets"
-	"github.com/dpeckett/cat-doorbell/internal/config"
-	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha1"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
 	"github.com/dpeckett/cat-doorbell/internal/constants"
+	"github.com/dpeckett/cat-doorbell/internal/locale"
+	"github.com/dpeckett/cat-doorbell/internal/logfile"
 	"github.com/dpeckett/cat-doorbell/internal/util"
-	paho "github.com/eclipse/paho.mqtt.golang"
-	"github.com/gen2brain/beeep"
-	"github.com/getlantern/systray"
-	"github.com/gopxl/beep/v2"
-	"github.com/gopxl/beep/v2/mp3"
-	"github.com/gopxl/beep/v2/speaker"
-	"github.com/pkg/browser"
 	slogmulti "github.com/samber/slog-multi"
 	"github.com/urfave/cli/v2"
-	"golang.org/x/sync/errgroup"
-)
-
-const (
-	mqttTopic = "bluetooth/devices"
 )
 
 func main() {
@@ -66,6 +51,52 @@ func main() {
 		os.Exit(1)
 	}
 
+	defaultHistoryFilePath, err := xdg.DataFile("cat-doorbell/history.db")
+	if err != nil {
+		slog.Error("Failed to get default history file path", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	defaultQueueFilePath, err := xdg.DataFile("cat-doorbell/notification-queue.json")
+	if err != nil {
+		slog.Error("Failed to get default notification queue file path", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	defaultCertDir, err := xdg.StateFile("cat-doorbell/tls")
+	if err != nil {
+		slog.Error("Failed to get state directory", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	defaultPushDir, err := xdg.StateFile("cat-doorbell/push")
+	if err != nil {
+		slog.Error("Failed to get state directory", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	defaultVisitsFilePath, err := xdg.StateFile("cat-doorbell/visits.json")
+	if err != nil {
+		slog.Error("Failed to get state directory", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	defaultRecordDir, err := xdg.StateFile("cat-doorbell/recordings")
+	if err != nil {
+		slog.Error("Failed to get state directory", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	defaultControlSocketPath, err := xdg.RuntimeFile("cat-doorbell/control.sock")
+	if err != nil {
+		slog.Error("Failed to get runtime directory", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// Settings shared by every user of the machine, which each user's
+	// configuration file can override.
+	const defaultSystemConfigFilePath = "/etc/cat-doorbell/config.yaml"
+
 	logFileName := fmt.Sprintf("%d-%d-cat-doorbell.log", time.Now().Unix(), os.Getpid())
 
 	persistentFlags := []cli.Flag{
@@ -75,6 +106,11 @@ func main() {
 			Usage:   "Path to the configuration file",
 			Value:   defaultConfigFilePath,
 		},
+		&cli.StringFlag{
+			Name:  "system-config",
+			Usage: "Path to the shared configuration file, which the configuration file overrides",
+			Value: defaultSystemConfigFilePath,
+		},
 		&cli.StringFlag{
 			Name:  "log-dir",
 			Usage: "Directory to store log files",
@@ -85,52 +121,156 @@ func main() {
 			Usage: "Set the log verbosity level",
 			Value: util.FromSlogLevel(slog.LevelInfo),
 		},
+		&cli.StringFlag{
+			Name:  "log-format",
+			Usage: "Format of log messages, \"text\" or \"json\"",
+			Value: "text",
+		},
+		&cli.Int64Flag{
+			Name:  "log-max-size",
+			Usage: "Size in MiB at which the log file is rotated (0 disables rotation)",
+			Value: 10,
+		},
+		&cli.DurationFlag{
+			Name:  "log-max-age",
+			Usage: "How long old log files are kept for (0 keeps them regardless of age)",
+			Value: 7 * 24 * time.Hour,
+		},
+		&cli.Int64Flag{
+			Name:  "log-max-total-size",
+			Usage: "Combined size in MiB of the log files, above which the oldest are removed (0 for no limit)",
+			Value: 100,
+		},
+		&cli.BoolFlag{
+			Name:  "log-compress",
+			Usage: "Compress rotated log files",
+			Value: true,
+		},
+		&cli.StringFlag{
+			Name:  "history-file",
+			Usage: "Path to the detection history database",
+			Value: defaultHistoryFilePath,
+		},
+		&cli.StringFlag{
+			Name:  "queue-file",
+			Usage: "Path to the queue of notifications that couldn't be delivered yet",
+			Value: defaultQueueFilePath,
+		},
+		&cli.BoolFlag{
+			Name:    "headless",
+			Usage:   "Run without a system tray icon or desktop notifications (auto-detected if there is no display)",
+			EnvVars: []string{"CAT_DOORBELL_HEADLESS"},
+		},
+		&cli.StringSliceFlag{
+			Name:  "set",
+			Usage: "Override a configuration field, eg. --set broker.address=tcp://localhost:1883 (can be repeated)",
+		},
+		&cli.BoolFlag{
+			Name:  "scan",
+			Usage: "Scan for devices using the host's Bluetooth adapter",
+		},
+		&cli.StringFlag{
+			Name:  "record",
+			Usage: "Append every received beacon to a file, for replaying later with \"cat-doorbell replay\"",
+		},
+		&cli.StringFlag{
+			Name:  "control-socket",
+			Usage: "Path to the socket the running instance is controlled through",
+			Value: defaultControlSocketPath,
+		},
+		&cli.BoolFlag{
+			Name:  "self-test",
+			Usage: "Check connectivity, audio, notifiers and payload parsing, print a JSON report and exit",
+		},
+		&cli.BoolFlag{
+			Name:    "dev",
+			Usage:   "Developer mode, which lets \"cat-doorbell dev\" inject faults into the broker connection",
+			EnvVars: []string{"CAT_DOORBELL_DEV"},
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Usage:   "Act on the named profile, rather than the doorbell of the configuration file",
+			EnvVars: []string{"CAT_DOORBELL_PROFILE"},
+		},
+		&cli.StringFlag{
+			Name:  "lang",
+			Usage: "Language of the command line help and messages (eg. nl), rather than the system locale",
+		},
 	}
 
+	var conf *latestconfig.Config
+
 	initLogger := func(c *cli.Context) error {
-		logDir := c.String("log-dir")
-		if err := os.MkdirAll(logDir, 0o755); err != nil {
-			slog.Error("Failed to create state directory", slog.Any("error", err))
-			os.Exit(1)
+		const mib = 1 << 20
+
+		logFile, err := logfile.Open(c.String("log-dir"), logFileName, logfile.Options{
+			MaxSize:      c.Int64("log-max-size") * mib,
+			MaxAge:       c.Duration("log-max-age"),
+			MaxTotalSize: c.Int64("log-max-total-size") * mib,
+			Compress:     c.Bool("log-compress"),
+			Pattern:      "*-cat-doorbell*.log*",
+		})
+		if err != nil {
+			return err
 		}
 
-		if err := removeOldLogs(logDir); err != nil {
-			return fmt.Errorf("failed to remove old logs: %w", err)
+		var redactor *util.MACRedactor
+		if conf != nil {
+			redactor = conf.Privacy.MACRedactor()
 		}
 
-		logFile, err := os.OpenFile(filepath.Join(logDir, logFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-		if err != nil {
-			return fmt.Errorf("failed to open log file: %w", err)
+		opts := &slog.HandlerOptions{
+			Level:       (*slog.Level)(c.Generic("log-level").(*util.LevelFlag)),
+			ReplaceAttr: redactor.ReplaceAttr,
 		}
 
-		opts := &slog.HandlerOptions{
-			Level: (*slog.Level)(c.Generic("log-level").(*util.LevelFlag)),
+		var newHandler func(w io.Writer, opts *slog.HandlerOptions) slog.Handler
+		switch format := c.String("log-format"); format {
+		case "text":
+			newHandler = func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+				return slog.NewTextHandler(w, opts)
+			}
+		case "json":
+			newHandler = func(w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+				return slog.NewJSONHandler(w, opts)
+			}
+		default:
+			return fmt.Errorf("unsupported log format: %s (expected text or json)", format)
 		}
 
 		slog.SetDefault(slog.New(
 			slogmulti.Fanout(
-				slog.NewTextHandler(logFile, opts),
-				slog.NewTextHandler(os.Stderr, opts),
+				newHandler(logFile, opts),
+				newHandler(os.Stderr, opts),
 			),
 		))
 
 		return nil
 	}
 
-	var conf *latestconfig.Config
 	loadConfig := func(c *cli.Context) error {
-		configFile, err := os.Open(c.String("config"))
-		if err != nil {
-			return fmt.Errorf("failed to open configuration file: %w", err)
+		// The config subcommands and the settings window create or edit and
+		// validate the configuration file themselves, so it may not exist or
+		// be valid yet. Secrets, the service and the local certificate
+		// authority are managed independently of the configuration, and the
+		// running instance is controlled through its socket. Reports include
+		// the configuration's errors rather than failing on them, and
+		// capabilities only depend on the binary and the host.
+		switch c.Args().First() {
+		case "config", "secret", "service", "tls", "pause", "resume", "status", "recording", "dev", "version", "settings", "error-dialog", "report", "capabilities":
+			return nil
 		}
-		defer configFile.Close()
 
-		conf, err = config.FromYAML(configFile)
-		if err != nil {
-			return fmt.Errorf("failed to unmarshal configuration: %w", err)
+		var err error
+		conf, err = readConfig(c)
+		if err != nil && !c.Args().Present() && !c.Bool("self-test") && !isHeadless(c) {
+			// When launched from the desktop there is no terminal to read the
+			// error from, so the tray shows it until the configuration is
+			// fixed.
+			return nil
 		}
 
-		return nil
+		return err
 	}
 
 	app := &cli.App{
@@ -138,193 +278,163 @@ func main() {
 		Usage:   "Receive a notification when the cat wants to come inside",
 		Version: constants.Version,
 		Flags:   persistentFlags,
-		Before:  beforeAll(initLogger, loadConfig),
+		Before:  beforeAll(selectProfile, loadConfig, initLogger),
+		Commands: []*cli.Command{
+			benchCommand(),
+			capabilitiesCommand(),
+			configCommand(),
+			deviceCommand(),
+			evaluateCommand(),
+			expectCommand(),
+			historyCommand(),
+			maintenanceCommand(),
+			pauseCommand(),
+			recordingCommand(),
+			devCommand(),
+			replayCommand(),
+			reportCommand(),
+			resumeCommand(),
+			scannerCommand(),
+			secretCommand(),
+			serviceCommand(),
+			settingsCommand(),
+			errorDialogCommand(),
+			simulateCommand(),
+			statsCommand(),
+			statusCommand(),
+			testCommand(),
+			tlsCommand(defaultCertDir),
+			tokenCommand(),
+			versionCommand(),
+		},
 		Action: func(c *cli.Context) error {
-			ctx, cancel := context.WithCancel(c.Context)
-			g, ctx := errgroup.WithContext(ctx)
-
-			systray.Run(func() {
-				var iconData []byte
-				iconData, err = assets.ReadFile("cat-icon.png")
-				if err != nil {
-					systray.Quit()
-					return
-				}
-
-				systray.SetIcon(iconData)
-				systray.SetTooltip("Doorbell")
-
-				mViewConfig := systray.AddMenuItem("View Config", "View the application configuration")
-				mViewLogs := systray.AddMenuItem("View Logs", "View the application logs")
-				mQuit := systray.AddMenuItem("Quit", "Quit the application")
-
-				sig := make(chan os.Signal, 1)
-				signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
-
-				g.Go(func() error {
-					defer systray.Quit()
-
-					for {
-						select {
-						case <-mViewConfig.ClickedCh:
-							slog.Info("User requested to view configuration")
-
-							if err := browser.OpenFile(c.String("config")); err != nil {
-								slog.Warn("Failed to open configuration file", slog.Any("error", err))
-							}
-						case <-mViewLogs.ClickedCh:
-							slog.Info("User requested to view logs")
-
-							logDir := c.String("log-dir")
-							if err := browser.OpenFile(filepath.Join(logDir, logFileName)); err != nil {
-								slog.Warn("Failed to open log file", slog.Any("error", err))
-							}
-						case <-mQuit.ClickedCh:
-							slog.Info("User requested shutdown")
-							return nil
-						case <-sig:
-							slog.Info("Received signal, shutting down")
-							return nil
-						}
-					}
-				})
+			logBuildInfo()
+			if conf != nil {
+				logConfigWarnings(conf)
+			}
 
-				g.Go(func() error {
-					return run(ctx, conf)
-				})
-			}, cancel)
+			opts := runOptions{
+				configPaths:     configPaths(c),
+				configOverrides: configOverrides(c),
+				historyPath:     c.String("history-file"),
+				queuePath:       c.String("queue-file"),
+				certDir:         defaultCertDir,
+				pushDir:         defaultPushDir,
+				visitsPath:      defaultVisitsFilePath,
+				headless:        isHeadless(c),
+				recordPath:      c.String("record"),
+				recordDir:       defaultRecordDir,
+				controlSocket:   c.String("control-socket"),
+				dev:             c.Bool("dev"),
+			}
 
-			if err := g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
-				return err
+			// The profile's configuration file and state files were
+			// selected by selectProfile, but the state directories and the
+			// visit sessions aren't flags.
+			if name := c.String("profile"); name != "" {
+				opts.profile = name
+				opts.pushDir = profilePath(opts.pushDir, name)
+				opts.visitsPath = profilePath(opts.visitsPath, name)
+				opts.recordDir = profilePath(opts.recordDir, name)
 			}
 
-			return nil
-		},
-	}
+			if c.Bool("self-test") {
+				return selfTest(conf, opts)
+			}
 
-	if err := app.Run(os.Args); err != nil {
-		slog.Error("Failed to run the application", slog.Any("error", err))
-		os.Exit(1)
-	}
-}
+			if opts.headless {
+				slog.Info("Running in headless mode")
 
-func run(ctx context.Context, conf *latestconfig.Config) error {
-	hostname, err := os.Hostname()
-	if err != nil {
-		return fmt.Errorf("failed to get hostname: %w", err)
-	}
+				doorbells, err := openDoorbells(c.Context, conf, opts)
+				if err != nil {
+					return err
+				}
+				defer closeDoorbells(doorbells)
 
-	// Configure MQTT client
-	opts := paho.NewClientOptions().
-		AddBroker(conf.Broker.Address).
-		SetClientID(fmt.Sprintf("%s-%d", hostname, os.Getpid())).
-		SetUsername(conf.Broker.Username).
-		SetPassword(conf.Broker.Password)
+				ctx, stop := signal.NotifyContext(c.Context, syscall.SIGTERM, syscall.SIGINT)
+				defer stop()
 
-	opts.OnConnect = func(client paho.Client) {
-		slog.Info("Connected to MQTT broker", slog.String("address", conf.Broker.Address))
-	}
+				if err := runDoorbells(ctx, doorbells); err != nil {
+					return err
+				}
 
-	opts.OnConnectionLost = func(_ paho.Client, err error) {
-		slog.Warn("Lost connection to MQTT broker", slog.Any("error", err))
-	}
+				slog.Info("Shutting down")
 
-	client := paho.NewClient(opts)
-	if token := client.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
-	}
-	defer client.Disconnect(250)
+				return nil
+			}
 
-	// Initialize the speaker.
-	sr := beep.SampleRate(44100)
-	if err := speaker.Init(sr, sr.N(time.Second/10)); err != nil {
-		return fmt.Errorf("failed to initialize speaker: %w", err)
-	}
+			start := func() ([]*doorbell, error) {
+				if conf == nil {
+					var err error
+					if conf, err = readConfig(c); err != nil {
+						return nil, err
+					}
 
-	var lastDetectedMu sync.Mutex
-	var lastDetected time.Time
+					logConfigWarnings(conf)
+				}
 
-	// Unpack the notification icon.
-	tempDir, err := os.MkdirTemp("", "cat-doorbell")
-	if err != nil {
-		return fmt.Errorf("failed to create temporary directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
+				return openDoorbells(c.Context, conf, opts)
+			}
 
-	catIconPath := filepath.Join(tempDir, "cat-icon.png")
-	if err := assets.Unpack("cat-icon.png", catIconPath); err != nil {
-		return fmt.Errorf("failed to unpack cat icon: %w", err)
+			return runTray(c, start, filepath.Join(c.String("log-dir"), logFileName))
+		},
 	}
 
-	if token := client.Subscribe(mqttTopic, 0, func(client paho.Client, msg paho.Message) {
-		mac := string(msg.Payload())
-
-		slog.Debug("Received beacon from device", slog.String("mac", mac))
-
-		if strings.EqualFold(mac, conf.TargetMAC) {
-			lastDetectedMu.Lock()
-			defer lastDetectedMu.Unlock()
-
-			if time.Since(lastDetected) >= conf.DetectionTimeout {
-				lastDetected = time.Now()
-
-				slog.Info("Detected target device", slog.String("mac", mac))
-
-				message := fmt.Sprintf("Device %s came into range", mac)
-				if err := beeep.Notify("Doorbell", message, catIconPath); err != nil {
-					slog.Warn("Failed to raise notification", slog.Any("error", err))
-				}
+	lang := cliLang(os.Args)
+	localizeApp(app, lang)
 
-				if err := playDoorbell(); err != nil {
-					slog.Warn("Failed to play doorbell sound", slog.Any("error", err))
-				}
-			} else {
-				slog.Debug("Ignoring beacon from device", slog.String("mac", mac))
-			}
-		}
-	}); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to subscribe to MQTT topic: %w", token.Error())
+	if err := app.Run(os.Args); err != nil {
+		slog.Error(locale.CLI(lang, "Failed to run the application"), slog.String("error", localizeError(lang, err)))
+		os.Exit(1)
 	}
+}
 
-	<-ctx.Done()
+// isHeadless returns whether to run without a system tray icon or desktop
+// notifications, either because it was asked for, there is no display, or
+// the build doesn't include GUI support.
+func isHeadless(c *cli.Context) bool {
+	return c.Bool("headless") || !hasDisplay() || !featureGUI.enabled()
+}
 
-	return ctx.Err()
+// configPaths returns the paths of the configuration files, in the order they
+// are layered.
+func configPaths(c *cli.Context) []string {
+	return []string{c.String("system-config"), c.String("config")}
 }
 
-func playDoorbell() error {
-	f, err := assets.Open("doorbell.mp3")
-	if err != nil {
-		return fmt.Errorf("failed to open embedded sound asset: %w", err)
+// configOverrides returns the configuration overrides given on the command
+// line, which take precedence over the configuration files.
+func configOverrides(c *cli.Context) []string {
+	overrides := c.StringSlice("set")
+	if c.Bool("scan") {
+		overrides = append(overrides, "scanner.enabled=true")
 	}
 
-	s, _, err := mp3.Decode(f)
+	return overrides
+}
+
+// readConfig loads the configuration files, and the overrides given on the
+// command line.
+func readConfig(c *cli.Context) (*latestconfig.Config, error) {
+	conf, err := loadConfigFiles(c.Context, configPaths(c), configOverrides(c))
 	if err != nil {
-		return fmt.Errorf("failed to decode MP3: %w", err)
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
 	}
 
-	speaker.Play(beep.Seq(s, beep.Callback(func() {
-		_ = f.Close()
-		_ = s.Close()
-	})))
-
-	return nil
+	return conf, nil
 }
 
-func removeOldLogs(logDir string) error {
-	entries, err := os.ReadDir(logDir)
-	if err != nil {
-		return fmt.Errorf("failed to read logs directory: %w", err)
+// logConfigWarnings logs the deprecated fields and suspicious values in the
+// configuration.
+func logConfigWarnings(conf *latestconfig.Config) {
+	for _, d := range conf.Deprecations() {
+		slog.Warn("Deprecated configuration field",
+			slog.String("field", d.Field), slog.String("replacement", d.Replacement))
 	}
 
-	if len(entries) > 10 {
-		for _, entry := range entries[:len(entries)-10] {
-			if err := os.Remove(filepath.Join(logDir, entry.Name())); err != nil {
-				return fmt.Errorf("failed to remove old log entry: %w", err)
-			}
-		}
+	for _, w := range conf.Lint() {
+		slog.Warn("Suspicious configuration", slog.String("warning", w))
 	}
-
-	return nil
 }
 
 func beforeAll(beforeFunc ...cli.BeforeFunc) cli.BeforeFunc {
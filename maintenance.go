@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+)
+
+// maintenance is maintenance mode started manually. It is guarded by the
+// doorbell's mutex.
+type maintenance struct {
+	// active is true if maintenance mode was started manually.
+	active bool
+	// until is when manually started maintenance ends, or zero if it lasts
+	// until stopped.
+	until time.Time
+}
+
+// StartMaintenance starts maintenance mode for the given duration, or until
+// StopMaintenance is called if the duration is zero. The broker being
+// disconnected and the gateway being silent aren't alerted on meanwhile.
+func (d *doorbell) StartMaintenance(duration time.Duration) {
+	var until time.Time
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+
+	d.mu.Lock()
+	d.maintenance = maintenance{active: true, until: until}
+	d.notifyChanged()
+	d.mu.Unlock()
+
+	slog.Info("Started maintenance", slog.Duration("duration", duration))
+}
+
+// StopMaintenance ends manually started maintenance mode. Scheduled
+// maintenance windows still apply.
+func (d *doorbell) StopMaintenance() {
+	d.mu.Lock()
+	d.maintenance = maintenance{}
+	d.notifyChanged()
+	d.mu.Unlock()
+
+	slog.Info("Stopped maintenance")
+}
+
+// inMaintenance returns whether maintenance mode is active.
+func (d *doorbell) inMaintenance() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	active, _ := d.maintenanceLocked(time.Now())
+	return active
+}
+
+// maintenanceLocked returns whether maintenance mode is active at the given
+// time, either manually or in a scheduled window, and when manually started
+// maintenance ends (zero if it lasts until stopped, or is scheduled). The
+// doorbell's mutex must be held.
+func (d *doorbell) maintenanceLocked(now time.Time) (bool, time.Time) {
+	if d.maintenance.active && (d.maintenance.until.IsZero() || now.Before(d.maintenance.until)) {
+		return true, d.maintenance.until
+	}
+
+	return slices.ContainsFunc(d.conf.Maintenance.Windows, func(w latestconfig.MaintenanceWindowConfig) bool {
+		return w.Contains(now.Local())
+	}), time.Time{}
+}
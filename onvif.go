@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+	"github.com/dpeckett/cat-doorbell/internal/onvif"
+)
+
+// watchONVIF subscribes to the events of the ONVIF camera, subscribing again
+// whenever its configuration changes.
+func (d *doorbell) watchONVIF(ctx context.Context) error {
+	for {
+		conf, changed := d.config()
+		if conf.ONVIF == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+				continue
+			}
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			d.runONVIF(runCtx, conf.ONVIF)
+		}()
+
+		// Other changes to the configuration don't need a new subscription.
+		for {
+			select {
+			case <-ctx.Done():
+			case <-changed:
+				var next *latestconfig.Config
+				next, changed = d.config()
+				if reflect.DeepEqual(next.ONVIF, conf.ONVIF) {
+					continue
+				}
+			}
+			break
+		}
+
+		cancel()
+		<-done
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// runONVIF raises a "motion" event whenever one of the configured topics
+// starts reporting motion, until the context is cancelled.
+func (d *doorbell) runONVIF(ctx context.Context, conf *latestconfig.ONVIFConfig) {
+	events := make(chan onvif.Event)
+	go func() {
+		_ = onvif.New(conf).Run(ctx, events)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-events:
+			if !slices.ContainsFunc(conf.Topics, func(topic string) bool {
+				return strings.Contains(strings.ToLower(e.Topic), strings.ToLower(topic))
+			}) {
+				slog.Debug("Ignoring ONVIF event", slog.String("topic", e.Topic), slog.Bool("active", e.Active))
+				continue
+			}
+
+			d.motionReported(ctx, e)
+		}
+	}
+}
+
+// motionReported records the state of a motion topic, raising a "motion"
+// event when motion starts.
+func (d *doorbell) motionReported(ctx context.Context, e onvif.Event) {
+	now := time.Now()
+
+	d.mu.Lock()
+	started := e.Active && !d.motionActive[e.Topic]
+	d.motionActive[e.Topic] = e.Active
+	d.mu.Unlock()
+
+	if !started {
+		return
+	}
+
+	d.handle(ctx, "", func() {
+		title, message := d.texts.Render("", latestconfig.EventMotion, &notifier.TextData{
+			Time: now.Local(),
+		})
+
+		d.raiseEvent(ctx, &notifier.Notification{
+			Event:    latestconfig.EventMotion,
+			Title:    title,
+			Message:  message,
+			Time:     now,
+			Instance: d.instance(),
+		}, "")
+	})
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultProfileName is how the doorbell of the configuration file itself
+// is referred to, alongside its profiles.
+const defaultProfileName = "Default"
+
+// profileConfigPath returns the path of a profile's configuration file, in
+// the profiles directory next to the configuration file.
+func profileConfigPath(configPath, name string) string {
+	return filepath.Join(filepath.Dir(configPath), "profiles", name+".yaml")
+}
+
+// profilePath returns the path of a profile's state file or directory,
+// derived from the default profile's by suffixing its name (eg.
+// history-parents.db).
+func profilePath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// selectProfile makes the commands act on the profile given with --profile,
+// by pointing the configuration file, and the state files that weren't
+// given explicitly, at the profile's.
+func selectProfile(c *cli.Context) error {
+	name := c.String("profile")
+	if name == "" {
+		return nil
+	}
+
+	if err := latestconfig.ValidateProfileName(name); err != nil {
+		return err
+	}
+
+	for _, flag := range []string{"history-file", "queue-file", "control-socket"} {
+		if c.IsSet(flag) {
+			continue
+		}
+
+		if err := c.Set(flag, profilePath(c.String(flag), name)); err != nil {
+			return fmt.Errorf("failed to set %s: %w", flag, err)
+		}
+	}
+
+	if err := c.Set("config", profileConfigPath(c.String("config"), name)); err != nil {
+		return fmt.Errorf("failed to set config: %w", err)
+	}
+
+	return nil
+}
+
+// forProfile returns the options of a profile run alongside the doorbell
+// with these options, which has its own configuration file and state.
+func (o runOptions) forProfile(name string, configPaths []string) runOptions {
+	o.profile = name
+	o.configPaths = configPaths
+	// Overrides given on the command line only apply to the default
+	// profile.
+	o.configOverrides = nil
+	o.historyPath = profilePath(o.historyPath, name)
+	o.queuePath = profilePath(o.queuePath, name)
+	o.pushDir = profilePath(o.pushDir, name)
+	o.visitsPath = profilePath(o.visitsPath, name)
+	o.recordDir = profilePath(o.recordDir, name)
+	o.recordPath = ""
+	if o.controlSocket != "" {
+		o.controlSocket = profilePath(o.controlSocket, name)
+	}
+
+	return o
+}
+
+// openDoorbells creates and opens the doorbell of the configuration, and
+// the doorbells of each of its profiles. If any of them fails to open, those
+// opened so far are closed.
+func openDoorbells(ctx context.Context, conf *latestconfig.Config, opts runOptions) (doorbells []*doorbell, err error) {
+	defer func() {
+		if err != nil {
+			closeDoorbells(doorbells)
+			doorbells = nil
+		}
+	}()
+
+	if opts.profile != "" && len(conf.Profiles) > 0 {
+		return nil, fmt.Errorf("profile %q: profiles can't have profiles of their own", opts.profile)
+	}
+
+	d := newDoorbell(conf, opts)
+	if err := d.open(); err != nil {
+		return nil, err
+	}
+	doorbells = append(doorbells, d)
+
+	for _, p := range conf.Profiles {
+		paths := []string{opts.configPaths[0], profileConfigPath(opts.configPaths[len(opts.configPaths)-1], p.Name)}
+
+		profileConf, err := loadConfigFiles(ctx, paths, nil)
+		if err != nil {
+			return doorbells, fmt.Errorf("profile %q: failed to load configuration: %w", p.Name, err)
+		}
+
+		if len(profileConf.Profiles) > 0 {
+			return doorbells, fmt.Errorf("profile %q: profiles can't have profiles of their own", p.Name)
+		}
+
+		slog.Info("Starting profile", slog.String("profile", p.Name))
+		logConfigWarnings(profileConf)
+
+		d := newDoorbell(profileConf, opts.forProfile(p.Name, paths))
+		if err := d.open(); err != nil {
+			return doorbells, fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+		doorbells = append(doorbells, d)
+	}
+
+	return doorbells, nil
+}
+
+// runDoorbells runs the opened doorbells until the context is cancelled, or
+// one of them stops with an error.
+func runDoorbells(ctx context.Context, doorbells []*doorbell) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	for _, d := range doorbells {
+		g.Go(func() error {
+			if err := d.run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				if d.opts.profile != "" {
+					return fmt.Errorf("profile %q: %w", d.opts.profile, err)
+				}
+
+				return err
+			}
+
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// closeDoorbells closes the doorbells, in the reverse order they were
+// opened.
+func closeDoorbells(doorbells []*doorbell) {
+	for i := len(doorbells) - 1; i >= 0; i-- {
+		doorbells[i].close()
+	}
+}
+
+// profileName returns the name the doorbell is referred to by in the tray.
+func (d *doorbell) profileName() string {
+	if d.opts.profile == "" {
+		return defaultProfileName
+	}
+
+	return d.opts.profile
+}
+
+// configPath returns the path of the doorbell's own configuration file (as
+// opposed to the shared configuration file it is layered on).
+func (d *doorbell) configPath() string {
+	return d.opts.configPaths[len(d.opts.configPaths)-1]
+}
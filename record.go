@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/source/replay"
+)
+
+// StartRecording starts appending every received beacon to a recording, and
+// returns its path. Unless a recording path was given on the command line, a
+// new recording is created in the recordings directory.
+func (d *doorbell) StartRecording() (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.recorder != nil {
+		return d.recordingPath, nil
+	}
+
+	path := d.opts.recordPath
+	if path == "" {
+		if err := os.MkdirAll(d.opts.recordDir, 0o755); err != nil {
+			return "", fmt.Errorf("failed to create recordings directory: %w", err)
+		}
+
+		path = filepath.Join(d.opts.recordDir, time.Now().Format("20060102-150405")+".ndjson")
+	}
+
+	recorder, err := replay.NewRecorder(path)
+	if err != nil {
+		return "", err
+	}
+
+	d.recorder = recorder
+	d.recordingPath = path
+	d.notifyChanged()
+
+	slog.Info("Started recording beacons", slog.String("path", path))
+
+	return path, nil
+}
+
+// StopRecording stops recording beacons, if they are being recorded.
+func (d *doorbell) StopRecording() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.recorder == nil {
+		return
+	}
+
+	if err := d.recorder.Close(); err != nil {
+		slog.Warn("Failed to close recording", slog.Any("error", err))
+	}
+
+	slog.Info("Stopped recording beacons", slog.String("path", d.recordingPath))
+
+	d.recorder = nil
+	d.recordingPath = ""
+	d.notifyChanged()
+}
+
+// recordBeacon appends a beacon to the recording, if beacons are being
+// recorded.
+func (d *doorbell) recordBeacon(b *source.Beacon, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.recorder == nil {
+		return
+	}
+
+	if err := d.recorder.Record(b, now); err != nil {
+		slog.Warn("Failed to record beacon", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,357 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/action"
+	"github.com/dpeckett/cat-doorbell/internal/camera"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/event"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDelay is how long to wait for changes to the configuration file
+// to settle before reloading it, as editors often write files in several steps.
+const configReloadDelay = 500 * time.Millisecond
+
+// config returns the current configuration, and a channel that is closed when
+// it is replaced.
+func (d *doorbell) config() (*latestconfig.Config, <-chan struct{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.conf, d.confChanged
+}
+
+// hasSources returns true if the configuration enables at least one beacon
+// source.
+func hasSources(conf *latestconfig.Config) bool {
+	return conf.Broker.Address != "" || conf.Scanner.Enabled
+}
+
+// newDispatcher creates a notification dispatcher for the configured
+// notifiers. Desktop notifications are skipped in headless mode.
+func (d *doorbell) newDispatcher(conf *latestconfig.Config) (*notifier.Dispatcher, error) {
+	notifiers := conf.Notifiers
+	if d.opts.headless {
+		notifiers = slices.DeleteFunc(slices.Clone(notifiers), func(n latestconfig.NotifierConfig) bool {
+			return n.Desktop != nil
+		})
+	}
+
+	queue := d.queue
+	if conf.NotificationQueue.Disabled {
+		queue = nil
+	}
+
+	dispatcher, err := notifier.NewDispatcher(notifiers, d.iconPath, d.push, queue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifiers: %w", err)
+	}
+
+	return dispatcher, nil
+}
+
+// newCamera creates the configured camera, or returns nil if there is no
+// camera.
+func newCamera(conf *latestconfig.Config) *camera.Camera {
+	if conf.Camera == nil {
+		return nil
+	}
+
+	return camera.New(conf.Camera)
+}
+
+// superviseSource runs the beacon source built from the current
+// configuration, and restarts it whenever the parts of the configuration it
+// depends on (as returned by key) change. No source is run while build
+// returns nil.
+func (d *doorbell) superviseSource(ctx context.Context, beacons chan<- source.Beacon, name string,
+	key func(conf *latestconfig.Config) any, build func(conf *latestconfig.Config) (source.Source, error)) error {
+	for {
+		conf, changed := d.config()
+		current := key(conf)
+
+		src, err := build(conf)
+		if err != nil {
+			return err
+		}
+
+		srcCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		if src != nil {
+			go func() {
+				done <- src.Run(srcCtx, beacons)
+			}()
+		}
+
+		restart := false
+		for !restart {
+			select {
+			case <-ctx.Done():
+				cancel()
+				if src != nil {
+					<-done
+				}
+				return ctx.Err()
+			case err := <-done:
+				cancel()
+				return err
+			case <-changed:
+				conf, changed = d.config()
+				restart = !reflect.DeepEqual(key(conf), current)
+			}
+		}
+
+		slog.Info("Restarting beacon source", slog.String("source", name))
+
+		cancel()
+		if src != nil {
+			<-done
+		}
+	}
+}
+
+// applyConfig replaces the running configuration. It must be called from the
+// beacon handling loop. Events received before the reload are handled with
+// the previous configuration.
+func (d *doorbell) applyConfig(ctx context.Context, conf *latestconfig.Config) {
+	if !hasSources(conf) {
+		slog.Error("Not applying reloaded configuration", slog.Any("error", errors.New("no beacon sources configured")))
+		return
+	}
+
+	dispatcher, err := d.newDispatcher(conf)
+	if err != nil {
+		slog.Error("Not applying reloaded configuration", slog.Any("error", err))
+		return
+	}
+
+	actions, err := action.NewRunner(conf.Actions)
+	if err != nil {
+		slog.Error("Not applying reloaded configuration", slog.Any("error", err))
+		return
+	}
+
+	events, err := event.NewDeriver(conf.Events)
+	if err != nil {
+		slog.Error("Not applying reloaded configuration", slog.Any("error", err))
+		return
+	}
+
+	texts, err := notifier.NewTexts(conf)
+	if err != nil {
+		slog.Error("Not applying reloaded configuration", slog.Any("error", err))
+		return
+	}
+
+	old, _ := d.config()
+	changes := describeChanges(old, conf)
+	if len(changes) == 0 {
+		slog.Info("Configuration unchanged")
+		return
+	}
+
+	// The workers read the parts of the configuration being replaced.
+	if err := d.workers.Wait(ctx); err != nil {
+		return
+	}
+
+	d.dispatcher = dispatcher
+	actions.Inherit(d.actions)
+	d.actions = actions
+	d.events = events
+	d.texts = texts
+	d.camera = newCamera(conf)
+	d.redactor = conf.Privacy.MACRedactor()
+	if d.player != nil {
+		if err := d.player.Update(conf); err != nil {
+			slog.Warn("Failed to apply sound settings", slog.Any("error", err))
+		}
+	}
+
+	d.mu.Lock()
+	d.conf = conf
+	d.updateTargetsLocked()
+	close(d.confChanged)
+	d.confChanged = make(chan struct{})
+	d.notifyChanged()
+	d.mu.Unlock()
+
+	slog.Info("Reloaded configuration", slog.Any("changed", changes))
+
+	if slices.Contains(changes, "web") {
+		slog.Warn("Web dashboard settings changed, restart to apply them")
+	}
+
+	if slices.Contains(changes, "metrics") {
+		slog.Warn("Metrics settings changed, restart to apply them")
+	}
+
+	if slices.Contains(changes, "limits") {
+		slog.Warn("Limits changed, restart to apply them")
+	}
+
+	if slices.Contains(changes, "instance") {
+		slog.Warn("Instance name changed, restart to apply it to metrics and the advertised dashboard")
+	}
+
+	if slices.Contains(changes, "profiles") {
+		slog.Warn("Profiles changed, restart to apply them")
+	}
+
+	if old.Sound.BufferSize != conf.Sound.BufferSize {
+		slog.Warn("Sound buffer size changed, restart to apply it")
+	}
+}
+
+// describeChanges returns the names of the configuration sections that differ.
+func describeChanges(old, new *latestconfig.Config) []string {
+	sections := []struct {
+		name     string
+		old, new any
+	}{
+		{"broker", old.Broker, new.Broker},
+		{"scanner", old.Scanner, new.Scanner},
+		{"targets", old.Targets, new.Targets},
+		{"doorbells", old.Doorbells, new.Doorbells},
+		{"notifiers", old.Notifiers, new.Notifiers},
+		{"notificationQueue", old.NotificationQueue, new.NotificationQueue},
+		{"actions", old.Actions, new.Actions},
+		{"events", old.Events, new.Events},
+		{"locale", old.Locale, new.Locale},
+		{"instance", old.Instance, new.Instance},
+		{"camera", old.Camera, new.Camera},
+		{"calendar", old.Calendar, new.Calendar},
+		{"automation", old.Automation, new.Automation},
+		{"visits", old.Visits, new.Visits},
+		{"onvif", old.ONVIF, new.ONVIF},
+		{"maintenance", old.Maintenance, new.Maintenance},
+		{"expect", old.Expect, new.Expect},
+		{"anomalies", old.Anomalies, new.Anomalies},
+		{"privacy", old.Privacy, new.Privacy},
+		{"sound", old.Sound, new.Sound},
+		{"web", old.Web, new.Web},
+		{"metrics", old.Metrics, new.Metrics},
+		{"limits", old.Limits, new.Limits},
+		{"profiles", old.Profiles, new.Profiles},
+	}
+
+	var changes []string
+	for _, s := range sections {
+		if !reflect.DeepEqual(s.old, s.new) {
+			changes = append(changes, s.name)
+		}
+	}
+
+	return changes
+}
+
+// watchConfig reloads the configuration file when it changes, or when the
+// process receives SIGHUP.
+func (d *doorbell) watchConfig(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watch the directories, as editors (and config.Edit) often replace the
+	// files rather than writing to them.
+	paths := make(map[string]bool, len(d.opts.configPaths))
+	for _, path := range d.opts.configPaths {
+		path = filepath.Clean(path)
+		paths[path] = true
+
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			// Configuration files are optional as long as one exists.
+			if errors.Is(err, os.ErrNotExist) {
+				slog.Debug("Not watching missing config directory", slog.String("path", filepath.Dir(path)))
+				continue
+			}
+
+			return fmt.Errorf("failed to watch config file: %w", err)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hup:
+			slog.Info("Received SIGHUP, reloading configuration")
+			d.reloadConfig(ctx)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			if paths[filepath.Clean(event.Name)] && event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				settled = time.After(configReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+
+			slog.Warn("Error watching config file", slog.Any("error", err))
+		case <-settled:
+			settled = nil
+
+			slog.Info("Configuration file changed, reloading")
+			d.reloadConfig(ctx)
+		}
+	}
+}
+
+// reloadConfig reads the configuration file and passes it to the beacon
+// handling loop to be applied. Invalid configurations are logged and ignored.
+func (d *doorbell) reloadConfig(ctx context.Context) {
+	conf, err := loadConfigFiles(ctx, d.opts.configPaths, d.opts.configOverrides)
+	if err != nil {
+		slog.Error("Failed to reload configuration", slog.Any("error", err))
+		return
+	}
+
+	logConfigWarnings(conf)
+
+	select {
+	case d.reloads <- conf:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/detector"
+	"github.com/dpeckett/cat-doorbell/internal/source/replay"
+	"github.com/urfave/cli/v2"
+)
+
+// replayedDetection is a detection raised while replaying a recording.
+type replayedDetection struct {
+	Time   time.Time              `json:"time"`
+	Name   string                 `json:"name"`
+	MAC    string                 `json:"mac"`
+	Event  latestconfig.EventType `json:"event"`
+	RSSI   int                    `json:"rssi,omitempty"`
+	Notify bool                   `json:"notify"`
+	Reason string                 `json:"reason,omitempty"`
+}
+
+func replayCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "replay",
+		Usage:     "Feed a recorded beacon stream through the detector and show the detections, without notifying",
+		ArgsUsage: "FILE",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "speed",
+				Usage: "Playback speed relative to the recording (eg. 10x), or \"max\" to replay as fast as possible",
+				Value: "1x",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output detections as JSON, one per line",
+			},
+			&cli.BoolFlag{
+				Name:  "notify",
+				Usage: "Ring the doorbell and notify for the detections, as if the beacons were being received",
+			},
+			waitFlag,
+		},
+		Action: func(c *cli.Context) error {
+			if c.NArg() != 1 {
+				return errors.New("expected the path of a recording")
+			}
+
+			speed, err := parseSpeed(c.String("speed"))
+			if err != nil {
+				return err
+			}
+
+			conf, err := readConfig(c)
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(c.Args().First())
+			if err != nil {
+				return fmt.Errorf("failed to open recording: %w", err)
+			}
+			defer f.Close()
+
+			if c.Bool("notify") {
+				return runSimulation(c, conf, replay.NewSource(replay.NewReader(f), speed))
+			}
+
+			ctx, stop := signal.NotifyContext(c.Context, syscall.SIGTERM, syscall.SIGINT)
+			defer stop()
+
+			output := printReplayedDetection
+			if c.Bool("json") {
+				enc := json.NewEncoder(os.Stdout)
+				output = func(d replayedDetection) {
+					_ = enc.Encode(d)
+				}
+			} else {
+				fmt.Printf("%-19s  %-16s  %-17s  %-13s  %4s  %-6s  %s\n",
+					"TIME", "NAME", "MAC", "EVENT", "RSSI", "NOTIFY", "REASON")
+			}
+
+			err = replayRecording(ctx, conf, replay.NewReader(f), speed, output)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
+
+// replayRecording feeds the recorded beacons through a detector for the
+// configured targets, at the given speed (or as fast as possible if it is
+// zero). Time is taken from the recording, so the detections are the same
+// at any speed.
+func replayRecording(ctx context.Context, conf *latestconfig.Config, r *replay.Reader, speed float64, output func(replayedDetection)) error {
+	det := detector.New(conf.Targets)
+
+	report := func(detections []*detector.Detection, t time.Time) {
+		for _, d := range detections {
+			output(replayedDetection{
+				Time:   t,
+				Name:   d.Target.Name,
+				MAC:    d.MAC,
+				Event:  d.Event,
+				RSSI:   d.RSSI,
+				Notify: d.Notify,
+				Reason: d.Reason,
+			})
+		}
+	}
+
+	var start, prev, nextCheck time.Time
+	wallStart := time.Now()
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if start.IsZero() {
+			start = rec.Time
+			nextCheck = start.Add(presenceCheckInterval)
+		} else if rec.Time.Before(prev) {
+			return fmt.Errorf("beacon at %s was received before the previous beacon: the recording must be in time order",
+				rec.Time.Format(time.RFC3339Nano))
+		}
+		prev = rec.Time
+
+		// Pace beacons relative to the start of the replay, so that delays
+		// don't accumulate.
+		if speed > 0 {
+			due := wallStart.Add(time.Duration(float64(rec.Time.Sub(start)) / speed))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Until(due)):
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Check for departures as often as the doorbell would have.
+		for !nextCheck.After(rec.Time) {
+			report(det.Departures(nextCheck), nextCheck)
+			nextCheck = nextCheck.Add(presenceCheckInterval)
+		}
+
+		report(det.Observe(rec.Beacon, rec.Time), rec.Time)
+	}
+}
+
+func printReplayedDetection(d replayedDetection) {
+	rssi := "-"
+	if d.RSSI != 0 {
+		rssi = strconv.Itoa(d.RSSI)
+	}
+
+	fmt.Printf("%-19s  %-16s  %-17s  %-13s  %4s  %-6t  %s\n",
+		d.Time.Local().Format(time.DateTime), d.Name, d.MAC, d.Event, rssi, d.Notify, d.Reason)
+}
+
+// parseSpeed parses a playback speed, eg. "10x", "0.5" or "max" (which is
+// returned as zero).
+func parseSpeed(s string) (float64, error) {
+	if s == "max" {
+		return 0, nil
+	}
+
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid speed %q: expected a positive multiplier (eg. 10x) or \"max\"", s)
+	}
+
+	return speed, nil
+}
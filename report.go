@@ -0,0 +1,550 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/stats"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxReportLogSize is how much of the end of each log file is included
+	// in a report.
+	maxReportLogSize = 5 << 20
+	// reportStatsPeriod is the period the statistics in a report cover.
+	reportStatsPeriod = 7 * 24 * time.Hour
+	// redacted replaces the secrets scrubbed from a report.
+	redacted = "REDACTED"
+	// issuesURL is where bugs are reported.
+	issuesURL = "https://github.com/dpeckett/cat-doorbell/issues"
+)
+
+// macPattern matches MAC addresses in configuration values and log lines.
+var macPattern = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?:[:-][0-9a-f]{2}){5}\b`)
+
+// configLinePattern matches a "key: value" line of a configuration file,
+// capturing everything up to the value, the key and the value.
+var configLinePattern = regexp.MustCompile(`^(\s*(?:-\s+)?([\w.-]+)\s*:\s*)(.*)$`)
+
+func reportCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "report",
+		Usage: "Gather recent logs, the configuration, version information and statistics into an archive to attach to a bug report",
+		Description: "Secrets (passwords, tokens, keys, usernames, and the paths and queries of URLs) are scrubbed from\n" +
+			"the configuration, and from the logs wherever they appear. MAC addresses are hashed with a salt\n" +
+			"that is thrown away, so the same device can still be recognized across the report.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Path of the archive (defaults to cat-doorbell-report-<time>.zip in the current directory)",
+			},
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Include the log files written to after a duration ago (eg. 24h) or RFC 3339 timestamp",
+				Value: "72h",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-macs",
+				Usage: "Include MAC addresses as they are, rather than hashed",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			now := time.Now()
+			since, err := parseSince(c.String("since"), now)
+			if err != nil {
+				return err
+			}
+
+			path := c.String("output")
+			if path == "" {
+				path = fmt.Sprintf("cat-doorbell-report-%s.zip", now.Format("20060102-150405"))
+			}
+
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return fmt.Errorf("failed to create report: %w", err)
+			}
+			defer f.Close()
+
+			s := &scrubber{}
+			if !c.Bool("keep-macs") {
+				// The salt is thrown away, so the hashes can't be reversed
+				// by trying every MAC address.
+				salt := make([]byte, 16)
+				if _, err := rand.Read(salt); err != nil {
+					return fmt.Errorf("failed to generate salt: %w", err)
+				}
+
+				s.macs = util.NewMACRedactor(hex.EncodeToString(salt))
+			}
+
+			r := &report{zip: zip.NewWriter(f), scrub: s, time: now}
+			r.gather(c, since)
+
+			if err := r.zip.Close(); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to write report: %w", err)
+			}
+
+			fmt.Printf("Wrote the report to %s\n", path)
+			fmt.Printf("Check it doesn't contain anything you'd rather not share, then attach it to an issue at %s\n", issuesURL)
+
+			return nil
+		},
+	}
+}
+
+// report is an archive of the information needed to investigate a bug.
+type report struct {
+	zip   *zip.Writer
+	scrub *scrubber
+	time  time.Time
+	// problems are why parts of the report couldn't be gathered.
+	problems []string
+}
+
+// gather adds the version information, capabilities, configuration, statistics and the
+// logs written to since the given time to the report. Parts that can't be
+// gathered are listed in errors.txt instead.
+func (r *report) gather(c *cli.Context, since time.Time) {
+	r.addJSON("version.json", getBuildInfo())
+	r.addJSON("capabilities.json", getCapabilities())
+
+	// The configuration is scrubbed first, so that the secrets found in it
+	// are scrubbed from the logs too.
+	conf, err := readConfig(c)
+	if err != nil {
+		r.problem(err)
+		r.addConfigFiles(configPaths(c))
+	} else {
+		r.addConfig(conf)
+		r.addStats(c, conf)
+	}
+
+	r.addLogs(c.String("log-dir"), since)
+
+	if len(r.problems) > 0 {
+		r.add("errors.txt", []byte(r.scrub.text(strings.Join(r.problems, "\n")+"\n")))
+	}
+}
+
+// addConfig adds the configuration, as loaded with defaults applied, and its
+// warnings.
+func (r *report) addConfig(conf *latestconfig.Config) {
+	var node yaml.Node
+	if err := node.Encode(conf); err != nil {
+		r.problem(fmt.Errorf("failed to encode configuration: %w", err))
+		return
+	}
+
+	r.addYAML("config.yaml", &node)
+
+	var warnings []string
+	for _, d := range conf.Deprecations() {
+		warnings = append(warnings, d.String())
+	}
+	warnings = append(warnings, conf.Lint()...)
+
+	if len(warnings) > 0 {
+		r.add("warnings.txt", []byte(r.scrub.text(strings.Join(warnings, "\n")+"\n")))
+	}
+}
+
+// addConfigFiles adds the configuration files as they are, for when they
+// can't be loaded.
+func (r *report) addConfigFiles(paths []string) {
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				r.problem(fmt.Errorf("failed to read config file: %w", err))
+			}
+			continue
+		}
+
+		name := fmt.Sprintf("config-files/%d-%s", i+1, filepath.Base(path))
+
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			// The file can't be scrubbed as YAML, so it's scrubbed line by
+			// line instead.
+			r.add(name, []byte(r.scrub.lines(string(data))))
+			continue
+		}
+
+		r.addYAML(name, &node)
+	}
+}
+
+// addStats adds the visit statistics of the last week.
+func (r *report) addStats(c *cli.Context, conf *latestconfig.Config) {
+	historyPath := c.String("history-file")
+	if conf.History.Backend != latestconfig.HistoryBackendPostgres {
+		// Opening the history would create it.
+		if _, err := os.Stat(historyPath); err != nil {
+			r.problem(fmt.Errorf("no history: %w", err))
+			return
+		}
+	}
+
+	store, err := history.Open(conf.History, historyPath)
+	if err != nil {
+		r.problem(err)
+		return
+	}
+	defer store.Close()
+
+	names := make([]string, 0, len(conf.Targets))
+	for _, t := range conf.Targets {
+		names = append(names, t.Name)
+	}
+
+	s, err := stats.Load(c.Context, store, names, false, r.time.Add(-reportStatsPeriod), r.time)
+	if err != nil {
+		r.problem(err)
+		return
+	}
+
+	r.addJSON("stats.json", s)
+}
+
+// addLogs adds the end of each log file written to since the given time,
+// decompressing rotated log files.
+func (r *report) addLogs(dir string, since time.Time) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*-cat-doorbell*.log*"))
+	if err != nil {
+		r.problem(err)
+		return
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.Size() == 0 || info.ModTime().Before(since) {
+			continue
+		}
+
+		data, err := readLog(path)
+		if err != nil {
+			r.problem(err)
+			continue
+		}
+
+		if len(data) > maxReportLogSize {
+			data = data[len(data)-maxReportLogSize:]
+			// Start at a whole line.
+			if i := bytes.IndexByte(data, '\n'); i >= 0 {
+				data = data[i+1:]
+			}
+		}
+
+		r.add("logs/"+strings.TrimSuffix(filepath.Base(path), ".gz"), []byte(r.scrub.text(string(data))))
+	}
+}
+
+// readLog reads a log file, decompressing it if it was compressed when it
+// was rotated.
+func readLog(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+
+	var rd io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress log file %s: %w", path, err)
+		}
+		defer gz.Close()
+
+		rd = gz
+	}
+
+	data, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log file %s: %w", path, err)
+	}
+
+	return data, nil
+}
+
+// addYAML scrubs a YAML document and adds it to the report.
+func (r *report) addYAML(name string, node *yaml.Node) {
+	r.scrub.node(node, "")
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		r.problem(fmt.Errorf("failed to encode %s: %w", name, err))
+		return
+	}
+	_ = enc.Close()
+
+	r.add(name, buf.Bytes())
+}
+
+// addJSON adds a value encoded as JSON to the report. It must not contain
+// secrets.
+func (r *report) addJSON(name string, v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		r.problem(fmt.Errorf("failed to encode %s: %w", name, err))
+		return
+	}
+
+	r.add(name, append(data, '\n'))
+}
+
+func (r *report) add(name string, data []byte) {
+	w, err := r.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: r.time})
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err != nil {
+		r.problem(fmt.Errorf("failed to add %s to report: %w", name, err))
+	}
+}
+
+func (r *report) problem(err error) {
+	r.problems = append(r.problems, err.Error())
+}
+
+// scrubber removes secrets and MAC addresses from the contents of a report.
+type scrubber struct {
+	// secrets are the values scrubbed from the configuration, which are
+	// scrubbed from everything else too.
+	secrets []string
+	// macs hashes MAC addresses, or is nil if they are kept.
+	macs *util.MACRedactor
+}
+
+// node scrubs the secrets from a YAML node, whose key is given, along with
+// the comments, which may hold them too.
+func (s *scrubber) node(n *yaml.Node, key string) {
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+
+	switch n.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range n.Content {
+			s.node(child, key)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			k, v := n.Content[i], n.Content[i+1]
+			k.HeadComment, k.LineComment, k.FootComment = "", "", ""
+
+			if isSecretKey(key, k.Value) {
+				s.redact(v)
+			} else {
+				s.node(v, k.Value)
+			}
+		}
+	case yaml.ScalarNode:
+		if v := s.value(n.Value); v != n.Value {
+			// Let the encoder quote the scrubbed value as it needs to.
+			n.Value, n.Style = v, 0
+		}
+	}
+}
+
+// redact replaces every value in a YAML node, keeping the keys of mappings
+// (eg. the names of HTTP headers).
+func (s *scrubber) redact(n *yaml.Node) {
+	n.HeadComment, n.LineComment, n.FootComment = "", "", ""
+
+	switch n.Kind {
+	case yaml.SequenceNode:
+		for _, child := range n.Content {
+			s.redact(child)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			s.redact(n.Content[i])
+		}
+	case yaml.ScalarNode:
+		if n.Value == "" {
+			return
+		}
+
+		s.secret(n.Value)
+		n.Value, n.Tag, n.Style = redacted, "!!str", 0
+	}
+}
+
+// value scrubs a configuration value that isn't a secret itself, but may be
+// a URL with credentials or a token in it, or a MAC address.
+func (s *scrubber) value(v string) string {
+	if u, err := url.Parse(v); err == nil && u.Scheme != "" && u.Host != "" {
+		clean := *u
+		clean.User = nil
+		clean.RawQuery = ""
+		// Webhook URLs often have a token in their path (eg. Slack's).
+		if (u.Scheme == "http" || u.Scheme == "https") && strings.Trim(u.Path, "/") != "" {
+			clean.Path, clean.RawPath = "/"+redacted, ""
+		}
+
+		if cleaned := clean.String(); cleaned != v {
+			s.secret(v)
+			if password, ok := u.User.Password(); ok {
+				s.secret(password)
+			}
+			if clean.Path != u.Path {
+				s.secret(strings.Trim(u.Path, "/"))
+			}
+			for _, values := range u.Query() {
+				for _, value := range values {
+					s.secret(value)
+				}
+			}
+
+			v = cleaned
+		}
+	}
+
+	return s.text(v)
+}
+
+// secret records a secret, to be scrubbed from everything else. Values too
+// short to be secrets would scrub unrelated text.
+func (s *scrubber) secret(v string) {
+	if len(v) >= 6 {
+		s.secrets = append(s.secrets, v)
+	}
+}
+
+// text scrubs the recorded secrets and MAC addresses from text (eg. a log).
+func (s *scrubber) text(t string) string {
+	// Longer secrets are replaced first, as they may contain shorter ones.
+	secrets := append([]string(nil), s.secrets...)
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, redacted)
+	}
+	t = strings.NewReplacer(pairs...).Replace(t)
+
+	if s.macs != nil {
+		t = macPattern.ReplaceAllStringFunc(t, s.macs.Redact)
+	}
+
+	return t
+}
+
+// lines scrubs the secrets from a configuration file that isn't valid YAML,
+// by the keys on each line, along with the comments. Every value nested
+// under a secret key (eg. the values of HTTP headers) is a secret too.
+func (s *scrubber) lines(data string) string {
+	// secretIndent is the indentation of the secret key the lines are nested
+	// under, if any.
+	secretIndent := -1
+
+	lines := strings.Split(data, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines[i] = ""
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if secretIndent >= 0 && indent <= secretIndent && strings.TrimSpace(line) != "" {
+			secretIndent = -1
+		}
+
+		m := configLinePattern.FindStringSubmatch(line)
+		if m == nil {
+			if secretIndent >= 0 && strings.TrimSpace(line) != "" {
+				s.secret(strings.TrimSpace(line))
+				line = strings.Repeat(" ", indent) + redacted
+			}
+
+			lines[i] = s.text(line)
+			continue
+		}
+
+		value := strings.TrimSpace(m[3])
+		if secretIndent >= 0 || isSecretKey("", m[2]) {
+			if value != "" {
+				s.secret(strings.Trim(value, `"'`))
+				value = redacted
+			} else if secretIndent < 0 {
+				secretIndent = indent
+			}
+		} else {
+			value = s.value(value)
+		}
+
+		lines[i] = m[1] + value
+	}
+
+	return s.text(strings.Join(lines, "\n"))
+}
+
+// isSecretKey returns whether the value of a configuration key is a secret.
+// parent is the key of the mapping the key is in.
+func isSecretKey(parent, key string) bool {
+	key = strings.ToLower(key)
+
+	switch {
+	case strings.HasSuffix(key, "file"), strings.HasSuffix(key, "from"):
+		// Paths, and where secrets are read from.
+		return false
+	case parent == "ntfy" && key == "topic":
+		// Anyone who knows an ntfy topic can read its notifications.
+		return true
+	}
+
+	for _, secret := range []string{"password", "token", "secret", "key", "salt", "username", "chatid", "headers"} {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/signal"
+	"syscall"
+
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/source/mqtt"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+func scannerCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "scanner",
+		Usage: "Scan for BLE devices and publish their beacons to the MQTT broker",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "topic",
+				Usage: "MQTT topic to publish beacons to (overrides the configuration file)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			conf, err := readConfig(c)
+			if err != nil {
+				return err
+			}
+
+			if conf.Broker.Address == "" {
+				return errors.New("no broker address configured")
+			}
+
+			topic := conf.Scanner.PublishTopic
+			if c.IsSet("topic") {
+				topic = c.String("topic")
+			}
+
+			ctx, stop := signal.NotifyContext(c.Context, syscall.SIGTERM, syscall.SIGINT)
+			defer stop()
+
+			if err := featureBluetooth.check(); err != nil {
+				return err
+			}
+
+			scanner, err := newScanner(conf.ServiceUUIDs(), conf.ButtonMACs())
+			if err != nil {
+				return fmt.Errorf("failed to create scanner: %w", err)
+			}
+
+			g, ctx := errgroup.WithContext(ctx)
+
+			beacons := make(chan source.Beacon, 64)
+
+			g.Go(func() error {
+				return scanner.Run(ctx, beacons)
+			})
+
+			g.Go(func() error {
+				return mqtt.NewPublisher(conf.Broker, topic).Run(ctx, beacons)
+			})
+
+			slog.Info("Forwarding beacons to MQTT broker", slog.String("topic", topic))
+
+			if err := g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dpeckett/cat-doorbell/internal/secret"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+func secretCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "secret",
+		Usage: "Manage credentials stored in the operating system's keyring",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "set",
+				Usage:     "Store a secret, read from the terminal or standard input",
+				ArgsUsage: strings.Join(secret.Names, "|"),
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.New("expected a single secret name argument")
+					}
+
+					if err := secret.CheckName(c.Args().First()); err != nil {
+						return err
+					}
+
+					value, err := readSecret(c.Args().First())
+					if err != nil {
+						return err
+					}
+
+					if err := secret.Set(c.Args().First(), value); err != nil {
+						return err
+					}
+
+					fmt.Printf("Stored %s\n", c.Args().First())
+
+					return nil
+				},
+			},
+			{
+				Name:      "delete",
+				Usage:     "Delete a secret",
+				ArgsUsage: strings.Join(secret.Names, "|"),
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.New("expected a single secret name argument")
+					}
+
+					return secret.Delete(c.Args().First())
+				},
+			},
+		},
+	}
+}
+
+// readSecret prompts for a secret without echoing it, or reads the first line
+// of standard input if it isn't a terminal.
+func readSecret(name string) (string, error) {
+	var value string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprintf(os.Stderr, "Enter %s: ", name)
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret: %w", err)
+		}
+
+		value = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read secret: %w", err)
+		}
+
+		value = strings.TrimRight(line, "\r\n")
+	}
+
+	if value == "" {
+		return "", errors.New("secret must not be empty")
+	}
+
+	return value, nil
+}
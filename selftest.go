@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/action"
+	"github.com/dpeckett/cat-doorbell/internal/camera"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+	"github.com/dpeckett/cat-doorbell/internal/source/mqtt"
+)
+
+// Self-test check statuses.
+const (
+	checkPass = "pass"
+	checkFail = "fail"
+	checkWarn = "warn"
+	checkSkip = "skip"
+)
+
+// selfTestCheck is the result of a single self-test check.
+type selfTestCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+// selfTestReport is the machine-readable result of a self-test.
+type selfTestReport struct {
+	OK     bool            `json:"ok"`
+	Checks []selfTestCheck `json:"checks"`
+}
+
+// selfTest checks that everything the doorbell depends on is working, writes
+// a JSON report to stdout, and returns an error if any check failed.
+func selfTest(conf *latestconfig.Config, opts runOptions) error {
+	report := selfTestReport{OK: true}
+
+	// check runs a single check. Failures of optional checks are reported
+	// as warnings.
+	check := func(name string, skip, optional bool, f func() error) {
+		c := selfTestCheck{Name: name, Status: checkPass}
+		if skip {
+			c.Status = checkSkip
+			report.Checks = append(report.Checks, c)
+			return
+		}
+
+		start := time.Now()
+		err := f()
+		c.DurationMS = time.Since(start).Milliseconds()
+		if err != nil {
+			c.Error = err.Error()
+			c.Status = checkFail
+			if optional {
+				c.Status = checkWarn
+			} else {
+				report.OK = false
+			}
+		}
+
+		report.Checks = append(report.Checks, c)
+	}
+
+	// With fallbacks, the doorbell works as long as any broker is reachable.
+	if brokers := conf.Broker.Brokers(); len(brokers) > 1 {
+		var reachable int
+		for _, b := range brokers {
+			check("broker:"+b.Address, false, true, func() error {
+				if err := mqtt.CheckConnection(b); err != nil {
+					return err
+				}
+
+				reachable++
+				return nil
+			})
+		}
+
+		check("broker", false, false, func() error {
+			if reachable == 0 {
+				return errors.New("none of the brokers are reachable")
+			}
+
+			return nil
+		})
+	} else {
+		check("broker", conf.Broker.Address == "", false, func() error {
+			return mqtt.CheckConnection(conf.Broker)
+		})
+	}
+
+	for _, t := range conf.Broker.Topics {
+		check("parser:"+t.Topic, conf.Broker.Address == "", false, func() error {
+			return mqtt.CheckTopic(conf.Broker, t)
+		})
+	}
+
+	check("bluetooth", !conf.Scanner.Enabled, false, func() error {
+		if err := featureBluetooth.check(); err != nil {
+			return err
+		}
+
+		return checkAdapter()
+	})
+
+	// Sound is optional in headless mode, and isn't checked if it was left out
+	// of the build.
+	check("audio", !featureAudio.enabled(), opts.headless, func() error {
+		player, err := newPlayer(conf)
+		if err != nil {
+			return err
+		}
+		player.Close()
+
+		return nil
+	})
+
+	for _, n := range conf.Notifiers {
+		// Desktop notifications are disabled in headless mode.
+		check("notifier:"+n.Name, opts.headless && n.Desktop != nil, false, func() error {
+			_, err := notifier.NewDispatcher([]latestconfig.NotifierConfig{n}, "", nil, nil)
+			return err
+		})
+	}
+
+	// Notifications are still delivered without a snapshot.
+	check("camera", conf.Camera == nil, true, func() error {
+		_, err := camera.New(conf.Camera).Snapshot(context.Background())
+		return err
+	})
+
+	for _, a := range conf.Actions {
+		check("action:"+a.Name, false, false, func() error {
+			if _, err := action.NewRunner([]latestconfig.ActionConfig{a}); err != nil {
+				return err
+			}
+
+			if len(a.Command) > 0 {
+				if _, err := exec.LookPath(a.Command[0]); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	check("history", false, false, func() error {
+		store, err := history.Open(conf.History, opts.historyPath)
+		if err != nil {
+			return err
+		}
+
+		return store.Close()
+	})
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	if !report.OK {
+		return errors.New("self-test failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// serviceName is the name the application is registered with the platform's
+// service manager as.
+const serviceName = "cat-doorbell"
+
+// serviceSpec describes how the service manager should run the application.
+type serviceSpec struct {
+	// executable is the absolute path to the cat-doorbell binary.
+	executable string
+	// args are the arguments to run it with.
+	args []string
+	// logDir is where the application (and service manager) writes logs.
+	logDir string
+	// headless is true if the application runs without a system tray.
+	headless bool
+}
+
+func serviceCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "service",
+		Usage: "Start cat-doorbell automatically at login (using systemd, launchd or a Windows startup entry)",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "install",
+				Usage: "Register cat-doorbell to start at login",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "now",
+						Usage: "Also start it now",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					spec, err := newServiceSpec(c)
+					if err != nil {
+						return err
+					}
+
+					if err := installService(spec); err != nil {
+						return fmt.Errorf("failed to install service: %w", err)
+					}
+
+					fmt.Printf("Installed %s, logs are written to %s\n", serviceName, spec.logDir)
+
+					if c.Bool("now") {
+						if err := startService(); err != nil {
+							return fmt.Errorf("failed to start service: %w", err)
+						}
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "uninstall",
+				Usage: "Stop cat-doorbell starting at login",
+				Action: func(c *cli.Context) error {
+					if err := uninstallService(); err != nil {
+						return fmt.Errorf("failed to uninstall service: %w", err)
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "start",
+				Usage: "Start the installed service",
+				Action: func(c *cli.Context) error {
+					if err := startService(); err != nil {
+						return fmt.Errorf("failed to start service: %w", err)
+					}
+
+					return nil
+				},
+			},
+			{
+				Name:  "stop",
+				Usage: "Stop the installed service",
+				Action: func(c *cli.Context) error {
+					if err := stopService(); err != nil {
+						return fmt.Errorf("failed to stop service: %w", err)
+					}
+
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// newServiceSpec returns the spec for running the current executable with
+// the same configuration, log and history paths as this invocation.
+func newServiceSpec(c *cli.Context) (*serviceSpec, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+
+	spec := &serviceSpec{
+		executable: executable,
+		headless:   c.Bool("headless"),
+	}
+
+	for _, name := range []string{"config", "system-config", "log-dir", "history-file", "queue-file"} {
+		path, err := filepath.Abs(c.String(name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s path: %w", name, err)
+		}
+
+		if name == "log-dir" {
+			spec.logDir = path
+		}
+
+		spec.args = append(spec.args, "--"+name, path)
+	}
+
+	if c.IsSet("log-level") {
+		spec.args = append(spec.args, "--log-level", c.Generic("log-level").(fmt.Stringer).String())
+	}
+
+	for _, override := range c.StringSlice("set") {
+		spec.args = append(spec.args, "--set", override)
+	}
+
+	if c.Bool("scan") {
+		spec.args = append(spec.args, "--scan")
+	}
+
+	if spec.headless {
+		spec.args = append(spec.args, "--headless")
+	}
+
+	return spec, nil
+}
+
+// runCommand runs a service manager command, including its output in the
+// returned error if it fails.
+func runCommand(name string, args ...string) error {
+	var output bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(output.String()); msg != "" {
+			return fmt.Errorf("%s %s: %w: %s", name, strings.Join(args, " "), err, msg)
+		}
+
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+
+	return nil
+}
+
+// removeServiceFile removes an installed service definition, returning an
+// error if it wasn't installed.
+func removeServiceFile(path string) error {
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%s is not installed", serviceName)
+		}
+
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+
+	return nil
+}
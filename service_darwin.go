@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+// launchdLabel identifies the launchd agent.
+const launchdLabel = "com.github.dpeckett.cat-doorbell"
+
+var launchdPlistTemplate = template.Must(template.New("plist").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>{{.Label}}</string>
+  <key>ProgramArguments</key>
+  <array>
+{{- range .Args}}
+    <string>{{.}}</string>
+{{- end}}
+  </array>
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+  <dict>
+    <key>SuccessfulExit</key>
+    <false/>
+  </dict>
+  <key>ProcessType</key>
+  <string>Interactive</string>
+  <key>StandardOutPath</key>
+  <string>{{.LogFile}}</string>
+  <key>StandardErrorPath</key>
+  <string>{{.LogFile}}</string>
+</dict>
+</plist>
+`))
+
+// launchdPlistPath returns the path of the launchd agent's property list.
+func launchdPlistPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), nil
+}
+
+// launchdTarget returns the launchd service target of the agent.
+func launchdTarget() string {
+	return fmt.Sprintf("gui/%d/%s", os.Getuid(), launchdLabel)
+}
+
+// installService installs and loads a launchd agent.
+func installService(spec *serviceSpec) error {
+	path, err := launchdPlistPath()
+	if err != nil {
+		return err
+	}
+
+	args := []string{xmlEscape(spec.executable)}
+	for _, arg := range spec.args {
+		args = append(args, xmlEscape(arg))
+	}
+
+	var plist bytes.Buffer
+	if err := launchdPlistTemplate.Execute(&plist, map[string]any{
+		"Label":   launchdLabel,
+		"Args":    args,
+		"LogFile": xmlEscape(filepath.Join(spec.logDir, "launchd.log")),
+	}); err != nil {
+		return fmt.Errorf("failed to render property list: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create launch agents directory: %w", err)
+	}
+
+	if err := os.MkdirAll(spec.logDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	// Replace any previously loaded version of the agent.
+	_ = runCommand("launchctl", "bootout", launchdTarget())
+
+	if err := os.WriteFile(path, plist.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write property list: %w", err)
+	}
+
+	// Bootstrapping starts the agent, as it runs at load.
+	return runCommand("launchctl", "bootstrap", fmt.Sprintf("gui/%d", os.Getuid()), path)
+}
+
+// uninstallService unloads and removes the launchd agent.
+func uninstallService() error {
+	path, err := launchdPlistPath()
+	if err != nil {
+		return err
+	}
+
+	_ = runCommand("launchctl", "bootout", launchdTarget())
+
+	return removeServiceFile(path)
+}
+
+func startService() error {
+	return runCommand("launchctl", "kickstart", launchdTarget())
+}
+
+func stopService() error {
+	return runCommand("launchctl", "kill", "SIGTERM", launchdTarget())
+}
+
+// xmlEscape escapes a string for inclusion in a property list.
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
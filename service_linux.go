@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/adrg/xdg"
+)
+
+var systemdUnitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description=Cat Doorbell
+Wants=network-online.target
+After=network-online.target{{if not .Headless}} graphical-session.target
+PartOf=graphical-session.target{{end}}
+
+[Service]
+ExecStart={{.ExecStart}}
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+
+[Install]
+WantedBy={{if .Headless}}default.target{{else}}graphical-session.target{{end}}
+`))
+
+// systemdUnitPath returns the path of the systemd user unit.
+func systemdUnitPath() string {
+	return filepath.Join(xdg.ConfigHome, "systemd", "user", serviceName+".service")
+}
+
+// installService installs and enables a systemd user unit.
+func installService(spec *serviceSpec) error {
+	// systemd splits ExecStart on whitespace, unless arguments are quoted.
+	quoted := []string{strconv.Quote(spec.executable)}
+	for _, arg := range spec.args {
+		quoted = append(quoted, strings.ReplaceAll(strconv.Quote(arg), "%", "%%"))
+	}
+
+	var unit bytes.Buffer
+	if err := systemdUnitTemplate.Execute(&unit, map[string]any{
+		"ExecStart": strings.Join(quoted, " "),
+		"Headless":  spec.headless,
+	}); err != nil {
+		return fmt.Errorf("failed to render unit: %w", err)
+	}
+
+	path := systemdUnitPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create unit directory: %w", err)
+	}
+
+	if err := os.WriteFile(path, unit.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write unit: %w", err)
+	}
+
+	if err := runCommand("systemctl", "--user", "daemon-reload"); err != nil {
+		return err
+	}
+
+	if err := runCommand("systemctl", "--user", "enable", serviceName); err != nil {
+		return err
+	}
+
+	if spec.headless {
+		// User units only run while the user is logged in, unless lingering
+		// is enabled.
+		fmt.Printf("To start %s at boot rather than login, run: loginctl enable-linger %s\n", serviceName, os.Getenv("USER"))
+	}
+
+	return nil
+}
+
+// uninstallService stops, disables and removes the systemd user unit.
+func uninstallService() error {
+	if _, err := os.Stat(systemdUnitPath()); err == nil {
+		if err := runCommand("systemctl", "--user", "disable", "--now", serviceName); err != nil {
+			return err
+		}
+	}
+
+	if err := removeServiceFile(systemdUnitPath()); err != nil {
+		return err
+	}
+
+	return runCommand("systemctl", "--user", "daemon-reload")
+}
+
+func startService() error {
+	return runCommand("systemctl", "--user", "start", serviceName)
+}
+
+func stopService() error {
+	return runCommand("systemctl", "--user", "stop", serviceName)
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// runKey is the registry key of programs started at login.
+const runKey = `HKCU\Software\Microsoft\Windows\CurrentVersion\Run`
+
+// installService adds a startup entry to the registry.
+func installService(spec *serviceSpec) error {
+	command := []string{syscall.EscapeArg(spec.executable)}
+	for _, arg := range spec.args {
+		command = append(command, syscall.EscapeArg(arg))
+	}
+
+	return runCommand("reg", "add", runKey, "/v", serviceName, "/t", "REG_SZ", "/d", strings.Join(command, " "), "/f")
+}
+
+// uninstallService removes the startup entry from the registry.
+func uninstallService() error {
+	if err := runCommand("reg", "delete", runKey, "/v", serviceName, "/f"); err != nil {
+		return fmt.Errorf("%s is not installed: %w", serviceName, err)
+	}
+
+	return nil
+}
+
+// startService starts the application in the background, with the command
+// line of the startup entry.
+func startService() error {
+	output, err := exec.Command("reg", "query", runKey, "/v", serviceName).Output()
+	if err != nil {
+		return errors.New(serviceName + " is not installed")
+	}
+
+	// The value is listed as "<name>    REG_SZ    <data>".
+	var commandLine string
+	for _, line := range strings.Split(string(output), "\n") {
+		if _, data, ok := strings.Cut(line, "REG_SZ"); ok {
+			commandLine = strings.TrimSpace(data)
+		}
+	}
+	if commandLine == "" {
+		return fmt.Errorf("failed to read the startup entry of %s", serviceName)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	cmd := exec.Command(executable)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine:       commandLine,
+		CreationFlags: 0x00000008, // DETACHED_PROCESS
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", serviceName, err)
+	}
+
+	return cmd.Process.Release()
+}
+
+// stopService stops every running instance of the application, other than
+// this one.
+func stopService() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	return runCommand("taskkill", "/F", "/IM", filepath.Base(executable), "/FI", fmt.Sprintf("PID ne %d", os.Getpid()))
+}
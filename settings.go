@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/urfave/cli/v2"
+)
+
+func settingsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "settings",
+		Usage: "Edit the broker, target and sound settings in a window",
+		Action: func(c *cli.Context) error {
+			if err := featureGUI.check(); err != nil {
+				return err
+			}
+
+			if !hasDisplay() {
+				return errors.New("the settings window requires a graphical session")
+			}
+
+			return runSettings(c.String("config"))
+		},
+	}
+}
+
+// openSettings opens the settings window for the configuration file at the
+// given path in a separate process, as it can't share the main thread with
+// the system tray. The running instance reloads the configuration once the
+// settings are saved.
+func openSettings(c *cli.Context, configPath string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+
+	// The configuration file is already the profile's (if any), so the
+	// profile isn't selected again from the environment.
+	cmd := exec.Command(executable,
+		"--config", configPath,
+		"--system-config", c.String("system-config"),
+		"--log-dir", c.String("log-dir"),
+		"--profile=",
+		"settings")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open settings window: %w", err)
+	}
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			slog.Warn("Settings window failed", slog.Any("error", err))
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,272 @@
+//go:build !nogui
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/app"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/dpeckett/cat-doorbell/internal/assets"
+	"github.com/dpeckett/cat-doorbell/internal/config"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	runSettings = runSettingsWindow
+}
+
+// settingsTarget is a target being edited in the settings window.
+type settingsTarget struct {
+	// index is the position of the target in the configuration file, or -1
+	// for targets that have been added.
+	index int
+	// name and mac are the original values of the target.
+	name, mac string
+	// nameEntry and macEntry hold the edited values.
+	nameEntry, macEntry *widget.Entry
+	removed             bool
+}
+
+// runSettingsWindow shows a window for editing the broker, targets and
+// sounds in the configuration file. Only the settings that were changed are
+// written back, the rest of the file (including comments) is left as it is.
+func runSettingsWindow(configPath string) error {
+	// The file is read without applying defaults, so that unset fields stay
+	// unset.
+	confBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file (create one with \"cat-doorbell config init\"): %w", err)
+	}
+
+	var conf latestconfig.Config
+	if err := yaml.Unmarshal(confBytes, &conf); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	if conf.APIVersion != latestconfig.APIVersion {
+		return fmt.Errorf("config file uses %s, migrate it to %s with \"cat-doorbell config migrate\" first",
+			conf.APIVersion, latestconfig.APIVersion)
+	}
+
+	a := app.NewWithID("com.github.dpeckett.cat-doorbell")
+	if icon, err := assets.ReadFile("cat-icon.png"); err == nil {
+		a.SetIcon(fyne.NewStaticResource("cat-icon.png", icon))
+	}
+
+	w := a.NewWindow("Doorbell Settings")
+
+	// Broker
+	address := widget.NewEntry()
+	address.SetText(conf.Broker.Address)
+	address.SetPlaceHolder("tcp://localhost:1883")
+	username := widget.NewEntry()
+	username.SetText(conf.Broker.Username)
+	password := widget.NewPasswordEntry()
+	password.SetText(conf.Broker.Password)
+
+	brokerForm := widget.NewForm(
+		widget.NewFormItem("Address", address),
+		widget.NewFormItem("Username", username),
+		widget.NewFormItem("Password", password),
+	)
+
+	// Targets
+	var targets []*settingsTarget
+	targetRows := container.NewVBox()
+	addTargetRow := func(t *settingsTarget) {
+		t.nameEntry = widget.NewEntry()
+		t.nameEntry.SetText(t.name)
+		t.nameEntry.SetPlaceHolder("Name")
+		t.macEntry = widget.NewEntry()
+		t.macEntry.SetText(t.mac)
+		t.macEntry.SetPlaceHolder("AA:BB:CC:DD:EE:FF")
+
+		var row *fyne.Container
+		remove := widget.NewButton("Remove", func() {
+			t.removed = true
+			targetRows.Remove(row)
+		})
+		row = container.NewBorder(nil, nil, nil, remove, container.NewGridWithColumns(2, t.nameEntry, t.macEntry))
+
+		targets = append(targets, t)
+		targetRows.Add(row)
+	}
+
+	for i, t := range conf.Targets {
+		addTargetRow(&settingsTarget{index: i, name: t.Name, mac: t.MAC})
+	}
+
+	addTarget := widget.NewButton("Add Target", func() {
+		addTargetRow(&settingsTarget{index: -1})
+	})
+
+	// Sounds
+	soundFile := widget.NewEntry()
+	soundFile.SetText(conf.Sound.File)
+	soundFile.SetPlaceHolder("Embedded doorbell sound")
+	buttonFile := widget.NewEntry()
+	buttonFile.SetText(conf.Sound.ButtonFile)
+	buttonFile.SetPlaceHolder("Same as the detection sound")
+
+	volume := 1.0
+	if conf.Sound.Volume != nil {
+		volume = *conf.Sound.Volume
+	}
+	volumeLabel := widget.NewLabel("")
+	volumeSlider := widget.NewSlider(0, 2)
+	volumeSlider.Step = 0.05
+	volumeSlider.OnChanged = func(v float64) {
+		volumeLabel.SetText(strconv.Itoa(int(v*100+0.5)) + "%")
+	}
+	volumeSlider.SetValue(volume)
+
+	soundForm := widget.NewForm(
+		widget.NewFormItem("Sound", fileEntry(w, soundFile)),
+		widget.NewFormItem("Button sound", fileEntry(w, buttonFile)),
+		widget.NewFormItem("Volume", container.NewBorder(nil, nil, nil, volumeLabel, volumeSlider)),
+	)
+
+	save := func() error {
+		return config.Edit(configPath, func(doc *yaml.Node) error {
+			set := func(path []string, old, new string) error {
+				if old == new {
+					return nil
+				}
+
+				return config.Set(doc, path, new)
+			}
+
+			if err := errors.Join(
+				set([]string{"broker", "address"}, conf.Broker.Address, address.Text),
+				set([]string{"broker", "username"}, conf.Broker.Username, username.Text),
+				set([]string{"broker", "password"}, conf.Broker.Password, password.Text),
+				set([]string{"sound", "file"}, conf.Sound.File, soundFile.Text),
+				set([]string{"sound", "buttonFile"}, conf.Sound.ButtonFile, buttonFile.Text),
+			); err != nil {
+				return err
+			}
+
+			if volumeSlider.Value != volume {
+				if err := config.Set(doc, []string{"sound", "volume"}, volumeSlider.Value); err != nil {
+					return err
+				}
+			}
+
+			// Existing targets are edited before any are removed, while their
+			// indexes are still valid, and removed last to first.
+			for _, t := range targets {
+				if t.index < 0 || t.removed {
+					continue
+				}
+
+				if t.nameEntry.Text != t.name {
+					if err := config.SetTarget(doc, t.index, "name", t.nameEntry.Text); err != nil {
+						return err
+					}
+				}
+
+				if t.macEntry.Text != t.mac {
+					if err := config.SetTarget(doc, t.index, "mac", t.macEntry.Text); err != nil {
+						return err
+					}
+				}
+			}
+
+			for i := len(targets) - 1; i >= 0; i-- {
+				if t := targets[i]; t.index >= 0 && t.removed {
+					if err := config.RemoveTargetAt(doc, t.index); err != nil {
+						return err
+					}
+				}
+			}
+
+			for _, t := range targets {
+				if t.index >= 0 || t.removed || (t.nameEntry.Text == "" && t.macEntry.Text == "") {
+					continue
+				}
+
+				if err := config.AddTarget(doc, latestconfig.TargetConfig{Name: t.nameEntry.Text, MAC: t.macEntry.Text}); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+	}
+
+	saveButton := widget.NewButton("Save", func() {
+		if err := save(); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+
+		slog.Info("Saved settings", slog.String("path", configPath))
+		w.Close()
+	})
+	saveButton.Importance = widget.HighImportance
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Broker", brokerForm),
+		container.NewTabItem("Targets", container.NewBorder(nil, container.NewHBox(addTarget), nil, nil,
+			container.NewVScroll(targetRows))),
+		container.NewTabItem("Sounds", soundForm),
+	)
+
+	w.SetContent(container.NewBorder(nil,
+		container.NewHBox(layout.NewSpacer(), widget.NewButton("Cancel", w.Close), saveButton),
+		nil, nil, tabs))
+	w.Resize(fyne.NewSize(560, 400))
+	w.ShowAndRun()
+
+	return nil
+}
+
+// fileEntry returns the entry with a button for choosing a sound file.
+func fileEntry(w fyne.Window, entry *widget.Entry) fyne.CanvasObject {
+	browse := widget.NewButton("Browse…", func() {
+		d := dialog.NewFileOpen(func(f fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+
+			if f != nil {
+				entry.SetText(f.URI().Path())
+				_ = f.Close()
+			}
+		}, w)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{".mp3", ".wav", ".ogg", ".flac"}))
+		d.Show()
+	})
+
+	return container.NewBorder(nil, nil, nil, browse, entry)
+}
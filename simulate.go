@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/source"
+	"github.com/dpeckett/cat-doorbell/internal/source/simulate"
+	"github.com/dpeckett/cat-doorbell/internal/util"
+	"github.com/urfave/cli/v2"
+)
+
+// waitFlag is the flag for how long a simulation keeps running after the
+// last beacon.
+var waitFlag = &cli.DurationFlag{
+	Name:  "wait",
+	Usage: "How long to keep running after the last beacon, eg. for notifications to be delivered or departures to be raised",
+	Value: 5 * time.Second,
+}
+
+func simulateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "simulate",
+		Usage: "Ring the doorbell for simulated beacons from a device, without a broker or Bluetooth adapter",
+		Description: "Beacons are fed through detection as if they had been received, so detection settings,\n" +
+			"custom events, actions and notifiers can be checked before mounting any hardware.\n" +
+			"Detections are notified as usual, but aren't recorded in the history.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "mac",
+				Usage:    "MAC address of the simulated device",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "rssi",
+				Usage: "Signal strength of the simulated beacons in dBm",
+				Value: -60,
+			},
+			&cli.IntFlag{
+				Name:  "count",
+				Usage: "Number of beacons to send",
+				Value: 1,
+			},
+			&cli.DurationFlag{
+				Name:  "interval",
+				Usage: "Time between beacons",
+				Value: 2 * time.Second,
+			},
+			&cli.BoolFlag{
+				Name:  "button",
+				Usage: "Report a button press in the simulated beacons",
+			},
+			waitFlag,
+		},
+		Action: func(c *cli.Context) error {
+			conf, err := readConfig(c)
+			if err != nil {
+				return err
+			}
+
+			mac, err := util.NormalizeMAC(c.String("mac"))
+			if err != nil {
+				return err
+			}
+
+			if c.Int("count") < 1 {
+				return errors.New("count must be at least 1")
+			}
+
+			src := simulate.New(source.Beacon{
+				MAC:    mac,
+				RSSI:   c.Int("rssi"),
+				Button: c.Bool("button"),
+			}, c.Int("count"), c.Duration("interval"))
+
+			return runSimulation(c, conf, src)
+		},
+	}
+}
+
+// runSimulation runs the doorbell with beacons from the given source, instead
+// of the configured broker and scanner, until the source has finished.
+func runSimulation(c *cli.Context, conf *latestconfig.Config, src source.Source) error {
+	d, cleanup, err := openSimulation(conf, runOptions{
+		headless: isHeadless(c),
+		source:   src,
+		linger:   c.Duration("wait"),
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	ctx, stop := signal.NotifyContext(c.Context, syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	err = d.run(ctx)
+	if err != nil && !errors.Is(err, errSourceFinished) && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+// openSimulation opens a doorbell for a simulation with the given options. A
+// temporary history is used, and the web dashboard, metrics and control
+// socket aren't served, so it can run alongside the doorbell. The returned
+// function closes the doorbell and removes the temporary files.
+func openSimulation(conf *latestconfig.Config, opts runOptions) (*doorbell, func(), error) {
+	dir, err := os.MkdirTemp("", "cat-doorbell-simulate-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	sim := *conf
+	sim.Web.ListenAddress = ""
+	sim.Metrics.ListenAddress = ""
+	sim.History = latestconfig.HistoryConfig{Backend: latestconfig.HistoryBackendSQLite}
+	// Simulated visits mustn't keep other instances from ringing.
+	if sim.Visits != nil {
+		visits := *sim.Visits
+		visits.Topic = ""
+		sim.Visits = &visits
+	}
+
+	opts.historyPath = filepath.Join(dir, "history.db")
+	opts.queuePath = filepath.Join(dir, "notification-queue.json")
+	opts.pushDir = filepath.Join(dir, "push")
+	opts.visitsPath = filepath.Join(dir, "visits.json")
+
+	d := newDoorbell(&sim, opts)
+	if err := d.open(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, nil, err
+	}
+
+	return d, func() {
+		d.close()
+		_ = os.RemoveAll(dir)
+	}, nil
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/stats"
+	"github.com/urfave/cli/v2"
+)
+
+func statsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "stats",
+		Usage: "Show how often and when each target rang the doorbell",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "since",
+				Usage: "Summarize visits after a duration ago (eg. 24h) or RFC 3339 timestamp",
+				Value: "168h",
+			},
+			&cli.StringSliceFlag{
+				Name:  "target",
+				Usage: "Only summarize the target with the given name (can be repeated)",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output statistics as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			now := time.Now()
+			since, err := parseSince(c.String("since"), now)
+			if err != nil {
+				return err
+			}
+
+			conf, err := readConfig(c)
+			if err != nil {
+				return err
+			}
+
+			// Without --target, every configured target is summarized, along
+			// with any others found in the history.
+			names, only := c.StringSlice("target"), true
+			if len(names) == 0 {
+				only = false
+				for _, t := range conf.Targets {
+					names = append(names, t.Name)
+				}
+			}
+
+			store, err := history.Open(conf.History, c.String("history-file"))
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			s, err := stats.Load(c.Context, store, names, only, since, now)
+			if err != nil {
+				return err
+			}
+
+			if c.Bool("json") {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if s.Targets == nil {
+					s.Targets = []stats.Target{}
+				}
+				return enc.Encode(s)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVISITS\tPER DAY\tBUSIEST\tAVERAGE GAP\tLAST VISIT")
+			for _, t := range s.Targets {
+				busiest, gap, last := "-", "-", "-"
+				if t.Busiest != nil {
+					busiest = fmt.Sprintf("%s (%d)", t.Busiest, t.Busiest.Visits)
+				}
+				if t.AverageGap > 0 {
+					gap = t.AverageGap.Round(time.Second).String()
+				}
+				if t.LastVisit != nil {
+					last = t.LastVisit.Format(time.DateTime)
+				}
+
+				fmt.Fprintf(w, "%s\t%d\t%.1f\t%s\t%s\t%s\n", t.Name, t.Visits, t.PerDay, busiest, gap, last)
+			}
+
+			return w.Flush()
+		},
+	}
+}
@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+	"github.com/dpeckett/cat-doorbell/internal/stats"
+)
+
+// summary is the summary of a target's visits over the last period.
+type summary struct {
+	target stats.Target
+	// time is when the summary was due.
+	time   time.Time
+	weekly bool
+}
+
+// watchSummaries raises a summary of each target's visits at the end of each
+// configured period.
+func (d *doorbell) watchSummaries(ctx context.Context) error {
+	for {
+		conf, changed := d.config()
+		if !conf.Summary.Enabled {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+				continue
+			}
+		}
+
+		jumped := d.clockJumps()
+		due := conf.Summary.Next(time.Now())
+
+		timer := time.NewTimer(time.Until(due))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			// The schedule may have changed.
+			timer.Stop()
+			continue
+		case <-jumped:
+			timer.Stop()
+
+			if !raiseLate(time.Now(), due, conf.Summary.Length()) {
+				continue
+			}
+		case <-timer.C:
+		}
+
+		// The timer runs on the monotonic clock, so if the system clock
+		// went back meanwhile, the summary isn't due yet.
+		if time.Now().Before(due) {
+			continue
+		}
+
+		s, err := stats.Load(ctx, d.history, summaryTargets(conf), true, due.Add(-conf.Summary.Length()), due)
+		if err != nil {
+			slog.Warn("Failed to summarize visits", slog.Any("error", err))
+			continue
+		}
+
+		for _, t := range s.Targets {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case d.summaries <- summary{target: t, time: due, weekly: conf.Summary.Period == latestconfig.SummaryPeriodWeekly}:
+			}
+		}
+	}
+}
+
+// raiseLate returns whether a summary due at the given time is raised once
+// the clock has jumped. A summary that became due as the clock jumped forward
+// is raised late, unless a whole period has passed since.
+func raiseLate(now, due time.Time, length time.Duration) bool {
+	return !now.Before(due) && now.Sub(due) < length
+}
+
+// raiseSummary raises a low priority notification summarizing a target's
+// visits.
+func (d *doorbell) raiseSummary(ctx context.Context, s summary) {
+	conf, _ := d.config()
+
+	var color string
+	for _, t := range conf.Targets {
+		if t.Name == s.target.Name {
+			color = t.Color
+		}
+	}
+
+	data := &notifier.TextData{
+		Name:       s.target.Name,
+		Time:       s.time,
+		CountToday: d.visitsToday(ctx, s.target.Name, s.time),
+		Visits:     s.target.Visits,
+		Weekly:     s.weekly,
+	}
+	if s.target.LastVisit != nil {
+		data.LastVisit = *s.target.LastVisit
+	}
+	if s.target.Busiest != nil {
+		day := time.Date(s.time.Year(), s.time.Month(), s.time.Day(), 0, 0, 0, 0, s.time.Location())
+		data.BusiestFrom = day.Add(time.Duration(s.target.Busiest.From) * time.Hour)
+		data.BusiestTo = day.Add(time.Duration(s.target.Busiest.To) * time.Hour)
+	}
+
+	title, message := d.texts.Render(s.target.Name, latestconfig.EventSummary, data)
+
+	d.raiseEvent(ctx, &notifier.Notification{
+		Event:    latestconfig.EventSummary,
+		Title:    title,
+		Message:  message,
+		Name:     s.target.Name,
+		Color:    color,
+		Time:     s.time,
+		Priority: notifier.PriorityLow,
+		Instance: d.instance(),
+	}, "")
+}
+
+// summaryTargets returns the names of the targets that are summarized.
+func summaryTargets(conf *latestconfig.Config) []string {
+	if len(conf.Summary.Targets) > 0 {
+		return conf.Summary.Targets
+	}
+
+	names := make([]string, 0, len(conf.Targets))
+	for _, t := range conf.Targets {
+		names = append(names, t.Name)
+	}
+
+	return names
+}
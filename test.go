@@ -0,0 +1,228 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/control"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+	"github.com/urfave/cli/v2"
+)
+
+// testResult is the outcome of sending a test notification to a notifier.
+type testResult struct {
+	Notifier  string `json:"notifier"`
+	Type      string `json:"type"`
+	OK        bool   `json:"ok"`
+	LatencyMS int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+	Queued    bool   `json:"queued,omitempty"`
+}
+
+func testCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "test",
+		Usage: "Send a test notification and report the result for each notifier",
+		Description: "If cat-doorbell is running, it rings the doorbell for a fake detection of a target,\n" +
+			"end-to-end. Otherwise (or with --all or --notifier) a test notification is sent directly.\n" +
+			"Either way the notification is delivered as if a device had been detected, so only\n" +
+			"notifiers subscribed to detection events receive it (unless --all is given).",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "target",
+				Usage: "Name of the target the running instance fakes a detection of (defaults to the first target)",
+			},
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "Send the test notification to every notifier, regardless of the events it is subscribed to",
+			},
+			&cli.StringSliceFlag{
+				Name:  "notifier",
+				Usage: "Only test the notifier with the given name (can be repeated)",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output the results as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			conf, err := readConfig(c)
+			if err != nil {
+				return err
+			}
+
+			types := make(map[string]string)
+			for _, nc := range conf.Notifiers {
+				types[nc.Name] = nc.Type()
+			}
+
+			var report []testResult
+			if !c.Bool("all") && !c.IsSet("notifier") {
+				report, err = testRunningInstance(c, types)
+				if errors.Is(err, control.ErrNotRunning) {
+					report, err = testNotifiers(c, conf, types)
+				}
+			} else {
+				report, err = testNotifiers(c, conf, types)
+			}
+			if err != nil {
+				return err
+			}
+
+			var failed int
+			for _, r := range report {
+				if !r.OK {
+					failed++
+				}
+			}
+
+			if c.Bool("json") {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(report); err != nil {
+					return err
+				}
+			} else {
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "NOTIFIER\tTYPE\tRESULT\tLATENCY\tERROR")
+				for _, r := range report {
+					result := "ok"
+					switch {
+					case r.Queued:
+						result = "queued"
+					case !r.OK:
+						result = "failed"
+					}
+
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Notifier, r.Type, result,
+						time.Duration(r.LatencyMS)*time.Millisecond, orDash(r.Error))
+				}
+
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+
+			if len(report) == 0 {
+				return errors.New("no notifiers received the test notification")
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d notifiers failed", failed, len(report))
+			}
+
+			return nil
+		},
+	}
+}
+
+// testRunningInstance asks the running instance to ring the doorbell for a
+// fake detection, and returns the result for each notifier. It returns
+// control.ErrNotRunning if there is no running instance.
+func testRunningInstance(c *cli.Context, types map[string]string) ([]testResult, error) {
+	results, err := controlClient(c).TestDetection(c.Context, c.String("target"))
+	if err != nil {
+		return nil, err
+	}
+
+	report := make([]testResult, 0, len(results))
+	for _, r := range results {
+		report = append(report, testResult{
+			Notifier:  r.Notifier,
+			Type:      types[r.Notifier],
+			OK:        r.Error == "",
+			LatencyMS: r.Latency.Milliseconds(),
+			Error:     r.Error,
+			Queued:    r.Queued,
+		})
+	}
+
+	return report, nil
+}
+
+// testNotifiers sends a test notification directly to the notifiers, and
+// returns the result for each.
+func testNotifiers(c *cli.Context, conf *latestconfig.Config, types map[string]string) ([]testResult, error) {
+	confs := conf.Notifiers
+	if names := c.StringSlice("notifier"); len(names) > 0 {
+		confs = nil
+		for _, name := range names {
+			i := slices.IndexFunc(conf.Notifiers, func(n latestconfig.NotifierConfig) bool {
+				return n.Name == name
+			})
+			if i < 0 {
+				return nil, fmt.Errorf("notifier %q not found", name)
+			}
+
+			confs = append(confs, conf.Notifiers[i])
+		}
+	}
+
+	catIconPath, cleanup, err := unpackIcon()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	dispatcher, err := notifier.NewDispatcher(confs, catIconPath, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifiers: %w", err)
+	}
+
+	n := &notifier.Notification{
+		Event:    latestconfig.EventDetected,
+		Title:    "Doorbell",
+		Message:  "This is a test notification from cat-doorbell",
+		Name:     "Test",
+		Time:     time.Now(),
+		Instance: conf.InstanceName(),
+	}
+
+	var results []notifier.Result
+	if c.Bool("all") {
+		results = dispatcher.Broadcast(c.Context, n)
+	} else {
+		results = dispatcher.Notify(c.Context, n)
+	}
+
+	report := make([]testResult, 0, len(results))
+	for _, r := range results {
+		tr := testResult{
+			Notifier:  r.Notifier,
+			Type:      types[r.Notifier],
+			OK:        r.Err == nil,
+			LatencyMS: r.Latency.Milliseconds(),
+		}
+		if r.Err != nil {
+			tr.Error = r.Err.Error()
+		}
+
+		report = append(report, tr)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dpeckett/cat-doorbell/internal/web"
+	"github.com/urfave/cli/v2"
+)
+
+// caName is the name the local certificate authority is installed as.
+const caName = "cat-doorbell"
+
+func tlsCommand(certDir string) *cli.Command {
+	return &cli.Command{
+		Name:  "tls",
+		Usage: "Manage the local certificate authority the web dashboard's certificate is issued by",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "ca",
+				Usage: "Print the certificate of the local certificate authority, creating it if necessary",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Write the certificate to the given path, rather than standard output",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					ca, err := web.LocalCA(certDir)
+					if err != nil {
+						return err
+					}
+
+					data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+					if path := c.String("output"); path != "" {
+						if err := os.WriteFile(path, data, 0o644); err != nil {
+							return fmt.Errorf("failed to write certificate: %w", err)
+						}
+
+						return nil
+					}
+
+					_, err = os.Stdout.Write(data)
+					return err
+				},
+			},
+			{
+				Name:  "install-ca",
+				Usage: "Trust the local certificate authority on this computer",
+				Action: func(c *cli.Context) error {
+					ca, err := web.LocalCA(certDir)
+					if err != nil {
+						return err
+					}
+
+					dir, err := os.MkdirTemp("", "cat-doorbell-ca-*")
+					if err != nil {
+						return fmt.Errorf("failed to create temporary directory: %w", err)
+					}
+					defer os.RemoveAll(dir)
+
+					path := filepath.Join(dir, caName+".crt")
+					if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0o644); err != nil {
+						return fmt.Errorf("failed to write certificate: %w", err)
+					}
+
+					if err := installCA(path); err != nil {
+						return fmt.Errorf("failed to install certificate authority: %w", err)
+					}
+
+					sum := sha256.Sum256(ca.Raw)
+					fmt.Printf("Installed %q (SHA-256 fingerprint %s), restart your browser for it to take effect\n",
+						ca.Subject.CommonName, hex.EncodeToString(sum[:]))
+
+					return nil
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// caTrustStores are the directories distributions load additional trusted
+// certificates from, and the command that updates the system trust store
+// from them.
+var caTrustStores = []struct {
+	dir    string
+	update []string
+}{
+	// Debian, Ubuntu and Alpine.
+	{dir: "/usr/local/share/ca-certificates", update: []string{"update-ca-certificates"}},
+	// Fedora and RHEL.
+	{dir: "/etc/pki/ca-trust/source/anchors", update: []string{"update-ca-trust", "extract"}},
+	// Arch.
+	{dir: "/etc/ca-certificates/trust-source/anchors", update: []string{"trust", "extract-compat"}},
+}
+
+// installCA adds the certificate to the system trust store (using sudo), and
+// the NSS database Chrome and Chromium read, if there is one.
+func installCA(path string) error {
+	installed := false
+	for _, store := range caTrustStores {
+		if _, err := os.Stat(store.dir); err != nil {
+			continue
+		}
+
+		if err := asRoot("install", "-m", "0644", path, filepath.Join(store.dir, caName+".crt")); err != nil {
+			return err
+		}
+
+		if err := asRoot(store.update[0], store.update[1:]...); err != nil {
+			return err
+		}
+
+		installed = true
+		break
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		nssDB := filepath.Join(home, ".pki", "nssdb")
+		if _, err := os.Stat(nssDB); err == nil {
+			if _, err := exec.LookPath("certutil"); err == nil {
+				if err := runCommand("certutil", "-d", "sql:"+nssDB, "-A", "-t", "C,,", "-n", caName, "-i", path); err != nil {
+					return err
+				}
+
+				installed = true
+			}
+		}
+	}
+
+	if !installed {
+		return errors.New("no supported trust store found, install the certificate printed by \"cat-doorbell tls ca\" manually")
+	}
+
+	return nil
+}
+
+// asRoot runs a command as root, using sudo if necessary.
+func asRoot(name string, args ...string) error {
+	if os.Geteuid() == 0 {
+		return runCommand(name, args...)
+	}
+
+	return runCommand("sudo", append([]string{"--", name}, args...)...)
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dpeckett/cat-doorbell/internal/config"
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/web"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+func tokenCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "token",
+		Usage: "Manage the tokens used to access the web dashboard and API",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Create a token, printing it to standard output",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "read-only",
+						Usage: "Only allow the token to view the dashboard and read the API",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.New("expected a single token name argument")
+					}
+
+					token, err := web.GenerateToken()
+					if err != nil {
+						return err
+					}
+
+					// Only the hash is stored, so the token can't be shown again.
+					if err := config.Edit(c.String("config"), func(doc *yaml.Node) error {
+						return config.AddToken(doc, latestconfig.APITokenConfig{
+							Name:     c.Args().First(),
+							Hash:     web.HashToken(token),
+							ReadOnly: c.Bool("read-only"),
+						})
+					}); err != nil {
+						return fmt.Errorf("failed to create token: %w", err)
+					}
+
+					slog.Info("Created token, it will not be shown again",
+						slog.String("name", c.Args().First()), slog.Bool("readOnly", c.Bool("read-only")))
+
+					fmt.Println(token)
+
+					return nil
+				},
+			},
+			{
+				Name:      "revoke",
+				Usage:     "Revoke a token",
+				ArgsUsage: "NAME",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return errors.New("expected a single token name argument")
+					}
+
+					if err := config.Edit(c.String("config"), func(doc *yaml.Node) error {
+						return config.RemoveToken(doc, c.Args().First())
+					}); err != nil {
+						return fmt.Errorf("failed to revoke token: %w", err)
+					}
+
+					slog.Info("Revoked token", slog.String("name", c.Args().First()))
+
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "List the names and access of the configured tokens",
+				Action: func(c *cli.Context) error {
+					conf, err := readConfig(c)
+					if err != nil {
+						return err
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(w, "NAME\tACCESS")
+					for _, t := range conf.Web.Tokens {
+						access := "full"
+						if t.ReadOnly {
+							access = "read-only"
+						}
+
+						fmt.Fprintf(w, "%s\t%s\n", t.Name, access)
+					}
+
+					return w.Flush()
+				},
+			},
+		},
+	}
+}
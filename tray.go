@@ -0,0 +1,722 @@
+//go:build !nogui
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/dpeckett/cat-doorbell/internal/assets"
+	"github.com/dpeckett/cat-doorbell/internal/config"
+	"github.com/getlantern/systray"
+	"github.com/pkg/browser"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	featureGUI.register("systray")
+
+	runTray = runSystemTray
+}
+
+// trayIcons are the icons displayed in the system tray for each state.
+type trayIcons struct {
+	normal       []byte
+	paused       []byte
+	disconnected []byte
+	// err is shown while the configuration can't be loaded.
+	err []byte
+}
+
+func loadTrayIcons() (*trayIcons, error) {
+	var icons trayIcons
+	for name, data := range map[string]*[]byte{
+		"cat-icon.png":              &icons.normal,
+		"cat-icon-paused.png":       &icons.paused,
+		"cat-icon-disconnected.png": &icons.disconnected,
+		"cat-icon-error.png":        &icons.err,
+	} {
+		var err error
+		*data, err = assets.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read icon %q: %w", name, err)
+		}
+	}
+
+	return &icons, nil
+}
+
+// runSystemTray runs the doorbells with a system tray icon, until the user
+// quits or the process receives a termination signal. Everything that can
+// fail is set up before the tray is shown, so failures don't have to be
+// unwound from inside its callbacks. If the doorbells can't be started, the
+// tray shows the error until it is retried successfully, and if a doorbell
+// stops with an error, the error is shown in a dialog.
+func runSystemTray(c *cli.Context, start func() ([]*doorbell, error), logFilePath string) error {
+	icons, err := loadTrayIcons()
+	if err != nil {
+		showErrorDialog(c, err, logFilePath)
+		return err
+	}
+
+	doorbells, startErr := start()
+
+	ctx, cancel := context.WithCancel(c.Context)
+	g, ctx := errgroup.WithContext(ctx)
+
+	systray.Run(func() {
+		if startErr != nil {
+			var ok bool
+			if doorbells, ok = recoverTray(ctx, c, icons, start, startErr, logFilePath); !ok {
+				systray.Quit()
+				return
+			}
+		}
+
+		systray.SetIcon(icons.normal)
+		systray.SetTooltip("Doorbell")
+
+		// With profiles, each doorbell has a submenu of its own.
+		menus := make([]*doorbellMenu, len(doorbells))
+		if len(doorbells) == 1 {
+			menus[0] = newDoorbellMenu(c, trayMenu{}, doorbells[0], icons)
+		} else {
+			for i, d := range doorbells {
+				parent := systray.AddMenuItem(d.profileName(), fmt.Sprintf("The %s profile", d.profileName()))
+				menus[i] = newDoorbellMenu(c, trayMenu{parent: parent}, d, icons)
+			}
+
+			systray.AddSeparator()
+		}
+
+		mViewLogs := systray.AddMenuItem("View Logs", "View the application logs")
+		mHelp := systray.AddMenuItem("Help", "Open the troubleshooting guide")
+		mQuit := systray.AddMenuItem("Quit", "Quit the application")
+
+		var statesMu sync.Mutex
+		states := make([]trayState, len(menus))
+		setState := func(i int, state trayState) {
+			statesMu.Lock()
+			defer statesMu.Unlock()
+
+			states[i] = state
+
+			icon, tooltip := summarizeTray(icons, doorbells, states)
+			systray.SetIcon(icon)
+			systray.SetTooltip(tooltip)
+		}
+
+		for i, m := range menus {
+			setState(i, m.update())
+
+			g.Go(func() error {
+				m.run(ctx, func(state trayState) {
+					setState(i, state)
+				})
+
+				return nil
+			})
+		}
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+
+		g.Go(func() error {
+			defer systray.Quit()
+
+			for {
+				select {
+				case <-mViewLogs.ClickedCh:
+					slog.Info("User requested to view logs")
+
+					if err := browser.OpenFile(logFilePath); err != nil {
+						slog.Warn("Failed to open log file", slog.Any("error", err))
+					}
+				case <-mHelp.ClickedCh:
+					slog.Info("User requested help")
+
+					if err := openHelp(); err != nil {
+						slog.Warn("Failed to open troubleshooting guide", slog.Any("error", err))
+					}
+				case <-mQuit.ClickedCh:
+					slog.Info("User requested shutdown")
+					return nil
+				case <-sig:
+					slog.Info("Received signal, shutting down")
+					return nil
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		})
+
+		g.Go(func() error {
+			defer closeDoorbells(doorbells)
+
+			return runDoorbells(ctx, doorbells)
+		})
+	}, cancel)
+
+	if err := g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
+		showErrorDialog(c, err, logFilePath)
+		return err
+	}
+
+	return nil
+}
+
+// trayMenu adds items to the top level of the tray menu, or to a submenu.
+type trayMenu struct {
+	// parent is the item the submenu belongs to, or nil for the top level.
+	parent *systray.MenuItem
+}
+
+func (m trayMenu) add(title, tooltip string) *systray.MenuItem {
+	if m.parent == nil {
+		return systray.AddMenuItem(title, tooltip)
+	}
+
+	return m.parent.AddSubMenuItem(title, tooltip)
+}
+
+func (m trayMenu) addCheckbox(title, tooltip string, checked bool) *systray.MenuItem {
+	if m.parent == nil {
+		return systray.AddMenuItemCheckbox(title, tooltip, checked)
+	}
+
+	return m.parent.AddSubMenuItemCheckbox(title, tooltip, checked)
+}
+
+// addSeparator adds a separator to the top level. Submenus can't have
+// separators, so they are left out.
+func (m trayMenu) addSeparator() {
+	if m.parent == nil {
+		systray.AddSeparator()
+	}
+}
+
+// trayState is the part of the tray icon and tooltip describing a doorbell.
+type trayState struct {
+	icon []byte
+	// severity orders the states, so that with profiles the icon shows the
+	// most severe: 0 for normal, 1 for paused and 2 for disconnected.
+	severity int
+	// summary follows "Doorbell - " in the tooltip (eg. "paused"), or is
+	// empty if there is nothing to report.
+	summary string
+	// details are the further lines of the tooltip (eg. presence).
+	details []string
+}
+
+// summarizeTray returns the tray icon and tooltip for the states of the
+// doorbells. With profiles, each doorbell's state is listed under its name.
+func summarizeTray(icons *trayIcons, doorbells []*doorbell, states []trayState) ([]byte, string) {
+	if len(states) == 1 {
+		tooltip := "Doorbell"
+		if states[0].summary != "" {
+			tooltip += " - " + states[0].summary
+		}
+
+		return states[0].icon, strings.Join(append([]string{tooltip}, states[0].details...), "\n")
+	}
+
+	icon, severity := icons.normal, 0
+	lines := []string{"Doorbell"}
+	for i, state := range states {
+		if state.severity > severity {
+			icon, severity = state.icon, state.severity
+		}
+
+		line := doorbells[i].profileName()
+		if state.summary != "" {
+			line += " - " + state.summary
+		}
+
+		lines = append(append(lines, line), state.details...)
+	}
+
+	return icon, strings.Join(lines, "\n")
+}
+
+// doorbellMenu is the part of the tray menu controlling a doorbell.
+type doorbellMenu struct {
+	c     *cli.Context
+	d     *doorbell
+	icons *trayIcons
+
+	status             *systray.MenuItem
+	acknowledge        *systray.MenuItem
+	pause              *systray.MenuItem
+	pause30m           *systray.MenuItem
+	pause1h            *systray.MenuItem
+	pauseIndefinitely  *systray.MenuItem
+	resume             *systray.MenuItem
+	expect             *systray.MenuItem
+	noRecent           *systray.MenuItem
+	recentItems        []*systray.MenuItem
+	record             *systray.MenuItem
+	settings           *systray.MenuItem
+	viewConfig         *systray.MenuItem
+	soundSettings      []soundSetting
+	soundSettingsClick chan soundSetting
+}
+
+// newDoorbellMenu adds the items controlling a doorbell to the menu.
+func newDoorbellMenu(c *cli.Context, menu trayMenu, d *doorbell, icons *trayIcons) *doorbellMenu {
+	m := &doorbellMenu{
+		c:                  c,
+		d:                  d,
+		icons:              icons,
+		soundSettingsClick: make(chan soundSetting),
+	}
+
+	m.status = menu.add("Starting", "Connection status")
+	m.status.Disable()
+
+	m.acknowledge = menu.add("Acknowledge Visit", "Acknowledge that the cat has been let in")
+	m.acknowledge.Hide()
+
+	menu.addSeparator()
+
+	m.pause = menu.add("Pause Notifications", "Temporarily stop notifications")
+	m.pause30m = m.pause.AddSubMenuItem("For 30 Minutes", "Pause notifications for 30 minutes")
+	m.pause1h = m.pause.AddSubMenuItem("For 1 Hour", "Pause notifications for 1 hour")
+	m.pauseIndefinitely = m.pause.AddSubMenuItem("Until Resumed", "Pause notifications until resumed")
+	m.resume = menu.add("Resume Notifications", "Resume notifications")
+	m.resume.Hide()
+	m.expect = menu.addCheckbox("Expect the Cat", "Make detection more sensitive for a while, eg. after putting the cat out", false)
+
+	mRecent := menu.add("Recent Detections", "Recently detected devices")
+	m.noRecent = mRecent.AddSubMenuItem("No detections yet", "")
+	m.noRecent.Disable()
+	m.recentItems = make([]*systray.MenuItem, recentDetectionsLimit)
+	for i := range m.recentItems {
+		m.recentItems[i] = mRecent.AddSubMenuItem("", "")
+		m.recentItems[i].Disable()
+		m.recentItems[i].Hide()
+	}
+
+	menu.addSeparator()
+
+	// Sound settings are changed by editing the configuration file, which
+	// is then reloaded.
+	mSound := menu.add("Sound", "Sound settings")
+	addSoundSetting := func(parent *systray.MenuItem, title, key string, value any) {
+		s := soundSetting{
+			item:  parent.AddSubMenuItemCheckbox(title, "", false),
+			key:   key,
+			value: value,
+		}
+		m.soundSettings = append(m.soundSettings, s)
+
+		go func() {
+			for range s.item.ClickedCh {
+				m.soundSettingsClick <- s
+			}
+		}()
+	}
+
+	if err := featureAudio.check(); err != nil {
+		slog.Debug("Not listing audio output devices", slog.Any("error", err))
+	} else if devices, err := audioDevices(); err != nil {
+		slog.Debug("Not listing audio output devices", slog.Any("error", err))
+	} else {
+		mDevice := mSound.AddSubMenuItem("Output Device", "Choose the audio output device")
+		addSoundSetting(mDevice, "System Default", "device", "")
+		for _, device := range devices {
+			addSoundSetting(mDevice, device.Description, "device", device.Name)
+		}
+	}
+
+	mVolume := mSound.AddSubMenuItem("Volume", "Choose the doorbell volume")
+	for _, volume := range []float64{0.25, 0.5, 0.75, 1} {
+		addSoundSetting(mVolume, fmt.Sprintf("%d%%", int(volume*100)), "volume", volume)
+	}
+
+	m.record = menu.addCheckbox("Record Beacons", "Record received beacons for replaying later", false)
+
+	m.settings = menu.add("Settings…", "Edit the broker, target and sound settings")
+	m.viewConfig = menu.add("View Config", "View the application configuration")
+
+	return m
+}
+
+// update brings the menu items up to date with the doorbell status, and
+// returns the doorbell's part of the tray icon and tooltip.
+func (m *doorbellMenu) update() trayState {
+	status := m.d.status()
+	icons := m.icons
+
+	state := trayState{icon: icons.normal}
+	switch {
+	case status.broker == "" && status.gatewaySilent:
+		m.status.SetTitle("Scanning for devices, none found")
+		state = trayState{icon: icons.disconnected, severity: 2, summary: "no beacons received"}
+	case status.broker == "":
+		m.status.SetTitle("Scanning for devices")
+	case status.connected && status.gatewaySilent:
+		m.status.SetTitle(fmt.Sprintf("Connected to %s, no beacons received", status.broker))
+		state = trayState{icon: icons.disconnected, severity: 2, summary: "no beacons received"}
+	case status.connected:
+		m.status.SetTitle(fmt.Sprintf("Connected to %s", status.broker))
+	case status.maintenance:
+		m.status.SetTitle(fmt.Sprintf("Disconnected from %s (maintenance)", status.broker))
+		state.summary = "maintenance"
+	case status.reconnecting:
+		m.status.SetTitle(fmt.Sprintf("Reconnecting to %s", status.broker))
+		state = trayState{icon: icons.disconnected, severity: 2, summary: "reconnecting"}
+	default:
+		m.status.SetTitle(fmt.Sprintf("Disconnected from %s", status.broker))
+		state = trayState{icon: icons.disconnected, severity: 2, summary: "disconnected"}
+	}
+
+	if status.brokerErr != nil {
+		m.status.SetTooltip(status.brokerErr.Error())
+	} else {
+		m.status.SetTooltip("")
+	}
+
+	if status.visit != nil {
+		m.acknowledge.SetTitle(fmt.Sprintf("Acknowledge %s (%s)", status.visit.name, status.visit.time.Format(time.Kitchen)))
+		m.acknowledge.Show()
+	} else {
+		m.acknowledge.Hide()
+	}
+
+	if status.paused {
+		state.icon = icons.paused
+		state.severity = max(state.severity, 1)
+		state.summary = "paused"
+		if !status.pausedUntil.IsZero() {
+			state.summary = fmt.Sprintf("paused until %s", formatPausedUntil(status.pausedUntil))
+		}
+
+		m.pause.Hide()
+		m.resume.Show()
+	} else {
+		m.resume.Hide()
+		m.pause.Show()
+	}
+
+	if !status.expectingUntil.IsZero() {
+		m.expect.SetTitle(fmt.Sprintf("Expecting the Cat Until %s", formatPausedUntil(status.expectingUntil)))
+		m.expect.Check()
+	} else {
+		m.expect.SetTitle("Expect the Cat")
+		m.expect.Uncheck()
+	}
+
+	if len(status.recent) > 0 {
+		m.noRecent.Hide()
+		if !status.paused {
+			state.summary = fmt.Sprintf("%s at %s", status.recent[0].message, status.recent[0].time.Format(time.Kitchen))
+		}
+	}
+
+	for i, item := range m.recentItems {
+		if i >= len(status.recent) {
+			item.Hide()
+			continue
+		}
+
+		r := status.recent[i]
+		item.SetTitle(fmt.Sprintf("%s - %s", r.time.Format(time.Kitchen), r.message))
+		if marker, err := colorMarker(r.color); err == nil {
+			item.SetIcon(marker)
+		}
+		item.Show()
+	}
+
+	if status.recording != "" {
+		m.record.Check()
+		m.record.SetTooltip(fmt.Sprintf("Recording to %s", status.recording))
+	} else {
+		m.record.Uncheck()
+		m.record.SetTooltip("Record received beacons for replaying later")
+	}
+
+	var presence, batteries []string
+	for _, dev := range status.devices {
+		if dev.Present != nil {
+			presenceState := "away"
+			if *dev.Present {
+				presenceState = "home"
+			}
+
+			presence = append(presence, fmt.Sprintf("%s %s", dev.Name, presenceState))
+		}
+
+		if dev.Battery != nil {
+			battery := fmt.Sprintf("%s battery %d%%", dev.Name, *dev.Battery)
+			if dev.BatteryLow {
+				battery += " (low)"
+			}
+
+			batteries = append(batteries, battery)
+		}
+	}
+	if len(presence) > 0 {
+		state.details = append(state.details, strings.Join(presence, ", "))
+	}
+	if len(batteries) > 0 {
+		state.details = append(state.details, strings.Join(batteries, ", "))
+	}
+
+	conf, _ := m.d.config()
+	for _, s := range m.soundSettings {
+		var current any
+		switch s.key {
+		case "device":
+			current = conf.Sound.Device
+		case "volume":
+			current = *conf.Sound.Volume
+		}
+
+		if current == s.value {
+			s.item.Check()
+		} else {
+			s.item.Uncheck()
+		}
+	}
+
+	return state
+}
+
+// run handles clicks on the menu items, and keeps them up to date with the
+// doorbell status, until the context is cancelled. Changes to the
+// doorbell's part of the tray icon and tooltip are passed to changed.
+func (m *doorbellMenu) run(ctx context.Context, changed func(trayState)) {
+	d := m.d
+
+	for {
+		select {
+		case <-d.changed:
+			changed(m.update())
+		case <-m.acknowledge.ClickedCh:
+			d.Acknowledge(ctx, "tray")
+		case <-m.pause30m.ClickedCh:
+			d.Pause(30 * time.Minute)
+		case <-m.pause1h.ClickedCh:
+			d.Pause(time.Hour)
+		case <-m.pauseIndefinitely.ClickedCh:
+			d.Pause(0)
+		case <-m.resume.ClickedCh:
+			d.Resume()
+		case <-m.expect.ClickedCh:
+			if m.expect.Checked() {
+				d.StopExpecting()
+			} else {
+				d.StartExpecting(0)
+			}
+		case <-m.record.ClickedCh:
+			if m.record.Checked() {
+				d.StopRecording()
+			} else if _, err := d.StartRecording(); err != nil {
+				slog.Warn("Failed to start recording beacons", slog.Any("error", err))
+			}
+		case s := <-m.soundSettingsClick:
+			slog.Info("User changed sound settings", slog.String("setting", s.key), slog.Any("value", s.value))
+
+			if err := config.Edit(d.configPath(), func(doc *yaml.Node) error {
+				return config.SetSound(doc, s.key, s.value)
+			}); err != nil {
+				slog.Warn("Failed to change sound settings", slog.Any("error", err))
+			}
+		case <-m.settings.ClickedCh:
+			slog.Info("User requested to edit settings")
+
+			if err := openSettings(m.c, d.configPath()); err != nil {
+				slog.Warn("Failed to open settings", slog.Any("error", err))
+			}
+		case <-m.viewConfig.ClickedCh:
+			slog.Info("User requested to view configuration")
+
+			if err := browser.OpenFile(d.configPath()); err != nil {
+				slog.Warn("Failed to open configuration file", slog.Any("error", err))
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// recoverTray shows why the doorbells couldn't be started (eg. an invalid
+// configuration), with menu items to open the configuration and retry. It
+// returns the doorbells once a retry succeeds, or false if the user quits
+// first.
+func recoverTray(ctx context.Context, c *cli.Context, icons *trayIcons, start func() ([]*doorbell, error), err error, logFilePath string) ([]*doorbell, bool) {
+	slog.Error("Failed to start, waiting for the configuration to be fixed", slog.Any("error", err))
+
+	systray.SetIcon(icons.err)
+	systray.SetTooltip("Doorbell - failed to start")
+
+	mError := systray.AddMenuItem("", "")
+	mError.Disable()
+	showError := func(err error) {
+		mError.SetTitle("Error: " + truncateTitle(err.Error()))
+		mError.SetTooltip(err.Error())
+	}
+	showError(err)
+
+	mOpenConfig := systray.AddMenuItem("Open Config", "Open the configuration file to fix it")
+	mSettings := systray.AddMenuItem("Settings…", "Edit the broker, target and sound settings")
+	mRetry := systray.AddMenuItem("Retry", "Load the configuration again")
+	mViewLogs := systray.AddMenuItem("View Logs", "View the application logs")
+	mHelp := systray.AddMenuItem("Help", "Open the troubleshooting guide")
+	mQuit := systray.AddMenuItem("Quit", "Quit the application")
+	items := []*systray.MenuItem{mError, mOpenConfig, mSettings, mRetry, mViewLogs, mHelp, mQuit}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-mOpenConfig.ClickedCh:
+			slog.Info("User requested to open configuration")
+
+			if err := browser.OpenFile(c.String("config")); err != nil {
+				slog.Warn("Failed to open configuration file", slog.Any("error", err))
+			}
+		case <-mSettings.ClickedCh:
+			slog.Info("User requested to edit settings")
+
+			if err := openSettings(c, c.String("config")); err != nil {
+				slog.Warn("Failed to open settings", slog.Any("error", err))
+			}
+		case <-mRetry.ClickedCh:
+			slog.Info("User requested to retry loading configuration")
+
+			doorbells, err := start()
+			if err != nil {
+				slog.Error("Failed to start, waiting for the configuration to be fixed", slog.Any("error", err))
+				showError(err)
+				continue
+			}
+
+			// The menu items can't be removed, so they are hidden in favour
+			// of the usual menu.
+			for _, item := range items {
+				item.Hide()
+			}
+
+			return doorbells, true
+		case <-mViewLogs.ClickedCh:
+			slog.Info("User requested to view logs")
+
+			if err := browser.OpenFile(logFilePath); err != nil {
+				slog.Warn("Failed to open log file", slog.Any("error", err))
+			}
+		case <-mHelp.ClickedCh:
+			slog.Info("User requested help")
+
+			if err := openHelp(); err != nil {
+				slog.Warn("Failed to open troubleshooting guide", slog.Any("error", err))
+			}
+		case <-mQuit.ClickedCh:
+			slog.Info("User requested shutdown")
+			return nil, false
+		case <-sig:
+			slog.Info("Received signal, shutting down")
+			return nil, false
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// openHelp opens the bundled troubleshooting guide with the platform's
+// opener. The guide is unpacked to the cache directory first, as the opener
+// needs a file, and on every open so it stays in step with the binary.
+func openHelp() error {
+	path, err := xdg.CacheFile("cat-doorbell/troubleshooting.html")
+	if err != nil {
+		return fmt.Errorf("failed to get cache directory: %w", err)
+	}
+
+	if err := assets.Unpack("troubleshooting.html", path); err != nil {
+		return fmt.Errorf("failed to unpack troubleshooting guide: %w", err)
+	}
+
+	return browser.OpenFile(path)
+}
+
+// truncateTitle shortens a menu item title that would otherwise make the
+// menu unreasonably wide.
+func truncateTitle(title string) string {
+	const maxLen = 80
+
+	if runes := []rune(title); len(runes) > maxLen {
+		return string(runes[:maxLen-1]) + "…"
+	}
+
+	return title
+}
+
+// soundSetting is a tray menu item that sets a field of the sound settings.
+type soundSetting struct {
+	item  *systray.MenuItem
+	key   string
+	value any
+}
+
+// colorMarker renders a small filled circle in the given hex colour (eg.
+// "#ff8800"), for use as a menu item icon.
+func colorMarker(hex string) ([]byte, error) {
+	var r, g, b uint8
+	if _, err := fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b); err != nil {
+		return nil, fmt.Errorf("invalid colour %q: %w", hex, err)
+	}
+
+	const size = 16
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	fill := color.NRGBA{R: r, G: g, B: b, A: 0xff}
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := 2*x+1-size, 2*y+1-size
+			if dx*dx+dy*dy <= (size-2)*(size-2) {
+				img.SetNRGBA(x, y, fill)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode colour marker: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dpeckett/cat-doorbell/internal/constants"
+	"github.com/urfave/cli/v2"
+)
+
+// buildInfo describes how the binary was built, for triaging reports across
+// platforms.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"buildDate,omitempty"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+	// Tags are the build tags the binary was built with.
+	Tags []string `json:"tags"`
+	// Features are the optional features built into the binary.
+	Features []string `json:"features"`
+	// Audio is the audio API sounds are played through, or "none" if audio
+	// support was left out.
+	Audio string `json:"audio"`
+	// Bluetooth is the Bluetooth stack used by the built-in scanner, or
+	// "none" if Bluetooth support was left out.
+	Bluetooth string `json:"bluetooth"`
+}
+
+// getBuildInfo returns how the binary was built. The commit and build date
+// set at build time take precedence over the version control information
+// embedded by the Go toolchain, which only has the time of the commit.
+func getBuildInfo() buildInfo {
+	info := buildInfo{
+		Version:   constants.Version,
+		Commit:    constants.Commit,
+		BuildDate: constants.BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Tags:      []string{},
+		Features:  []string{},
+		Audio:     orNone(featureAudio.backend),
+		Bluetooth: orNone(featureBluetooth.backend),
+	}
+
+	for _, f := range features {
+		if f.enabled() {
+			info.Features = append(info.Features, f.name)
+		}
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	var revision, commitTime string
+	var modified bool
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "-tags":
+			for _, tag := range strings.Split(s.Value, ",") {
+				if tag != "" {
+					info.Tags = append(info.Tags, tag)
+				}
+			}
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			commitTime = s.Value
+		case "vcs.modified":
+			modified = s.Value == "true"
+		}
+	}
+
+	if info.Commit == "" && revision != "" {
+		info.Commit = revision
+		if modified {
+			info.Commit += "-dirty"
+		}
+	}
+
+	if info.BuildDate == "" {
+		info.BuildDate = commitTime
+	}
+
+	return info
+}
+
+// logBuildInfo logs how the binary was built.
+func logBuildInfo() {
+	info := getBuildInfo()
+
+	slog.Info("Starting cat-doorbell",
+		slog.String("version", info.Version),
+		slog.String("commit", orDash(info.Commit)),
+		slog.String("buildDate", orDash(info.BuildDate)),
+		slog.String("goVersion", info.GoVersion),
+		slog.String("platform", info.Platform),
+		slog.String("tags", orDash(strings.Join(info.Tags, ","))),
+		slog.String("features", orDash(strings.Join(info.Features, ","))),
+		slog.String("audio", info.Audio),
+		slog.String("bluetooth", info.Bluetooth))
+}
+
+func versionCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "version",
+		Usage: "Show the version, and how the binary was built",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output the build information as JSON",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			info := getBuildInfo()
+
+			if c.Bool("json") {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(info)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "Version:\t%s\n", info.Version)
+			fmt.Fprintf(w, "Commit:\t%s\n", orDash(info.Commit))
+			fmt.Fprintf(w, "Build date:\t%s\n", orDash(info.BuildDate))
+			fmt.Fprintf(w, "Go version:\t%s\n", info.GoVersion)
+			fmt.Fprintf(w, "Platform:\t%s\n", info.Platform)
+			fmt.Fprintf(w, "Build tags:\t%s\n", orDash(strings.Join(info.Tags, ",")))
+			fmt.Fprintf(w, "Features:\t%s\n", orDash(strings.Join(info.Features, ", ")))
+			fmt.Fprintf(w, "Audio:\t%s\n", info.Audio)
+			fmt.Fprintf(w, "Bluetooth:\t%s\n", info.Bluetooth)
+
+			return w.Flush()
+		},
+	}
+}
+
+// orNone returns the string, or "none" if it is empty.
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+
+	return s
+}
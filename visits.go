@@ -0,0 +1,353 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/detector"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+	"github.com/dpeckett/cat-doorbell/internal/source/mqtt"
+	"github.com/dpeckett/cat-doorbell/internal/visits"
+)
+
+const (
+	// visitRefreshInterval is how often visit sessions are extended while
+	// their targets are still seen, and shared with other instances.
+	visitRefreshInterval = 10 * time.Second
+	// visitPublishTimeout is how long sharing a visit session may take.
+	visitPublishTimeout = 10 * time.Second
+)
+
+// claimVisit decides whether a detection that would ring the doorbell starts
+// a new visit, or belongs to a visit the doorbell already rang for (eg.
+// before a restart, or on another instance). It returns the session of the
+// visit, and whether this instance rings the doorbell for it.
+func (d *doorbell) claimVisit(ctx context.Context, conf *latestconfig.VisitsConfig, detection *detector.Detection, now time.Time) (visits.Session, bool) {
+	name := detection.Target.Name
+	timeout := detection.Target.DetectionTimeout
+
+	if s, ok := d.visits.Current(name); ok && s.Active(now, timeout) {
+		d.visits.Seen(name, now, timeout)
+
+		return s, false
+	}
+
+	s, err := d.visits.Start(name, detection.MAC, now)
+	if err != nil {
+		slog.Warn("Failed to save visit session", slog.Any("error", err))
+
+		// Ringing twice is better than not ringing at all.
+		if s.ID == "" {
+			return s, true
+		}
+	}
+
+	if conf.Topic == "" {
+		return s, true
+	}
+
+	go d.publishVisit(ctx, conf.Topic, s)
+
+	// Waiting delays the sound, so don't wait for other instances until one
+	// has shared a session.
+	if !d.visits.PeerSeen() {
+		return s, true
+	}
+
+	// Another instance may have seen the cat at the same time. Whichever
+	// instance's session started first rings the doorbell.
+	select {
+	case <-ctx.Done():
+	case <-time.After(conf.ClaimDelay):
+	}
+
+	if current, ok := d.visits.Current(name); ok && current.ID != s.ID {
+		return current, false
+	}
+
+	return s, true
+}
+
+// visitRungReason is why a detection doesn't ring the doorbell, because it
+// already rang for the visit on the named instance.
+func visitRungReason(instance string) string {
+	return fmt.Sprintf("the doorbell already rang for this visit on %s", instance)
+}
+
+// restoreVisit restores the unacknowledged visit the doorbell rang for
+// before it was restarted, if the target is still around, and schedules its
+// remaining reminders.
+func (d *doorbell) restoreVisit(ctx context.Context) {
+	conf, _ := d.config()
+	if conf.Visits == nil {
+		return
+	}
+
+	now := time.Now()
+
+	var restore *visits.Session
+	var target latestconfig.TargetConfig
+	for _, s := range d.visits.Sessions() {
+		if s.Instance != d.visits.Instance() || s.Acknowledged {
+			continue
+		}
+
+		i := slices.IndexFunc(conf.Targets, func(t latestconfig.TargetConfig) bool {
+			return t.Name == s.Name
+		})
+		if i < 0 || !s.Active(now, conf.Targets[i].DetectionTimeout) {
+			continue
+		}
+
+		if restore == nil || s.Started.After(restore.Started) {
+			restore = &s
+			target = conf.Targets[i]
+		}
+	}
+
+	if restore == nil {
+		return
+	}
+
+	slog.Info("Restored unacknowledged visit",
+		slog.String("name", restore.Name), slog.Time("started", restore.Started))
+
+	title, message := d.texts.Render(target.Name, latestconfig.EventDetected, &notifier.TextData{
+		Name: target.Name,
+		MAC:  d.redactor.Redact(restore.MAC),
+		Time: restore.Started.Local(),
+	})
+
+	n := &notifier.Notification{
+		Event:    latestconfig.EventDetected,
+		Title:    title,
+		Message:  message,
+		Name:     target.Name,
+		Color:    target.Color,
+		MAC:      d.redactor.Redact(restore.MAC),
+		Time:     restore.Started,
+		Instance: d.instance(),
+	}
+
+	v := d.startVisit(visit{time: restore.Started, name: target.Name, mac: restore.MAC, session: restore.ID})
+	for _, derived := range d.events.Derive(n) {
+		if derived.UnacknowledgedFor > 0 && !slices.Contains(restore.Reminders, string(derived.Notification.Event)) {
+			d.scheduleOverdue(ctx, v, derived)
+		}
+	}
+}
+
+// acknowledgeSession records that the visit of a session was acknowledged,
+// and shares it with other instances.
+func (d *doorbell) acknowledgeSession(ctx context.Context, id string) {
+	s, changed, err := d.visits.Acknowledge(id)
+	if err != nil {
+		slog.Warn("Failed to save visit session", slog.Any("error", err))
+	}
+
+	conf, _ := d.config()
+	if changed && conf.Visits != nil && conf.Visits.Topic != "" {
+		go d.publishVisit(ctx, conf.Visits.Topic, s)
+	}
+}
+
+// remindSession records that a reminder was raised for the visit of a
+// session, so it isn't raised again after a restart.
+func (d *doorbell) remindSession(ctx context.Context, id string, event latestconfig.EventType) {
+	s, changed, err := d.visits.Remind(id, string(event))
+	if err != nil {
+		slog.Warn("Failed to save visit session", slog.Any("error", err))
+	}
+
+	conf, _ := d.config()
+	if changed && conf.Visits != nil && conf.Visits.Topic != "" {
+		go d.publishVisit(ctx, conf.Visits.Topic, s)
+	}
+}
+
+// watchVisits keeps the visit sessions up to date, and shares them with
+// other instances, restarting whenever the configuration changes.
+func (d *doorbell) watchVisits(ctx context.Context) error {
+	for {
+		conf, changed := d.config()
+		if conf.Visits == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-changed:
+				continue
+			}
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			d.runVisits(runCtx, conf)
+		}()
+
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		}
+
+		cancel()
+		<-done
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// runVisits extends the visit sessions while their targets are still seen,
+// and merges the sessions shared by other instances, until the context is
+// cancelled.
+func (d *doorbell) runVisits(ctx context.Context, conf *latestconfig.Config) {
+	timeouts := make(map[string]time.Duration, len(conf.Targets))
+	for _, t := range conf.Targets {
+		timeouts[t.Name] = t.DetectionTimeout
+	}
+
+	timeout := func(name string) time.Duration {
+		if timeout, ok := timeouts[name]; ok {
+			return timeout
+		}
+
+		return conf.DetectionTimeout
+	}
+
+	if conf.Visits.Topic != "" {
+		client := mqtt.NewClient(conf.Broker, "visits")
+		client.Subscribe(conf.Visits.Topic, func(payload []byte) {
+			d.mergeVisit(ctx, payload, timeout)
+		})
+
+		go func() {
+			if err := client.Run(ctx); err != nil && ctx.Err() == nil {
+				slog.Warn("Failed to connect to MQTT broker for visit sessions", slog.Any("error", err))
+			}
+		}()
+
+		d.mu.Lock()
+		d.visitsClient = client
+		d.mu.Unlock()
+
+		defer func() {
+			d.mu.Lock()
+			d.visitsClient = nil
+			d.mu.Unlock()
+		}()
+	}
+
+	ticker := time.NewTicker(visitRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Save how long the targets were seen for before stopping, so
+			// that their visits carry on after a restart.
+			d.refreshVisits(ctx, conf.Visits.Topic, timeout)
+			return
+		case <-ticker.C:
+			d.refreshVisits(ctx, conf.Visits.Topic, timeout)
+		}
+	}
+}
+
+// refreshVisits extends the visit sessions of the targets that have been
+// seen since, saves them, and shares the extended sessions if a topic is
+// given.
+func (d *doorbell) refreshVisits(ctx context.Context, topic string, timeout func(name string) time.Duration) {
+	for _, dev := range d.detector.Devices(time.Now()) {
+		if dev.LastSeen.IsZero() {
+			continue
+		}
+
+		s, extended := d.visits.Seen(dev.Name, dev.LastSeen, timeout(dev.Name))
+		if extended && topic != "" && ctx.Err() == nil {
+			go d.publishVisit(ctx, topic, s)
+		}
+	}
+
+	if err := d.visits.Flush(); err != nil {
+		slog.Warn("Failed to save visit sessions", slog.Any("error", err))
+	}
+}
+
+// mergeVisit merges a visit session shared by another instance. If the
+// visit was acknowledged there, it is acknowledged here too.
+func (d *doorbell) mergeVisit(ctx context.Context, payload []byte, timeout func(name string) time.Duration) {
+	var remote visits.Session
+	if err := json.Unmarshal(payload, &remote); err != nil {
+		slog.Warn("Failed to decode visit session", slog.Any("error", err))
+		return
+	}
+
+	s, changed, err := d.visits.Merge(remote, timeout(remote.Name))
+	if err != nil {
+		slog.Warn("Failed to merge visit session", slog.Any("error", err))
+		return
+	}
+
+	if !changed || !s.Acknowledged {
+		return
+	}
+
+	d.mu.Lock()
+	current := d.visit != nil && d.visit.session == s.ID
+	d.mu.Unlock()
+
+	if current {
+		d.Acknowledge(ctx, "another instance")
+	}
+}
+
+// publishVisit shares a visit session with other instances.
+func (d *doorbell) publishVisit(ctx context.Context, topic string, s visits.Session) {
+	d.mu.Lock()
+	client := d.visitsClient
+	d.mu.Unlock()
+
+	if client == nil {
+		return
+	}
+
+	s.MAC = ""
+	payload, err := json.Marshal(s)
+	if err != nil {
+		slog.Warn("Failed to encode visit session", slog.Any("error", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, visitPublishTimeout)
+	defer cancel()
+
+	if err := client.Publish(ctx, topic, payload); err != nil {
+		slog.Warn("Failed to share visit session", slog.Any("error", err))
+	}
+}
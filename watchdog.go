@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/notifier"
+)
+
+// originStatus is when a beacon was last received from an origin (eg. an
+// MQTT topic).
+type originStatus struct {
+	origin     string
+	lastBeacon time.Time
+}
+
+// watchdog tracks when beacons were last received, to notice a gateway that
+// has stopped publishing them. It is guarded by the doorbell's mutex.
+type watchdog struct {
+	// seen holds when a beacon was last received from each origin.
+	seen map[string]time.Time
+	// since is when a beacon was last received, or when beacons could first
+	// have been received (at startup, or once the broker reconnected).
+	since time.Time
+	// silent is true once no beacons have been received for the gateway
+	// timeout, until they are received again.
+	silent bool
+}
+
+// origins returns when a beacon was last received from each origin, sorted
+// by origin.
+func (w *watchdog) origins() []originStatus {
+	origins := make([]originStatus, 0, len(w.seen))
+	for origin, t := range w.seen {
+		origins = append(origins, originStatus{origin: origin, lastBeacon: t})
+	}
+
+	slices.SortFunc(origins, func(a, b originStatus) int {
+		return strings.Compare(a.origin, b.origin)
+	})
+
+	return origins
+}
+
+// beaconSeen records that a beacon was received from the origin, and raises
+// a "gatewayResumed" event if beacons had stopped arriving.
+func (d *doorbell) beaconSeen(ctx context.Context, origin string, now time.Time) {
+	d.mu.Lock()
+	d.watchdog.seen[origin] = now
+	d.watchdog.since = now
+	resumed := d.watchdog.silent
+	if resumed {
+		d.watchdog.silent = false
+		d.notifyChanged()
+	}
+	d.mu.Unlock()
+
+	if resumed {
+		slog.Info("Receiving beacons again", slog.String("origin", origin))
+
+		d.handle(ctx, "", func() {
+			d.raiseGatewayEvent(ctx, latestconfig.EventGatewayResumed, now)
+		})
+	}
+}
+
+// checkGateway raises a "gatewaySilent" event once no beacons have been
+// received for the gateway timeout. It isn't raised while the MQTT broker is
+// disconnected, which is reported already, or during maintenance, after which
+// the gateway gets a full timeout to resume publishing beacons.
+func (d *doorbell) checkGateway(ctx context.Context) {
+	conf, _ := d.config()
+	if conf.GatewayTimeout == 0 {
+		return
+	}
+
+	now := time.Now()
+
+	d.mu.Lock()
+	disconnected := conf.Broker.Address != "" && !d.broker.Connected
+	if maintenance, _ := d.maintenanceLocked(now); maintenance && !d.watchdog.silent {
+		d.watchdog.since = now
+	}
+	since := d.watchdog.since
+	silent := !d.watchdog.silent && !disconnected && now.Sub(since) >= conf.GatewayTimeout
+	if silent {
+		d.watchdog.silent = true
+		d.notifyChanged()
+	}
+	origins := d.watchdog.origins()
+	d.mu.Unlock()
+
+	if !silent {
+		return
+	}
+
+	attrs := []any{slog.Time("since", since)}
+	for _, o := range origins {
+		attrs = append(attrs, slog.Time(o.origin, o.lastBeacon))
+	}
+	slog.Warn("No beacons received, has the gateway stopped?", attrs...)
+
+	d.handle(ctx, "", func() {
+		d.raiseGatewayEvent(ctx, latestconfig.EventGatewaySilent, since)
+	})
+}
+
+// raiseGatewayEvent raises a gateway watchdog event. lastBeacon is when a
+// beacon was last received.
+func (d *doorbell) raiseGatewayEvent(ctx context.Context, event latestconfig.EventType, lastBeacon time.Time) {
+	now := time.Now()
+	title, message := d.texts.Render("", event, &notifier.TextData{
+		Time:       now.Local(),
+		LastBeacon: lastBeacon.Local(),
+	})
+
+	d.raiseEvent(ctx, &notifier.Notification{
+		Event:    event,
+		Title:    title,
+		Message:  message,
+		Time:     now,
+		Instance: d.instance(),
+	}, "")
+}
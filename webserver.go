@@ -0,0 +1,41 @@
+//go:build !noweb
+
+// SPDX-License-Identifier: AGPL-3.0-or-later
+/*
+ * Copyright (C) 2024 Damian Peckett <damian@pecke.tt>.
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program. If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	latestconfig "github.com/dpeckett/cat-doorbell/internal/config/v1alpha2"
+	"github.com/dpeckett/cat-doorbell/internal/history"
+	"github.com/dpeckett/cat-doorbell/internal/web"
+	"github.com/dpeckett/cat-doorbell/internal/webpush"
+)
+
+func init() {
+	featureWeb.register("builtin")
+
+	newWebServer = func(conf *latestconfig.Config, history history.Store, push *webpush.Service, d *doorbell, certDir string) (server, error) {
+		s, err := web.New(conf.Web, history, push, d, certDir)
+		if err != nil {
+			return nil, err
+		}
+
+		return s, nil
+	}
+}